@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/bootstrap"
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/database"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+)
+
+// reservedPrefixes 存储中的内部前缀（进行中的上传、文件元数据、数据导出包、头像、缩略图等），不参与垃圾回收
+var reservedPrefixes = []string{"temp", ".multipart", ".meta", "exports", "avatars", "thumbnails"}
+
+func main() {
+	// 解析命令行参数
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", true, "only report orphaned blobs without deleting them")
+	var confirm bool
+	flag.BoolVar(&confirm, "confirm", false, "confirm deletion of orphaned blobs (required with -dry-run=false)")
+	var minAge time.Duration
+	flag.DurationVar(&minAge, "min-age", time.Hour, "only consider blobs older than this duration")
+	flag.Parse()
+
+	if !dryRun && !confirm {
+		log.Fatal("Refusing to delete orphaned blobs without -confirm")
+	}
+
+	// 加载配置
+	cfg := config.LoadConfig()
+
+	// 初始化数据库
+	db, err := database.InitDatabase(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.CloseDatabase()
+
+	// 初始化存储，与服务使用相同的配置（压缩、加密、单独的历史版本存储）
+	storageImpl, err := bootstrap.SetupStorage(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	versionStorage, err := bootstrap.SetupVersionStorage(cfg, storageImpl)
+	if err != nil {
+		log.Fatalf("Failed to initialize version storage: %v", err)
+	}
+
+	ctx := context.Background()
+
+	// 收集数据库中引用的存储键
+	fileKeys, versionKeys, err := loadReferencedKeys(db)
+	if err != nil {
+		log.Fatalf("Failed to load referenced storage keys: %v", err)
+	}
+	log.Printf("Loaded %d referenced file keys and %d version keys", len(fileKeys), len(versionKeys))
+
+	// 当前版本的记录指向文件存储中的内容，配置单独的版本存储之前归档的版本也可能仍在文件存储中
+	for key := range versionKeys {
+		fileKeys[key] = struct{}{}
+	}
+	stores := []gcStore{{name: "files", storage: storageImpl, referenced: fileKeys}}
+	if versionStorage != storageImpl {
+		stores = append(stores, gcStore{name: "versions", storage: versionStorage, referenced: versionKeys})
+	}
+
+	cutoff := time.Now().Add(-minAge).Unix()
+	var total gcResult
+	for _, store := range stores {
+		result, err := collectStore(ctx, store, cutoff, dryRun)
+		if err != nil {
+			log.Fatalf("Failed to list %s storage: %v", store.name, err)
+		}
+		total.add(result)
+	}
+
+	if dryRun {
+		log.Printf("Dry run: found %d orphaned blobs (%d bytes). Re-run with -dry-run=false -confirm to delete them.",
+			total.orphanCount, total.orphanSize)
+		return
+	}
+
+	log.Printf("Garbage collection completed: %d deleted, %d failed, %d bytes reclaimed",
+		total.deletedCount, total.failedCount, total.reclaimedSize)
+}
+
+// gcStore 参与垃圾回收的存储及其中被引用的存储键
+type gcStore struct {
+	name       string
+	storage    storage.Storage
+	referenced map[string]struct{}
+}
+
+// gcResult 垃圾回收统计
+type gcResult struct {
+	orphanCount   int
+	orphanSize    int64
+	deletedCount  int
+	failedCount   int
+	reclaimedSize int64
+}
+
+func (r *gcResult) add(other gcResult) {
+	r.orphanCount += other.orphanCount
+	r.orphanSize += other.orphanSize
+	r.deletedCount += other.deletedCount
+	r.failedCount += other.failedCount
+	r.reclaimedSize += other.reclaimedSize
+}
+
+// collectStore 扫描存储，报告或删除早于cutoff且未被引用的对象
+func collectStore(ctx context.Context, store gcStore, cutoff int64, dryRun bool) (gcResult, error) {
+	var result gcResult
+
+	// 列出存储中的全部对象
+	blobs, err := listAllBlobs(ctx, store.storage, "")
+	if err != nil {
+		return result, err
+	}
+	log.Printf("Scanned %d blobs in %s storage", len(blobs), store.name)
+
+	// 查找孤立对象
+	for _, blob := range blobs {
+		if isReserved(blob.Path) || blob.LastModified > cutoff {
+			continue
+		}
+		if _, ok := store.referenced[filepath.Clean(blob.Path)]; ok {
+			continue
+		}
+
+		result.orphanCount++
+		result.orphanSize += blob.Size
+
+		if dryRun {
+			log.Printf("Orphan (%s): %s (%d bytes)", store.name, blob.Path, blob.Size)
+			continue
+		}
+
+		if err := store.storage.Delete(ctx, blob.Path); err != nil {
+			log.Printf("Failed to delete %s: %v", blob.Path, err)
+			result.failedCount++
+			continue
+		}
+		log.Printf("Deleted (%s): %s (%d bytes)", store.name, blob.Path, blob.Size)
+		result.deletedCount++
+		result.reclaimedSize += blob.Size
+	}
+
+	return result, nil
+}
+
+// loadReferencedKeys 加载文件记录引用的存储键（包括回收站中的文件和去重共享的内容）以及历史版本引用的存储键
+func loadReferencedKeys(db *gorm.DB) (map[string]struct{}, map[string]struct{}, error) {
+	fileKeys := make(map[string]struct{})
+
+	var files []models.File
+	if err := db.Unscoped().
+		Select("user_id", "space_id", "path", "blob_key").
+		Where("type = ?", models.FileTypeFile).
+		Find(&files).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, file := range files {
+		key := storage.GenerateFileKey(file.UserID, file.Path)
+		if file.SpaceID != nil {
+			key = storage.GenerateSpaceFileKey(*file.SpaceID, file.Path)
+		}
+		fileKeys[filepath.Clean(key)] = struct{}{}
+		if file.BlobKey != "" {
+			fileKeys[filepath.Clean(file.BlobKey)] = struct{}{}
+		}
+	}
+
+	versionKeys := make(map[string]struct{})
+	var versionPaths []string
+	if err := db.Model(&models.FileVersion{}).
+		Where("storage_path <> ''").
+		Pluck("storage_path", &versionPaths).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, path := range versionPaths {
+		versionKeys[filepath.Clean(path)] = struct{}{}
+	}
+
+	return fileKeys, versionKeys, nil
+}
+
+// listAllBlobs 递归列出存储中的全部对象
+// S3的List已按前缀分页返回所有对象；本地存储逐级返回，目录需要递归展开
+func listAllBlobs(ctx context.Context, s storage.Storage, prefix string) ([]storage.FileInfo, error) {
+	entries, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []storage.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir {
+			if isReserved(entry.Path) {
+				continue
+			}
+			children, err := listAllBlobs(ctx, s, entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			blobs = append(blobs, children...)
+			continue
+		}
+		blobs = append(blobs, entry)
+	}
+
+	return blobs, nil
+}
+
+// isReserved 检查存储键是否位于内部保留前缀下
+func isReserved(key string) bool {
+	first := strings.SplitN(filepath.ToSlash(key), "/", 2)[0]
+	for _, prefix := range reservedPrefixes {
+		if first == prefix {
+			return true
+		}
+	}
+	return false
+}
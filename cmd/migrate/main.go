@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 
+	"cloud-storage/internal/bootstrap"
 	"cloud-storage/internal/config"
 	"cloud-storage/internal/database"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +21,8 @@ func main() {
 	flag.StringVar(&configPath, "config", ".env", "path to config file")
 	var rollback bool
 	flag.BoolVar(&rollback, "rollback", false, "rollback migrations")
+	var spaceKeys bool
+	flag.BoolVar(&spaceKeys, "space-keys", false, "move space file content from <user_id>/<path> to spaces/<space_id>/<path>")
 	flag.Parse()
 
 	// 加载配置
@@ -35,6 +41,70 @@ func main() {
 	} else {
 		runMigrations(db)
 	}
+
+	if spaceKeys {
+		storageImpl, err := bootstrap.SetupStorage(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize storage: %v", err)
+		}
+		if err := migrateSpaceKeys(context.Background(), db, storageImpl); err != nil {
+			log.Fatalf("Failed to migrate space file keys: %v", err)
+		}
+	}
+}
+
+// migrateSpaceKeys 将空间文件的内容从上传者的个人存储键移动到空间自己的存储键，并更新指向旧键的版本记录
+// 上传者在同一路径还有个人文件时两者共用了旧键，只复制不移动
+func migrateSpaceKeys(ctx context.Context, db *gorm.DB, s storage.Storage) error {
+	log.Println("Migrating space file storage keys...")
+
+	var files []models.File
+	if err := db.Unscoped().
+		Where("space_id IS NOT NULL AND type = ? AND (blob_key = '' OR blob_key IS NULL)", models.FileTypeFile).
+		Find(&files).Error; err != nil {
+		return err
+	}
+
+	var moved, copied int
+	for _, file := range files {
+		oldKey := storage.GenerateFileKey(file.UserID, file.Path)
+		newKey := storage.GenerateSpaceFileKey(*file.SpaceID, file.Path)
+
+		if exists, err := s.Exists(ctx, newKey); err != nil {
+			return err
+		} else if !exists {
+			if exists, err = s.Exists(ctx, oldKey); err != nil {
+				return err
+			}
+			if exists {
+				var shared int64
+				if err := db.Unscoped().Model(&models.File{}).
+					Where("user_id = ? AND space_id IS NULL AND path = ?", file.UserID, file.Path).
+					Count(&shared).Error; err != nil {
+					return err
+				}
+				if shared > 0 {
+					err = s.Copy(ctx, oldKey, newKey)
+					copied++
+				} else {
+					err = s.Move(ctx, oldKey, newKey)
+					moved++
+				}
+				if err != nil {
+					return fmt.Errorf("failed to migrate %s: %w", oldKey, err)
+				}
+			}
+		}
+
+		if err := db.Model(&models.FileVersion{}).
+			Where("file_id = ? AND storage_path = ?", file.ID, oldKey).
+			Update("storage_path", newKey).Error; err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Space file keys migrated: %d moved, %d copied", moved, copied)
+	return nil
 }
 
 // runMigrations 运行数据库迁移
@@ -46,8 +116,17 @@ func runMigrations(db *gorm.DB) {
 		&models.User{},
 		&models.File{},
 		&models.FileVersion{},
+		&models.FileText{},
+		&models.FilePermission{},
 		&models.Share{},
 		&models.OperationLog{},
+		&models.DataExport{},
+		&models.Announcement{},
+		&models.AnnouncementDismissal{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.Space{},
+		&models.SpaceMember{},
 	)
 
 	if err != nil {
@@ -156,6 +235,12 @@ func createIndexes(db *gorm.DB) error {
 	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_operation_logs_created_at ON operation_logs(created_at)").Error; err != nil {
 		return err
 	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_operation_logs_created_at_id ON operation_logs(created_at DESC, id DESC)").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_operation_logs_user_id_created_at_id ON operation_logs(user_id, created_at DESC, id DESC)").Error; err != nil {
+		return err
+	}
 
 	log.Println("Indexes created successfully!")
 	return nil
@@ -12,11 +12,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"cloud-storage/internal/bootstrap"
 	"cloud-storage/internal/config"
 	"cloud-storage/internal/database"
 	"cloud-storage/internal/handlers"
 	"cloud-storage/internal/middleware"
-	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/pkg/mail"
 	"cloud-storage/internal/repositories"
 	"cloud-storage/internal/services"
 )
@@ -28,6 +31,9 @@ func main() {
 	// 设置日志
 	setupLogging(cfg)
 
+	// 设置列表接口的分页大小限制
+	models.SetPageSizeLimits(cfg.Pagination.DefaultPageSize, cfg.Pagination.MaxPageSize)
+
 	// 初始化数据库
 	db, err := database.InitDatabase(cfg)
 	if err != nil {
@@ -50,30 +56,85 @@ func main() {
 	}
 
 	// 初始化存储
-	storageImpl, err := setupStorage(cfg)
+	storageImpl, err := bootstrap.SetupStorage(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	versionStorage, err := bootstrap.SetupVersionStorage(cfg, storageImpl)
+	if err != nil {
+		log.Fatalf("Failed to initialize version storage: %v", err)
+	}
+
+	avatarStorage, err := bootstrap.SetupAvatarStorage(cfg, storageImpl)
+	if err != nil {
+		log.Fatalf("Failed to initialize avatar storage: %v", err)
+	}
+
 	// 初始化仓库
 	fileRepo := repositories.NewFileRepository(db)
 	userRepo := repositories.NewUserRepository(db)
 	shareRepo := repositories.NewShareRepository(db)
 	operationLogRepo := repositories.NewOperationLogRepository(db)
+	exportRepo := repositories.NewDataExportRepository(db)
+	announcementRepo := repositories.NewAnnouncementRepository(db)
+	webhookRepo := repositories.NewWebhookRepository(db)
+	spaceRepo := repositories.NewSpaceRepository(db)
+	jobRepo := repositories.NewJobRepository(db)
+
+	// 初始化事件总线
+	eventBus := events.NewBus()
 
 	// 初始化服务
-	fileService := services.NewFileService(cfg, db, fileRepo, userRepo, storageImpl)
-	shareService := services.NewShareService(db, shareRepo, fileRepo)
-	operationLogService := services.NewOperationLogService(operationLogRepo)
+	jobService := services.NewJobService(cfg, jobRepo)
+	fileService := services.NewFileService(cfg, db, fileRepo, userRepo, storageImpl, versionStorage, eventBus, jobService)
+	fileService.StartVersionRetention()
+	shareService := services.NewShareService(cfg, db, shareRepo, fileRepo, userRepo, fileService, storageImpl, eventBus)
+	operationLogService := services.NewOperationLogService(cfg, operationLogRepo)
+	mailer := mail.NewMailer(mail.Config{
+		Host:     cfg.Mail.SMTPHost,
+		Port:     cfg.Mail.SMTPPort,
+		Username: cfg.Mail.SMTPUsername,
+		Password: cfg.Mail.SMTPPassword,
+		From:     cfg.Mail.From,
+	})
+	avatarService := services.NewAvatarService(cfg, userRepo, avatarStorage)
+	exportService := services.NewExportService(cfg, exportRepo, userRepo, fileRepo, shareRepo,
+		operationLogRepo, storageImpl, mailer, jobService)
+	announcementService := services.NewAnnouncementService(announcementRepo)
+	webhookService := services.NewWebhookService(cfg, webhookRepo)
+	webhookService.Start(eventBus)
+	spaceService := services.NewSpaceService(spaceRepo, userRepo)
+	wopiService := services.NewWOPIService(fileService, userRepo)
+	uploadUsageService := services.NewUploadUsageService(cfg, db)
+	securityService := services.NewSecurityService(cfg, db)
+	securityService.Start(eventBus)
+	chunkUploadService := services.NewChunkUploadService(cfg, db, fileService)
+	chunkUploadService.StartSessionCleanup()
+	accountService := services.NewAccountService(db, storageImpl, versionStorage, avatarStorage, chunkUploadService)
 
 	// 初始化中间件
 	authMiddleware := middleware.NewAuthMiddleware(cfg)
+	downloadLimiter := middleware.NewDownloadLimiter(cfg)
+	uploadTracker := middleware.NewUploadTracker()
+	transferDrain := middleware.NewTransferDrain()
 
 	// 初始化处理器
-	fileHandler := handlers.NewFileHandler(fileService)
-	authHandler := handlers.NewAuthHandler(&userRepo, authMiddleware)
-	shareHandler := handlers.NewShareHandler(shareService)
-	adminHandler := handlers.NewAdminHandler(userRepo, operationLogService, shareService, fileService)
+	fileHandler := handlers.NewFileHandler(cfg, fileService, chunkUploadService, uploadUsageService, authMiddleware)
+	authHandler := handlers.NewAuthHandler(cfg, &userRepo, authMiddleware, accountService, securityService, mailer, eventBus)
+	shareHandler := handlers.NewShareHandler(cfg, shareService, operationLogService)
+	exportHandler := handlers.NewExportHandler(exportService, operationLogService)
+	avatarHandler := handlers.NewAvatarHandler(cfg, avatarService, operationLogService)
+	announcementHandler := handlers.NewAnnouncementHandler(announcementService)
+	operationLogHandler := handlers.NewOperationLogHandler(operationLogService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	spaceHandler := handlers.NewSpaceHandler(spaceService)
+	wopiHandler := handlers.NewWOPIHandler(wopiService, authMiddleware)
+	accountHandler := handlers.NewAccountHandler(fileService, shareService, chunkUploadService)
+	jobHandler := handlers.NewJobHandler(jobService)
+	adminHandler := handlers.NewAdminHandler(userRepo, operationLogService, shareService, fileService, accountService,
+		downloadLimiter, authMiddleware, uploadTracker, uploadUsageService, securityService,
+		chunkUploadService)
 
 	// 设置Gin模式
 	if cfg.App.Env == "production" {
@@ -82,12 +143,15 @@ func main() {
 
 	// 创建Gin路由器
 	router := gin.New()
+	// 超过该大小的multipart内容写入临时文件
+	router.MaxMultipartMemory = cfg.Storage.MaxMemorySize
 
 	// 注册中间件
 	router.Use(middleware.RecoveryMiddleware())
 	router.Use(middleware.LoggingMiddleware())
 	router.Use(middleware.SecurityHeadersMiddleware())
 	router.Use(middleware.CORSMiddleware(cfg))
+	router.Use(transferDrain.Middleware())
 
 	// 健康检查端点
 	router.GET("/health", func(c *gin.Context) {
@@ -99,21 +163,40 @@ func main() {
 
 	// API路由组
 	api := router.Group("/api/v1")
+	api.Use(middleware.OperationLogMiddleware(operationLogService))
 	{
 		// 公开路由
 		public := api.Group("")
+		public.Use(downloadLimiter.Middleware())
 		authHandler.RegisterRoutes(public)
 
 		// 需要认证的路由
 		protected := api.Group("")
-		protected.Use(authMiddleware.Authenticate())
-		fileHandler.RegisterRoutes(protected)
+		protected.Use(authMiddleware.Authenticate(), downloadLimiter.Middleware(), uploadTracker.Middleware())
+		fileHandler.RegisterRoutes(protected, public)
 		shareHandler.RegisterRoutes(protected, public)
-		adminHandler.RegisterRoutes(protected)
+		exportHandler.RegisterRoutes(protected, public)
+		avatarHandler.RegisterRoutes(protected, public)
+		accountHandler.RegisterRoutes(protected)
+		webhookHandler.RegisterRoutes(protected)
+		spaceHandler.RegisterRoutes(protected)
+		jobHandler.RegisterRoutes(protected)
+
+		// 管理员路由
+		admin := protected.Group("")
+		admin.Use(authMiddleware.RequireRole("admin"))
+		adminHandler.RegisterRoutes(admin)
+		announcementHandler.RegisterRoutes(protected, admin)
+		operationLogHandler.RegisterRoutes(protected, admin)
+
+		// WOPI回调路由位于/wopi下，使用WOPI访问令牌认证
+		if cfg.WOPI.Enabled {
+			wopiHandler.RegisterRoutes(protected, router.Group("/wopi"))
+		}
 	}
 
 	// 启动服务器
-	startServer(cfg, router)
+	startServer(cfg, router, transferDrain, uploadTracker, chunkUploadService)
 }
 
 // setupLogging 设置日志
@@ -136,34 +219,14 @@ func setupLogging(cfg *config.Config) {
 	log.Printf("Starting cloud storage service in %s mode", cfg.App.Env)
 }
 
-// setupStorage 设置存储
-func setupStorage(cfg *config.Config) (storage.Storage, error) {
-	storageConfig := storage.StorageConfig{
-		Type:      storage.StorageTypeLocal,
-		LocalPath: cfg.Storage.StoragePath,
-	}
-
-	// 创建存储实例
-	storageImpl, err := storage.NewStorage(storageConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create storage: %w", err)
-	}
-
-	// 创建必要的目录
-	if err := os.MkdirAll(cfg.Storage.StoragePath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create storage directory: %w", err)
-	}
-
-	if err := os.MkdirAll(cfg.Storage.TempPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
-	}
-
-	log.Printf("Storage initialized at: %s", cfg.Storage.StoragePath)
-	return storageImpl, nil
-}
-
-// startServer 启动服务器
-func startServer(cfg *config.Config, router *gin.Engine) {
+// startServer 启动服务器，收到中断信号后等待进行中的请求和传输结束再退出
+func startServer(
+	cfg *config.Config,
+	router *gin.Engine,
+	drain *middleware.TransferDrain,
+	uploadTracker *middleware.UploadTracker,
+	chunkUploadService *services.ChunkUploadService,
+) {
 	serverAddr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
 
 	srv := &http.Server{
@@ -188,17 +251,42 @@ func startServer(cfg *config.Config, router *gin.Engine) {
 	<-quit
 	log.Println("Shutting down server...")
 
-	// 优雅关闭
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// 优雅关闭：停止接受新请求，等待进行中的请求和传输结束
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	shutdownErr := srv.Shutdown(ctx)
+	if err := drain.Wait(ctx); err != nil {
+		// 超时后中止仍在进行的上传，上传处理会删除已写入的临时内容，再给它们一点时间收尾
+		log.Printf("%d transfers still active after %s, aborting uploads", drain.Active(), cfg.Server.ShutdownTimeout)
+		uploadTracker.CancelAll(middleware.ErrServerShutdown)
+
+		graceCtx, graceCancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+		if err := drain.Wait(graceCtx); err != nil {
+			log.Printf("%d transfers did not finish before exit", drain.Active())
+		}
+		graceCancel()
+	}
+
+	// 释放已过期分片上传会话的临时内容，未过期的会话重启后仍可继续上传
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	if canceled, err := chunkUploadService.CancelExpiredSessions(cleanupCtx); err != nil {
+		log.Printf("Failed to clean up expired upload sessions: %v", err)
+	} else if canceled > 0 {
+		log.Printf("Canceled %d expired upload sessions", canceled)
+	}
+	cleanupCancel()
+
+	if shutdownErr != nil {
+		log.Fatalf("Server forced to shutdown: %v", shutdownErr)
 	}
 
 	log.Println("Server exited gracefully")
 }
 
+// shutdownGracePeriod 关闭超时后中止上传的收尾时间，以及清理过期上传会话的时间
+const shutdownGracePeriod = 5 * time.Second
+
 // init 初始化函数
 func init() {
 	// 设置时区
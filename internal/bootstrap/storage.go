@@ -0,0 +1,122 @@
+// Package bootstrap 按配置创建服务和命令行工具共用的组件
+package bootstrap
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/pkg/storage"
+)
+
+// SetupStorage 按配置创建文件存储，启用时包装压缩和加密
+func SetupStorage(cfg *config.Config) (storage.Storage, error) {
+	// 合并自定义的扩展名MIME映射
+	storage.RegisterMimeTypes(cfg.Storage.MimeTypes)
+	// 公开文件允许内联展示的类型
+	storage.RegisterInlineTypes(cfg.Preview.InlineTypes)
+
+	storageConfig, err := localStorageConfig(cfg, cfg.Storage.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建存储实例
+	storageImpl, err := storage.NewStorage(storageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+
+	// 压缩在加密之前进行，加密后的内容无法压缩
+	if cfg.Storage.Compression {
+		storageImpl, err = storage.NewCompressingStorage(storageImpl, cfg.Storage.CompressionTypes, cfg.Storage.CompressionMinSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create compressing storage: %w", err)
+		}
+	}
+
+	// 创建必要的目录
+	if err := os.MkdirAll(cfg.Storage.StoragePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	if err := os.MkdirAll(cfg.Storage.TempPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	log.Printf("Storage initialized at: %s", cfg.Storage.StoragePath)
+	if storageConfig.Encrypted {
+		log.Printf("Storage encryption enabled (plaintext files readable: %t)", storageConfig.AllowPlaintext)
+	}
+	if cfg.Storage.Compression {
+		log.Printf("Storage compression enabled for %v", cfg.Storage.CompressionTypes)
+	}
+	return storageImpl, nil
+}
+
+// localStorageConfig 生成位于path的本地存储配置，启用加密时读取主密钥
+func localStorageConfig(cfg *config.Config, path string) (storage.StorageConfig, error) {
+	storageConfig := storage.StorageConfig{
+		Type:      storage.StorageTypeLocal,
+		LocalPath: path,
+	}
+	if !cfg.Storage.Encrypted {
+		return storageConfig, nil
+	}
+
+	key, err := cfg.Storage.EncryptionMasterKey()
+	if err != nil {
+		return storageConfig, err
+	}
+	storageConfig.Encrypted = true
+	storageConfig.EncryptionKey = key
+	storageConfig.AllowPlaintext = cfg.Storage.AllowPlaintext
+	return storageConfig, nil
+}
+
+// SetupVersionStorage 设置历史版本存储，未单独配置时复用当前文件存储
+func SetupVersionStorage(cfg *config.Config, fileStorage storage.Storage) (storage.Storage, error) {
+	if cfg.Storage.VersionStoragePath == "" {
+		return fileStorage, nil
+	}
+
+	if err := os.MkdirAll(cfg.Storage.VersionStoragePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create version storage directory: %w", err)
+	}
+
+	storageConfig, err := localStorageConfig(cfg, cfg.Storage.VersionStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	versionStorage, err := storage.NewStorage(storageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create version storage: %w", err)
+	}
+
+	log.Printf("Version storage initialized at: %s", cfg.Storage.VersionStoragePath)
+	return versionStorage, nil
+}
+
+// SetupAvatarStorage 设置头像存储，未单独配置时复用当前文件存储
+func SetupAvatarStorage(cfg *config.Config, fileStorage storage.Storage) (storage.Storage, error) {
+	if cfg.Avatar.StoragePath == "" {
+		return fileStorage, nil
+	}
+
+	if err := os.MkdirAll(cfg.Avatar.StoragePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create avatar storage directory: %w", err)
+	}
+
+	storageConfig, err := localStorageConfig(cfg, cfg.Avatar.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+	avatarStorage, err := storage.NewStorage(storageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create avatar storage: %w", err)
+	}
+
+	log.Printf("Avatar storage initialized at: %s", cfg.Avatar.StoragePath)
+	return avatarStorage, nil
+}
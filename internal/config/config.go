@@ -1,12 +1,16 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Config 应用配置结构体
@@ -18,19 +22,37 @@ type Config struct {
 	JWT      JWTConfig
 	Storage  StorageConfig
 	Security SecurityConfig
+	Share    ShareConfig
+	Download DownloadConfig
+	Mail     MailConfig
+	Export   ExportConfig
+	Preview  PreviewConfig
+	Avatar   AvatarConfig
+	Image    ImageConfig
+	Audit    AuditConfig
+	Webhook  WebhookConfig
+	WOPI     WOPIConfig
+	Jobs     JobConfig
+	Pagination PaginationConfig
+	UploadAbuse UploadAbuseConfig
+	Alerts   AlertConfig
+	Versions VersionConfig
+	Scan     ScanConfig
 	Log      LogConfig
 }
 
 // AppConfig 应用配置
 type AppConfig struct {
-	Env  string
-	Name string
+	Env     string
+	Name    string
+	BaseURL string // 对外访问地址，用于生成邮件中的链接
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string
-	Port string
+	Host            string
+	Port            string
+	ShutdownTimeout time.Duration // 关闭时等待进行中请求和传输结束的时间
 }
 
 // DatabaseConfig 数据库配置
@@ -42,6 +64,15 @@ type DatabaseConfig struct {
 	Password string
 	SSLMode  string
 	Timezone string
+	MaxIdleConns       int           // 连接池最大空闲连接数
+	MaxOpenConns       int           // 连接池最大打开连接数（0表示不限制）
+	ConnMaxLifetime    time.Duration // 连接最长复用时间
+	ConnMaxIdleTime    time.Duration // 空闲连接最长保留时间（0表示不限制）
+	SlowQueryThreshold time.Duration // 慢查询日志阈值
+	StatementTimeout   time.Duration // 每条SQL语句的最长执行时间，由数据库强制取消（0表示不限制）
+	SearchTimeout      time.Duration // 搜索类接口的查询超时（0表示只受StatementTimeout限制）
+	TreeTimeout        time.Duration // 列表和跨目录查询接口的查询超时
+	StatsTimeout       time.Duration // 统计类接口的查询超时
 }
 
 // RedisConfig Redis配置
@@ -57,6 +88,8 @@ type JWTConfig struct {
 	Secret              string
 	ExpireHours         int
 	RefreshExpireHours  int
+	Issuer              string // 签发者（iss），解析时校验
+	Audience            string // 受众（aud），解析时校验
 }
 
 // StorageConfig 存储配置
@@ -67,6 +100,55 @@ type StorageConfig struct {
 	MaxMemorySize    int64
 	EnableChunkUpload bool
 	ChunkSize        int64
+	UploadSessionTTL time.Duration // 分片上传会话的有效期，过期后不再接受分片
+	UploadSessionCleanupInterval time.Duration // 取消过期分片上传会话并释放其临时内容的间隔，0表示不定期清理
+	UploadTempQuota int64 // 每个用户进行中的分片上传声明大小之和的上限，0表示不限制
+	VerifyUploadChecksum bool // 校验客户端提供的文件/分片哈希
+	VersionStoragePath string // 历史版本存储路径，为空时与当前文件共用存储
+	MimeTypes        map[string]string // 扩展名到MIME类型的自定义映射，覆盖内置映射
+	MaxTreeDepth     int // 删除、复制、移动目录时允许的最大目录深度，0表示不限制
+	MaxTreeNodes     int // 删除、复制、移动目录时一次处理的最大文件数，0表示不限制
+	FileTreeMaxDepth int // 文件树接口最多展开的层数
+	FileTreeMaxNodes int // 文件树接口最多返回的节点数
+	NameNormalization string // 文件名Unicode规范化形式：nfc（默认）或none
+	QuotaWarningPercent int64 // 已用空间达到配额的该百分比时发出配额警告
+	AllowEmptyFiles  bool // 是否允许上传0字节的空文件
+	AllowedTypes     []string // 允许上传的扩展名（如 .pdf）或MIME类型（支持 image/* 通配），为空时不限制
+	BlockedTypes     []string // 禁止上传的扩展名或MIME类型，优先于允许列表，同时按嗅探出的类型检查
+	RejectTypeMismatch bool // 嗅探出的内容类型与声明的类型明显不符时拒绝上传
+	CopyConcurrency  int // 复制目录时并发复制文件内容的数量
+	CopyAsyncThreshold int64 // 复制的总大小达到该值（字节）时在后台执行，0表示不按大小判断
+	CopyAsyncMinFiles int // 复制的文件数达到该值时在后台执行，0表示不按文件数判断
+	UndoMoveWindow   time.Duration // 移动后可撤销的时长，0表示不限制
+	CleanupInterval  time.Duration // 重试删除永久删除文件后遗留的存储内容的间隔，0表示只在删除后立即尝试一次
+	Encrypted        bool // 是否使用AES-256-GCM加密保存文件内容
+	EncryptionKey    string // base64编码的32字节主密钥
+	EncryptionKeyFile string // 保存base64编码主密钥的文件路径，设置时优先于EncryptionKey
+	AllowPlaintext   bool // 启用加密后是否仍可读取之前保存的明文文件，全部文件重新加密后可关闭
+	Compression      bool // 是否gzip压缩保存可压缩类型的文件
+	CompressionTypes []string // 压缩保存的类型（支持 text/* 通配），按存储键的扩展名判断
+	CompressionMinSize int64 // 参与压缩的最小文件大小
+}
+
+// EncryptionMasterKey 返回加密文件内容使用的主密钥，优先从密钥文件读取
+func (c StorageConfig) EncryptionMasterKey() ([]byte, error) {
+	encoded := c.EncryptionKey
+	if c.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(c.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		encoded = string(data)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
 }
 
 // SecurityConfig 安全配置
@@ -75,6 +157,171 @@ type SecurityConfig struct {
 	CORSAllowCredentials bool
 	RateLimit          int
 	RateLimitDuration  time.Duration
+	BcryptCost         int
+	RequireEmailVerification bool // 邮箱验证前是否禁止登录
+}
+
+// PasswordCost 返回有效的bcrypt成本（超出范围时回退为默认值）
+func (c SecurityConfig) PasswordCost() int {
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return c.BcryptCost
+}
+
+// DownloadConfig 并发下载限制（0表示不限制）
+type DownloadConfig struct {
+	MaxConcurrent       int           // 全局同时进行的下载数
+	MaxPerUser          int           // 每个用户（未登录时按IP）同时进行的下载数
+	QueueTimeout        time.Duration // 达到上限时排队等待的最长时间，0表示立即拒绝
+	RetryAfter          time.Duration // 拒绝时通过Retry-After建议的重试间隔
+	PublicCacheMaxAge   int           // 公开文件响应的Cache-Control max-age（秒），0表示每次需重新验证
+	PublicMetaCacheTTL  time.Duration // 公开文件元数据的进程内缓存时间，0表示不缓存
+	PublicMetaCacheSize int           // 公开文件元数据缓存的最大条目数
+	FilenameEncoding    string        // Content-Disposition文件名编码：rfc5987（默认，附带UTF-8原文件名）或ascii
+	URLTTL              time.Duration // 下载链接（本地存储的签名令牌）的有效期
+}
+
+// ShareConfig 分享配置（0表示不限制）
+type ShareConfig struct {
+	MaxSharesPerUser      int
+	MaxSharesPerFile      int
+	AdminMaxSharesPerUser int
+	AdminMaxSharesPerFile int
+}
+
+// LimitsForRole 根据角色返回活跃分享数量上限（每用户、每文件）
+func (c ShareConfig) LimitsForRole(role string) (int, int) {
+	if role == "admin" {
+		return c.AdminMaxSharesPerUser, c.AdminMaxSharesPerFile
+	}
+	return c.MaxSharesPerUser, c.MaxSharesPerFile
+}
+
+// MailConfig 邮件配置（未配置SMTP主机时邮件仅写入日志）
+type MailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
+// ExportConfig 数据导出配置
+type ExportConfig struct {
+	LinkExpireHours int // 导出下载链接有效期（小时）
+}
+
+// PreviewConfig 文件预览配置
+type PreviewConfig struct {
+	TextExtractEnabled bool     // 启用文档文本提取（预览和内容搜索）
+	TextExtractors     []string // 启用的提取器，按顺序匹配（text、docx、pdf）
+	TextMaxFileSize    int64    // 参与文本提取的最大文件大小
+	TextMaxChars       int      // 保存的提取文本最大字符数
+	TextSnippetChars   int      // 预览片段的默认字符数
+	ContentMaxBytes    int64    // 代码和文本内容预览返回的最大字节数，超过时截断
+	MimeValidation     string   // 预览和内联展示使用的类型：strict（默认，只信任内容嗅探结果）或lenient（嗅探结果不确定时使用客户端声明的类型）
+	InlineTypes        []string // 公开文件允许内联展示的类型（支持 image/* 通配），其余类型只能作为附件下载
+
+	ThumbnailSize        int           // 缩略图最大边长（像素）
+	ThumbnailWorkers     int           // 上传后在后台生成缩略图的工作协程数，0表示仅在请求时生成
+	ThumbnailQueueSize   int           // 待生成缩略图队列长度，队列满时丢弃任务
+	ThumbnailMaxFileSize int64         // 参与生成缩略图的最大文件大小
+	ThumbnailTimeout     time.Duration // 单个缩略图的生成超时（含外部命令）
+	PDFToPPMPath         string        // pdftoppm可执行文件路径，为空时不生成PDF缩略图
+	FFmpegPath           string        // ffmpeg可执行文件路径，为空时不生成视频缩略图
+}
+
+// StrictMime 是否只按内容嗅探出的类型预览和内联展示文件
+func (c PreviewConfig) StrictMime() bool {
+	return c.MimeValidation != "lenient"
+}
+
+// AvatarConfig 头像配置（头像不计入用户存储配额）
+type AvatarConfig struct {
+	StoragePath string // 头像存储路径，为空时与文件共用存储，位于 avatars/ 前缀下
+	MaxSize     int64  // 上传图片的最大字节数
+	Size        int    // 生成的正方形头像边长（像素）
+	CacheMaxAge int    // 公开头像的缓存时间（秒）
+}
+
+// ImageConfig 上传图片处理配置，目前只处理JPEG
+type ImageConfig struct {
+	AutoOrient bool  // 按EXIF方向旋转上传的照片，并将方向标记重置为正常
+	StripExif  bool  // 删除上传照片中的EXIF/XMP元数据（拍摄位置等）
+	MaxSize    int64 // 参与处理的最大文件大小，超过时原样保存
+	MaxPixels  int   // 自动旋转时允许解码的最大像素数
+	Quality    int   // 自动旋转后重新编码的JPEG质量
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	ComplianceMode bool // 合规模式：操作日志只允许追加，禁止清理
+	HashChain      bool // 为每条操作日志计算链式哈希，可检测篡改和删除
+}
+
+// WOPIConfig 在线编辑器（Collabora、OnlyOffice等WOPI客户端）集成配置
+type WOPIConfig struct {
+	Enabled  bool          // 是否注册 /wopi 接口
+	TokenTTL time.Duration // WOPI访问令牌有效期
+}
+
+// WebhookConfig 出站Webhook配置
+type WebhookConfig struct {
+	Timeout              time.Duration // 单次投递请求超时
+	MaxAttempts          int           // 每个事件的最大投递次数（含首次）
+	RetryBackoff         time.Duration // 首次重试的等待时间，之后每次翻倍
+	Workers              int           // 并发投递的工作协程数
+	QueueSize            int           // 待投递事件队列长度，队列满时丢弃事件
+	MaxPerUser           int           // 每个用户最多可创建的Webhook数
+	AllowPrivateNetworks bool          // 是否允许投递到回环、内网等私有地址
+	URLs                 []string      // 系统级Webhook地址，接收所有用户的全部事件
+	Secret               string        // 系统级Webhook的签名密钥
+}
+
+// PaginationConfig 列表接口分页配置
+type PaginationConfig struct {
+	DefaultPageSize int // 未指定page_size时的每页条数
+	MaxPageSize     int // page_size上限，超过时截断
+}
+
+// JobConfig 后台任务配置
+type JobConfig struct {
+	Workers   int // 同时执行的后台任务数
+	QueueSize int // 等待执行的任务队列长度，队列满时拒绝新任务
+}
+
+// UploadAbuseConfig 上传流量异常检测配置：统计每个用户和每个IP在滑动窗口内的上传字节数（依赖Redis）
+type UploadAbuseConfig struct {
+	Window        time.Duration // 统计窗口
+	UserThreshold int64         // 每个用户在窗口内的上传字节数阈值，0表示不检测
+	IPThreshold   int64         // 每个IP在窗口内的上传字节数阈值，0表示不检测
+	Action        string        // 超过阈值时的处理：alert（默认，仅记录安全警报）或block（同时拒绝上传）
+}
+
+// AlertConfig 可疑活动安全警报配置（阈值为0表示不检测）
+type AlertConfig struct {
+	FailedLoginThreshold   int           // 同一用户名在窗口内连续登录失败的次数阈值
+	FailedLoginWindow      time.Duration // 登录失败的统计窗口
+	NewIPAlert             bool          // 老用户从未使用过的IP登录时是否告警
+	ShareDownloadThreshold int64         // 同一分享在窗口内的下载次数阈值（依赖Redis）
+	ShareDownloadWindow    time.Duration // 分享下载的统计窗口
+	QuotaAlertInterval     time.Duration // 同一用户超出配额告警的最小间隔
+}
+
+// ScanConfig 上传内容的病毒扫描配置
+type ScanConfig struct {
+	Enabled       bool          // 是否在保存上传内容时扫描病毒
+	ClamAVAddress string        // clamd的TCP地址（host:port）
+	Timeout       time.Duration // 连接clamd和等待扫描结果的超时
+}
+
+// VersionConfig 历史版本保留策略
+type VersionConfig struct {
+	KeepLast        int           // 每个文件最多保留的版本数（含当前版本），0表示不限制
+	MaxAgeDays      int           // 早于该天数的历史版本被清理，0表示不限制
+	MinVersions     int           // 无论其他条件如何至少保留的最新版本数（含当前版本）
+	CleanupInterval time.Duration // 按保留策略清理所有文件历史版本的间隔，0表示不定期清理
 }
 
 // LogConfig 日志配置
@@ -94,10 +341,12 @@ func LoadConfig() *Config {
 		App: AppConfig{
 			Env:  getEnv("APP_ENV", "development"),
 			Name: getEnv("APP_NAME", "cloud-storage"),
+			BaseURL: getEnv("APP_BASE_URL", "http://localhost:8080"),
 		},
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "8080"),
+			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:            getEnv("SERVER_PORT", "8080"),
+			ShutdownTimeout: time.Duration(getEnvAsInt("SERVER_SHUTDOWN_TIMEOUT", 30)) * time.Second,
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -107,6 +356,15 @@ func LoadConfig() *Config {
 			Password: getEnv("DB_PASSWORD", "password"),
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 			Timezone: getEnv("DB_TIMEZONE", "Asia/Shanghai"),
+			MaxIdleConns:       getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
+			MaxOpenConns:       getEnvAsInt("DB_MAX_OPEN_CONNS", 100),
+			ConnMaxLifetime:    time.Duration(getEnvAsInt("DB_CONN_MAX_LIFETIME", 3600)) * time.Second,
+			ConnMaxIdleTime:    time.Duration(getEnvAsInt("DB_CONN_MAX_IDLE_TIME", 0)) * time.Second,
+			SlowQueryThreshold: time.Duration(getEnvAsInt("DB_SLOW_QUERY_MS", 1000)) * time.Millisecond,
+			StatementTimeout:   time.Duration(getEnvAsInt("DB_STATEMENT_TIMEOUT_MS", 60000)) * time.Millisecond,
+			SearchTimeout:      time.Duration(getEnvAsInt("DB_SEARCH_TIMEOUT_MS", 10000)) * time.Millisecond,
+			TreeTimeout:        time.Duration(getEnvAsInt("DB_TREE_TIMEOUT_MS", 15000)) * time.Millisecond,
+			StatsTimeout:       time.Duration(getEnvAsInt("DB_STATS_TIMEOUT_MS", 10000)) * time.Millisecond,
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -118,6 +376,8 @@ func LoadConfig() *Config {
 			Secret:             getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
 			ExpireHours:        getEnvAsInt("JWT_EXPIRE_HOURS", 24),
 			RefreshExpireHours: getEnvAsInt("JWT_REFRESH_EXPIRE_HOURS", 168),
+			Issuer:             getEnv("JWT_ISSUER", "cloud-storage"),
+			Audience:           getEnv("JWT_AUDIENCE", "cloud-storage-api"),
 		},
 		Storage: StorageConfig{
 			StoragePath:      getEnv("STORAGE_PATH", "./storage/uploads"),
@@ -126,12 +386,152 @@ func LoadConfig() *Config {
 			MaxMemorySize:    getEnvAsInt64("MAX_MEMORY_SIZE", 33554432),   // 32MB
 			EnableChunkUpload: getEnvAsBool("ENABLE_CHUNK_UPLOAD", true),
 			ChunkSize:        getEnvAsInt64("CHUNK_SIZE", 5242880),         // 5MB
+			UploadSessionTTL: time.Duration(getEnvAsInt("UPLOAD_SESSION_TTL", 86400)) * time.Second,
+			UploadSessionCleanupInterval: time.Duration(getEnvAsInt("UPLOAD_SESSION_CLEANUP_INTERVAL", 3600)) * time.Second,
+			UploadTempQuota: getEnvAsInt64("UPLOAD_TEMP_QUOTA", 10737418240), // 10GB
+			VerifyUploadChecksum: getEnvAsBool("UPLOAD_VERIFY_CHECKSUM", true),
+			VersionStoragePath: getEnv("VERSION_STORAGE_PATH", ""),
+			MimeTypes:        getEnvAsMap("MIME_TYPES"),
+			MaxTreeDepth:     getEnvAsInt("MAX_TREE_DEPTH", 64),
+			MaxTreeNodes:     getEnvAsInt("MAX_TREE_NODES", 10000),
+			FileTreeMaxDepth: getEnvAsInt("FILE_TREE_MAX_DEPTH", 10),
+			FileTreeMaxNodes: getEnvAsInt("FILE_TREE_MAX_NODES", 5000),
+			NameNormalization: strings.ToLower(getEnv("FILE_NAME_NORMALIZATION", "nfc")),
+			QuotaWarningPercent: getEnvAsInt64("QUOTA_WARNING_PERCENT", 90),
+			AllowEmptyFiles:  getEnvAsBool("ALLOW_EMPTY_FILES", true),
+			AllowedTypes:     getEnvAsSlice("UPLOAD_ALLOWED_TYPES", nil),
+			BlockedTypes:     getEnvAsSlice("UPLOAD_BLOCKED_TYPES", nil),
+			RejectTypeMismatch: getEnvAsBool("UPLOAD_REJECT_TYPE_MISMATCH", true),
+			CopyConcurrency:  getEnvAsInt("COPY_CONCURRENCY", 4),
+			CopyAsyncThreshold: getEnvAsInt64("COPY_ASYNC_THRESHOLD", 1073741824), // 1GB
+			CopyAsyncMinFiles: getEnvAsInt("COPY_ASYNC_MIN_FILES", 1000),
+			UndoMoveWindow:   time.Duration(getEnvAsInt("UNDO_MOVE_WINDOW", 86400)) * time.Second,
+			CleanupInterval:  time.Duration(getEnvAsInt("STORAGE_CLEANUP_INTERVAL", 300)) * time.Second,
+			Encrypted:        getEnvAsBool("STORAGE_ENCRYPTION_ENABLED", false),
+			EncryptionKey:    getEnv("STORAGE_ENCRYPTION_KEY", ""),
+			EncryptionKeyFile: getEnv("STORAGE_ENCRYPTION_KEY_FILE", ""),
+			AllowPlaintext:   getEnvAsBool("STORAGE_ENCRYPTION_ALLOW_PLAINTEXT", true),
+			Compression:      getEnvAsBool("STORAGE_COMPRESSION_ENABLED", false),
+			CompressionTypes: getEnvAsSlice("STORAGE_COMPRESSION_TYPES", []string{"text/*", "application/json", "application/xml", "application/yaml", "application/toml"}),
+			CompressionMinSize: getEnvAsInt64("STORAGE_COMPRESSION_MIN_SIZE", 1024),
 		},
 		Security: SecurityConfig{
 			CORSAllowOrigins:   getEnv("CORS_ALLOW_ORIGINS", "*"),
 			CORSAllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", true),
 			RateLimit:          getEnvAsInt("RATE_LIMIT", 100),
 			RateLimitDuration:  time.Duration(getEnvAsInt("RATE_LIMIT_DURATION", 60)) * time.Second,
+			BcryptCost:         getEnvAsInt("BCRYPT_COST", bcrypt.DefaultCost),
+			RequireEmailVerification: getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+		},
+		Share: ShareConfig{
+			MaxSharesPerUser:      getEnvAsInt("SHARE_MAX_PER_USER", 1000),
+			MaxSharesPerFile:      getEnvAsInt("SHARE_MAX_PER_FILE", 100),
+			AdminMaxSharesPerUser: getEnvAsInt("SHARE_ADMIN_MAX_PER_USER", 10000),
+			AdminMaxSharesPerFile: getEnvAsInt("SHARE_ADMIN_MAX_PER_FILE", 1000),
+		},
+		Download: DownloadConfig{
+			MaxConcurrent:       getEnvAsInt("DOWNLOAD_MAX_CONCURRENT", 200),
+			MaxPerUser:          getEnvAsInt("DOWNLOAD_MAX_PER_USER", 5),
+			QueueTimeout:        time.Duration(getEnvAsInt("DOWNLOAD_QUEUE_TIMEOUT", 10)) * time.Second,
+			RetryAfter:          time.Duration(getEnvAsInt("DOWNLOAD_RETRY_AFTER", 5)) * time.Second,
+			PublicCacheMaxAge:   getEnvAsInt("DOWNLOAD_PUBLIC_CACHE_MAX_AGE", 3600),
+			PublicMetaCacheTTL:  time.Duration(getEnvAsInt("DOWNLOAD_PUBLIC_META_CACHE_TTL", 30)) * time.Second,
+			PublicMetaCacheSize: getEnvAsInt("DOWNLOAD_PUBLIC_META_CACHE_SIZE", 10000),
+			FilenameEncoding:    strings.ToLower(getEnv("DOWNLOAD_FILENAME_ENCODING", "rfc5987")),
+			URLTTL:              time.Duration(getEnvAsInt("DOWNLOAD_URL_TTL", 900)) * time.Second,
+		},
+		Mail: MailConfig{
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "noreply@cloud-storage.local"),
+		},
+		Export: ExportConfig{
+			LinkExpireHours: getEnvAsInt("EXPORT_LINK_EXPIRE_HOURS", 48),
+		},
+		Preview: PreviewConfig{
+			TextExtractEnabled: getEnvAsBool("PREVIEW_TEXT_EXTRACT_ENABLED", false),
+			TextExtractors:     getEnvAsSlice("PREVIEW_TEXT_EXTRACTORS", []string{"text", "docx", "pdf"}),
+			TextMaxFileSize:    getEnvAsInt64("PREVIEW_TEXT_MAX_FILE_SIZE", 20971520), // 20MB
+			TextMaxChars:       getEnvAsInt("PREVIEW_TEXT_MAX_CHARS", 100000),
+			TextSnippetChars:   getEnvAsInt("PREVIEW_TEXT_SNIPPET_CHARS", 500),
+			ContentMaxBytes:    getEnvAsInt64("PREVIEW_CONTENT_MAX_BYTES", 1048576), // 1MB
+			MimeValidation:     strings.ToLower(getEnv("PREVIEW_MIME_VALIDATION", "strict")),
+			InlineTypes:        getEnvAsSlice("PREVIEW_INLINE_TYPES", []string{"image/*", "video/*", "audio/*", "application/pdf", "text/plain"}),
+
+			ThumbnailSize:        getEnvAsInt("PREVIEW_THUMBNAIL_SIZE", 256),
+			ThumbnailWorkers:     getEnvAsInt("PREVIEW_THUMBNAIL_WORKERS", 2),
+			ThumbnailQueueSize:   getEnvAsInt("PREVIEW_THUMBNAIL_QUEUE_SIZE", 1000),
+			ThumbnailMaxFileSize: getEnvAsInt64("PREVIEW_THUMBNAIL_MAX_FILE_SIZE", 104857600), // 100MB
+			ThumbnailTimeout:     time.Duration(getEnvAsInt("PREVIEW_THUMBNAIL_TIMEOUT", 30)) * time.Second,
+			PDFToPPMPath:         getEnv("PREVIEW_PDFTOPPM_PATH", ""),
+			FFmpegPath:           getEnv("PREVIEW_FFMPEG_PATH", ""),
+		},
+		Avatar: AvatarConfig{
+			StoragePath: getEnv("AVATAR_STORAGE_PATH", ""),
+			MaxSize:     getEnvAsInt64("AVATAR_MAX_SIZE", 2097152), // 2MB
+			Size:        getEnvAsInt("AVATAR_SIZE", 256),
+			CacheMaxAge: getEnvAsInt("AVATAR_CACHE_MAX_AGE", 604800), // 7天
+		},
+		Image: ImageConfig{
+			AutoOrient: getEnvAsBool("IMAGE_AUTO_ORIENT", false),
+			StripExif:  getEnvAsBool("IMAGE_STRIP_EXIF", false),
+			MaxSize:    getEnvAsInt64("IMAGE_PROCESS_MAX_SIZE", 31457280), // 30MB
+			MaxPixels:  getEnvAsInt("IMAGE_MAX_PIXELS", 50000000),
+			Quality:    getEnvAsInt("IMAGE_JPEG_QUALITY", 92),
+		},
+		Audit: AuditConfig{
+			ComplianceMode: getEnvAsBool("AUDIT_COMPLIANCE_MODE", false),
+			HashChain:      getEnvAsBool("AUDIT_HASH_CHAIN", false),
+		},
+		Webhook: WebhookConfig{
+			Timeout:              time.Duration(getEnvAsInt("WEBHOOK_TIMEOUT", 10)) * time.Second,
+			MaxAttempts:          getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 3),
+			RetryBackoff:         time.Duration(getEnvAsInt("WEBHOOK_RETRY_BACKOFF", 5)) * time.Second,
+			Workers:              getEnvAsInt("WEBHOOK_WORKERS", 4),
+			QueueSize:            getEnvAsInt("WEBHOOK_QUEUE_SIZE", 1000),
+			MaxPerUser:           getEnvAsInt("WEBHOOK_MAX_PER_USER", 10),
+			AllowPrivateNetworks: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+			URLs:                 getEnvAsSlice("WEBHOOK_URLS", nil),
+			Secret:               getEnv("WEBHOOK_SECRET", ""),
+		},
+		WOPI: WOPIConfig{
+			Enabled:  getEnvAsBool("WOPI_ENABLED", false),
+			TokenTTL: time.Duration(getEnvAsInt("WOPI_TOKEN_TTL", 36000)) * time.Second,
+		},
+		Jobs: JobConfig{
+			Workers:   getEnvAsInt("JOB_WORKERS", 4),
+			QueueSize: getEnvAsInt("JOB_QUEUE_SIZE", 1000),
+		},
+		Pagination: PaginationConfig{
+			DefaultPageSize: getEnvAsInt("PAGE_SIZE_DEFAULT", 20),
+			MaxPageSize:     getEnvAsInt("PAGE_SIZE_MAX", 100),
+		},
+		UploadAbuse: UploadAbuseConfig{
+			Window:        time.Duration(getEnvAsInt("UPLOAD_ABUSE_WINDOW", 3600)) * time.Second,
+			UserThreshold: getEnvAsInt64("UPLOAD_ABUSE_USER_THRESHOLD", 536870912000), // 500GB
+			IPThreshold:   getEnvAsInt64("UPLOAD_ABUSE_IP_THRESHOLD", 536870912000),   // 500GB
+			Action:        strings.ToLower(getEnv("UPLOAD_ABUSE_ACTION", "alert")),
+		},
+		Alerts: AlertConfig{
+			FailedLoginThreshold:   getEnvAsInt("ALERT_FAILED_LOGIN_THRESHOLD", 5),
+			FailedLoginWindow:      time.Duration(getEnvAsInt("ALERT_FAILED_LOGIN_WINDOW", 900)) * time.Second,
+			NewIPAlert:             getEnvAsBool("ALERT_NEW_LOGIN_IP", true),
+			ShareDownloadThreshold: getEnvAsInt64("ALERT_SHARE_DOWNLOAD_THRESHOLD", 1000),
+			ShareDownloadWindow:    time.Duration(getEnvAsInt("ALERT_SHARE_DOWNLOAD_WINDOW", 3600)) * time.Second,
+			QuotaAlertInterval:     time.Duration(getEnvAsInt("ALERT_QUOTA_INTERVAL", 3600)) * time.Second,
+		},
+		Versions: VersionConfig{
+			KeepLast:        getEnvAsInt("VERSION_KEEP_LAST", 0),
+			MaxAgeDays:      getEnvAsInt("VERSION_MAX_AGE_DAYS", 0),
+			MinVersions:     getEnvAsInt("VERSION_MIN_KEEP", 1),
+			CleanupInterval: time.Duration(getEnvAsInt("VERSION_CLEANUP_INTERVAL", 86400)) * time.Second,
+		},
+		Scan: ScanConfig{
+			Enabled:       getEnvAsBool("VIRUS_SCAN_ENABLED", false),
+			ClamAVAddress: getEnv("CLAMAV_ADDRESS", "localhost:3310"),
+			Timeout:       time.Duration(getEnvAsInt("VIRUS_SCAN_TIMEOUT", 60)) * time.Second,
 		},
 		Log: LogConfig{
 			Level: getEnv("LOG_LEVEL", "info"),
@@ -170,4 +570,34 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 		return value
 	}
 	return defaultValue
+}
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsMap 解析 key=value 形式、以逗号分隔的环境变量，未设置时返回nil
+func getEnvAsMap(key string) map[string]string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, pair := range strings.Split(valueStr, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if k, v = strings.TrimSpace(k), strings.TrimSpace(v); ok && k != "" && v != "" {
+			values[k] = v
+		}
+	}
+	return values
 }
\ No newline at end of file
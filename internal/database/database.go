@@ -3,7 +3,6 @@ package database
 import (
 	"fmt"
 	"log"
-	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -28,11 +27,16 @@ func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 		cfg.Database.Timezone,
 	)
 
+	// 由数据库强制取消超时的语句，防止失控的查询长期占用连接
+	if cfg.Database.StatementTimeout > 0 {
+		dsn += fmt.Sprintf(" statement_timeout=%d", cfg.Database.StatementTimeout.Milliseconds())
+	}
+
 	// 配置GORM日志
 	gormLogger := logger.New(
 		log.New(log.Writer(), "\r\n", log.LstdFlags),
 		logger.Config{
-			SlowThreshold:             time.Second,
+			SlowThreshold:             cfg.Database.SlowQueryThreshold,
 			LogLevel:                  logger.Warn,
 			IgnoreRecordNotFoundError: true,
 			Colorful:                  true,
@@ -53,9 +57,10 @@ func InitDatabase(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// 设置连接池参数
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
 
 	// 测试连接
 	if err := sqlDB.Ping(); err != nil {
@@ -72,6 +77,44 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
+// PoolStats 数据库连接池统计
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// GetPoolStats 获取数据库连接池统计
+func GetPoolStats() (*PoolStats, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database connection not initialized")
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	stats := sqlDB.Stats()
+	return &PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}, nil
+}
+
 // CloseDatabase 关闭数据库连接
 func CloseDatabase() error {
 	if DB != nil {
@@ -104,13 +147,39 @@ func AutoMigrate() error {
 		// 文件相关
 		&models.File{},
 		&models.FileVersion{},
+		&models.FileText{},
+		&models.FilePermission{},
+		&models.FileMoveHistory{},
+		&models.StorageDeletion{},
+		&models.UploadSession{},
+		&models.UploadedChunk{},
+		&models.StorageBlob{},
 
 		// 分享相关
 		&models.Share{},
+		&models.ShareAccess{},
 
 		// 日志相关
 		&models.OperationLog{},
 		&models.SecurityAlert{},
+
+		// 数据导出
+		&models.DataExport{},
+
+		// 后台任务
+		&models.Job{},
+
+		// 系统公告
+		&models.Announcement{},
+		&models.AnnouncementDismissal{},
+
+		// Webhook
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+
+		// 团队空间
+		&models.Space{},
+		&models.SpaceMember{},
 	)
 
 	if err != nil {
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/services"
+)
+
+// AccountHandler 账户概览处理器
+type AccountHandler struct {
+	fileService  *services.FileService
+	shareService *services.ShareService
+	chunkUploads *services.ChunkUploadService
+}
+
+// NewAccountHandler 创建账户概览处理器
+func NewAccountHandler(
+	fileService *services.FileService,
+	shareService *services.ShareService,
+	chunkUploads *services.ChunkUploadService,
+) *AccountHandler {
+	return &AccountHandler{
+		fileService:  fileService,
+		shareService: shareService,
+		chunkUploads: chunkUploads,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *AccountHandler) RegisterRoutes(protected *gin.RouterGroup) {
+	protected.GET("/users/me/account", h.GetAccountSummary)
+}
+
+// GetAccountSummary 获取账户概览：配额、用量、文件和分享统计及各项限制
+func (h *AccountHandler) GetAccountSummary(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	summary, err := h.fileService.GetAccountSummary(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	shareStats, err := h.shareService.GetShareStats(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	summary.Shares = *shareStats
+	summary.Limits.MaxSharesPerUser = shareStats.MaxSharesPerUser
+	summary.Limits.MaxSharesPerFile = shareStats.MaxSharesPerFile
+
+	tempUsage, err := h.chunkUploads.TempUsage(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	summary.UploadTemp = *tempUsage
+
+	c.JSON(http.StatusOK, summary)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,7 +10,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloud-storage/internal/database"
+	"cloud-storage/internal/middleware"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
 	"cloud-storage/internal/repositories"
 	"cloud-storage/internal/services"
 )
@@ -23,19 +28,23 @@ func NewOperationLogHandler(logService *services.OperationLogService) *Operation
 	}
 }
 
-func (h *OperationLogHandler) RegisterRoutes(router *gin.RouterGroup) {
-	logs := router.Group("/logs")
+// RegisterRoutes 注册日志路由：/logs 和 /admin/logs/export 仅管理员可用，/me/activity 供用户查看自己的操作记录
+func (h *OperationLogHandler) RegisterRoutes(protected *gin.RouterGroup, admin *gin.RouterGroup) {
+	protected.GET("/me/activity", h.GetMyActivity)
+
+	logs := admin.Group("/logs")
 	{
 		logs.GET("", h.GetLogs)
 		logs.GET("/stats", h.GetLogStats)
 		logs.DELETE("/cleanup", h.CleanupLogs)
 	}
+	admin.GET("/admin/logs/export", h.ExportLogs)
 }
 
 func (h *OperationLogHandler) GetLogs(c *gin.Context) {
 	var filter models.OperationLogFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -48,11 +57,18 @@ func (h *OperationLogHandler) GetLogs(c *gin.Context) {
 		filter.UserID = &userID
 	}
 
-	if filter.Page == 0 {
-		filter.Page = 1
-	}
-	if filter.PageSize == 0 {
-		filter.PageSize = 50
+	filter.Page, filter.PageSize = models.NormalizePage(filter.Page, filter.PageSize)
+
+	// 游标分页避免深分页时的大偏移扫描
+	if filter.UseCursor() {
+		logs, nextCursor, err := h.logService.GetLogsByCursor(filter)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.NewCursorPage("logs", toLogResponses(logs), filter.PageSize, nextCursor))
+		return
 	}
 
 	logs, total, err := h.logService.GetLogs(filter)
@@ -61,68 +77,129 @@ func (h *OperationLogHandler) GetLogs(c *gin.Context) {
 		return
 	}
 
-	var response []models.OperationLogResponse
+	c.JSON(http.StatusOK, models.NewPage("logs", toLogResponses(logs), total, filter.Page, filter.PageSize))
+}
+
+// GetMyActivity 分页获取当前用户自己的操作日志，支持与 /logs 相同的过滤条件（user_id除外）
+func (h *OperationLogHandler) GetMyActivity(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var filter models.OperationLogFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	filter.UserID = nil
+	filter.Page, filter.PageSize = models.NormalizePage(filter.Page, filter.PageSize)
+
+	logs, total, err := h.logService.GetUserLogs(userID, filter)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("logs", toLogResponses(logs), total, filter.Page, filter.PageSize))
+}
+
+// ExportLogs 以CSV（默认）或JSON流式导出时间范围内的操作日志，指定group_by时导出分组统计
+func (h *OperationLogHandler) ExportLogs(c *gin.Context) {
+	var req models.AuditLogRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.StartDate != nil && req.EndDate != nil && req.EndDate.Before(*req.StartDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be before start_date"})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+
+	name := "operation-logs"
+	if req.GroupBy != "" {
+		name += "-by-" + req.GroupBy
+	}
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), req.Format)
+	contentType := "text/csv; charset=utf-8"
+	if req.Format == "json" {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Header("Content-Disposition", storage.ContentDisposition("attachment", filename, false))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	if err := h.logService.ExportLogs(c.Request.Context(), c.Writer, req); err != nil {
+		// 已开始写出时无法再返回错误响应，只能中断
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			c.Writer.Header().Del("Content-Type")
+			c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to export operation logs: %v", err)
+	}
+}
+
+// toLogResponses 转换为日志响应格式
+func toLogResponses(logs []models.OperationLog) []models.OperationLogResponse {
+	response := make([]models.OperationLogResponse, 0, len(logs))
 	for _, log := range logs {
 		response = append(response, log.ToResponse())
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"logs":  response,
-		"total": total,
-		"page":  filter.Page,
-		"size":  filter.PageSize,
-	})
+	return response
 }
 
+// GetLogStats 统计时间范围内（默认最近7天）的操作日志分布，指定user_id时只统计该用户
 func (h *OperationLogHandler) GetLogStats(c *gin.Context) {
 	userIDStr := c.Query("user_id")
 	startDateStr := c.DefaultQuery("start_date", "")
 	endDateStr := c.DefaultQuery("end_date", "")
 
+	var userID *uuid.UUID
 	if userIDStr != "" {
-		userID, err := uuid.Parse(userIDStr)
+		id, err := uuid.Parse(userIDStr)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
 			return
 		}
+		userID = &id
+	}
 
-		var startDate, endDate time.Time
-		if startDateStr != "" {
-			startDate, err = time.Parse(time.RFC3339, startDateStr)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start date format"})
-				return
-			}
-		} else {
-			startDate = time.Now().AddDate(0, 0, -7)
-		}
-
-		if endDateStr != "" {
-			endDate, err = time.Parse(time.RFC3339, endDateStr)
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end date format"})
-				return
-			}
-		} else {
-			endDate = time.Now()
+	var startDate, endDate time.Time
+	var err error
+	if startDateStr != "" {
+		startDate, err = time.Parse(time.RFC3339, startDateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid start date format"})
+			return
 		}
+	} else {
+		startDate = time.Now().AddDate(0, 0, -7)
+	}
 
-		stats, err := h.logService.GetUserOperationStats(userID, startDate, endDate)
+	if endDateStr != "" {
+		endDate, err = time.Parse(time.RFC3339, endDateStr)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end date format"})
 			return
 		}
+	} else {
+		endDate = time.Now()
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"user_id":    userID,
-			"start_date": startDate,
-			"end_date":   endDate,
-			"stats":      stats,
-		})
+	stats, err := h.logService.GetOperationStats(c.Request.Context(), userID, startDate, endDate)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusBadRequest, gin.H{"error": "user_id parameter is required"})
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":    userID,
+		"start_date": startDate,
+		"end_date":   endDate,
+		"stats":      stats,
+	})
 }
 
 func (h *OperationLogHandler) CleanupLogs(c *gin.Context) {
@@ -139,7 +216,7 @@ func (h *OperationLogHandler) CleanupLogs(c *gin.Context) {
 
 	deletedCount, err := h.logService.CleanupOldLogs(days)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -151,10 +228,17 @@ func (h *OperationLogHandler) CleanupLogs(c *gin.Context) {
 }
 
 type AdminHandler struct {
-	userRepo     repositories.UserRepository
-	logService   *services.OperationLogService
-	shareService *services.ShareService
-	fileService  *services.FileService
+	userRepo       repositories.UserRepository
+	logService     *services.OperationLogService
+	shareService   *services.ShareService
+	fileService    *services.FileService
+	accountService *services.AccountService
+	downloads      *middleware.DownloadLimiter
+	authMiddleware *middleware.AuthMiddleware
+	uploads        *middleware.UploadTracker
+	uploadUsage    *services.UploadUsageService
+	security       *services.SecurityService
+	chunkUploads   *services.ChunkUploadService
 }
 
 func NewAdminHandler(
@@ -162,12 +246,26 @@ func NewAdminHandler(
 	logService *services.OperationLogService,
 	shareService *services.ShareService,
 	fileService *services.FileService,
+	accountService *services.AccountService,
+	downloads *middleware.DownloadLimiter,
+	authMiddleware *middleware.AuthMiddleware,
+	uploads *middleware.UploadTracker,
+	uploadUsage *services.UploadUsageService,
+	security *services.SecurityService,
+	chunkUploads *services.ChunkUploadService,
 ) *AdminHandler {
 	return &AdminHandler{
-		userRepo:     userRepo,
-		logService:   logService,
-		shareService: shareService,
-		fileService:  fileService,
+		userRepo:       userRepo,
+		logService:     logService,
+		shareService:   shareService,
+		fileService:    fileService,
+		accountService: accountService,
+		downloads:      downloads,
+		authMiddleware: authMiddleware,
+		uploads:        uploads,
+		uploadUsage:    uploadUsage,
+		security:       security,
+		chunkUploads:   chunkUploads,
 	}
 }
 
@@ -175,17 +273,45 @@ func (h *AdminHandler) RegisterRoutes(router *gin.RouterGroup) {
 	admin := router.Group("/admin")
 	{
 		admin.GET("/stats", h.GetSystemStats)
+		admin.GET("/stats/database", h.GetDatabaseStats)
+		admin.GET("/health", h.GetSystemHealth)
+		admin.GET("/audit/verify", h.VerifyAuditChain)
+		admin.GET("/uploads/usage", h.GetUploadUsage)
+		admin.GET("/security/alerts", h.ListSecurityAlerts)
+		admin.POST("/security/alerts/:id/resolve", h.ResolveSecurityAlert)
+		admin.POST("/files/detect-mime", h.BackfillDetectedMime)
+		admin.POST("/files/hashes", h.BackfillHashes)
+		admin.POST("/storage/cleanup-multipart", h.CleanupMultipartUploads)
 		admin.GET("/users", h.ListUsers)
+		admin.POST("/users/recalculate-storage", h.RecalculateAllStorage)
 		admin.GET("/users/:id", h.GetUser)
 		admin.PUT("/users/:id", h.UpdateUser)
 		admin.DELETE("/users/:id", h.DeleteUser)
+		admin.DELETE("/users/:id/purge", h.PurgeUser)
 		admin.POST("/users/:id/activate", h.ActivateUser)
 		admin.POST("/users/:id/deactivate", h.DeactivateUser)
+		admin.POST("/users/:id/terminate", h.TerminateUser)
+		admin.POST("/users/:id/recalculate-storage", h.RecalculateStorage)
 	}
 }
 
 func (h *AdminHandler) GetSystemStats(c *gin.Context) {
-	stats, err := h.logService.GetSystemStats()
+	stats, err := h.logService.GetSystemStats(c.Request.Context())
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	cleanup := h.chunkUploads.SessionCleanupStats()
+	stats.UploadSessionCleanup = &cleanup
+	stats.PhysicalStorage = h.fileService.PhysicalStorageStats(c.Request.Context())
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetDatabaseStats 获取数据库连接池统计
+func (h *AdminHandler) GetDatabaseStats(c *gin.Context) {
+	stats, err := database.GetPoolStats()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -194,9 +320,152 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// GetSystemHealth 获取系统运行状态（目前只统计进行中的下载数）
+func (h *AdminHandler) GetSystemHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SystemHealthLog{
+		Timestamp:       time.Now(),
+		ActiveDownloads: h.downloads.ActiveDownloads(),
+	})
+}
+
+// VerifyAuditChain 校验操作日志哈希链是否完整
+func (h *AdminHandler) VerifyAuditChain(c *gin.Context) {
+	report, err := h.logService.VerifyChain()
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetUploadUsage 获取统计窗口内各用户和IP的上传量
+func (h *AdminHandler) GetUploadUsage(c *gin.Context) {
+	report, err := h.uploadUsage.GetUsageReport(c.Request.Context())
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListSecurityAlerts 分页查询安全警报，可按严重程度、类型和是否已处理过滤
+func (h *AdminHandler) ListSecurityAlerts(c *gin.Context) {
+	var filter models.SecurityAlertFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	filter.Page, filter.PageSize = models.NormalizePage(filter.Page, filter.PageSize)
+
+	alerts, total, err := h.security.ListAlerts(filter)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("alerts", alerts, total, filter.Page, filter.PageSize))
+}
+
+// ResolveSecurityAlert 将安全警报标记为已处理
+func (h *AdminHandler) ResolveSecurityAlert(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	alertID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert ID"})
+		return
+	}
+
+	alert, err := h.security.ResolveAlert(alertID, adminID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// BackfillDetectedMime 提交后台任务，为已有文件补充按内容嗅探的MIME类型
+func (h *AdminHandler) BackfillDetectedMime(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	job, err := h.fileService.BackfillDetectedMime(adminID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job.ToResponse()})
+}
+
+// BackfillHashes 提交后台任务，为尚未计算哈希的已有文件补充SHA-256
+func (h *AdminHandler) BackfillHashes(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	job, err := h.fileService.BackfillHashes(adminID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job.ToResponse()})
+}
+
+// CleanupMultipartUploads 中止存储中超过older_than_hours（默认为分片上传会话有效期）的未完成分片上传
+func (h *AdminHandler) CleanupMultipartUploads(c *gin.Context) {
+	var olderThan time.Duration
+	if value := c.Query("older_than_hours"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than_hours must be a positive integer"})
+			return
+		}
+		olderThan = time.Duration(hours) * time.Hour
+	}
+
+	result, err := h.chunkUploads.CleanupIncompleteUploads(c.Request.Context(), olderThan)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RecalculateStorage 按用户的实际文件重新计算已使用存储，返回修正前后的值
+func (h *AdminHandler) RecalculateStorage(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	result, err := h.fileService.RecalculateUsedStorage(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RecalculateAllStorage 提交后台任务，重新计算所有用户的已使用存储
+func (h *AdminHandler) RecalculateAllStorage(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	job, err := h.fileService.RecalculateAllUsedStorage(adminID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job.ToResponse()})
+}
+
 func (h *AdminHandler) ListUsers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
 
 	filter := models.UserFilter{
 		Page:     page,
@@ -216,12 +485,7 @@ func (h *AdminHandler) ListUsers(c *gin.Context) {
 
 	total, _ := h.userRepo.Count(filter)
 
-	c.JSON(http.StatusOK, gin.H{
-		"users": response,
-		"total": total,
-		"page":  page,
-		"size":  pageSize,
-	})
+	c.JSON(http.StatusOK, models.NewPage("users", response, total, page, pageSize))
 }
 
 func (h *AdminHandler) GetUser(c *gin.Context) {
@@ -249,7 +513,17 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 
 	var req models.UserUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.userRepo.FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if req.LockVersion != nil && *req.LockVersion != user.LockVersion {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrVersionConflict.Error()})
 		return
 	}
 
@@ -263,18 +537,32 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		updates["storage_quota"] = *req.StorageQuota
 	}
 
+	if req.CategoryQuotas != nil {
+		if err := req.CategoryQuotas.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["category_quotas"] = *req.CategoryQuotas
+	}
+
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
 
+	// 期间用户被其他请求修改时返回冲突，避免覆盖其他管理员的修改
 	if len(updates) > 0 {
-		if err := h.userRepo.Update(userID, updates); err != nil {
+		updated, err := h.userRepo.UpdateIfVersion(userID, user.LockVersion, updates)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if !updated {
+			c.JSON(http.StatusConflict, gin.H{"error": services.ErrVersionConflict.Error()})
+			return
+		}
 	}
 
-	user, err := h.userRepo.FindByID(userID)
+	user, err = h.userRepo.FindByID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -301,6 +589,37 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "user deleted successfully"})
 }
 
+// PurgeUser 永久清除用户及其全部数据；未指定confirm=true时只返回预演报告
+func (h *AdminHandler) PurgeUser(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if userID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot purge your own account"})
+		return
+	}
+
+	dryRun := c.Query("confirm") != "true"
+
+	report, err := h.accountService.EraseUser(c, userID, dryRun)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !dryRun {
+		h.logService.LogOperation(c, adminID, models.OperationUserDelete, models.ResourceTypeUser,
+			&userID, report, models.OperationSuccess, "")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
 func (h *AdminHandler) ActivateUser(c *gin.Context) {
 	userID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -332,3 +651,52 @@ func (h *AdminHandler) DeactivateUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "user deactivated successfully"})
 }
+
+// TerminateUser 紧急终止用户：撤销全部令牌、中止进行中的上传、停用账户，可选停用所有分享，并记录安全警报
+func (h *AdminHandler) TerminateUser(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+	if userID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot terminate your own account"})
+		return
+	}
+
+	// 请求体可选
+	var req models.UserTerminateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	user, err := h.userRepo.FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// 先撤销令牌，阻止用户在停用过程中继续操作
+	if err := h.authMiddleware.RevokeUserTokens(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke tokens: " + err.Error()})
+		return
+	}
+
+	report := &models.UserTerminationReport{
+		UserID:         user.ID,
+		Username:       user.Username,
+		TokensRevoked:  true,
+		UploadsAborted: h.uploads.CancelUser(userID),
+	}
+	if err := h.accountService.TerminateUser(adminID, report, req, c.ClientIP()); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// AnnouncementHandler 系统公告处理器
+type AnnouncementHandler struct {
+	announcementService *services.AnnouncementService
+}
+
+// NewAnnouncementHandler 创建公告处理器
+func NewAnnouncementHandler(announcementService *services.AnnouncementService) *AnnouncementHandler {
+	return &AnnouncementHandler{
+		announcementService: announcementService,
+	}
+}
+
+// RegisterRoutes 注册路由，admin为已启用管理员权限校验的路由组
+func (h *AnnouncementHandler) RegisterRoutes(protected *gin.RouterGroup, admin *gin.RouterGroup) {
+	announcements := protected.Group("/announcements")
+	{
+		announcements.GET("", h.GetActiveAnnouncements)
+		announcements.POST("/:id/dismiss", h.DismissAnnouncement)
+	}
+
+	manage := admin.Group("/admin/announcements")
+	{
+		manage.GET("", h.ListAnnouncements)
+		manage.POST("", h.CreateAnnouncement)
+		manage.PUT("/:id", h.UpdateAnnouncement)
+		manage.DELETE("/:id", h.DeleteAnnouncement)
+		manage.POST("/:id/expire", h.ExpireAnnouncement)
+	}
+}
+
+// GetActiveAnnouncements 获取当前用户可见的有效公告
+func (h *AnnouncementHandler) GetActiveAnnouncements(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	role := models.UserRole(c.MustGet("role").(string))
+	includeDismissed, _ := strconv.ParseBool(c.DefaultQuery("include_dismissed", "false"))
+
+	announcements, err := h.announcementService.GetActiveAnnouncements(userID, role, includeDismissed)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"announcements": announcements})
+}
+
+// DismissAnnouncement 关闭公告，之后不再返回给该用户
+func (h *AnnouncementHandler) DismissAnnouncement(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	role := models.UserRole(c.MustGet("role").(string))
+
+	announcementID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid announcement ID"})
+		return
+	}
+
+	if err := h.announcementService.DismissAnnouncement(userID, role, announcementID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "announcement dismissed"})
+}
+
+// ListAnnouncements 管理员分页获取全部公告
+func (h *AnnouncementHandler) ListAnnouncements(c *gin.Context) {
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+
+	announcements, total, err := h.announcementService.ListAnnouncements(page, pageSize)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]models.AnnouncementResponse, len(announcements))
+	for i := range announcements {
+		response[i] = announcements[i].ToResponse()
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("announcements", response, total, page, pageSize))
+}
+
+// CreateAnnouncement 管理员发布公告
+func (h *AnnouncementHandler) CreateAnnouncement(c *gin.Context) {
+	adminID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.AnnouncementCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	announcement, err := h.announcementService.CreateAnnouncement(adminID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "announcement created successfully",
+		"announcement": announcement.ToResponse(),
+	})
+}
+
+// UpdateAnnouncement 管理员更新公告
+func (h *AnnouncementHandler) UpdateAnnouncement(c *gin.Context) {
+	announcementID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid announcement ID"})
+		return
+	}
+
+	var req models.AnnouncementUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	announcement, err := h.announcementService.UpdateAnnouncement(announcementID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "announcement updated successfully",
+		"announcement": announcement.ToResponse(),
+	})
+}
+
+// ExpireAnnouncement 管理员立即结束公告
+func (h *AnnouncementHandler) ExpireAnnouncement(c *gin.Context) {
+	announcementID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid announcement ID"})
+		return
+	}
+
+	announcement, err := h.announcementService.ExpireAnnouncement(announcementID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "announcement expired",
+		"announcement": announcement.ToResponse(),
+	})
+}
+
+// DeleteAnnouncement 管理员删除公告
+func (h *AnnouncementHandler) DeleteAnnouncement(c *gin.Context) {
+	announcementID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid announcement ID"})
+		return
+	}
+
+	if err := h.announcementService.DeleteAnnouncement(announcementID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "announcement deleted successfully"})
+}
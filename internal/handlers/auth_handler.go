@@ -1,33 +1,57 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 
+	"cloud-storage/internal/config"
 	"cloud-storage/internal/middleware"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/pkg/mail"
 	"cloud-storage/internal/repositories"
+	"cloud-storage/internal/services"
 )
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
+	cfg            *config.Config
 	userRepo       *repositories.UserRepository
 	authMiddleware *middleware.AuthMiddleware
+	accountService *services.AccountService
+	security       *services.SecurityService
+	mailer         mail.Mailer
+	events         *events.Bus
 }
 
 // NewAuthHandler 创建认证处理器实例
 func NewAuthHandler(
+	cfg *config.Config,
 	userRepo *repositories.UserRepository,
 	authMiddleware *middleware.AuthMiddleware,
+	accountService *services.AccountService,
+	security *services.SecurityService,
+	mailer mail.Mailer,
+	eventBus *events.Bus,
 ) *AuthHandler {
 	return &AuthHandler{
+		cfg:            cfg,
 		userRepo:       userRepo,
 		authMiddleware: authMiddleware,
+		accountService: accountService,
+		security:       security,
+		mailer:         mailer,
+		events:         eventBus,
 	}
 }
 
@@ -39,10 +63,13 @@ func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
 		auth.POST("/login", h.Login)
 		auth.POST("/logout", h.Logout)
 		auth.POST("/refresh", h.RefreshToken)
+		auth.GET("/verify-email", h.VerifyEmail)
 		auth.GET("/profile", h.RequireAuth(), h.GetProfile)
 		auth.PUT("/profile", h.RequireAuth(), h.UpdateProfile)
 		auth.PUT("/password", h.RequireAuth(), h.ChangePassword)
 	}
+
+	router.POST("/users/me/erase", h.RequireAuth(), h.EraseAccount)
 }
 
 // RequireAuth 要求认证的中间件包装
@@ -54,7 +81,7 @@ func (h *AuthHandler) RequireAuth() gin.HandlerFunc {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req models.UserCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -81,7 +108,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// 哈希密码
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.cfg.Security.PasswordCost())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
 		return
@@ -93,13 +120,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		role = req.Role
 	}
 
+	verificationToken, err := generateVerificationToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 创建用户
 	user := &models.User{
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: string(passwordHash),
-		Role:         role,
-		IsActive:     true,
+		Username:          req.Username,
+		Email:             req.Email,
+		PasswordHash:      string(passwordHash),
+		Role:              role,
+		IsActive:          true,
+		VerificationToken: &verificationToken,
 	}
 
 	if err := (*h.userRepo).Create(user); err != nil {
@@ -107,6 +141,23 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	h.sendVerificationEmail(user, verificationToken)
+
+	h.events.Publish(events.New(events.UserRegistered, user.ID, map[string]interface{}{
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}))
+
+	// 要求验证邮箱时，验证前不签发令牌
+	if h.cfg.Security.RequireEmailVerification {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "user registered successfully, please verify your email before logging in",
+			"user":    user.ToResponse(),
+		})
+		return
+	}
+
 	// 生成令牌
 	accessToken, err := h.authMiddleware.GenerateToken(user.ID, user.Username, string(user.Role))
 	if err != nil {
@@ -136,7 +187,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.UserLoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -144,22 +195,38 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	user, err := (*h.userRepo).FindByUsername(req.Username)
 	if err != nil {
 		// 用户不存在或查询错误
+		h.recordLogin(c, req.Username, nil, "user not found")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
 	// 检查用户是否活跃
 	if !user.IsActive {
+		h.recordLogin(c, req.Username, user, "account is disabled")
 		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
 		return
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.recordLogin(c, req.Username, user, "invalid password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
 
+	// 配置要求时，未验证邮箱的用户不能登录
+	if h.cfg.Security.RequireEmailVerification && !user.EmailVerified {
+		h.recordLogin(c, req.Username, user, "email is not verified")
+		c.JSON(http.StatusForbidden, gin.H{"error": "email is not verified"})
+		return
+	}
+
+	// 密码哈希成本低于当前配置时透明升级
+	if err := h.upgradePasswordHash(user, req.Password); err != nil {
+		// 记录错误但不影响登录
+		fmt.Printf("Failed to upgrade password hash: %v\n", err)
+	}
+
 	// 更新最后登录时间
 	if err := (*h.userRepo).UpdateLastLogin(user.ID); err != nil {
 		// 记录错误但不影响登录
@@ -179,6 +246,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	h.recordLogin(c, req.Username, user, "")
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "login successful",
 		"user":    user.ToResponse(),
@@ -191,6 +260,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// recordLogin 记录登录尝试，failure为空表示登录成功
+func (h *AuthHandler) recordLogin(c *gin.Context, username string, user *models.User, failure string) {
+	h.security.RecordLogin(username, c.ClientIP(), c.Request.UserAgent(), user, failure)
+}
+
 // Logout 用户登出
 func (h *AuthHandler) Logout(c *gin.Context) {
 	// 获取访问令牌
@@ -233,7 +307,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -274,7 +348,17 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 
 	var req models.UserUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	currentUser, err := (*h.userRepo).FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if req.LockVersion != nil && *req.LockVersion != currentUser.LockVersion {
+		c.JSON(http.StatusConflict, gin.H{"error": services.ErrVersionConflict.Error()})
 		return
 	}
 
@@ -290,8 +374,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		}
 		if exists {
 			// 检查是否是自己当前的用户名
-			currentUser, err := (*h.userRepo).FindByID(userID)
-			if err != nil || currentUser.Username != *req.Username {
+			if currentUser.Username != *req.Username {
 				c.JSON(http.StatusConflict, gin.H{"error": "username already exists"})
 				return
 			}
@@ -299,6 +382,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		updates["username"] = *req.Username
 	}
 
+	var verificationToken string
 	if req.Email != nil {
 		// 检查新邮箱是否已存在
 		exists, err := (*h.userRepo).ExistsByEmail(*req.Email)
@@ -308,13 +392,22 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		}
 		if exists {
 			// 检查是否是自己当前的邮箱
-			currentUser, err := (*h.userRepo).FindByID(userID)
-			if err != nil || currentUser.Email != *req.Email {
+			if currentUser.Email != *req.Email {
 				c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
 				return
 			}
 		}
 		updates["email"] = *req.Email
+
+		// 更换邮箱后需重新验证
+		if currentUser.Email != *req.Email {
+			if verificationToken, err = generateVerificationToken(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			updates["email_verified"] = false
+			updates["verification_token"] = verificationToken
+		}
 	}
 
 	if req.Role != nil {
@@ -337,6 +430,20 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		updates["storage_quota"] = *req.StorageQuota
 	}
 
+	if req.CategoryQuotas != nil {
+		// 只有管理员可以修改分类子配额
+		userRole := c.MustGet("role").(string)
+		if userRole != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions to change category quotas"})
+			return
+		}
+		if err := req.CategoryQuotas.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["category_quotas"] = *req.CategoryQuotas
+	}
+
 	if req.IsActive != nil {
 		// 只有管理员可以修改活跃状态
 		userRole := c.MustGet("role").(string)
@@ -347,12 +454,17 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		updates["is_active"] = *req.IsActive
 	}
 
-	// 应用更新
+	// 应用更新，期间用户被其他请求修改时返回冲突
 	if len(updates) > 0 {
-		if err := (*h.userRepo).Update(userID, updates); err != nil {
+		updated, err := (*h.userRepo).UpdateIfVersion(userID, currentUser.LockVersion, updates)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile"})
 			return
 		}
+		if !updated {
+			c.JSON(http.StatusConflict, gin.H{"error": services.ErrVersionConflict.Error()})
+			return
+		}
 	}
 
 	// 获取更新后的用户信息
@@ -361,6 +473,9 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get updated profile"})
 		return
 	}
+	if verificationToken != "" {
+		h.sendVerificationEmail(user, verificationToken)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "profile updated successfully",
@@ -378,7 +493,7 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -396,7 +511,7 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	}
 
 	// 哈希新密码
-	newPasswordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	newPasswordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.cfg.Security.PasswordCost())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash new password"})
 		return
@@ -413,16 +528,90 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully"})
 }
 
+// upgradePasswordHash 在密码验证成功后，若存储的哈希成本低于配置成本则重新哈希
+func (h *AuthHandler) upgradePasswordHash(user *models.User, password string) error {
+	targetCost := h.cfg.Security.PasswordCost()
+
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err != nil {
+		return fmt.Errorf("failed to read hash cost: %w", err)
+	}
+	if cost >= targetCost {
+		return nil
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(password), targetCost)
+	if err != nil {
+		return fmt.Errorf("failed to rehash password: %w", err)
+	}
+
+	if err := (*h.userRepo).Update(user.ID, map[string]interface{}{
+		"password_hash": string(newHash),
+	}); err != nil {
+		return fmt.Errorf("failed to store rehashed password: %w", err)
+	}
+
+	user.PasswordHash = string(newHash)
+	return nil
+}
+
 // ResetPassword 重置密码（需要邮箱验证）
 func (h *AuthHandler) ResetPassword(c *gin.Context) {
 	// 重置密码功能需要邮箱服务
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "password reset not implemented yet"})
 }
 
-// VerifyEmail 验证邮箱
+// VerifyEmail 通过验证邮件中的链接验证邮箱
 func (h *AuthHandler) VerifyEmail(c *gin.Context) {
-	// 邮箱验证功能需要邮箱服务
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "email verification not implemented yet"})
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	user, err := (*h.userRepo).FindByVerificationToken(token)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid verification token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+
+	if err := (*h.userRepo).Update(user.ID, map[string]interface{}{
+		"email_verified":     true,
+		"verification_token": nil,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		return
+	}
+	user.EmailVerified = true
+	user.VerificationToken = nil
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified successfully",
+		"user":    user.ToResponse(),
+	})
+}
+
+// sendVerificationEmail 发送包含验证链接的邮件，发送失败只记录日志
+func (h *AuthHandler) sendVerificationEmail(user *models.User, token string) {
+	link := fmt.Sprintf("%s/api/v1/auth/verify-email?token=%s", strings.TrimRight(h.cfg.App.BaseURL, "/"), token)
+	body := fmt.Sprintf("Hello %s,\n\nPlease verify your email address by opening the link below:\n\n%s\n",
+		user.Username, link)
+	if err := h.mailer.Send(user.Email, "Verify your email address", body); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+	}
+}
+
+// generateVerificationToken 生成邮箱验证令牌
+func generateVerificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
 }
 
 // DeleteAccount 删除账户
@@ -434,7 +623,7 @@ func (h *AuthHandler) DeleteAccount(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -457,18 +646,61 @@ func (h *AuthHandler) DeleteAccount(c *gin.Context) {
 		return
 	}
 
-	// 获取访问令牌并加入黑名单
+	h.blacklistRequestToken(c)
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deleted successfully"})
+}
+
+// EraseAccount 永久删除账户并清除全部数据（被遗忘权）
+// 未设置confirm时只返回将要删除的数据报告
+func (h *AuthHandler) EraseAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.AccountErasureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	// 获取用户
+	user, err := (*h.userRepo).FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	// 验证密码
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	report, err := h.accountService.EraseUser(c, userID, !req.Confirm)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Confirm {
+		h.blacklistRequestToken(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// blacklistRequestToken 将当前请求的访问令牌加入黑名单
+func (h *AuthHandler) blacklistRequestToken(c *gin.Context) {
 	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 && parts[0] == "Bearer" {
-			tokenString := parts[1]
-			claims, err := h.authMiddleware.ParseToken(tokenString)
-			if err == nil {
-				h.authMiddleware.BlacklistToken(tokenString, claims.ExpiresAt.Time)
-			}
-		}
+	if authHeader == "" {
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "account deleted successfully"})
+	parts := strings.Split(authHeader, " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		tokenString := parts[1]
+		claims, err := h.authMiddleware.ParseToken(tokenString)
+		if err == nil {
+			h.authMiddleware.BlacklistToken(tokenString, claims.ExpiresAt.Time)
+		}
+	}
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// AvatarHandler 用户头像处理器
+type AvatarHandler struct {
+	cfg           *config.Config
+	avatarService *services.AvatarService
+	logService    *services.OperationLogService
+}
+
+// NewAvatarHandler 创建头像处理器
+func NewAvatarHandler(cfg *config.Config, avatarService *services.AvatarService, logService *services.OperationLogService) *AvatarHandler {
+	return &AvatarHandler{
+		cfg:           cfg,
+		avatarService: avatarService,
+		logService:    logService,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *AvatarHandler) RegisterRoutes(protected *gin.RouterGroup, public *gin.RouterGroup) {
+	me := protected.Group("/users/me")
+	{
+		me.POST("/avatar", h.UploadAvatar)
+		me.DELETE("/avatar", h.DeleteAvatar)
+	}
+
+	public.GET("/avatars/:user_id/:name", h.GetAvatar)
+}
+
+// UploadAvatar 上传头像
+func (h *AvatarHandler) UploadAvatar(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "avatar file is required"})
+		return
+	}
+
+	user, err := h.avatarService.UploadAvatar(c, userID, fileHeader)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logService.LogOperation(c, userID, models.OperationUserUpdate, models.ResourceTypeUser,
+		&userID, gin.H{"avatar": "updated"}, models.OperationSuccess, "")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "avatar updated successfully",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeleteAvatar 删除头像
+func (h *AvatarHandler) DeleteAvatar(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.avatarService.DeleteAvatar(c, userID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logService.LogOperation(c, userID, models.OperationUserUpdate, models.ResourceTypeUser,
+		&userID, gin.H{"avatar": "deleted"}, models.OperationSuccess, "")
+
+	c.JSON(http.StatusOK, gin.H{"message": "avatar deleted successfully"})
+}
+
+// GetAvatar 公开访问头像，头像地址随每次上传变化，可长期缓存
+func (h *AvatarHandler) GetAvatar(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "avatar not found"})
+		return
+	}
+
+	reader, err := h.avatarService.OpenAvatar(c, userID, c.Param("name"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Type", "image/jpeg")
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", h.cfg.Avatar.CacheMaxAge))
+
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
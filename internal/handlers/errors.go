@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"cloud-storage/internal/services"
+)
+
+// errorStatus 将服务层错误映射为HTTP状态码
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrFileNotFound),
+		errors.Is(err, services.ErrVersionNotFound),
+		errors.Is(err, services.ErrShareNotFound),
+		errors.Is(err, services.ErrExportNotFound),
+		errors.Is(err, services.ErrAnnouncementNotFound),
+		errors.Is(err, services.ErrWebhookNotFound),
+		errors.Is(err, services.ErrSpaceNotFound),
+		errors.Is(err, services.ErrJobNotFound),
+		errors.Is(err, services.ErrUploadNotFound),
+		errors.Is(err, services.ErrAlertNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPermissionDenied),
+		errors.Is(err, services.ErrQuotaExceeded),
+		errors.Is(err, services.ErrShareInvalid),
+		errors.Is(err, services.ErrPasswordRequired),
+		errors.Is(err, services.ErrInvalidPassword),
+		errors.Is(err, services.ErrShareNotAllowed),
+		errors.Is(err, services.ErrShareLimitReached),
+		errors.Is(err, services.ErrAuditLogImmutable),
+		errors.Is(err, services.ErrUploadAborted):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrNameConflict),
+		errors.Is(err, services.ErrSpaceNotEmpty),
+		errors.Is(err, services.ErrLastSpaceAdmin),
+		errors.Is(err, services.ErrVersionConflict),
+		errors.Is(err, services.ErrJobFinished),
+		errors.Is(err, services.ErrMoveNotUndoable),
+		errors.Is(err, services.ErrUploadClosed),
+		errors.Is(err, services.ErrTempQuotaExceeded):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrExportInProgress),
+		errors.Is(err, services.ErrUploadLimitExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrExportExpired),
+		errors.Is(err, services.ErrUploadExpired):
+		return http.StatusGone
+	case errors.Is(err, services.ErrQueryTimeout),
+		errors.Is(err, services.ErrJobQueueFull),
+		errors.Is(err, services.ErrScanFailed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrPreviewUnavailable),
+		errors.Is(err, services.ErrFileTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrRangeNotSatisfiable):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, services.ErrTreeTooLarge),
+		errors.Is(err, services.ErrMalwareDetected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrInvalidTarget),
+		errors.Is(err, services.ErrInvalidArgument),
+		errors.Is(err, services.ErrChecksumMismatch):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
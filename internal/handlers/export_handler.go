@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/services"
+)
+
+// ExportHandler 用户数据导出处理器
+type ExportHandler struct {
+	exportService *services.ExportService
+	logService    *services.OperationLogService
+}
+
+// NewExportHandler 创建数据导出处理器
+func NewExportHandler(exportService *services.ExportService, logService *services.OperationLogService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		logService:    logService,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *ExportHandler) RegisterRoutes(protected *gin.RouterGroup, public *gin.RouterGroup) {
+	me := protected.Group("/users/me")
+	{
+		me.POST("/export", h.RequestExport)
+		me.GET("/exports", h.GetExports)
+	}
+
+	public.GET("/exports/:token/download", h.DownloadExport)
+}
+
+// RequestExport 申请导出个人数据
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	export, err := h.exportService.RequestExport(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logService.LogOperation(c, userID, models.OperationUserExport, models.ResourceTypeUser,
+		&userID, gin.H{"export_id": export.ID}, models.OperationSuccess, "")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "export started, a download link will be emailed when it is ready",
+		"export":  export.ToResponse(),
+	})
+}
+
+// GetExports 获取导出任务列表
+func (h *ExportHandler) GetExports(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	exports, err := h.exportService.GetUserExports(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses := make([]models.DataExportResponse, len(exports))
+	for i := range exports {
+		responses[i] = exports[i].ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"exports": responses})
+}
+
+// DownloadExport 通过限时链接下载导出包
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	reader, export, err := h.exportService.OpenExport(c, c.Param("token"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	filename := fmt.Sprintf("export-%s.zip", export.CreatedAt.Format("20060102"))
+	c.Header("Content-Disposition", storage.ContentDisposition("attachment", filename, false))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Length", strconv.FormatInt(export.FileSize, 10))
+
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
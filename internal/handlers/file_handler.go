@@ -1,50 +1,97 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/middleware"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
 	"cloud-storage/internal/services"
 )
 
 // FileHandler 文件处理器
 type FileHandler struct {
-	fileService *services.FileService
+	cfg          *config.Config
+	fileService  *services.FileService
+	chunkUploads *services.ChunkUploadService
+	uploadUsage  *services.UploadUsageService
+	auth         *middleware.AuthMiddleware
 }
 
 // NewFileHandler 创建文件处理器实例
-func NewFileHandler(fileService *services.FileService) *FileHandler {
+func NewFileHandler(
+	cfg *config.Config,
+	fileService *services.FileService,
+	chunkUploads *services.ChunkUploadService,
+	uploadUsage *services.UploadUsageService,
+	auth *middleware.AuthMiddleware,
+) *FileHandler {
 	return &FileHandler{
-		fileService: fileService,
+		cfg:          cfg,
+		fileService:  fileService,
+		chunkUploads: chunkUploads,
+		uploadUsage:  uploadUsage,
+		auth:         auth,
 	}
 }
 
-// RegisterRoutes 注册文件路由
-func (h *FileHandler) RegisterRoutes(router *gin.RouterGroup) {
+// RegisterRoutes 注册文件路由，公开文件通过public路由免登录访问
+func (h *FileHandler) RegisterRoutes(router *gin.RouterGroup, public *gin.RouterGroup) {
+	public.GET("/public/files/:id", h.GetPublicFile)
+	public.GET("/d/:token", h.DownloadByToken)
+
 	files := router.Group("/files")
 	{
 		files.GET("", h.GetFileList)
 		files.POST("", h.CreateFileOrDirectory)
+		files.GET("/by-type", h.GetFilesByType)
+		files.GET("/tree", h.GetFileTree)
+		files.GET("/duplicates", h.GetDuplicates)
+		files.GET("/moves", h.GetRecentMoves)
+		files.POST("/duplicates/dedup", h.DedupFiles)
+		files.POST("/batch-delete", h.BatchDeleteFiles)
+		files.POST("/batch-move", h.BatchMoveFiles)
 		files.GET("/:id", h.GetFile)
 		files.PUT("/:id", h.UpdateFile)
+		files.PATCH("/:id/rename", h.RenameFile)
 		files.DELETE("/:id", h.DeleteFile)
 		files.POST("/:id/copy", h.CopyFile)
 		files.POST("/:id/move", h.MoveFile)
+		files.POST("/:id/undo-move", h.UndoMove)
 		files.GET("/:id/download", h.DownloadFile)
+		files.GET("/:id/download-url", h.GetDownloadURL)
+		files.GET("/:id/download-archive", h.DownloadFolderArchive)
+		files.GET("/:id/content", h.GetFileContent)
+		files.PUT("/:id/content", h.UpdateFileContent)
+		files.GET("/:id/text-preview", h.GetTextPreview)
+		files.GET("/:id/thumbnail", h.GetThumbnail)
 		files.GET("/:id/versions", h.GetFileVersions)
+		files.GET("/:id/versions/:version/download", h.DownloadFileVersion)
+		files.DELETE("/:id/versions/cleanup", h.CleanupFileVersions)
 		files.POST("/:id/restore-version", h.RestoreFileVersion)
+		files.GET("/:id/permissions", h.GetFilePermissions)
+		files.POST("/:id/permissions", h.GrantFilePermission)
+		files.DELETE("/:id/permissions/:user_id", h.RevokeFilePermission)
 	}
 
 	upload := router.Group("/upload")
 	{
 		upload.POST("", h.UploadFile)
+		upload.POST("/initiate", h.InitiateUpload)
 		upload.POST("/chunk", h.UploadChunk)
+		upload.POST("/complete", h.CompleteUpload)
+		upload.GET("/:id", h.GetUploadSession)
 	}
 
 	recycle := router.Group("/recycle")
@@ -72,7 +119,7 @@ func (h *FileHandler) GetFileList(c *gin.Context) {
 
 	var filter models.FileFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -85,32 +132,98 @@ func (h *FileHandler) GetFileList(c *gin.Context) {
 		filter.ParentID = &parentID
 	}
 
-	// 设置默认值
-	if filter.Page == 0 {
-		filter.Page = 1
+	if filter.SpaceIDStr != "" {
+		spaceID, err := uuid.Parse(filter.SpaceIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space_id format"})
+			return
+		}
+		filter.SpaceID = &spaceID
+	}
+
+	filter.Page, filter.PageSize = models.NormalizePage(filter.Page, filter.PageSize)
+
+	files, total, err := h.fileService.GetFileList(c.Request.Context(), userID, filter)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 转换为响应格式
+	var response []models.FileResponse
+	for _, file := range files {
+		response = append(response, h.fileResponse(&file))
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("files", response, total, filter.Page, filter.PageSize))
+}
+
+// GetFilesByType 跨目录按MIME类型或分类列出文件
+func (h *FileHandler) GetFilesByType(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	mimeType := c.Query("mime")
+	category := c.Query("category")
+	if mimeType == "" && category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mime or category is required"})
+		return
+	}
+	if category != "" && !models.IsValidMimeCategory(category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category"})
+		return
+	}
+
+	sortBy := c.DefaultQuery("sort_by", "updated_at")
+	sortOrder := c.DefaultQuery("sort_order", "desc")
+	switch sortBy {
+	case "name", "size", "created_at", "updated_at":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort_by"})
+		return
+	}
+	if sortOrder != "asc" && sortOrder != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort_order"})
+		return
+	}
+
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+
+	filter := models.FileFilter{
+		Page:      page,
+		PageSize:  pageSize,
+		SortBy:    sortBy,
+		SortOrder: sortOrder,
+	}
+	if mimeType != "" {
+		filter.MimeType = &mimeType
 	}
-	if filter.PageSize == 0 {
-		filter.PageSize = 20
+	if category != "" {
+		filter.MimeCategory = &category
+	}
+	if spaceIDStr := c.Query("space_id"); spaceIDStr != "" {
+		spaceID, err := uuid.Parse(spaceIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space_id format"})
+			return
+		}
+		filter.SpaceID = &spaceID
 	}
 
-	files, total, err := h.fileService.GetFileList(userID, filter)
+	files, total, err := h.fileService.GetFilesByType(c.Request.Context(), userID, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	// 转换为响应格式
 	var response []models.FileResponse
 	for _, file := range files {
-		response = append(response, file.ToResponse())
+		response = append(response, h.fileResponse(&file))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"files": response,
-		"total": total,
-		"page":  filter.Page,
-		"size":  filter.PageSize,
-	})
+	c.JSON(http.StatusOK, models.NewPage("files", response, total, page, pageSize).
+		With("mime", mimeType).
+		With("category", category))
 }
 
 // CreateFileOrDirectory 创建文件或目录
@@ -119,7 +232,7 @@ func (h *FileHandler) CreateFileOrDirectory(c *gin.Context) {
 
 	var req models.FileCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -155,17 +268,11 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 
 	file, err := h.fileService.GetFileByID(userID, fileID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, file.ToResponse())
+	c.JSON(http.StatusOK, h.fileResponse(file))
 }
 
 // UpdateFile 更新文件信息
@@ -180,25 +287,42 @@ func (h *FileHandler) UpdateFile(c *gin.Context) {
 
 	var req models.FileUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	file, err := h.fileService.UpdateFile(userID, fileID, req)
+	file, err := h.fileService.UpdateFile(c, userID, fileID, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		} else if err.Error() == "file with this name already exists" {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
+}
+
+// RenameFile 重命名文件或目录
+func (h *FileHandler) RenameFile(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	var req models.FileRenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	file, err := h.fileService.RenameFile(c, userID, fileID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, file.ToResponse())
+	c.JSON(http.StatusOK, h.fileResponse(file))
 }
 
 // DeleteFile 删除文件
@@ -216,13 +340,7 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 
 	err = h.fileService.DeleteFile(c, userID, fileID, permanent)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -233,10 +351,48 @@ func (h *FileHandler) DeleteFile(c *gin.Context) {
 	}
 }
 
+// BatchDeleteFiles 批量删除文件，返回每个文件的结果，部分失败时仍返回200
+func (h *FileHandler) BatchDeleteFiles(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.FileBatchDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileService.BatchDeleteFiles(c, userID, req))
+}
+
+// BatchMoveFiles 批量移动文件到同一目录，返回每个文件移动成功或跳过的原因
+func (h *FileHandler) BatchMoveFiles(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.FileBatchMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result, err := h.fileService.BatchMoveFiles(c, userID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // UploadFile 上传文件
 func (h *FileHandler) UploadFile(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
 
+	// 在读取请求体之前按请求大小检查上传流量
+	if err := h.uploadUsage.CheckUpload(c.Request.Context(), userID, c.ClientIP(), c.Request.ContentLength); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	// 解析表单数据
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
@@ -246,7 +402,7 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 
 	var req models.FileUploadRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -259,19 +415,80 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		req.ParentID = &parentID
 	}
 
+	if req.SpaceIDStr != "" {
+		spaceID, err := uuid.Parse(req.SpaceIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space_id format"})
+			return
+		}
+		req.SpaceID = &spaceID
+	}
+
 	file, err := h.fileService.UploadFile(c, userID, fileHeader, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "storage quota exceeded" {
-			status = http.StatusForbidden
-		} else if err.Error() == "file already exists" {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		respondUploadError(c, err)
+		return
+	}
+	h.uploadUsage.RecordUpload(c.Request.Context(), userID, c.ClientIP(), file.Size)
+
+	c.JSON(http.StatusCreated, h.fileResponse(file))
+}
+
+// UpdateFileContent 用上传的内容替换文件内容，文件名、位置和ID不变，版本号加一
+func (h *FileHandler) UpdateFileContent(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	if err := h.uploadUsage.CheckUpload(c.Request.Context(), userID, c.ClientIP(), c.Request.ContentLength); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	var req models.FileContentUpdateRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondBindError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, file.ToResponse())
+	file, err := h.fileService.UpdateFileContent(c, userID, fileID, fileHeader, req)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	h.uploadUsage.RecordUpload(c.Request.Context(), userID, c.ClientIP(), file.Size)
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
+}
+
+// respondUploadError 返回上传失败的错误，超出分类子配额时附带该分类的用量，类型不允许时附带该类型
+func respondUploadError(c *gin.Context, err error) {
+	var typeErr *services.FileTypeError
+	if errors.As(err, &typeErr) {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error(), "file_type": typeErr.Type})
+		return
+	}
+	var quotaErr *services.CategoryQuotaError
+	if errors.As(err, &quotaErr) {
+		c.JSON(errorStatus(err), gin.H{
+			"error":          err.Error(),
+			"quota_category": quotaErr.Category,
+			"category_used":  quotaErr.Used,
+			"category_quota": quotaErr.Quota,
+		})
+		return
+	}
+	c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 }
 
 // DownloadFile 下载文件
@@ -284,23 +501,85 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 		return
 	}
 
-	reader, file, err := h.fileService.DownloadFile(c, userID, fileID)
+	h.serveDownload(c, userID, fileID)
+}
+
+// GetDownloadURL 获取文件的限时下载链接，可直接用于<a>或<img>而无需携带访问令牌
+// 存储支持时返回预签名URL，否则返回由签名令牌访问的 /d/{token} 链接
+func (h *FileHandler) GetDownloadURL(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	file, url, err := h.fileService.GetDirectDownloadURL(c, userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	expiresAt := time.Now().Add(storage.DownloadURLExpiry)
+	if url == "" {
+		var token string
+		token, expiresAt, err = h.auth.GenerateDownloadToken(userID, file.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate download token"})
+			return
+		}
+		url = apiURL(c, "/d/"+token)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":      file.ID,
+		"download_url": url,
+		"expires_at":   expiresAt,
+	})
+}
+
+// DownloadByToken 凭下载链接中的签名令牌免登录下载文件，下载时按签发令牌的用户重新检查权限
+func (h *FileHandler) DownloadByToken(c *gin.Context) {
+	claims, err := h.auth.ParseDownloadToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "download link is invalid or expired"})
+		return
+	}
+
+	// 以签发令牌的用户记录操作日志
+	c.Set("userID", claims.UserID)
+	c.Set("logResourceID", claims.FileID)
+
+	h.serveDownload(c, claims.UserID, claims.FileID)
+}
+
+// serveDownload 检查权限后按Range请求头流式返回文件内容
+func (h *FileHandler) serveDownload(c *gin.Context, userID, fileID uuid.UUID) {
+	reader, file, byteRange, err := h.fileService.DownloadFileRange(c, userID, fileID, c.GetHeader("Range"))
+	if err != nil {
+		var rangeErr *services.RangeNotSatisfiableError
+		if errors.As(err, &rangeErr) {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", rangeErr.Size))
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	defer reader.Close()
 
-	// 设置响应头
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.Name))
+	// 设置响应头，登录后的下载即使是公开文件也不允许共享缓存
+	c.Header("Content-Disposition", h.contentDisposition("attachment", file.Name))
 	c.Header("Content-Type", file.MimeType)
-	c.Header("Content-Length", strconv.FormatInt(file.Size, 10))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Cache-Control", "private, no-store")
+	if byteRange != nil {
+		// 只返回请求的范围，支持视频拖动和断点续传
+		c.Header("Content-Range", byteRange.ContentRange(file.Size))
+		c.Header("Content-Length", strconv.FormatInt(byteRange.Length, 10))
+		c.Status(http.StatusPartialContent)
+	} else {
+		c.Header("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
 
 	// 流式传输文件
 	c.Stream(func(w io.Writer) bool {
@@ -309,6 +588,102 @@ func (h *FileHandler) DownloadFile(c *gin.Context) {
 	})
 }
 
+// DownloadFolderArchive 将目录打包为ZIP下载，压缩包边生成边传输
+func (h *FileHandler) DownloadFolderArchive(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	archive, err := h.fileService.PrepareFolderArchive(userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 压缩包大小事先未知，不设置Content-Length
+	c.Header("Content-Disposition", h.contentDisposition("attachment", archive.Directory.Name+".zip"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+
+	// 响应头已发送，出错时只能中断传输
+	if err := h.fileService.WriteFolderArchive(c, c.Writer, archive); err != nil {
+		log.Printf("Failed to stream archive of directory %s: %v", fileID, err)
+	}
+}
+
+// GetPublicFile 免登录访问公开文件，响应可被浏览器和CDN缓存
+// 以文件ID和版本号作为ETag，客户端重新验证时未变化返回304
+func (h *FileHandler) GetPublicFile(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrFileNotFound.Error()})
+		return
+	}
+
+	file, err := h.fileService.GetPublicFile(fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.GetHeader("If-None-Match") == publicFileETag(file) {
+		h.setPublicCacheHeaders(c, file)
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	reader, file, err := h.fileService.OpenPublicFile(c, file)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	// 嗅探出的类型在PREVIEW_INLINE_TYPES允许列表中时内联展示，其余类型和可执行脚本的类型（HTML、SVG等）强制作为附件下载
+	h.setPublicCacheHeaders(c, file)
+	mimeType := file.PreviewMimeType(h.cfg.Preview.StrictMime())
+	if storage.IsInlineSafe(mimeType) {
+		c.Header("Content-Disposition", h.contentDisposition("inline", file.Name))
+		c.Header("Content-Type", mimeType)
+	} else {
+		c.Header("Content-Disposition", h.contentDisposition("attachment", file.Name))
+		c.Header("Content-Type", storage.DefaultMimeType)
+	}
+	c.Header("Content-Length", strconv.FormatInt(file.Size, 10))
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
+
+// setPublicCacheHeaders 设置公开文件的缓存响应头，只用于is_public文件
+func (h *FileHandler) setPublicCacheHeaders(c *gin.Context, file *models.File) {
+	if h.cfg.Download.PublicCacheMaxAge > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", h.cfg.Download.PublicCacheMaxAge))
+	} else {
+		c.Header("Cache-Control", "public, no-cache")
+	}
+	c.Header("ETag", publicFileETag(file))
+	c.Header("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+}
+
+// contentDisposition 按DOWNLOAD_FILENAME_ENCODING生成Content-Disposition响应头
+func (h *FileHandler) contentDisposition(disposition, filename string) string {
+	return storage.ContentDisposition(disposition, filename, h.cfg.Download.FilenameEncoding == "ascii")
+}
+
+// publicFileETag 公开文件的ETag，内容每次更新都会增加版本号
+func publicFileETag(file *models.File) string {
+	return fmt.Sprintf("\"%s-%d\"", file.ID, file.Version)
+}
+
 // CopyFile 复制文件
 func (h *FileHandler) CopyFile(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
@@ -321,27 +696,23 @@ func (h *FileHandler) CopyFile(c *gin.Context) {
 
 	var req models.FileCopyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	file, err := h.fileService.CopyFile(c, userID, fileID, req)
+	file, job, err := h.fileService.CopyFile(c, userID, fileID, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		} else if err.Error() == "storage quota exceeded" {
-			status = http.StatusForbidden
-		} else if err.Error() == "file with this name already exists in target directory" {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, file.ToResponse())
+	// 大量内容在后台复制，客户端通过任务接口轮询进度
+	if job != nil {
+		c.JSON(http.StatusAccepted, gin.H{"job": job.ToResponse()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
 }
 
 // MoveFile 移动文件
@@ -356,25 +727,178 @@ func (h *FileHandler) MoveFile(c *gin.Context) {
 
 	var req models.FileMoveRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	file, err := h.fileService.MoveFile(c, userID, fileID, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		} else if err.Error() == "file with this name already exists in target directory" {
-			status = http.StatusConflict
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
+}
+
+// UndoMove 撤销文件最近一次移动
+func (h *FileHandler) UndoMove(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	file, err := h.fileService.UndoMove(c, userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
+}
+
+// GetRecentMoves 获取当前用户最近的移动记录
+func (h *FileHandler) GetRecentMoves(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	moves, err := h.fileService.GetRecentMoves(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	responses := make([]models.FileMoveResponse, len(moves))
+	for i := range moves {
+		responses[i] = moves[i].ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"moves": responses})
+}
+
+// GetTextPreview 获取文件提取文本的预览
+func (h *FileHandler) GetTextPreview(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	length, err := strconv.Atoi(c.DefaultQuery("length", "0"))
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid length"})
+		return
+	}
+
+	preview, err := h.fileService.GetTextPreview(c, userID, fileID, length)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// GetFileContent 获取文件内容：preview=true时以JSON返回文本内容和语言提示，供代码查看器使用；
+// 否则与下载相同
+func (h *FileHandler) GetFileContent(c *gin.Context) {
+	if c.Query("preview") != "true" {
+		h.DownloadFile(c)
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	content, err := h.fileService.GetTextContent(c, userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, content)
+}
+
+// GetDuplicates 获取重复文件报告
+func (h *FileHandler) GetDuplicates(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	report, err := h.fileService.GetDuplicateReport(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// DedupFiles 提交清理重复文件的后台任务，每组保留一份
+func (h *FileHandler) DedupFiles(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	// 请求体可选，为空时处理全部重复组
+	var req models.DuplicateDedupRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+	}
+
+	job, err := h.fileService.DedupFiles(c, userID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job.ToResponse()})
+}
+
+// GetThumbnail 获取文件缩略图（JPEG），w、h指定最大宽高（按比例缩放），按版本和尺寸生成ETag，客户端可通过If-None-Match重新验证
+func (h *FileHandler) GetThumbnail(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	width, err := strconv.Atoi(c.DefaultQuery("w", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thumbnail width"})
+		return
+	}
+	height, err := strconv.Atoi(c.DefaultQuery("h", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thumbnail height"})
+		return
+	}
+
+	data, file, err := h.fileService.GetThumbnail(c, userID, fileID, width, height)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s-%d-thumbnail-%dx%d\"", file.ID, file.Version, width, height)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	c.JSON(http.StatusOK, file.ToResponse())
+	c.Data(http.StatusOK, "image/jpeg", data)
 }
 
 // GetFileVersions 获取文件版本列表
@@ -389,13 +913,7 @@ func (h *FileHandler) GetFileVersions(c *gin.Context) {
 
 	versions, err := h.fileService.GetFileVersions(userID, fileID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -408,6 +926,31 @@ func (h *FileHandler) GetFileVersions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"versions": response})
 }
 
+// CleanupFileVersions 按保留策略删除文件的历史版本，未提供的参数使用VERSION_*配置的默认策略
+func (h *FileHandler) CleanupFileVersions(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	policy := h.fileService.DefaultVersionPolicy()
+	if err := c.ShouldBindQuery(&policy); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result, err := h.fileService.CleanupFileVersions(c, userID, fileID, policy)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // RestoreFileVersion 恢复文件版本
 func (h *FileHandler) RestoreFileVersion(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
@@ -420,38 +963,237 @@ func (h *FileHandler) RestoreFileVersion(c *gin.Context) {
 
 	var req models.VersionRestoreRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	file, err := h.fileService.RestoreFileVersion(c, userID, fileID, req.VersionNumber)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		} else if err.Error() == "version not found" {
-			status = http.StatusNotFound
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fileResponse(file))
+}
+
+// DownloadFileVersion 下载文件的历史版本
+func (h *FileHandler) DownloadFileVersion(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(c.Param("version"))
+	if err != nil || versionNumber < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version number"})
+		return
+	}
+
+	reader, file, version, err := h.fileService.DownloadFileVersion(c, userID, fileID, versionNumber)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	// 设置响应头
+	c.Header("Content-Disposition", h.contentDisposition("attachment", file.Name))
+	c.Header("Content-Type", version.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(version.FileSize, 10))
+	c.Header("Cache-Control", "private, no-store")
+
+	// 流式传输文件
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
+
+// GetFilePermissions 获取文件的授权列表
+func (h *FileHandler) GetFilePermissions(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	permissions, err := h.fileService.GetFilePermissions(userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, file.ToResponse())
+	// 转换为响应格式
+	response := make([]models.FilePermissionResponse, 0, len(permissions))
+	for i := range permissions {
+		response = append(response, permissions[i].ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"permissions": response})
 }
 
-// UploadChunk 分片上传
+// GrantFilePermission 向指定用户授予文件权限
+func (h *FileHandler) GrantFilePermission(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	var req models.FilePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	permission, err := h.fileService.GrantFilePermission(c, userID, fileID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, permission.ToResponse())
+}
+
+// RevokeFilePermission 撤销用户的文件权限
+func (h *FileHandler) RevokeFilePermission(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	granteeID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := h.fileService.RevokeFilePermission(c, userID, fileID, granteeID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "permission revoked successfully"})
+}
+
+// InitiateUpload 创建分片上传会话
+func (h *FileHandler) InitiateUpload(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.InitiateUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	session, err := h.chunkUploads.InitiateUpload(c, userID, req)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, session.ToResponse([]int{}))
+}
+
+// UploadChunk 上传一个分片，分片内容放在表单的chunk字段
 func (h *FileHandler) UploadChunk(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "chunk upload functionality requires additional implementation"})
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	// 在读取请求体之前按请求大小检查上传流量
+	if err := h.uploadUsage.CheckUpload(c.Request.Context(), userID, c.ClientIP(), c.Request.ContentLength); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var req models.ChunkUploadRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	uploadID, err := uuid.Parse(req.UploadIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload_id format"})
+		return
+	}
+	req.UploadID = uploadID
+
+	chunkHeader, err := c.FormFile("chunk")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chunk is required"})
+		return
+	}
+
+	chunk, err := chunkHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read chunk"})
+		return
+	}
+	defer chunk.Close()
+
+	response, err := h.chunkUploads.UploadChunk(c, userID, req, chunk)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.uploadUsage.RecordUpload(c.Request.Context(), userID, c.ClientIP(), req.ChunkSize)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CompleteUpload 合并已上传的分片并创建文件
+func (h *FileHandler) CompleteUpload(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.CompleteUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	file, err := h.chunkUploads.CompleteUpload(c, userID, req.UploadID)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.fileResponse(file))
+}
+
+// GetUploadSession 获取分片上传进度，用于断点续传
+func (h *FileHandler) GetUploadSession(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	uploadID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid upload ID"})
+		return
+	}
+
+	session, completedChunks, err := h.chunkUploads.GetUploadSession(userID, uploadID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, session.ToResponse(completedChunks))
 }
 
 // GetRecycledFiles 获取回收站文件
 func (h *FileHandler) GetRecycledFiles(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
 
 	files, total, err := h.fileService.GetRecycledFiles(userID, page, pageSize)
 	if err != nil {
@@ -462,15 +1204,10 @@ func (h *FileHandler) GetRecycledFiles(c *gin.Context) {
 	// 转换为响应格式
 	var response []models.FileResponse
 	for _, file := range files {
-		response = append(response, file.ToResponse())
+		response = append(response, h.fileResponse(&file))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"files": response,
-		"total": total,
-		"page":  page,
-		"size":  pageSize,
-	})
+	c.JSON(http.StatusOK, models.NewPage("files", response, total, page, pageSize))
 }
 
 // RestoreRecycledFile 恢复回收站文件
@@ -485,13 +1222,7 @@ func (h *FileHandler) RestoreRecycledFile(c *gin.Context) {
 
 	err = h.fileService.RestoreRecycledFile(userID, fileID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -516,6 +1247,49 @@ func (h *FileHandler) CleanupRecycledFiles(c *gin.Context) {
 	})
 }
 
+// GetFileTree 获取目录树，默认只包含目录，include_files=true时包含文件
+func (h *FileHandler) GetFileTree(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var rootID *uuid.UUID
+	if rootIDStr := c.Query("root_id"); rootIDStr != "" {
+		id, err := uuid.Parse(rootIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid root_id"})
+			return
+		}
+		rootID = &id
+	}
+
+	depth, _ := strconv.Atoi(c.Query("depth"))
+	includeFiles := c.Query("include_files") == "true"
+
+	tree, truncated, err := h.fileService.GetFileTree(userID, rootID, depth, includeFiles)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"root_id":   rootID,
+		"tree":      h.treeResponse(tree),
+		"truncated": truncated,
+	})
+}
+
+// treeResponse 递归转换文件树节点
+func (h *FileHandler) treeResponse(nodes []*repositories.FileTreeNode) []*models.FileTreeNodeResponse {
+	response := make([]*models.FileTreeNodeResponse, 0, len(nodes))
+	for _, node := range nodes {
+		item := &models.FileTreeNodeResponse{FileResponse: h.fileResponse(&node.File)}
+		if len(node.Children) > 0 {
+			item.Children = h.treeResponse(node.Children)
+		}
+		response = append(response, item)
+	}
+	return response
+}
+
 // SearchFiles 搜索文件
 func (h *FileHandler) SearchFiles(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
@@ -527,28 +1301,25 @@ func (h *FileHandler) SearchFiles(c *gin.Context) {
 	}
 
 	searchIn := c.DefaultQuery("search_in", "name")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
 
-	files, total, err := h.fileService.SearchFiles(userID, query, searchIn, page, pageSize)
+	hits, total, err := h.fileService.SearchFiles(c.Request.Context(), userID, query, searchIn, page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	// 转换为响应格式
 	var response []models.FileResponse
-	for _, file := range files {
-		response = append(response, file.ToResponse())
+	for _, hit := range hits {
+		item := h.fileResponse(&hit.File)
+		if hit.Ancestors != nil {
+			item.Ancestors = models.NewBreadcrumbs(hit.Ancestors)
+		}
+		response = append(response, item)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"files": response,
-		"total": total,
-		"page":  page,
-		"size":  pageSize,
-		"query": query,
-	})
+	c.JSON(http.StatusOK, models.NewPage("files", response, total, page, pageSize).With("query", query))
 }
 
 // GetStorageUsage 获取存储使用情况
@@ -561,11 +1332,29 @@ func (h *FileHandler) GetStorageUsage(c *gin.Context) {
 		return
 	}
 
+	categories, err := h.fileService.GetCategoryUsage(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	tempUsage, err := h.chunkUploads.TempUsage(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	usagePercent := 0.0
 	if quota > 0 {
 		usagePercent = float64(used) / float64(quota) * 100
 	}
 
+	// 达到配额警告比例时返回警告，超出配额前上传不受影响
+	warning := h.fileService.StorageWarning(used, quota)
+	if warning != nil {
+		c.Header("X-Storage-Warning", warning.Header())
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"used":          used,
 		"quota":         quota,
@@ -574,6 +1363,9 @@ func (h *FileHandler) GetStorageUsage(c *gin.Context) {
 		"usage_readable": fmt.Sprintf("%s / %s",
 			formatFileSize(used),
 			formatFileSize(quota)),
+		"categories":  categories,
+		"warning":     warning,
+		"upload_temp": tempUsage,
 	})
 }
 
@@ -592,6 +1384,15 @@ func (h *FileHandler) GetFileStats(c *gin.Context) {
 
 // 辅助函数
 
+// fileResponse 转换为响应格式，可生成缩略图的文件附带缩略图地址
+func (h *FileHandler) fileResponse(file *models.File) models.FileResponse {
+	response := file.ToResponse()
+	if h.fileService.SupportsThumbnail(file) {
+		response.PreviewURL = fmt.Sprintf("/api/v1/files/%s/thumbnail", file.ID)
+	}
+	return response
+}
+
 // formatFileSize 格式化文件大小
 func formatFileSize(size int64) string {
 	const unit = 1024
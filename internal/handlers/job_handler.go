@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// JobHandler 后台任务处理器
+type JobHandler struct {
+	jobService *services.JobService
+}
+
+// NewJobHandler 创建后台任务处理器
+func NewJobHandler(jobService *services.JobService) *JobHandler {
+	return &JobHandler{
+		jobService: jobService,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *JobHandler) RegisterRoutes(router *gin.RouterGroup) {
+	jobs := router.Group("/jobs")
+	{
+		jobs.GET("", h.ListJobs)
+		jobs.GET("/:id", h.GetJob)
+		jobs.POST("/:id/cancel", h.CancelJob)
+	}
+}
+
+// ListJobs 获取当前用户最近的后台任务
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	jobs, err := h.jobService.ListJobs(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	responses := make([]models.JobResponse, len(jobs))
+	for i := range jobs {
+		responses[i] = jobs[i].ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": responses})
+}
+
+// GetJob 获取后台任务的状态、进度和结果
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.GetJob(userID, jobID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job.ToResponse())
+}
+
+// CancelJob 取消等待中或执行中的后台任务
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.CancelJob(userID, jobID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job.ToResponse())
+}
@@ -1,22 +1,32 @@
 package handlers
 
 import (
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"cloud-storage/internal/config"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/humanize"
+	"cloud-storage/internal/pkg/storage"
 	"cloud-storage/internal/services"
 )
 
 type ShareHandler struct {
+	cfg          *config.Config
 	shareService *services.ShareService
+	logService   *services.OperationLogService
 }
 
-func NewShareHandler(shareService *services.ShareService) *ShareHandler {
+func NewShareHandler(cfg *config.Config, shareService *services.ShareService, logService *services.OperationLogService) *ShareHandler {
 	return &ShareHandler{
+		cfg:          cfg,
 		shareService: shareService,
+		logService:   logService,
 	}
 }
 
@@ -26,16 +36,21 @@ func (h *ShareHandler) RegisterRoutes(protected *gin.RouterGroup, public *gin.Ro
 		shares.POST("", h.CreateShare)
 		shares.GET("", h.GetUserShares)
 		shares.GET("/:id", h.GetShare)
+		shares.GET("/:id/accesses", h.GetShareAccesses)
 		shares.PUT("/:id", h.UpdateShare)
 		shares.DELETE("/:id", h.DeleteShare)
 		shares.POST("/batch-delete", h.BatchDeleteShares)
 		shares.GET("/stats", h.GetShareStats)
 	}
+	protected.GET("/files/:id/sharing", h.GetFileSharing)
 
 	publicRoutes := public.Group("/s")
 	{
 		publicRoutes.GET("/:token", h.AccessShare)
+		publicRoutes.GET("/:token/files", h.ListSharedDirectory)
 		publicRoutes.GET("/:token/download", h.DownloadSharedFile)
+		publicRoutes.GET("/:token/files/:childId/download", h.DownloadSharedChild)
+		publicRoutes.PUT("/:token/content", h.UpdateSharedFileContent)
 	}
 }
 
@@ -44,22 +59,19 @@ func (h *ShareHandler) CreateShare(c *gin.Context) {
 
 	var req models.ShareCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	share, err := h.shareService.CreateShare(userID, req.FileID, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "file not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	h.logService.LogOperation(c, userID, models.OperationShareCreate, models.ResourceTypeShare,
+		&share.ID, gin.H{"file_id": share.FileID, "access_type": share.AccessType}, models.OperationSuccess, "")
+
 	response := share.ToResponse()
 	response.ShareURL = getShareURL(c, share.ShareToken)
 
@@ -71,7 +83,7 @@ func (h *ShareHandler) GetUserShares(c *gin.Context) {
 
 	var filter models.ShareFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -93,12 +105,7 @@ func (h *ShareHandler) GetUserShares(c *gin.Context) {
 		filter.FileID = &fileID
 	}
 
-	if filter.Page == 0 {
-		filter.Page = 1
-	}
-	if filter.PageSize == 0 {
-		filter.PageSize = 20
-	}
+	filter.Page, filter.PageSize = models.NormalizePage(filter.Page, filter.PageSize)
 
 	shares, total, err := h.shareService.GetUserShares(userID, filter)
 	if err != nil {
@@ -113,12 +120,39 @@ func (h *ShareHandler) GetUserShares(c *gin.Context) {
 		response = append(response, r)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"shares": response,
-		"total":  total,
-		"page":   filter.Page,
-		"size":   filter.PageSize,
-	})
+	c.JSON(http.StatusOK, models.NewPage("shares", response, total, filter.Page, filter.PageSize))
+}
+
+// GetFileSharing 获取文件的公开状态和有效分享列表
+func (h *ShareHandler) GetFileSharing(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	file, shares, err := h.shareService.GetFileSharing(userID, fileID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := models.FileSharingResponse{
+		FileID:       file.ID,
+		IsPublic:     file.IsPublic,
+		PublicToken:  file.ShareToken,
+		ActiveShares: len(shares),
+		Shares:       make([]models.ShareResponse, 0, len(shares)),
+	}
+	for _, share := range shares {
+		r := share.ToResponse()
+		r.ShareURL = getShareURL(c, share.ShareToken)
+		response.Shares = append(response.Shares, r)
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *ShareHandler) GetShare(c *gin.Context) {
@@ -132,13 +166,7 @@ func (h *ShareHandler) GetShare(c *gin.Context) {
 
 	share, err := h.shareService.GetShare(shareID, userID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "share not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -148,6 +176,33 @@ func (h *ShareHandler) GetShare(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetShareAccesses 分页查询分享的访问记录，可按动作（view、download）过滤
+func (h *ShareHandler) GetShareAccesses(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	shareID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share ID"})
+		return
+	}
+
+	action := models.ShareAccessAction(c.Query("action"))
+	if action != "" && action != models.ShareActionView && action != models.ShareActionDownload {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be view or download"})
+		return
+	}
+
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+
+	accesses, total, err := h.shareService.GetShareAccesses(shareID, userID, action, page, pageSize)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("accesses", accesses, total, page, pageSize))
+}
+
 func (h *ShareHandler) UpdateShare(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
 
@@ -159,19 +214,13 @@ func (h *ShareHandler) UpdateShare(c *gin.Context) {
 
 	var req models.ShareUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	share, err := h.shareService.UpdateShare(shareID, userID, req)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "share not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -192,13 +241,7 @@ func (h *ShareHandler) DeleteShare(c *gin.Context) {
 
 	err = h.shareService.DeleteShare(shareID, userID)
 	if err != nil {
-		status := http.StatusInternalServerError
-		if err.Error() == "share not found" {
-			status = http.StatusNotFound
-		} else if err.Error() == "permission denied" {
-			status = http.StatusForbidden
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -210,7 +253,7 @@ func (h *ShareHandler) BatchDeleteShares(c *gin.Context) {
 
 	var req models.ShareBulkDeleteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -241,19 +284,11 @@ func (h *ShareHandler) GetShareStats(c *gin.Context) {
 func (h *ShareHandler) AccessShare(c *gin.Context) {
 	token := c.Param("token")
 
-	var password *string
-	if c.Query("password") != "" {
-		pw := c.Query("password")
-		password = &pw
-	}
+	password := sharePassword(c).Value
 
-	share, err := h.shareService.AccessShare(token, password)
+	share, err := h.shareService.ViewShare(token, password, shareVisitor(c))
 	if err != nil {
-		status := http.StatusForbidden
-		if err.Error() == "share not found" {
-			status = http.StatusNotFound
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -267,40 +302,178 @@ func (h *ShareHandler) AccessShare(c *gin.Context) {
 		response.FileType = string(file.Type)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	result := gin.H{
 		"share": response,
-	})
+	}
+	if share.ExpiresAt != nil {
+		remaining := max(time.Until(*share.ExpiresAt), 0)
+		lang := humanize.Language(c.Query("locale"), c.GetHeader("Accept-Language"))
+		result["expires_in"] = humanize.Duration(remaining, lang)
+		result["expires_in_seconds"] = int64(remaining / time.Second)
+	}
+
+	if !share.File.IsDirectory() {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	// 目录分享同时返回根目录下的直接子文件，子文件的访问类型不超过分享的访问类型
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+	files, total, err := h.shareService.ListShareRoot(share, page, pageSize)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	listing := models.NewPage("files", files, total, page, pageSize)
+	for key, value := range result {
+		listing.With(key, value)
+	}
+	c.JSON(http.StatusOK, listing)
 }
 
 func (h *ShareHandler) DownloadSharedFile(c *gin.Context) {
+	fileID, ok := optionalUUIDQuery(c, "file_id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	h.serveSharedFile(c, fileID)
+}
+
+// DownloadSharedChild 下载目录分享中的后代文件，文件必须位于分享的目录之下
+func (h *ShareHandler) DownloadSharedChild(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("childId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	h.serveSharedFile(c, &fileID)
+}
+
+// serveSharedFile 验证分享后流式返回分享的文件内容
+func (h *ShareHandler) serveSharedFile(c *gin.Context, fileID *uuid.UUID) {
 	token := c.Param("token")
+	password := sharePassword(c)
 
-	var password *string
-	if c.Query("password") != "" {
-		pw := c.Query("password")
-		password = &pw
+	reader, file, err := h.shareService.DownloadSharedFile(c, token, password, fileID, shareVisitor(c))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	// 分享内容始终作为附件下载，不允许浏览器按内容嗅探类型
+	c.Header("Content-Disposition", storage.ContentDisposition("attachment", file.Name,
+		h.cfg.Download.FilenameEncoding == "ascii"))
+	c.Header("Content-Type", file.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(file.Size, 10))
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
+
+// ListSharedDirectory 列出目录分享中的文件，子文件继承分享的访问权限
+func (h *ShareHandler) ListSharedDirectory(c *gin.Context) {
+	token := c.Param("token")
+
+	password := sharePassword(c).Value
+
+	parentID, ok := optionalUUIDQuery(c, "parent_id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid parent ID"})
+		return
 	}
 
-	file, err := h.shareService.DownloadSharedFile(token, password)
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+
+	directory, files, total, err := h.shareService.ListSharedDirectory(token, password, parentID, page, pageSize)
 	if err != nil {
-		status := http.StatusForbidden
-		if err.Error() == "share not found" {
-			status = http.StatusNotFound
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("files", files, total, page, pageSize).
+		With("directory", directory.ToResponse()))
+}
+
+// UpdateSharedFileContent 通过编辑权限的分享上传新的文件内容
+func (h *ShareHandler) UpdateSharedFileContent(c *gin.Context) {
+	token := c.Param("token")
+	password := sharePassword(c)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	fileID, ok := optionalUUIDQuery(c, "file_id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	_, file, err := h.shareService.UpdateSharedFileContent(c, token, password, fileID, fileHeader)
+	if err != nil {
+		respondUploadError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"file":         file.ToResponse(),
-		"download_url": c.Request.Host + "/api/v1/s/" + token + "/download",
+		"message": "file updated successfully",
+		"file":    file.ToResponse(),
 	})
 }
 
+// sharePassword 读取分享密码，X-Share-Password请求头优先于password查询参数
+func sharePassword(c *gin.Context) services.SharePassword {
+	if pw := c.GetHeader("X-Share-Password"); pw != "" {
+		return services.SharePassword{Value: &pw}
+	}
+	if pw := c.Query("password"); pw != "" {
+		return services.SharePassword{Value: &pw, InURL: true}
+	}
+	return services.SharePassword{}
+}
+
+// shareVisitor 读取访问分享的客户端信息
+func shareVisitor(c *gin.Context) services.ShareVisitor {
+	return services.ShareVisitor{
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// optionalUUIDQuery 解析可选的UUID查询参数，未提供时返回nil，格式错误时ok为false
+func optionalUUIDQuery(c *gin.Context, key string) (*uuid.UUID, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, false
+	}
+	return &id, true
+}
+
 func getShareURL(c *gin.Context, token string) string {
+	return apiURL(c, "/s/"+token)
+}
+
+// apiURL 按当前请求的协议和主机生成API的完整地址
+func apiURL(c *gin.Context, path string) string {
 	scheme := "http"
 	if c.Request.TLS != nil {
 		scheme = "https"
 	}
-	return scheme + "://" + c.Request.Host + "/api/v1/s/" + token
+	return scheme + "://" + c.Request.Host + "/api/v1" + path
 }
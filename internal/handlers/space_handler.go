@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// SpaceHandler 团队空间处理器
+type SpaceHandler struct {
+	spaceService *services.SpaceService
+}
+
+// NewSpaceHandler 创建空间处理器
+func NewSpaceHandler(spaceService *services.SpaceService) *SpaceHandler {
+	return &SpaceHandler{
+		spaceService: spaceService,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *SpaceHandler) RegisterRoutes(router *gin.RouterGroup) {
+	spaces := router.Group("/spaces")
+	{
+		spaces.GET("", h.ListSpaces)
+		spaces.POST("", h.CreateSpace)
+		spaces.GET("/:id", h.GetSpace)
+		spaces.PUT("/:id", h.UpdateSpace)
+		spaces.DELETE("/:id", h.DeleteSpace)
+		spaces.POST("/:id/members", h.AddMember)
+		spaces.PUT("/:id/members/:user_id", h.UpdateMember)
+		spaces.DELETE("/:id/members/:user_id", h.RemoveMember)
+	}
+}
+
+// ListSpaces 获取当前用户加入的空间
+func (h *SpaceHandler) ListSpaces(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaces, err := h.spaceService.ListSpaces(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"spaces": spaces})
+}
+
+// CreateSpace 创建空间
+func (h *SpaceHandler) CreateSpace(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.SpaceCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	space, err := h.spaceService.CreateSpace(userID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, space)
+}
+
+// GetSpace 获取空间详情及成员
+func (h *SpaceHandler) GetSpace(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space ID"})
+		return
+	}
+
+	space, err := h.spaceService.GetSpace(userID, spaceID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, space)
+}
+
+// UpdateSpace 更新空间信息
+func (h *SpaceHandler) UpdateSpace(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space ID"})
+		return
+	}
+
+	var req models.SpaceUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	space, err := h.spaceService.UpdateSpace(userID, spaceID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, space)
+}
+
+// DeleteSpace 删除空间
+func (h *SpaceHandler) DeleteSpace(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space ID"})
+		return
+	}
+
+	if err := h.spaceService.DeleteSpace(userID, spaceID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "space deleted successfully"})
+}
+
+// AddMember 添加空间成员
+func (h *SpaceHandler) AddMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space ID"})
+		return
+	}
+
+	var req models.SpaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	member, err := h.spaceService.AddMember(userID, spaceID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateMember 修改成员角色
+func (h *SpaceHandler) UpdateMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, memberID, ok := parseSpaceMemberIDs(c)
+	if !ok {
+		return
+	}
+
+	var req models.SpaceMemberUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.spaceService.UpdateMemberRole(userID, spaceID, memberID, req); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member role updated successfully"})
+}
+
+// RemoveMember 移除成员或退出空间
+func (h *SpaceHandler) RemoveMember(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	spaceID, memberID, ok := parseSpaceMemberIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.spaceService.RemoveMember(userID, spaceID, memberID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "member removed successfully"})
+}
+
+// parseSpaceMemberIDs 解析路径中的空间ID和成员用户ID，失败时写入400响应
+func parseSpaceMemberIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	spaceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid space ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	memberID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return spaceID, memberID, true
+}
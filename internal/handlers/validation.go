@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field,omitempty"` // 与具体字段无关的错误（如JSON格式错误）为空
+	Message string `json:"message"`
+}
+
+func init() {
+	// 校验错误中使用请求中的字段名（json或form标签）而不是结构体字段名
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(requestFieldName)
+	}
+}
+
+// requestFieldName 返回字段在请求中的名称，优先使用json标签
+func requestFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// respondBindError 以结构化格式返回请求绑定错误
+func respondBindError(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "invalid request",
+		"errors": translateBindError(err),
+	})
+}
+
+// translateBindError 将绑定和校验错误转换为字段错误列表
+func translateBindError(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fieldErrs := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:   fieldPath(fe),
+				Message: validationMessage(fe),
+			})
+		}
+		return fieldErrs
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{Field: typeErr.Field, Message: "must be " + typeName(typeErr.Type)}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return []FieldError{{Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return []FieldError{{Message: "malformed JSON: unexpected end of input"}}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return []FieldError{{Message: "request body is required"}}
+	}
+
+	return []FieldError{{Message: err.Error()}}
+}
+
+// fieldPath 返回去掉顶层结构体名称的字段路径，如 events[0]
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+// validationMessage 生成可读的校验失败信息
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "gte":
+		return "must be at least " + sizeLimit(fe)
+	case "max", "lte":
+		return "must be at most " + sizeLimit(fe)
+	case "len":
+		return "must be exactly " + sizeLimit(fe)
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	default:
+		return fmt.Sprintf("failed %q validation", fe.Tag())
+	}
+}
+
+// sizeLimit 根据字段类型描述长度或数值限制
+func sizeLimit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return fe.Param() + " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fe.Param() + " items"
+	default:
+		return fe.Param()
+	}
+}
+
+// typeName 描述JSON字段期望的类型
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a valid " + t.String()
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/services"
+)
+
+// WebhookHandler Webhook处理器
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+// NewWebhookHandler 创建Webhook处理器
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *WebhookHandler) RegisterRoutes(router *gin.RouterGroup) {
+	webhooks := router.Group("/webhooks")
+	{
+		webhooks.GET("", h.ListWebhooks)
+		webhooks.POST("", h.CreateWebhook)
+		webhooks.GET("/:id", h.GetWebhook)
+		webhooks.PUT("/:id", h.UpdateWebhook)
+		webhooks.DELETE("/:id", h.DeleteWebhook)
+		webhooks.GET("/:id/deliveries", h.ListDeliveries)
+		webhooks.POST("/:id/ping", h.PingWebhook)
+	}
+}
+
+// ListWebhooks 获取当前用户的Webhook列表
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhooks, err := h.webhookService.ListWebhooks(userID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks,
+		"events":   events.Types,
+	})
+}
+
+// CreateWebhook 创建Webhook
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req models.WebhookCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(userID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhook 获取Webhook详情
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	webhook, err := h.webhookService.GetWebhook(userID, webhookID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook 更新Webhook
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	var req models.WebhookUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(userID, webhookID, req)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook 删除Webhook
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(userID, webhookID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "webhook deleted successfully"})
+}
+
+// ListDeliveries 分页获取Webhook投递记录
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	page, pageSize := models.ParsePage(c.Query("page"), c.Query("page_size"))
+
+	deliveries, total, err := h.webhookService.ListDeliveries(userID, webhookID, page, pageSize)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewPage("deliveries", deliveries, total, page, pageSize))
+}
+
+// PingWebhook 发送测试事件
+func (h *WebhookHandler) PingWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook ID"})
+		return
+	}
+
+	delivery, err := h.webhookService.PingWebhook(userID, webhookID)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/middleware"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// WOPIHandler WOPI宿主处理器，供Collabora、OnlyOffice等在线编辑器读取和保存文件
+type WOPIHandler struct {
+	wopiService    *services.WOPIService
+	authMiddleware *middleware.AuthMiddleware
+}
+
+// NewWOPIHandler 创建WOPI处理器
+func NewWOPIHandler(wopiService *services.WOPIService, authMiddleware *middleware.AuthMiddleware) *WOPIHandler {
+	return &WOPIHandler{
+		wopiService:    wopiService,
+		authMiddleware: authMiddleware,
+	}
+}
+
+// RegisterRoutes 注册路由，WOPI接口通过查询参数access_token认证，不使用API令牌
+func (h *WOPIHandler) RegisterRoutes(protected *gin.RouterGroup, wopi *gin.RouterGroup) {
+	protected.POST("/files/:id/wopi", h.IssueToken)
+
+	files := wopi.Group("/files")
+	{
+		files.GET("/:id", h.CheckFileInfo)
+		files.GET("/:id/contents", h.GetFile)
+		files.POST("/:id/contents", h.PutFile)
+	}
+}
+
+// IssueToken 为当前用户签发打开文件所需的WOPI访问令牌
+func (h *WOPIHandler) IssueToken(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file ID"})
+		return
+	}
+
+	if _, err := h.wopiService.GetEditableFile(userID, fileID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	token, expiresAt, err := h.authMiddleware.GenerateWOPIToken(userID, fileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate WOPI token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WOPITokenResponse{
+		WopiSrc:        getWOPISrc(c, fileID),
+		AccessToken:    token,
+		AccessTokenTTL: expiresAt.UnixMilli(),
+	})
+}
+
+// CheckFileInfo WOPI CheckFileInfo
+func (h *WOPIHandler) CheckFileInfo(c *gin.Context) {
+	userID, fileID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.wopiService.CheckFileInfo(userID, fileID)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// GetFile WOPI GetFile，返回文件内容
+func (h *WOPIHandler) GetFile(c *gin.Context) {
+	userID, fileID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	reader, file, err := h.wopiService.GetFile(c, userID, fileID)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+	defer reader.Close()
+
+	c.Header("X-WOPI-ItemVersion", strconv.Itoa(file.Version))
+	c.Header("Content-Type", file.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(file.Size, 10))
+	c.Header("Cache-Control", "private, no-store")
+
+	c.Stream(func(w io.Writer) bool {
+		_, err := io.Copy(w, reader)
+		return err == nil
+	})
+}
+
+// PutFile WOPI PutFile，保存编辑后的内容为新版本
+func (h *WOPIHandler) PutFile(c *gin.Context) {
+	userID, fileID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if c.GetHeader("X-WOPI-Override") != "PUT" {
+		c.Status(http.StatusNotImplemented)
+		return
+	}
+
+	if c.Request.ContentLength < 0 {
+		c.Status(http.StatusLengthRequired)
+		return
+	}
+
+	file, err := h.wopiService.PutFile(c, userID, fileID, c.Request.Body, c.Request.ContentLength)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	c.Header("X-WOPI-ItemVersion", strconv.Itoa(file.Version))
+	c.Status(http.StatusOK)
+}
+
+// authenticate 校验access_token是否为该文件签发，失败时写入401响应
+func (h *WOPIHandler) authenticate(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	claims, err := h.authMiddleware.ParseWOPIToken(c.Query("access_token"), fileID)
+	if err != nil {
+		c.Status(http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return claims.UserID, fileID, true
+}
+
+// getWOPISrc 获取文件的WOPI地址，编辑器通过该地址回调宿主
+func getWOPISrc(c *gin.Context, fileID uuid.UUID) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/wopi/files/" + fileID.String()
+}
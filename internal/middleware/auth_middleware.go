@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -63,8 +64,8 @@ func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
 			return
 		}
 
-		// 检查令牌是否在Redis黑名单中（如果支持注销）
-		if m.isTokenBlacklisted(tokenString) {
+		// 检查令牌是否在Redis黑名单中（如果支持注销），或用户的全部令牌已被管理员撤销
+		if m.isTokenBlacklisted(tokenString) || m.isUserRevoked(claims.UserID, claims.IssuedAt) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
 			c.Abort()
 			return
@@ -88,7 +89,7 @@ func (m *AuthMiddleware) ParseToken(tokenString string) (*Claims, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(m.cfg.JWT.Secret), nil
-	})
+	}, m.parserOptions()...)
 
 	if err != nil {
 		return nil, err
@@ -101,6 +102,25 @@ func (m *AuthMiddleware) ParseToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// parserOptions 返回校验签发者和受众的解析选项
+func (m *AuthMiddleware) parserOptions() []jwt.ParserOption {
+	return []jwt.ParserOption{
+		jwt.WithIssuer(m.cfg.JWT.Issuer),
+		jwt.WithAudience(m.cfg.JWT.Audience),
+	}
+}
+
+// registeredClaims 构建包含签发者和受众的标准声明
+func (m *AuthMiddleware) registeredClaims(userID uuid.UUID, expireTime time.Time) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expireTime),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Issuer:    m.cfg.JWT.Issuer,
+		Audience:  jwt.ClaimStrings{m.cfg.JWT.Audience},
+		Subject:   userID.String(),
+	}
+}
+
 // parseToken 解析JWT令牌
 func (m *AuthMiddleware) parseToken(tokenString string) (*Claims, error) {
 	return m.ParseToken(tokenString)
@@ -129,15 +149,10 @@ func (m *AuthMiddleware) GenerateToken(userID uuid.UUID, username, role string)
 	expireTime := time.Now().Add(time.Duration(m.cfg.JWT.ExpireHours) * time.Hour)
 
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expireTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "cloud-storage",
-			Subject:   userID.String(),
-		},
+		UserID:           userID,
+		Username:         username,
+		Role:             role,
+		RegisteredClaims: m.registeredClaims(userID, expireTime),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -150,13 +165,8 @@ func (m *AuthMiddleware) GenerateRefreshToken(userID uuid.UUID) (string, error)
 	expireTime := time.Now().Add(time.Duration(m.cfg.JWT.RefreshExpireHours) * time.Hour)
 
 	claims := &Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expireTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "cloud-storage",
-			Subject:   userID.String(),
-		},
+		UserID:           userID,
+		RegisteredClaims: m.registeredClaims(userID, expireTime),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -169,12 +179,16 @@ func (m *AuthMiddleware) RefreshToken(refreshToken string) (string, string, erro
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(m.cfg.JWT.Secret), nil
-	})
+	}, m.parserOptions()...)
 
 	if err != nil || !token.Valid {
 		return "", "", fmt.Errorf("invalid refresh token")
 	}
 
+	if m.isUserRevoked(claims.UserID, claims.IssuedAt) {
+		return "", "", fmt.Errorf("refresh token has been revoked")
+	}
+
 	// 生成新的访问令牌和刷新令牌
 	newAccessToken, err := m.GenerateToken(claims.UserID, claims.Username, claims.Role)
 	if err != nil {
@@ -207,6 +221,31 @@ func (m *AuthMiddleware) BlacklistToken(tokenString string, expireTime time.Time
 	return database.Set(key, "1", expiration)
 }
 
+// RevokeUserTokens 撤销用户此前签发的所有访问令牌、刷新令牌和WOPI令牌
+// 记录撤销时间，签发时间不晚于该时间的令牌均被拒绝，记录保留到最长的令牌有效期结束
+func (m *AuthMiddleware) RevokeUserTokens(userID uuid.UUID) error {
+	expiration := time.Duration(max(m.cfg.JWT.ExpireHours, m.cfg.JWT.RefreshExpireHours)) * time.Hour
+	expiration = max(expiration, m.cfg.WOPI.TokenTTL)
+
+	key := fmt.Sprintf("revoked:user:%s", userID)
+	return database.Set(key, strconv.FormatInt(time.Now().Unix(), 10), expiration)
+}
+
+// isUserRevoked 检查令牌是否签发于用户令牌被撤销之前，Redis错误时默认认为令牌有效
+func (m *AuthMiddleware) isUserRevoked(userID uuid.UUID, issuedAt *jwt.NumericDate) bool {
+	value, err := database.Get(fmt.Sprintf("revoked:user:%s", userID))
+	if err != nil {
+		return false
+	}
+
+	revokedAt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return issuedAt == nil || issuedAt.Unix() <= revokedAt
+}
+
 // RequireRole 要求特定角色的中间件
 func (m *AuthMiddleware) RequireRole(requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -287,7 +326,7 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		}
 
 		// 检查令牌是否在黑名单中
-		if m.isTokenBlacklisted(tokenString) {
+		if m.isTokenBlacklisted(tokenString) || m.isUserRevoked(claims.UserID, claims.IssuedAt) {
 			c.Next()
 			return
 		}
@@ -345,7 +384,7 @@ func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Share-Password")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/config"
+)
+
+// DownloadLimiter 全局和每用户的并发下载限制
+type DownloadLimiter struct {
+	cfg    config.DownloadConfig
+	global chan struct{} // 全局信号量，为nil时不限制
+	active atomic.Int64
+
+	mu    sync.Mutex
+	users map[string]*userDownloads
+}
+
+// userDownloads 单个用户的下载信号量，refs为持有或等待的请求数，归零时删除
+type userDownloads struct {
+	sem  chan struct{}
+	refs int
+}
+
+// NewDownloadLimiter 创建并发下载限制器
+func NewDownloadLimiter(cfg *config.Config) *DownloadLimiter {
+	l := &DownloadLimiter{
+		cfg:   cfg.Download,
+		users: make(map[string]*userDownloads),
+	}
+	if cfg.Download.MaxConcurrent > 0 {
+		l.global = make(chan struct{}, cfg.Download.MaxConcurrent)
+	}
+	return l
+}
+
+// ActiveDownloads 返回正在进行的下载数
+func (l *DownloadLimiter) ActiveDownloads() int {
+	return int(l.active.Load())
+}
+
+// Middleware 限制以 /download 结尾的路由和下载链接 /d/:token 的并发数，其余路由直接放行
+// 达到上限时排队等待，超时后返回503和Retry-After；需注册在认证中间件之后才能按用户计数
+func (l *DownloadLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasSuffix(c.FullPath(), "/download") && c.FullPath() != "/api/v1/d/:token" {
+			c.Next()
+			return
+		}
+
+		release, ok := l.acquire(c.Request.Context(), downloadKey(c))
+		if !ok {
+			retryAfter := int(math.Ceil(l.cfg.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":       "too many concurrent downloads",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		defer release()
+
+		c.Next()
+	}
+}
+
+// acquire 依次获取用户和全局名额，排队超过QueueTimeout或请求取消时失败
+func (l *DownloadLimiter) acquire(ctx context.Context, key string) (func(), bool) {
+	if l.cfg.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.cfg.QueueTimeout)
+		defer cancel()
+	}
+
+	user := l.joinUser(key)
+	if user != nil && !wait(ctx, user.sem, l.cfg.QueueTimeout > 0) {
+		l.leaveUser(key, user)
+		return nil, false
+	}
+
+	if l.global != nil && !wait(ctx, l.global, l.cfg.QueueTimeout > 0) {
+		if user != nil {
+			<-user.sem
+			l.leaveUser(key, user)
+		}
+		return nil, false
+	}
+
+	l.active.Add(1)
+	return func() {
+		l.active.Add(-1)
+		if l.global != nil {
+			<-l.global
+		}
+		if user != nil {
+			<-user.sem
+			l.leaveUser(key, user)
+		}
+	}, true
+}
+
+// joinUser 获取用户的信号量并增加引用，未限制每用户并发时返回nil
+func (l *DownloadLimiter) joinUser(key string) *userDownloads {
+	if l.cfg.MaxPerUser <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	user, ok := l.users[key]
+	if !ok {
+		user = &userDownloads{sem: make(chan struct{}, l.cfg.MaxPerUser)}
+		l.users[key] = user
+	}
+	user.refs++
+	return user
+}
+
+// leaveUser 减少引用，没有请求持有或等待时删除用户的信号量
+func (l *DownloadLimiter) leaveUser(key string, user *userDownloads) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	user.refs--
+	if user.refs == 0 {
+		delete(l.users, key)
+	}
+}
+
+// wait 获取信号量，queue为false时不等待
+func wait(ctx context.Context, sem chan struct{}, queue bool) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		if !queue {
+			return false
+		}
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// downloadKey 已登录用户按用户ID计数，公开下载按客户端IP计数
+func downloadKey(c *gin.Context) string {
+	if userID, ok := c.Get("userID"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			return "user:" + id.String()
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
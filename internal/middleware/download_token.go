@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// downloadAudienceSuffix 下载令牌的受众后缀，使下载令牌与API令牌互不通用
+const downloadAudienceSuffix = ":download"
+
+// DownloadClaims 下载链接令牌声明，令牌只能下载签发时指定的文件
+type DownloadClaims struct {
+	UserID uuid.UUID `json:"user_id"`
+	FileID uuid.UUID `json:"file_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateDownloadToken 为用户生成下载指定文件的短期令牌，返回令牌及其过期时间
+func (m *AuthMiddleware) GenerateDownloadToken(userID, fileID uuid.UUID) (string, time.Time, error) {
+	expireTime := time.Now().Add(m.cfg.Download.URLTTL)
+
+	registered := m.registeredClaims(userID, expireTime)
+	registered.Audience = jwt.ClaimStrings{m.cfg.JWT.Audience + downloadAudienceSuffix}
+
+	claims := &DownloadClaims{
+		UserID:           userID,
+		FileID:           fileID,
+		RegisteredClaims: registered,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(m.cfg.JWT.Secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expireTime, nil
+}
+
+// ParseDownloadToken 解析下载令牌，校验签名、有效期以及用户令牌是否已被撤销
+func (m *AuthMiddleware) ParseDownloadToken(tokenString string) (*DownloadClaims, error) {
+	claims := &DownloadClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(m.cfg.JWT.Secret), nil
+	}, jwt.WithIssuer(m.cfg.JWT.Issuer), jwt.WithAudience(m.cfg.JWT.Audience+downloadAudienceSuffix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if m.isUserRevoked(claims.UserID, claims.IssuedAt) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/services"
+)
+
+// operationErrorLimit 失败响应中最多读取的字节数，用于提取错误消息
+const operationErrorLimit = 1024
+
+// loggedOperation 需要记录操作日志的路由
+// failuresOnly为true时成功的操作已由服务层在数据变更的事务中记录，中间件只记录失败
+type loggedOperation struct {
+	operation    models.OperationType
+	resourceType models.ResourceType
+	failuresOnly bool
+}
+
+// loggedOperations 按"方法 完整路由"登记需要记录操作日志的路由
+var loggedOperations = map[string]loggedOperation{
+	"POST /api/v1/upload":                              {models.OperationFileUpload, models.ResourceTypeFile, true},
+	"POST /api/v1/upload/complete":                     {models.OperationFileUpload, models.ResourceTypeFile, true},
+	"PUT /api/v1/files/:id/content":                    {models.OperationFileUpdate, models.ResourceTypeFile, true},
+	"GET /api/v1/files/:id/download":                   {models.OperationFileDownload, models.ResourceTypeFile, false},
+	"GET /api/v1/files/:id/download-archive":           {models.OperationFileDownload, models.ResourceTypeDir, false},
+	"GET /api/v1/files/:id/versions/:version/download": {models.OperationFileDownload, models.ResourceTypeFile, false},
+	"GET /api/v1/d/:token":                             {models.OperationFileDownload, models.ResourceTypeFile, false},
+	"DELETE /api/v1/files/:id":                         {models.OperationFileDelete, models.ResourceTypeFile, true},
+	"POST /api/v1/files/batch-delete":                  {models.OperationFileDelete, models.ResourceTypeFile, true},
+	"POST /api/v1/files/:id/move":                      {models.OperationFileMove, models.ResourceTypeFile, true},
+	"PATCH /api/v1/files/:id/rename":                   {models.OperationFileRename, models.ResourceTypeFile, true},
+	"POST /api/v1/files/batch-move":                    {models.OperationFileMove, models.ResourceTypeFile, true},
+	"POST /api/v1/files/:id/copy":                      {models.OperationFileCopy, models.ResourceTypeFile, true},
+	"POST /api/v1/shares":                              {models.OperationShareCreate, models.ResourceTypeShare, true},
+	"PUT /api/v1/auth/profile":                         {models.OperationUserUpdate, models.ResourceTypeUser, false},
+	"PUT /api/v1/auth/password":                        {models.OperationUserUpdate, models.ResourceTypeUser, false},
+	"PUT /api/v1/admin/users/:id":                      {models.OperationUserUpdate, models.ResourceTypeUser, false},
+	"POST /api/v1/admin/users/:id/activate":            {models.OperationUserUpdate, models.ResourceTypeUser, false},
+	"POST /api/v1/admin/users/:id/deactivate":          {models.OperationUserUpdate, models.ResourceTypeUser, false},
+}
+
+// errorCaptureWriter 记录失败响应的开头部分，成功响应直接写出
+type errorCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorCaptureWriter) capture(data []byte) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < operationErrorLimit {
+		w.body.Write(data[:min(len(data), operationErrorLimit-w.body.Len())])
+	}
+}
+
+// OperationLogMiddleware 为登记的路由记录操作日志（IP、User-Agent、耗时和结果），未认证的请求不记录
+// 同时记录请求开始时间，服务层记录的日志据此计算耗时
+func OperationLogMiddleware(logService *services.OperationLogService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("requestStart", time.Now())
+
+		op, ok := loggedOperations[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		writer := &errorCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		value, exists := c.Get("userID")
+		if !exists {
+			return
+		}
+		userID := value.(uuid.UUID)
+
+		status := c.Writer.Status()
+		failed := status >= http.StatusBadRequest
+		if !failed && op.failuresOnly {
+			return
+		}
+
+		// 资源为处理器指定的资源或路径中的id，修改自己资料时为当前用户
+		resourceID := &userID
+		if value, ok := c.Get("logResourceID"); ok {
+			id := value.(uuid.UUID)
+			resourceID = &id
+		} else if id, err := uuid.Parse(c.Param("id")); err == nil {
+			resourceID = &id
+		} else if op.resourceType != models.ResourceTypeUser {
+			resourceID = nil
+		}
+
+		details := gin.H{"method": c.Request.Method, "path": c.Request.URL.Path, "status": status}
+		result, message := models.OperationSuccess, ""
+		if failed {
+			result, message = models.OperationFailure, responseError(writer.body.Bytes(), status)
+		}
+
+		if err := logService.LogOperation(c, userID, op.operation, op.resourceType, resourceID,
+			details, result, message); err != nil {
+			log.Printf("Failed to log %s for user %s: %v", op.operation, userID, err)
+		}
+	}
+}
+
+// responseError 从失败响应的JSON中提取错误消息，无法解析时使用状态码说明
+func responseError(body []byte, status int) string {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Error != "" {
+		return response.Error
+	}
+	return http.StatusText(status)
+}
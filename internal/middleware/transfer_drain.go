@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transferRoutes 路由中包含这些片段的请求视为传输（上传、下载、替换内容）
+var transferRoutes = []string{"/upload", "/download", "/content", "/d/:token"}
+
+// TransferDrain 记录进行中的上传和下载，服务关闭时等待它们结束
+type TransferDrain struct {
+	wg     sync.WaitGroup
+	active atomic.Int64
+}
+
+// NewTransferDrain 创建传输跟踪器
+func NewTransferDrain() *TransferDrain {
+	return &TransferDrain{}
+}
+
+// Middleware 跟踪传输路由的请求，其余路由直接放行
+func (d *TransferDrain) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isTransferRoute(c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		d.wg.Add(1)
+		d.active.Add(1)
+		defer func() {
+			d.active.Add(-1)
+			d.wg.Done()
+		}()
+
+		c.Next()
+	}
+}
+
+// Active 进行中的传输数
+func (d *TransferDrain) Active() int64 {
+	return d.active.Load()
+}
+
+// Wait 等待进行中的传输全部结束，ctx结束时返回ctx的错误
+func (d *TransferDrain) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isTransferRoute(route string) bool {
+	for _, part := range transferRoutes {
+		if strings.Contains(route, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ErrUploadTerminated 上传被管理员终止时请求上下文的取消原因
+var ErrUploadTerminated = errors.New("upload terminated by administrator")
+
+// ErrServerShutdown 服务关闭时仍未完成的上传被中止的原因
+var ErrServerShutdown = errors.New("upload aborted by server shutdown")
+
+// UploadTracker 记录每个用户进行中的上传请求，管理员可一次性中止某个用户的全部上传
+type UploadTracker struct {
+	mu      sync.Mutex
+	uploads map[uuid.UUID]map[*trackedUpload]struct{}
+}
+
+type trackedUpload struct {
+	cancel context.CancelCauseFunc
+}
+
+// NewUploadTracker 创建上传跟踪器
+func NewUploadTracker() *UploadTracker {
+	return &UploadTracker{uploads: make(map[uuid.UUID]map[*trackedUpload]struct{})}
+}
+
+// Middleware 跟踪 /upload 路由的请求，其余路由直接放行；需注册在认证中间件之后
+// 请求上下文被取消后，写入存储的上传内容会读取失败，上传随之中止
+func (t *UploadTracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok || !strings.Contains(c.FullPath(), "/upload") {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		upload := &trackedUpload{cancel: cancel}
+		t.add(userID.(uuid.UUID), upload)
+		defer func() {
+			t.remove(userID.(uuid.UUID), upload)
+			cancel(nil)
+		}()
+
+		c.Next()
+	}
+}
+
+// CancelUser 中止用户所有进行中的上传，返回中止的数量
+func (t *UploadTracker) CancelUser(userID uuid.UUID) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	uploads := t.uploads[userID]
+	for upload := range uploads {
+		upload.cancel(ErrUploadTerminated)
+	}
+	delete(t.uploads, userID)
+	return len(uploads)
+}
+
+// CancelAll 以cause中止所有用户进行中的上传，返回中止的数量
+func (t *UploadTracker) CancelAll(cause error) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for userID, uploads := range t.uploads {
+		for upload := range uploads {
+			upload.cancel(cause)
+		}
+		count += len(uploads)
+		delete(t.uploads, userID)
+	}
+	return count
+}
+
+func (t *UploadTracker) add(userID uuid.UUID, upload *trackedUpload) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.uploads[userID] == nil {
+		t.uploads[userID] = make(map[*trackedUpload]struct{})
+	}
+	t.uploads[userID][upload] = struct{}{}
+}
+
+func (t *UploadTracker) remove(userID uuid.UUID, upload *trackedUpload) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.uploads[userID], upload)
+	if len(t.uploads[userID]) == 0 {
+		delete(t.uploads, userID)
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// wopiAudienceSuffix WOPI令牌的受众后缀，使WOPI令牌与API令牌互不通用
+const wopiAudienceSuffix = ":wopi"
+
+// WOPIClaims WOPI访问令牌声明，令牌只能访问签发时指定的文件
+type WOPIClaims struct {
+	UserID uuid.UUID `json:"user_id"`
+	FileID uuid.UUID `json:"file_id"`
+	jwt.RegisteredClaims
+}
+
+// GenerateWOPIToken 为用户生成访问指定文件的WOPI令牌，返回令牌及其过期时间
+func (m *AuthMiddleware) GenerateWOPIToken(userID, fileID uuid.UUID) (string, time.Time, error) {
+	expireTime := time.Now().Add(m.cfg.WOPI.TokenTTL)
+
+	registered := m.registeredClaims(userID, expireTime)
+	registered.Audience = jwt.ClaimStrings{m.cfg.JWT.Audience + wopiAudienceSuffix}
+
+	claims := &WOPIClaims{
+		UserID:           userID,
+		FileID:           fileID,
+		RegisteredClaims: registered,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(m.cfg.JWT.Secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expireTime, nil
+}
+
+// ParseWOPIToken 解析WOPI令牌，并校验令牌签发给fileID
+func (m *AuthMiddleware) ParseWOPIToken(tokenString string, fileID uuid.UUID) (*WOPIClaims, error) {
+	claims := &WOPIClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(m.cfg.JWT.Secret), nil
+	}, jwt.WithIssuer(m.cfg.JWT.Issuer), jwt.WithAudience(m.cfg.JWT.Audience+wopiAudienceSuffix))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if claims.FileID != fileID {
+		return nil, fmt.Errorf("token was not issued for this file")
+	}
+
+	if m.isUserRevoked(claims.UserID, claims.IssuedAt) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import "github.com/google/uuid"
+
+// AccountErasureRequest 用户自助注销并清除数据的请求
+type AccountErasureRequest struct {
+	Password string `json:"password" binding:"required"`
+	Confirm  bool   `json:"confirm"` // 必须为true才会真正删除，否则仅返回预演报告
+}
+
+// AccountErasureReport 账户数据清除报告（预演时为将要删除的数据）
+type AccountErasureReport struct {
+	UserID                uuid.UUID `json:"user_id"`
+	Username              string    `json:"username"`
+	DryRun                bool      `json:"dry_run"`
+	Files                 int       `json:"files"`
+	Directories           int       `json:"directories"`
+	Versions              int       `json:"versions"`
+	Shares                int       `json:"shares"`
+	Exports               int       `json:"exports"`
+	UploadSessions        int       `json:"upload_sessions"` // 分片上传会话，未完成的上传会先中止
+	Webhooks              int       `json:"webhooks"`
+	WebhookDeliveries     int64     `json:"webhook_deliveries"`
+	OperationLogs         int64     `json:"operation_logs"`  // 匿名化的操作日志数量
+	SecurityAlerts        int64     `json:"security_alerts"` // 匿名化的安全告警数量
+	LoginAttempts         int64     `json:"login_attempts"`
+	StorageFreed          int64     `json:"storage_freed"`
+	SpaceFilesTransferred int       `json:"space_files_transferred"` // 转交给空间其他成员、保留在空间中的文件和目录数量
+	BlobErrors            []string  `json:"blob_errors,omitempty"`   // 存储清理失败的键，可由垃圾回收工具后续处理
+}
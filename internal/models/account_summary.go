@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// 配额使用警告级别
+const (
+	QuotaLevelNormal   = "normal"
+	QuotaLevelWarning  = "warning"  // 已用空间达到QUOTA_WARNING_PERCENT
+	QuotaLevelExceeded = "exceeded" // 已用空间达到或超过配额
+)
+
+// QuotaLevel 按已用空间、配额和警告比例返回配额使用警告级别，配额为0时始终为normal
+func QuotaLevel(used, quota, warningPercent int64) string {
+	switch {
+	case quota <= 0:
+		return QuotaLevelNormal
+	case used >= quota:
+		return QuotaLevelExceeded
+	case used >= quota*warningPercent/100:
+		return QuotaLevelWarning
+	}
+	return QuotaLevelNormal
+}
+
+// UsagePercent 返回已用空间占配额的百分比，保留两位小数，配额为0时为0
+func UsagePercent(used, quota int64) float64 {
+	if quota <= 0 {
+		return 0
+	}
+	return math.Round(float64(used)*10000/float64(quota)) / 100
+}
+
+// StorageWarning 已用空间达到警告比例或配额时的提示，在此之后上传仍可进行直到超出配额
+type StorageWarning struct {
+	Level          string  `json:"level"` // warning或exceeded
+	UsagePercent   float64 `json:"usage_percent"`
+	WarningPercent int64   `json:"warning_percent"`
+	Message        string  `json:"message"`
+}
+
+// NewStorageWarning 创建存储警告，未达到警告比例时返回nil
+func NewStorageWarning(used, quota, warningPercent int64) *StorageWarning {
+	level := QuotaLevel(used, quota, warningPercent)
+	if level == QuotaLevelNormal {
+		return nil
+	}
+
+	percent := UsagePercent(used, quota)
+	message := fmt.Sprintf("storage usage is at %.2f%% of the quota", percent)
+	if level == QuotaLevelExceeded {
+		message = "storage quota is full, further uploads will be rejected"
+	}
+	return &StorageWarning{
+		Level:          level,
+		UsagePercent:   percent,
+		WarningPercent: warningPercent,
+		Message:        message,
+	}
+}
+
+// Header 返回X-Storage-Warning响应头的值，如 "warning; usage_percent=92.50"
+func (w *StorageWarning) Header() string {
+	return fmt.Sprintf("%s; usage_percent=%.2f", w.Level, w.UsagePercent)
+}
+
+// AccountSummary 用户账户概览：配额、用量、文件和分享统计及各项限制
+type AccountSummary struct {
+	Username     string          `json:"username"`
+	Role         string          `json:"role"`
+	Quota        int64           `json:"quota"`
+	Used         int64           `json:"used"`
+	Available    int64           `json:"available"`
+	UsagePercent float64         `json:"usage_percent"` // 保留两位小数，配额为0时为0
+	WarningLevel string          `json:"warning_level"`
+	Files        FileStats       `json:"files"`
+	Shares       ShareStats      `json:"shares"`
+	Limits       AccountLimits   `json:"limits"`
+	UploadTemp   UploadTempUsage `json:"upload_temp"` // 进行中的分片上传占用的临时空间及上限
+}
+
+// AccountLimits 账户适用的限制（0表示不限制）
+type AccountLimits struct {
+	MaxUploadSize       int64 `json:"max_upload_size"`
+	MaxSharesPerUser    int   `json:"max_shares_per_user"`
+	MaxSharesPerFile    int   `json:"max_shares_per_file"`
+	QuotaWarningPercent int64 `json:"quota_warning_percent"`
+}
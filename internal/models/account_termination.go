@@ -0,0 +1,20 @@
+package models
+
+import "github.com/google/uuid"
+
+// UserTerminateRequest 管理员紧急终止用户的请求
+type UserTerminateRequest struct {
+	DisableShares bool   `json:"disable_shares"` // 同时停用用户的所有分享
+	Reason        string `json:"reason" binding:"max=500"`
+}
+
+// UserTerminationReport 终止用户的结果
+type UserTerminationReport struct {
+	UserID         uuid.UUID `json:"user_id"`
+	Username       string    `json:"username"`
+	TokensRevoked  bool      `json:"tokens_revoked"`  // 已撤销此前签发的全部令牌
+	UploadsAborted int       `json:"uploads_aborted"` // 中止的进行中上传数
+	Deactivated    bool      `json:"deactivated"`
+	SharesDisabled int64     `json:"shares_disabled"`
+	AlertID        uuid.UUID `json:"alert_id"` // 记录本次操作的安全警报
+}
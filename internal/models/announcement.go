@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AnnouncementLevel 公告级别
+type AnnouncementLevel string
+
+const (
+	AnnouncementInfo     AnnouncementLevel = "info"
+	AnnouncementWarning  AnnouncementLevel = "warning"
+	AnnouncementCritical AnnouncementLevel = "critical"
+)
+
+// Announcement 管理员发布的系统公告（维护通知、政策变更等）
+type Announcement struct {
+	ID         uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Title      string            `gorm:"type:varchar(200);not null" json:"title"`
+	Content    string            `gorm:"type:text;not null" json:"content"`
+	Level      AnnouncementLevel `gorm:"type:varchar(20);not null;default:'info'" json:"level"`
+	TargetRole *UserRole         `gorm:"type:varchar(20);index" json:"target_role,omitempty"` // 为空时面向所有用户
+	StartsAt   time.Time         `gorm:"not null;index" json:"starts_at"`
+	EndsAt     *time.Time        `gorm:"index" json:"ends_at,omitempty"` // 为空时一直有效
+	CreatedBy  uuid.UUID         `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt  time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Announcement) TableName() string {
+	return "announcements"
+}
+
+// BeforeCreate 创建前的钩子
+func (a *Announcement) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive 检查公告在指定时间是否处于展示期内
+func (a *Announcement) IsActive(now time.Time) bool {
+	return !a.StartsAt.After(now) && (a.EndsAt == nil || a.EndsAt.After(now))
+}
+
+// AnnouncementDismissal 用户已关闭的公告
+type AnnouncementDismissal struct {
+	AnnouncementID uuid.UUID `gorm:"type:uuid;primary_key" json:"announcement_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;primary_key;index" json:"user_id"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AnnouncementDismissal) TableName() string {
+	return "announcement_dismissals"
+}
+
+// AnnouncementCreateRequest 公告创建请求
+type AnnouncementCreateRequest struct {
+	Title      string            `json:"title" binding:"required,max=200"`
+	Content    string            `json:"content" binding:"required"`
+	Level      AnnouncementLevel `json:"level" binding:"omitempty,oneof=info warning critical"`
+	TargetRole *UserRole         `json:"target_role" binding:"omitempty,oneof=admin user"`
+	StartsAt   *time.Time        `json:"starts_at"` // 为空时立即生效
+	EndsAt     *time.Time        `json:"ends_at"`
+}
+
+// AnnouncementUpdateRequest 公告更新请求
+type AnnouncementUpdateRequest struct {
+	Title      *string            `json:"title" binding:"omitempty,max=200"`
+	Content    *string            `json:"content"`
+	Level      *AnnouncementLevel `json:"level" binding:"omitempty,oneof=info warning critical"`
+	TargetRole *UserRole          `json:"target_role" binding:"omitempty,oneof=admin user all"` // all表示面向所有用户
+	StartsAt   *time.Time         `json:"starts_at"`
+	EndsAt     *time.Time         `json:"ends_at"`
+}
+
+// AnnouncementResponse 公告响应
+type AnnouncementResponse struct {
+	ID         uuid.UUID         `json:"id"`
+	Title      string            `json:"title"`
+	Content    string            `json:"content"`
+	Level      AnnouncementLevel `json:"level"`
+	TargetRole *UserRole         `json:"target_role,omitempty"`
+	StartsAt   time.Time         `json:"starts_at"`
+	EndsAt     *time.Time        `json:"ends_at,omitempty"`
+	Active     bool              `json:"active"`
+	Dismissed  bool              `json:"dismissed"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// ToResponse 转换为响应格式
+func (a *Announcement) ToResponse() AnnouncementResponse {
+	return AnnouncementResponse{
+		ID:         a.ID,
+		Title:      a.Title,
+		Content:    a.Content,
+		Level:      a.Level,
+		TargetRole: a.TargetRole,
+		StartsAt:   a.StartsAt,
+		EndsAt:     a.EndsAt,
+		Active:     a.IsActive(time.Now()),
+		CreatedAt:  a.CreatedAt,
+	}
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// auditTimeLayout 参与哈希计算的时间格式（数据库时间精度为微秒）
+const auditTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// Seal 为操作日志分配哈希链序号并计算哈希，prevHash为链上前一条日志的哈希（首条为空）
+func (ol *OperationLog) Seal(seq int64, prevHash string) {
+	if ol.ID == uuid.Nil {
+		ol.ID = uuid.New()
+	}
+	// 统一为UTC并截断到微秒，保证写入数据库后读回的时间与计算哈希时一致
+	ol.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	ol.Seq = &seq
+	ol.PrevHash = prevHash
+	ol.SubjectDigest = ol.ComputeSubjectDigest()
+	ol.Hash = ol.ComputeHash()
+}
+
+// ComputeSubjectDigest 计算用户ID、IP、User-Agent和详情的摘要
+func (ol *OperationLog) ComputeSubjectDigest() string {
+	var userID string
+	if ol.UserID != nil {
+		userID = ol.UserID.String()
+	}
+	return hashFields(userID, ol.IPAddress, ol.UserAgent, ol.Details)
+}
+
+// ComputeHash 计算日志的链式哈希，用户身份相关字段通过SubjectDigest参与计算
+func (ol *OperationLog) ComputeHash() string {
+	var seq, resourceID string
+	if ol.Seq != nil {
+		seq = strconv.FormatInt(*ol.Seq, 10)
+	}
+	if ol.ResourceID != nil {
+		resourceID = *ol.ResourceID
+	}
+	return hashFields(
+		seq,
+		ol.PrevHash,
+		ol.ID.String(),
+		string(ol.Operation),
+		string(ol.ResourceType),
+		resourceID,
+		string(ol.Result),
+		ol.Error,
+		strconv.FormatInt(ol.Duration, 10),
+		ol.CreatedAt.UTC().Format(auditTimeLayout),
+		ol.SubjectDigest,
+	)
+}
+
+// IsAnonymized 日志是否已在账户删除时被匿名化
+func (ol *OperationLog) IsAnonymized() bool {
+	return ol.UserID == nil && ol.IPAddress == "" && ol.UserAgent == "" && ol.Details == ""
+}
+
+// hashFields 计算各字段按长度前缀拼接后的SHA-256
+func hashFields(fields ...string) string {
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(strconv.Itoa(len(field)))
+		b.WriteByte(':')
+		b.WriteString(field)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainIssue 哈希链校验发现的问题
+type AuditChainIssue struct {
+	Seq    int64     `json:"seq"`
+	LogID  uuid.UUID `json:"log_id"`
+	Reason string    `json:"reason"`
+}
+
+// AuditChainReport 哈希链校验报告
+type AuditChainReport struct {
+	ComplianceMode bool              `json:"compliance_mode"`
+	HashChain      bool              `json:"hash_chain"`
+	Valid          bool              `json:"valid"`
+	Checked        int64             `json:"checked"`
+	Anonymized     int64             `json:"anonymized"` // 已匿名化、仅校验摘要的日志数
+	Unchained      int64             `json:"unchained"`  // 启用哈希链之前写入的日志数
+	LastSeq        int64             `json:"last_seq"`
+	LastHash       string            `json:"last_hash,omitempty"` // 可记录在外部用于检测末尾日志被删除
+	Issues         []AuditChainIssue `json:"issues"`
+	IssuesOmitted  int64             `json:"issues_omitted,omitempty"`
+	VerifiedAt     time.Time         `json:"verified_at"`
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExportStatus 数据导出任务状态
+type ExportStatus string
+
+const (
+	ExportStatusPending    ExportStatus = "pending"
+	ExportStatusProcessing ExportStatus = "processing"
+	ExportStatusCompleted  ExportStatus = "completed"
+	ExportStatusFailed     ExportStatus = "failed"
+)
+
+// DataExport 用户数据导出任务模型
+type DataExport struct {
+	ID            uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID    `gorm:"type:uuid;not null;index" json:"user_id"`
+	Status        ExportStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	StorageKey    string       `gorm:"type:text" json:"-"`
+	FileSize      int64        `gorm:"default:0" json:"file_size"`
+	DownloadToken *string      `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	ErrorMessage  string       `gorm:"type:text" json:"error_message,omitempty"`
+	JobID         *uuid.UUID   `gorm:"type:uuid" json:"job_id,omitempty"` // 生成导出包的后台任务
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+	CompletedAt   *time.Time   `json:"completed_at,omitempty"`
+	CreatedAt     time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关联关系
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (DataExport) TableName() string {
+	return "data_exports"
+}
+
+// BeforeCreate 创建前的钩子
+func (e *DataExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsActive 检查导出任务是否仍在进行中
+func (e *DataExport) IsActive() bool {
+	return e.Status == ExportStatusPending || e.Status == ExportStatusProcessing
+}
+
+// IsExpired 检查导出文件的下载链接是否已过期
+func (e *DataExport) IsExpired() bool {
+	return e.ExpiresAt != nil && time.Now().After(*e.ExpiresAt)
+}
+
+// DataExportResponse 数据导出任务响应
+type DataExportResponse struct {
+	ID           uuid.UUID    `json:"id"`
+	Status       ExportStatus `json:"status"`
+	FileSize     int64        `json:"file_size"`
+	ErrorMessage string       `json:"error_message,omitempty"`
+	JobID        *uuid.UUID   `json:"job_id,omitempty"`
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+	CompletedAt  *time.Time   `json:"completed_at,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// ToResponse 转换为响应格式
+func (e *DataExport) ToResponse() DataExportResponse {
+	return DataExportResponse{
+		ID:           e.ID,
+		Status:       e.Status,
+		FileSize:     e.FileSize,
+		ErrorMessage: e.ErrorMessage,
+		JobID:        e.JobID,
+		ExpiresAt:    e.ExpiresAt,
+		CompletedAt:  e.CompletedAt,
+		CreatedAt:    e.CreatedAt,
+	}
+}
+
+// DataExportManifest 导出包中的元数据清单
+type DataExportManifest struct {
+	ExportedAt    time.Time              `json:"exported_at"`
+	User          UserResponse           `json:"user"`
+	Files         []FileResponse         `json:"files"`
+	Shares        []ShareResponse        `json:"shares"`
+	OperationLogs []OperationLogResponse `json:"operation_logs"`
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -19,21 +20,30 @@ const (
 
 // File 文件模型
 type File struct {
-	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
-	ParentID   *uuid.UUID     `gorm:"type:uuid;index" json:"parent_id,omitempty"`
-	Name       string         `gorm:"type:varchar(255);not null" json:"name"`
-	Path       string         `gorm:"type:text;not null;index" json:"path"`
-	Size       int64          `gorm:"default:0" json:"size"`
-	MimeType   string         `gorm:"type:varchar(100)" json:"mime_type"`
-	Hash       string         `gorm:"type:varchar(64);index" json:"hash,omitempty"`
-	Type       FileType       `gorm:"type:varchar(20);not null" json:"type"`
-	IsPublic   bool           `gorm:"default:false" json:"is_public"`
-	ShareToken *string        `gorm:"type:varchar(32);uniqueIndex" json:"share_token,omitempty"`
-	Version    int            `gorm:"default:1" json:"version"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	CreatedAt  time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt  time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	ID           uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	ParentID     *uuid.UUID     `gorm:"type:uuid;index" json:"parent_id,omitempty"`
+	SpaceID      *uuid.UUID     `gorm:"type:uuid;index" json:"space_id,omitempty"` // 所属团队空间，为空时为个人文件
+	Name         string         `gorm:"type:varchar(255);not null" json:"name"`
+	Path         string         `gorm:"type:text;not null;index" json:"path"`
+	Size         int64          `gorm:"default:0" json:"size"`
+	MimeType     string         `gorm:"type:varchar(100)" json:"mime_type"`               // 客户端声明的类型，仅用于展示
+	DetectedMime string         `gorm:"type:varchar(100)" json:"detected_mime,omitempty"` // 按内容嗅探出的类型，用于预览和内联展示
+	Hash         string         `gorm:"type:varchar(64);index" json:"hash,omitempty"`
+	Type         FileType       `gorm:"type:varchar(20);not null" json:"type"`
+	IsPublic     bool           `gorm:"default:false" json:"is_public"`
+	ShareToken   *string        `gorm:"type:varchar(32);uniqueIndex" json:"share_token,omitempty"`
+	Version      int            `gorm:"default:1" json:"version"`
+	LockVersion  int64          `gorm:"not null;default:1" json:"lock_version"` // 乐观锁版本，每次更新递增
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 覆盖内容时是否保留旧版本，关闭后原地覆盖，不创建版本记录也不保留旧内容
+	VersioningEnabled bool `gorm:"not null;default:true" json:"versioning_enabled"`
+
+	// 去重保存时当前内容所在的共享存储键，为空时内容位于由所有者和路径生成的存储键
+	BlobKey string `gorm:"type:varchar(512);index" json:"-"`
 
 	// 关联关系
 	User     User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -62,52 +72,38 @@ func (f *File) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// BeforeUpdate 更新前的钩子
-func (f *File) BeforeUpdate(tx *gorm.DB) error {
-	// 如果父目录或名称改变，重新构建路径
-	if tx.Statement.Changed("ParentID") || tx.Statement.Changed("Name") {
-		f.Path = f.BuildPath()
-	}
-	return nil
-}
-
-// BuildPath 构建文件路径
+// BuildPath 按预加载的父目录构建文件路径，未预加载父目录时只返回名称
+// 服务层创建文件时按父目录的路径显式设置Path，移动和重命名时同时更新Path和存储内容
 func (f *File) BuildPath() string {
-	if f.ParentID == nil {
+	if f.Parent == nil || f.Parent.Path == "" {
 		return f.Name
 	}
-
-	// 查询父目录路径
-	var parentPath string
-	if f.Parent != nil && f.Parent.Path != "" {
-		parentPath = f.Parent.Path
-	} else {
-		// 注意：这里简化处理，实际实现中可能需要数据库连接
-		// 在GORM的钩子中，可以通过tx参数访问数据库
-		// 这里返回相对路径，由上层处理完整路径
-		parentPath = ""
-	}
-
-	if parentPath == "" {
-		return f.Name
-	}
-
-	return filepath.Join(parentPath, f.Name)
+	return filepath.Join(f.Parent.Path, f.Name)
 }
 
 // FileCreateRequest 文件创建请求
 type FileCreateRequest struct {
 	Name     string     `json:"name" binding:"required"`
 	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+	SpaceID  *uuid.UUID `json:"space_id,omitempty"` // 在空间根目录下创建时指定
 	Type     FileType   `json:"type" binding:"required,oneof=file directory"`
 	IsPublic bool       `json:"is_public,omitempty"`
 }
 
 // FileUpdateRequest 文件更新请求
 type FileUpdateRequest struct {
-	Name     *string    `json:"name"`
-	ParentID *uuid.UUID `json:"parent_id"`
-	IsPublic *bool      `json:"is_public"`
+	Name        *string    `json:"name"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	IsPublic    *bool      `json:"is_public"`
+	LockVersion *int64     `json:"lock_version"` // 客户端读取到的lock_version，不一致时返回409
+
+	VersioningEnabled *bool `json:"versioning_enabled"`
+}
+
+// FileRenameRequest 重命名请求
+type FileRenameRequest struct {
+	Name        string `json:"name" binding:"required"`
+	LockVersion *int64 `json:"lock_version"` // 客户端读取到的lock_version，不一致时返回409
 }
 
 // FileUploadRequest 文件上传请求
@@ -116,46 +112,98 @@ type FileUploadRequest struct {
 	IsPublic    bool       `form:"is_public"`
 	Override    bool       `form:"override"`
 	ParentIDStr string     `form:"parent_id"`
+	SpaceID     *uuid.UUID `form:"-"`
+	SpaceIDStr  string     `form:"space_id"`                       // 上传到空间根目录时指定
+	FileHash    string     `form:"file_hash"`                      // 可选，格式为 sha256:<hex> 或 md5:<hex>
+	Dedup       bool       `form:"dedup"`                          // 内容与自己已去重保存的文件相同时共享存储，不匹配未去重保存的文件
+	AutoOrient  *bool      `form:"auto_orient"`                    // 可选，覆盖 IMAGE_AUTO_ORIENT
+	StripExif   *bool      `form:"strip_exif"`                     // 可选，覆盖 IMAGE_STRIP_EXIF
+	ChangeNote  string     `form:"change_note" binding:"max=1000"` // 可选，记录在创建的版本上
+}
+
+// FileContentUpdateRequest 替换文件内容请求，文件内容通过multipart的file字段上传
+type FileContentUpdateRequest struct {
+	ChangeNote  string `form:"change_note" binding:"max=1000"`
+	FileHash    string `form:"file_hash"`    // 可选，格式同上传
+	LockVersion *int64 `form:"lock_version"` // 客户端读取到的lock_version，不一致时返回409
 }
 
 // FileResponse 文件响应
 type FileResponse struct {
-	ID         uuid.UUID  `json:"id"`
-	Name       string     `json:"name"`
-	Path       string     `json:"path"`
-	Size       int64      `json:"size"`
-	MimeType   string     `json:"mime_type"`
-	Type       FileType   `json:"type"`
-	IsPublic   bool       `json:"is_public"`
-	ShareToken *string    `json:"share_token,omitempty"`
-	Version    int        `json:"version"`
-	UserID     uuid.UUID  `json:"user_id"`
-	ParentID   *uuid.UUID `json:"parent_id,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	ID           uuid.UUID  `json:"id"`
+	Name         string     `json:"name"`
+	Path         string     `json:"path"`
+	Size         int64      `json:"size"`
+	MimeType     string     `json:"mime_type"`
+	DetectedMime string     `json:"detected_mime,omitempty"`
+	Type         FileType   `json:"type"`
+	IsPublic     bool       `json:"is_public"`
+	ShareToken   *string    `json:"share_token,omitempty"`
+	Version      int        `json:"version"`
+	LockVersion  int64      `json:"lock_version"`
+	UserID       uuid.UUID  `json:"user_id"`
+	ParentID     *uuid.UUID `json:"parent_id,omitempty"`
+	SpaceID      *uuid.UUID `json:"space_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	VersioningEnabled bool `json:"versioning_enabled"`
 
 	// 可选的关联数据
-	ChildrenCount int64  `json:"children_count,omitempty"`
-	DownloadURL   string `json:"download_url,omitempty"`
-	PreviewURL    string `json:"preview_url,omitempty"`
+	ChildrenCount int64            `json:"children_count,omitempty"`
+	DownloadURL   string           `json:"download_url,omitempty"`
+	PreviewURL    string           `json:"preview_url,omitempty"`
+	Ancestors     []FileBreadcrumb `json:"ancestors,omitempty"` // 路径搜索结果从根目录开始的上级目录
+}
+
+// FileBreadcrumb 面包屑中的目录
+type FileBreadcrumb struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// NewBreadcrumbs 按从根到父目录的顺序转换为面包屑
+func NewBreadcrumbs(dirs []File) []FileBreadcrumb {
+	breadcrumbs := make([]FileBreadcrumb, 0, len(dirs))
+	for _, dir := range dirs {
+		breadcrumbs = append(breadcrumbs, FileBreadcrumb{ID: dir.ID, Name: dir.Name})
+	}
+	return breadcrumbs
+}
+
+// FileTreeNodeResponse 文件树节点
+type FileTreeNodeResponse struct {
+	FileResponse
+	Children []*FileTreeNodeResponse `json:"children,omitempty"`
+}
+
+// FileSearchHit 搜索结果，路径搜索时附带从根目录开始的上级目录
+type FileSearchHit struct {
+	File      File
+	Ancestors []File
 }
 
 // ToResponse 转换为响应格式
 func (f *File) ToResponse() FileResponse {
 	return FileResponse{
-		ID:         f.ID,
-		Name:       f.Name,
-		Path:       f.Path,
-		Size:       f.Size,
-		MimeType:   f.MimeType,
-		Type:       f.Type,
-		IsPublic:   f.IsPublic,
-		ShareToken: f.ShareToken,
-		Version:    f.Version,
-		UserID:     f.UserID,
-		ParentID:   f.ParentID,
-		CreatedAt:  f.CreatedAt,
-		UpdatedAt:  f.UpdatedAt,
+		ID:           f.ID,
+		Name:         f.Name,
+		Path:         f.Path,
+		Size:         f.Size,
+		MimeType:     f.MimeType,
+		DetectedMime: f.DetectedMime,
+		Type:         f.Type,
+		IsPublic:     f.IsPublic,
+		ShareToken:   f.ShareToken,
+		Version:      f.Version,
+		LockVersion:  f.LockVersion,
+		UserID:       f.UserID,
+		ParentID:     f.ParentID,
+		SpaceID:      f.SpaceID,
+		CreatedAt:    f.CreatedAt,
+		UpdatedAt:    f.UpdatedAt,
+
+		VersioningEnabled: f.VersioningEnabled,
 	}
 }
 
@@ -169,6 +217,27 @@ func (f *File) IsFile() bool {
 	return f.Type == FileTypeFile
 }
 
+// PreviewMimeType 预览和内联展示使用的类型
+// 严格模式只信任内容嗅探结果，尚未嗅探的文件视为未知类型；
+// 宽松模式在嗅探结果不确定（通用二进制或纯文本）或尚未嗅探时使用客户端声明的类型
+func (f *File) PreviewMimeType(strict bool) string {
+	const unknown = "application/octet-stream"
+	if strict {
+		if f.DetectedMime == "" {
+			return unknown
+		}
+		return f.DetectedMime
+	}
+
+	if f.MimeType != "" && (f.DetectedMime == "" || f.DetectedMime == unknown || f.DetectedMime == "text/plain") {
+		return f.MimeType
+	}
+	if f.DetectedMime == "" {
+		return unknown
+	}
+	return f.DetectedMime
+}
+
 // GetExtension 获取文件扩展名
 func (f *File) GetExtension() string {
 	if f.IsDirectory() {
@@ -179,6 +248,9 @@ func (f *File) GetExtension() string {
 
 // GetFullPath 获取完整存储路径
 func (f *File) GetFullPath(storagePath string) string {
+	if f.SpaceID != nil {
+		return filepath.Join(storagePath, "spaces", f.SpaceID.String(), f.Path)
+	}
 	return filepath.Join(storagePath, f.UserID.String(), f.Path)
 }
 
@@ -186,17 +258,24 @@ func (f *File) GetFullPath(storagePath string) string {
 type FileFilter struct {
 	UserID        *uuid.UUID `form:"-"`
 	ParentID      *uuid.UUID `form:"-"`
+	SpaceID       *uuid.UUID `form:"-"`
+	PersonalOnly  bool       `form:"-"` // 为true且未指定空间时排除空间文件
 	UserIDStr     string     `form:"user_id"`
 	ParentIDStr   string     `form:"parent_id"`
+	SpaceIDStr    string     `form:"space_id"`
 	Name          *string    `form:"name"`
+	PathPattern   *string    `form:"-"` // 路径的ILIKE模式
 	Type          *FileType  `form:"type"`
 	MimeType      *string    `form:"mime_type"`
+	MimeCategory  *string    `form:"category"`
+	Content       *string    `form:"-"` // 在提取的文本中全文搜索
+	Recursive     bool       `form:"-"` // 为true时不限制父目录，跨所有目录查询
 	IsPublic      *bool      `form:"is_public"`
 	Deleted       *bool      `form:"deleted"`
 	CreatedAtFrom *time.Time `form:"created_at_from"`
 	CreatedAtTo   *time.Time `form:"created_at_to"`
 	Page          int        `form:"page" binding:"omitempty,min=1"`
-	PageSize      int        `form:"page_size" binding:"omitempty,min=1,max=100"`
+	PageSize      int        `form:"page_size" binding:"omitempty,min=1"`
 	SortBy        string     `form:"sort_by" binding:"oneof=name size created_at updated_at"`
 	SortOrder     string     `form:"sort_order" binding:"oneof=asc desc"`
 }
@@ -209,9 +288,15 @@ func (f *FileFilter) ApplyFilter(db *gorm.DB) *gorm.DB {
 		query = query.Where("user_id = ?", *f.UserID)
 	}
 
+	if f.SpaceID != nil {
+		query = query.Where("space_id = ?", *f.SpaceID)
+	} else if f.PersonalOnly {
+		query = query.Where("space_id IS NULL")
+	}
+
 	if f.ParentID != nil {
 		query = query.Where("parent_id = ?", *f.ParentID)
-	} else if f.ParentID == nil && f.Deleted != nil && !*f.Deleted {
+	} else if f.ParentID == nil && !f.Recursive && f.Deleted != nil && !*f.Deleted {
 		// 默认只显示根目录文件（未删除的）
 		query = query.Where("parent_id IS NULL")
 	}
@@ -220,14 +305,27 @@ func (f *FileFilter) ApplyFilter(db *gorm.DB) *gorm.DB {
 		query = query.Where("name ILIKE ?", "%"+*f.Name+"%")
 	}
 
+	if f.PathPattern != nil && *f.PathPattern != "" {
+		query = query.Where("path ILIKE ?", *f.PathPattern)
+	}
+
 	if f.Type != nil {
 		query = query.Where("type = ?", *f.Type)
 	}
 
+	if f.Content != nil && *f.Content != "" {
+		query = query.Where("id IN (SELECT file_id FROM file_texts WHERE to_tsvector('simple', content) @@ plainto_tsquery('simple', ?))", *f.Content)
+	}
+
 	if f.MimeType != nil && *f.MimeType != "" {
 		query = query.Where("mime_type ILIKE ?", "%"+*f.MimeType+"%")
 	}
 
+	if f.MimeCategory != nil && *f.MimeCategory != "" {
+		condition, args := MimeCategoryCondition(*f.MimeCategory)
+		query = query.Where(condition, args...)
+	}
+
 	if f.IsPublic != nil {
 		query = query.Where("is_public = ?", *f.IsPublic)
 	}
@@ -262,6 +360,78 @@ func (f *FileFilter) ApplyFilter(db *gorm.DB) *gorm.DB {
 	return query
 }
 
+// MimeCategories MIME分类与匹配模式（ILIKE）的映射
+var MimeCategories = map[string][]string{
+	"image":    {"image/%"},
+	"video":    {"video/%"},
+	"audio":    {"audio/%"},
+	"text":     {"text/%"},
+	"document": {"application/pdf", "application/msword", "application/vnd.%", "text/plain", "text/markdown"},
+	"archive":  {"application/zip", "application/x-tar", "application/gzip", "application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2", "application/x-xz"},
+}
+
+// IsValidMimeCategory 检查MIME分类是否受支持
+func IsValidMimeCategory(category string) bool {
+	_, ok := MimeCategories[category]
+	return ok
+}
+
+// MimeCategoryCondition 返回匹配MIME分类的SQL条件，未知分类不匹配任何文件
+func MimeCategoryCondition(category string) (string, []interface{}) {
+	patterns := MimeCategories[category]
+	if len(patterns) == 0 {
+		return "1 = 0", nil
+	}
+
+	conditions := make([]string, len(patterns))
+	args := make([]interface{}, len(patterns))
+	for i, pattern := range patterns {
+		conditions[i] = "mime_type ILIKE ?"
+		args[i] = pattern
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// MimeCategoriesOf 返回MIME类型所属的全部分类（与按分类查询的ILIKE匹配规则一致，可能属于多个分类）
+func MimeCategoriesOf(mimeType string) []string {
+	mimeType = strings.ToLower(mimeType)
+
+	var categories []string
+	for category, patterns := range MimeCategories {
+		for _, pattern := range patterns {
+			if matchLikePattern(strings.ToLower(pattern), mimeType) {
+				categories = append(categories, category)
+				break
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// matchLikePattern 按SQL LIKE规则匹配，仅支持通配符%
+func matchLikePattern(pattern, value string) bool {
+	parts := strings.Split(pattern, "%")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, last)
+}
+
 // FileStats 文件统计信息
 type FileStats struct {
 	TotalFiles  int64 `json:"total_files"`
@@ -269,11 +439,35 @@ type FileStats struct {
 	TotalSize   int64 `json:"total_size"`
 	PublicFiles int64 `json:"public_files"`
 	RecentFiles int64 `json:"recent_files"` // 最近7天
+
+	// 按分类（图片、视频、文档、其他）的文件数和大小，仅文件统计接口返回
+	ByCategory map[string]CategoryStats `json:"by_category,omitempty"`
+}
+
+// FileStatsCategoryOther 不属于任何统计分类的文件
+const FileStatsCategoryOther = "other"
+
+// FileStatsCategories 文件统计按顺序归类使用的MIME分类，一个文件只计入第一个匹配的分类
+var FileStatsCategories = []string{"image", "video", "document"}
+
+// CategoryStats 某一分类的文件统计
+type CategoryStats struct {
+	Count int64 `json:"count"`
+	Size  int64 `json:"size"`
 }
 
-// FileMoveRequest 文件移动请求
+// FileMoveRequest 文件移动请求，target_parent_id为空且to_root为true时移动到根目录
 type FileMoveRequest struct {
-	TargetParentID *uuid.UUID `json:"target_parent_id" binding:"required"`
+	TargetParentID *uuid.UUID `json:"target_parent_id"`
+	ToRoot         bool       `json:"to_root"`
+	LockVersion    *int64     `json:"lock_version"` // 客户端读取到的lock_version，不一致时返回409
+}
+
+// FileBatchMoveRequest 批量移动请求，所有文件移动到同一目标目录，或各自所在空间（个人文件为个人）的根目录
+type FileBatchMoveRequest struct {
+	FileIDs        []uuid.UUID `json:"file_ids" binding:"required,min=1,max=1000"`
+	TargetParentID *uuid.UUID  `json:"target_parent_id"`
+	ToRoot         bool        `json:"to_root"`
 }
 
 // FileCopyRequest 文件复制请求
@@ -282,10 +476,102 @@ type FileCopyRequest struct {
 	NewName        *string    `json:"new_name"`
 }
 
+// FileBatchDeleteRequest 批量删除请求
+type FileBatchDeleteRequest struct {
+	FileIDs   []uuid.UUID `json:"file_ids" binding:"required,min=1,max=1000"`
+	Permanent bool        `json:"permanent"` // 永久删除，默认移入回收站
+}
+
+// FileBatchItemResult 批量操作中单个文件的结果
+type FileBatchItemResult struct {
+	FileID  uuid.UUID `json:"file_id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// FileBatchResult 批量操作结果，Results与请求中的文件ID顺序一致（重复的ID只处理一次）
+type FileBatchResult struct {
+	Results   []FileBatchItemResult `json:"results"`
+	Succeeded int                   `json:"succeeded"`
+	Failed    int                   `json:"failed"`
+}
+
+// Record 记录单个文件的处理结果，err为nil表示成功
+func (r *FileBatchResult) Record(fileID uuid.UUID, err error) {
+	item := FileBatchItemResult{FileID: fileID, Success: err == nil}
+	if err != nil {
+		item.Error = err.Error()
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Results = append(r.Results, item)
+}
+
+// DuplicateGroup 内容相同（SHA-256一致）的一组文件，Files按创建时间从早到晚排列
+type DuplicateGroup struct {
+	Hash        string         `json:"hash"`
+	Size        int64          `json:"size"`
+	Files       []FileResponse `json:"files"`
+	Reclaimable int64          `json:"reclaimable"` // 只保留一份时可释放的空间
+}
+
+// DuplicateReport 用户的重复文件报告
+type DuplicateReport struct {
+	Groups           []DuplicateGroup `json:"groups"`
+	DuplicateFiles   int              `json:"duplicate_files"` // 可删除的多余副本数
+	TotalReclaimable int64            `json:"total_reclaimable"`
+}
+
+// DuplicateDedupRequest 去重请求，每组保留一份，其余副本删除
+type DuplicateDedupRequest struct {
+	Hashes    []string    `json:"hashes" binding:"max=1000"` // 只处理这些重复组，为空时处理全部
+	KeepIDs   []uuid.UUID `json:"keep_ids"`                  // 各组中要保留的文件，未指定的组保留最早创建的文件
+	Permanent bool        `json:"permanent"`                 // 永久删除多余副本，默认移入回收站
+}
+
+// DuplicateDedupResult 去重结果
+type DuplicateDedupResult struct {
+	Groups    int         `json:"groups"`
+	Removed   []uuid.UUID `json:"removed"`
+	Failed    []uuid.UUID `json:"failed,omitempty"`
+	Reclaimed int64       `json:"reclaimed"` // 移入回收站时在回收站清理后才实际释放
+	Permanent bool        `json:"permanent"`
+}
+
+// MimeBackfillResult 补充嗅探MIME类型的结果
+type MimeBackfillResult struct {
+	Detected   int         `json:"detected"`
+	Mismatched int         `json:"mismatched"` // 嗅探结果与客户端声明的类型不一致的文件数
+	Failed     []uuid.UUID `json:"failed,omitempty"`
+}
+
+// HashBackfillResult 补充文件哈希的结果
+type HashBackfillResult struct {
+	Computed int         `json:"computed"`
+	Failed   []uuid.UUID `json:"failed,omitempty"`
+}
+
+// StorageRecalculation 重新计算用户已用空间的结果
+type StorageRecalculation struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Username   string    `json:"username"`
+	OldUsed    int64     `json:"old_used"`
+	NewUsed    int64     `json:"new_used"`
+	Difference int64     `json:"difference"` // NewUsed - OldUsed
+}
+
+// StorageRecalculationSummary 重新计算所有用户已用空间的结果，Corrected只包含数值有变化的用户
+type StorageRecalculationSummary struct {
+	Checked   int                    `json:"checked"`
+	Corrected []StorageRecalculation `json:"corrected,omitempty"`
+	Failed    []uuid.UUID            `json:"failed,omitempty"`
+}
+
 // FileSearchRequest 文件搜索请求
 type FileSearchRequest struct {
 	Query    string `form:"q" binding:"required"`
 	SearchIn string `form:"search_in" binding:"oneof=name path content"`
 	Page     int    `form:"page" binding:"min=1"`
-	PageSize int    `form:"page_size" binding:"min=1,max=100"`
+	PageSize int    `form:"page_size" binding:"omitempty,min=1"`
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FileMoveHistory 文件移动记录，用于撤销误操作的移动
+type FileMoveHistory struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	FileID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"file_id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"` // 执行移动的用户
+	FromParentID *uuid.UUID `gorm:"type:uuid" json:"from_parent_id,omitempty"`
+	ToParentID   *uuid.UUID `gorm:"type:uuid" json:"to_parent_id,omitempty"`
+	UndoneAt     *time.Time `json:"undone_at,omitempty"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+
+	// 关联关系
+	File File `gorm:"foreignKey:FileID" json:"-"`
+}
+
+// TableName 指定表名
+func (FileMoveHistory) TableName() string {
+	return "file_move_history"
+}
+
+// BeforeCreate 创建前的钩子
+func (m *FileMoveHistory) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// FileMoveResponse 文件移动记录响应
+type FileMoveResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	FileID       uuid.UUID  `json:"file_id"`
+	FileName     string     `json:"file_name,omitempty"` // 文件已被永久删除时为空
+	FileType     FileType   `json:"file_type,omitempty"`
+	FromParentID *uuid.UUID `json:"from_parent_id,omitempty"`
+	ToParentID   *uuid.UUID `json:"to_parent_id,omitempty"`
+	UndoneAt     *time.Time `json:"undone_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ToResponse 转换为响应格式，需预加载File
+func (m *FileMoveHistory) ToResponse() FileMoveResponse {
+	return FileMoveResponse{
+		ID:           m.ID,
+		FileID:       m.FileID,
+		FileName:     m.File.Name,
+		FileType:     m.File.Type,
+		FromParentID: m.FromParentID,
+		ToParentID:   m.ToParentID,
+		UndoneAt:     m.UndoneAt,
+		CreatedAt:    m.CreatedAt,
+	}
+}
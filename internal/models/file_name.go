@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// MaxFileNameLength 文件名的最大字符数，与files.name列的长度一致
+const MaxFileNameLength = 255
+
+// reservedFileNames Windows保留的设备名，不区分大小写，带扩展名时同样保留
+var reservedFileNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName 清理客户端提交的文件名：去掉路径部分（"/"和"\"之前的内容）、控制字符和首尾空白，
+// 超过MaxFileNameLength个字符时保留扩展名截断；结果为空、"."、".."或保留的设备名时返回错误
+func SanitizeFileName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name))
+
+	if name == "" || name == "." || name == ".." {
+		return "", errors.New("invalid file name")
+	}
+	if stem, _, _ := strings.Cut(name, "."); reservedFileNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		return "", fmt.Errorf("file name %q is reserved", name)
+	}
+
+	if runes := []rune(name); len(runes) > MaxFileNameLength {
+		ext := []rune(path.Ext(name))
+		if len(ext) >= MaxFileNameLength/2 {
+			ext = nil
+		}
+		name = string(runes[:MaxFileNameLength-len(ext)]) + string(ext)
+	}
+	return name, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FilePermissionLevel 直接授予用户的文件权限
+type FilePermissionLevel string
+
+const (
+	FilePermissionRead  FilePermissionLevel = "read"  // 查看和下载
+	FilePermissionWrite FilePermissionLevel = "write" // 另可重命名
+)
+
+// Allows 检查权限是否包含required，write包含read
+func (p FilePermissionLevel) Allows(required FilePermissionLevel) bool {
+	switch p {
+	case FilePermissionWrite:
+		return required == FilePermissionRead || required == FilePermissionWrite
+	case FilePermissionRead:
+		return required == FilePermissionRead
+	default:
+		return false
+	}
+}
+
+// FilePermission 文件访问控制项，向指定用户授予文件的读写权限
+type FilePermission struct {
+	ID            uuid.UUID           `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	FileID        uuid.UUID           `gorm:"type:uuid;not null;uniqueIndex:idx_file_permissions_file_grantee" json:"file_id"`
+	GranteeUserID uuid.UUID           `gorm:"type:uuid;not null;uniqueIndex:idx_file_permissions_file_grantee;index" json:"grantee_user_id"`
+	Permission    FilePermissionLevel `gorm:"type:varchar(10);not null" json:"permission"`
+	GrantedBy     uuid.UUID           `gorm:"type:uuid;not null" json:"granted_by"`
+	CreatedAt     time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关联关系
+	Grantee User `gorm:"foreignKey:GranteeUserID" json:"-"`
+}
+
+// TableName 指定表名
+func (FilePermission) TableName() string {
+	return "file_permissions"
+}
+
+// BeforeCreate 创建前的钩子
+func (p *FilePermission) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// FilePermissionResponse 文件授权响应
+type FilePermissionResponse struct {
+	GranteeUserID uuid.UUID           `json:"grantee_user_id"`
+	Username      string              `json:"username"`
+	Permission    FilePermissionLevel `json:"permission"`
+	GrantedBy     uuid.UUID           `json:"granted_by"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// ToResponse 转换为响应格式
+func (p *FilePermission) ToResponse() FilePermissionResponse {
+	return FilePermissionResponse{
+		GranteeUserID: p.GranteeUserID,
+		Username:      p.Grantee.Username,
+		Permission:    p.Permission,
+		GrantedBy:     p.GrantedBy,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+	}
+}
+
+// FilePermissionRequest 授予文件权限请求，已有授权时更新权限
+type FilePermissionRequest struct {
+	Username   string              `json:"username" binding:"required"`
+	Permission FilePermissionLevel `json:"permission" binding:"required,oneof=read write"`
+}
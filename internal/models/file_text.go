@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileText 文件提取文本模型，用于文本预览和内容搜索
+type FileText struct {
+	FileID    uuid.UUID `gorm:"type:uuid;primary_key" json:"file_id"`
+	Version   int       `gorm:"not null" json:"version"` // 提取时的文件版本，版本变化后重新提取
+	Extractor string    `gorm:"type:varchar(20);not null" json:"extractor"`
+	Snippet   string    `gorm:"type:text" json:"snippet"`
+	Content   string    `gorm:"type:text" json:"-"`
+	Truncated bool      `gorm:"default:false" json:"truncated"` // 原文超过保存的最大字符数
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FileText) TableName() string {
+	return "file_texts"
+}
+
+// TextPreviewResponse 文本预览响应
+type TextPreviewResponse struct {
+	FileID    uuid.UUID `json:"file_id"`
+	Extractor string    `json:"extractor"`
+	Text      string    `json:"text"`
+	Length    int       `json:"length"`    // 返回文本的字符数
+	Truncated bool      `json:"truncated"` // 是否还有更多文本
+}
+
+// TextContentResponse 代码和文本内容预览响应，供浏览器内的代码查看器按语言高亮显示
+type TextContentResponse struct {
+	FileID    uuid.UUID `json:"file_id"`
+	Name      string    `json:"name"`
+	Language  string    `json:"language"` // 按文件名推断的语言，如 go、python，无法识别时为 plaintext
+	Encoding  string    `json:"encoding"`
+	Content   string    `json:"content"`
+	Size      int64     `json:"size"`      // 返回内容的字节数
+	FileSize  int64     `json:"file_size"` // 文件的完整字节数
+	Truncated bool      `json:"truncated"` // 内容超过返回上限被截断
+}
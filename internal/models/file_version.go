@@ -91,7 +91,7 @@ type FileVersionFilter struct {
 	CreatedAtFrom *time.Time `form:"created_at_from"`
 	CreatedAtTo   *time.Time `form:"created_at_to"`
 	Page          int        `form:"page" binding:"omitempty,min=1"`
-	PageSize      int        `form:"page_size" binding:"omitempty,min=1,max=100"`
+	PageSize      int        `form:"page_size" binding:"omitempty,min=1"`
 }
 
 // ApplyFilter 应用过滤器到查询
@@ -164,7 +164,49 @@ type FileVersionStats struct {
 
 // CleanupOldVersions 清理旧版本的配置
 type CleanupOldVersions struct {
-	KeepLastNVersions int `json:"keep_last_n_versions"` // 保留最近N个版本
-	MaxAgeDays        int `json:"max_age_days"`         // 最大保留天数
-	MinVersions       int `json:"min_versions"`         // 最少保留版本数
+	KeepLastNVersions int `json:"keep_last_n_versions" form:"keep_last_n_versions" binding:"omitempty,min=0"` // 保留最近N个版本
+	MaxAgeDays        int `json:"max_age_days" form:"max_age_days" binding:"omitempty,min=0"`                 // 最大保留天数
+	MinVersions       int `json:"min_versions" form:"min_versions" binding:"omitempty,min=0"`                 // 最少保留版本数
+}
+
+// IsEmpty 未设置保留版本数和保留天数时不清理任何版本
+func (p CleanupOldVersions) IsEmpty() bool {
+	return p.KeepLastNVersions <= 0 && p.MaxAgeDays <= 0
+}
+
+// Expired 返回按策略应删除的历史版本，versions须按版本号降序排列（与FindByFileID一致）
+// 保留数量包括当前版本；当前版本current和最新的MinVersions个版本始终保留
+func (p CleanupOldVersions) Expired(versions []FileVersion, current int, now time.Time) []FileVersion {
+	var cutoff time.Time
+	if p.MaxAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -p.MaxAgeDays)
+	}
+
+	var expired []FileVersion
+	for i, version := range versions {
+		if version.VersionNumber == current || i < p.MinVersions {
+			continue
+		}
+		if (p.KeepLastNVersions > 0 && i >= p.KeepLastNVersions) ||
+			(!cutoff.IsZero() && version.CreatedAt.Before(cutoff)) {
+			expired = append(expired, version)
+		}
+	}
+	return expired
+}
+
+// VersionCleanupResult 按保留策略清理单个文件历史版本的结果
+type VersionCleanupResult struct {
+	FileID          uuid.UUID `json:"file_id"`
+	DeletedVersions []int     `json:"deleted_versions"`
+	FreedBytes      int64     `json:"freed_bytes"` // 删除的归档内容大小
+	Remaining       int       `json:"remaining"`
+}
+
+// VersionRetentionSummary 按保留策略清理所有文件历史版本的结果
+type VersionRetentionSummary struct {
+	Files           int         `json:"files"` // 检查的文件数
+	DeletedVersions int         `json:"deleted_versions"`
+	FreedBytes      int64       `json:"freed_bytes"`
+	Failed          []uuid.UUID `json:"failed,omitempty"`
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// JobType 后台任务类型
+type JobType string
+
+const (
+	JobTypeFileCopy   JobType = "file.copy"        // 复制大目录或大文件
+	JobTypeDataExport JobType = "data.export"      // 用户数据导出
+	JobTypeFileDedup  JobType = "file.dedup"       // 批量清理重复文件
+	JobTypeDetectMime JobType = "file.detect_mime" // 为已有文件补充内容嗅探的MIME类型
+	JobTypeFileHash   JobType = "file.hash"        // 为已有文件补充内容哈希
+
+	JobTypeRecalculateStorage JobType = "user.recalculate_storage" // 按实际文件重新计算所有用户的已用空间
+)
+
+// JobStatus 后台任务状态
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCanceled  JobStatus = "canceled"
+)
+
+// Job 耗时操作的后台任务，客户端通过任务ID轮询状态、进度和结果
+type Job struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Type       JobType    `gorm:"type:varchar(50);not null" json:"type"`
+	Status     JobStatus  `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Progress   float64    `gorm:"not null;default:0" json:"progress"` // 完成百分比（0~100）
+	Result     string     `gorm:"type:jsonb" json:"-"`
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关联关系
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// BeforeCreate 创建前的钩子
+func (j *Job) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// IsFinished 检查任务是否已结束
+func (j *Job) IsFinished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusCanceled
+}
+
+// JobResponse 后台任务响应
+type JobResponse struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       JobType         `json:"type"`
+	Status     JobStatus       `json:"status"`
+	Progress   float64         `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// ToResponse 转换为响应格式
+func (j *Job) ToResponse() JobResponse {
+	response := JobResponse{
+		ID:         j.ID,
+		Type:       j.Type,
+		Status:     j.Status,
+		Progress:   j.Progress,
+		Error:      j.Error,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		CreatedAt:  j.CreatedAt,
+		UpdatedAt:  j.UpdatedAt,
+	}
+	if j.Result != "" {
+		response.Result = json.RawMessage(j.Result)
+	}
+	return response
+}
@@ -17,6 +17,7 @@ const (
 	OperationUserLogout   OperationType = "user_logout"
 	OperationUserUpdate   OperationType = "user_update"
 	OperationUserDelete   OperationType = "user_delete"
+	OperationUserExport   OperationType = "user_export"
 
 	// 文件相关操作
 	OperationFileUpload   OperationType = "file_upload"
@@ -80,6 +81,12 @@ type OperationLog struct {
 	Duration     int64           `gorm:"default:0" json:"duration"` // 操作耗时，单位毫秒
 	CreatedAt    time.Time       `gorm:"autoCreateTime;index" json:"created_at"`
 
+	// 哈希链字段，未启用哈希链时为空
+	Seq           *int64 `gorm:"uniqueIndex" json:"seq,omitempty"`
+	PrevHash      string `gorm:"type:varchar(64)" json:"prev_hash,omitempty"`
+	Hash          string `gorm:"type:varchar(64)" json:"hash,omitempty"`
+	SubjectDigest string `gorm:"type:varchar(64)" json:"-"` // 用户身份相关字段的摘要，匿名化后仍可校验哈希链
+
 	// 关联关系
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
@@ -125,6 +132,9 @@ type OperationLogResponse struct {
 	Error        string          `json:"error,omitempty"`
 	Duration     int64           `json:"duration"`
 	CreatedAt    time.Time       `json:"created_at"`
+	Seq          *int64          `json:"seq,omitempty"`
+	PrevHash     string          `json:"prev_hash,omitempty"`
+	Hash         string          `json:"hash,omitempty"`
 
 	// 可选的关联数据
 	UserName     string `json:"user_name,omitempty"`
@@ -146,6 +156,9 @@ func (ol *OperationLog) ToResponse() OperationLogResponse {
 		Error:        ol.Error,
 		Duration:     ol.Duration,
 		CreatedAt:    ol.CreatedAt,
+		Seq:          ol.Seq,
+		PrevHash:     ol.PrevHash,
+		Hash:         ol.Hash,
 	}
 }
 
@@ -161,13 +174,38 @@ type OperationLogFilter struct {
 	CreatedAtFrom *time.Time       `form:"created_at_from"`
 	CreatedAtTo   *time.Time       `form:"created_at_to"`
 	Page          int              `form:"page" binding:"omitempty,min=1"`
-	PageSize      int              `form:"page_size" binding:"omitempty,min=1,max=100"`
-	SortBy        string           `form:"sort_by" binding:"oneof=created_at operation duration"`
-	SortOrder     string           `form:"sort_order" binding:"oneof=asc desc"`
+	PageSize      int              `form:"page_size" binding:"omitempty,min=1"`
+	SortBy        string           `form:"sort_by" binding:"omitempty,oneof=created_at operation duration"`
+	SortOrder     string           `form:"sort_order" binding:"omitempty,oneof=asc desc"`
+	Pagination    string           `form:"pagination" binding:"omitempty,oneof=offset cursor"` // cursor为游标分页
+	Cursor        string           `form:"cursor"`                                             // 游标分页时上一页返回的next_cursor
+}
+
+// UseCursor 是否使用游标分页（按 created_at、id 倒序，忽略page和排序参数）
+func (f *OperationLogFilter) UseCursor() bool {
+	return f.Pagination == "cursor" || f.Cursor != ""
 }
 
 // ApplyFilter 应用过滤器到查询
 func (f *OperationLogFilter) ApplyFilter(db *gorm.DB) *gorm.DB {
+	query := f.ApplyConditions(db)
+
+	// 排序
+	if f.SortBy != "" {
+		order := f.SortBy
+		if f.SortOrder != "" {
+			order = order + " " + f.SortOrder
+		}
+		query = query.Order(order)
+	} else {
+		query = query.Order("created_at DESC") // 默认按时间降序
+	}
+
+	return query
+}
+
+// ApplyConditions 只应用过滤条件，不排序
+func (f *OperationLogFilter) ApplyConditions(db *gorm.DB) *gorm.DB {
 	query := db
 
 	if f.UserID != nil {
@@ -202,17 +240,6 @@ func (f *OperationLogFilter) ApplyFilter(db *gorm.DB) *gorm.DB {
 		query = query.Where("created_at <= ?", *f.CreatedAtTo)
 	}
 
-	// 排序
-	if f.SortBy != "" {
-		order := f.SortBy
-		if f.SortOrder != "" {
-			order = order + " " + f.SortOrder
-		}
-		query = query.Order(order)
-	} else {
-		query = query.Order("created_at DESC") // 默认按时间降序
-	}
-
 	return query
 }
 
@@ -231,8 +258,16 @@ type OperationStats struct {
 type AuditLogRequest struct {
 	StartDate *time.Time `form:"start_date"`
 	EndDate   *time.Time `form:"end_date"`
-	GroupBy   string     `form:"group_by" binding:"oneof=hour day month operation resource_type"`
-	Format    string     `form:"format" binding:"oneof=json csv"`
+	GroupBy   string     `form:"group_by" binding:"omitempty,oneof=hour day month operation resource_type"`
+	Format    string     `form:"format" binding:"omitempty,oneof=json csv"` // 默认csv
+}
+
+// OperationLogAggregate 按group_by分组的日志统计
+type OperationLogAggregate struct {
+	Group        string `gorm:"column:group_key" json:"group"`
+	Total        int64  `gorm:"column:total" json:"total"`
+	SuccessCount int64  `gorm:"column:success_count" json:"success_count"`
+	FailureCount int64  `gorm:"column:failure_count" json:"failure_count"`
 }
 
 // SystemHealthLog 系统健康日志
@@ -264,6 +299,22 @@ func (LoginAttempt) TableName() string {
 	return "login_attempts"
 }
 
+// 安全警报类型和严重程度
+const (
+	SecurityAlertAccountTerminated = "account_terminated"
+	SecurityAlertUploadVolume      = "upload_volume_exceeded"
+	SecurityAlertFailedLogins      = "repeated_failed_logins"
+	SecurityAlertNewLoginIP        = "new_login_ip"
+	SecurityAlertShareMassDownload = "share_mass_download"
+	SecurityAlertQuotaExceeded     = "quota_exceeded"
+	SecurityAlertQuotaReached      = "quota_reached"
+	SecurityAlertMalwareDetected   = "malware_detected"
+
+	SecuritySeverityLow    = "low"
+	SecuritySeverityMedium = "medium"
+	SecuritySeverityHigh   = "high"
+)
+
 // SecurityAlert 安全警报
 type SecurityAlert struct {
 	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
@@ -284,6 +335,15 @@ func (SecurityAlert) TableName() string {
 	return "security_alerts"
 }
 
+// SecurityAlertFilter 安全警报查询条件
+type SecurityAlertFilter struct {
+	Severity  string `form:"severity" binding:"omitempty,oneof=low medium high critical"`
+	AlertType string `form:"alert_type"`
+	Resolved  *bool  `form:"resolved"`
+	Page      int    `form:"page" binding:"omitempty,min=1"`
+	PageSize  int    `form:"page_size" binding:"omitempty,min=1"`
+}
+
 // SystemStats 系统统计信息
 type SystemStats struct {
 	TotalUsers      int64 `json:"total_users"`
@@ -292,4 +352,19 @@ type SystemStats struct {
 	TotalStorage    int64 `json:"total_storage"`
 	TodayOperations int64 `json:"today_operations"`
 	ActiveShares    int64 `json:"active_shares"`
+
+	UploadSessionCleanup *UploadSessionCleanupStats `json:"upload_session_cleanup,omitempty"` // 过期分片上传会话清理
+	PhysicalStorage      []PhysicalStorageStats     `json:"physical_storage,omitempty"`       // 存储的物理使用情况，TotalStorage为文件大小之和
+}
+
+// PhysicalStorageStats 一个存储的物理使用情况，Store为 files 或 versions（单独配置历史版本存储时）
+// 本地存储为所在文件系统的容量；对象存储为存储桶中的对象数和总大小，没有容量上限
+type PhysicalStorageStats struct {
+	Store      string `json:"store"`
+	Type       string `json:"type"`
+	TotalBytes uint64 `json:"total_bytes,omitempty"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	FreeBytes  uint64 `json:"free_bytes,omitempty"`
+	Objects    *int64 `json:"objects,omitempty"`
+	Error      string `json:"error,omitempty"` // 获取失败时的原因
 }
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidCursor 游标格式错误
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 分页大小的默认值和上限，启动时由SetPageSizeLimits按PAGE_SIZE_DEFAULT、PAGE_SIZE_MAX设置
+var (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// SetPageSizeLimits 设置分页大小的默认值和上限，非正数的参数保留原值，默认值不超过上限
+func SetPageSizeLimits(defaultSize, maxSize int) {
+	if maxSize > 0 {
+		maxPageSize = maxSize
+	}
+	if defaultSize > 0 {
+		defaultPageSize = defaultSize
+	}
+	defaultPageSize = min(defaultPageSize, maxPageSize)
+}
+
+// NormalizePage 规范化分页参数：page小于1时为1，size小于1时为默认值，超过上限时截断为上限
+// 所有列表接口（包括游标分页）在查询前都需调用，避免一次读取过多数据
+func NormalizePage(page, size int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = defaultPageSize
+	}
+	return page, min(size, maxPageSize)
+}
+
+// ParsePage 解析查询参数中的page和page_size并规范化，无法解析的值按未提供处理
+func ParsePage(page, size string) (int, int) {
+	p, _ := strconv.Atoi(page)
+	s, _ := strconv.Atoi(size)
+	return NormalizePage(p, s)
+}
+
+// Page 列表接口统一的分页响应信封
+// 列表项放在资源名对应的键下（如 files、shares、logs），分页信息字段在所有列表接口中保持一致：
+// 偏移分页返回 total、page、size、total_pages、has_more、has_next、has_prev；
+// 游标分页返回 size、has_more、has_next、next_cursor（has_next与has_more相同）
+type Page[T any] struct {
+	key        string
+	Items      []T
+	Total      *int64
+	Page       int
+	Size       int
+	HasMore    bool
+	NextCursor string
+	extra      map[string]interface{}
+}
+
+// NewPage 创建偏移分页响应
+func NewPage[T any](key string, items []T, total int64, page, size int) *Page[T] {
+	return &Page[T]{
+		key:     key,
+		Items:   items,
+		Total:   &total,
+		Page:    page,
+		Size:    size,
+		HasMore: int64(page)*int64(size) < total,
+	}
+}
+
+// NewCursorPage 创建游标分页响应，nextCursor为空表示没有更多数据
+func NewCursorPage[T any](key string, items []T, size int, nextCursor string) *Page[T] {
+	return &Page[T]{
+		key:        key,
+		Items:      items,
+		Size:       size,
+		HasMore:    nextCursor != "",
+		NextCursor: nextCursor,
+	}
+}
+
+// TotalPages 偏移分页的总页数，没有数据时为0
+func (p *Page[T]) TotalPages() int64 {
+	if p.Total == nil || p.Size <= 0 {
+		return 0
+	}
+	return (*p.Total + int64(p.Size) - 1) / int64(p.Size)
+}
+
+// HasPrev 偏移分页是否有上一页；页码超出最后一页时上一页指向前面的页，同样返回true
+func (p *Page[T]) HasPrev() bool {
+	return p.Total != nil && p.Page > 1 && *p.Total > 0
+}
+
+// With 附加列表之外的响应字段（如查询条件）
+func (p *Page[T]) With(key string, value interface{}) *Page[T] {
+	if p.extra == nil {
+		p.extra = make(map[string]interface{})
+	}
+	p.extra[key] = value
+	return p
+}
+
+// MarshalJSON 实现json.Marshaler
+func (p *Page[T]) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(p.extra)+9)
+	for key, value := range p.extra {
+		body[key] = value
+	}
+
+	items := p.Items
+	if items == nil {
+		items = []T{}
+	}
+	body[p.key] = items
+	body["size"] = p.Size
+	body["has_more"] = p.HasMore
+	body["has_next"] = p.HasMore
+
+	if p.Total != nil {
+		body["total"] = *p.Total
+		body["page"] = p.Page
+		body["total_pages"] = p.TotalPages()
+		body["has_prev"] = p.HasPrev()
+	} else {
+		body["next_cursor"] = p.NextCursor
+	}
+
+	return json.Marshal(body)
+}
+
+// Cursor 键集分页游标，指向上一页最后一条记录（按 created_at、id 倒序）
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// NewCursor 根据记录的创建时间和ID创建游标
+func NewCursor(createdAt time.Time, id uuid.UUID) *Cursor {
+	return &Cursor{CreatedAt: createdAt, ID: id}
+}
+
+// Encode 将游标编码为不透明字符串
+func (c *Cursor) Encode() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor 解析游标字符串
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: createdAt, ID: id}, nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// CategoryQuotas 按MIME分类设置的子配额（字节），未设置的分类只受总配额限制
+type CategoryQuotas map[string]int64
+
+// Value 实现driver.Valuer，以JSON保存，为空时保存NULL
+func (q CategoryQuotas) Value() (driver.Value, error) {
+	if len(q) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string]int64(q))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 实现sql.Scanner
+func (q *CategoryQuotas) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*q = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported category quotas type %T", value)
+	}
+
+	quotas := make(map[string]int64)
+	if err := json.Unmarshal(data, &quotas); err != nil {
+		return err
+	}
+	*q = quotas
+	return nil
+}
+
+// Validate 检查分类是否受支持、配额是否为正数
+func (q CategoryQuotas) Validate() error {
+	for category, quota := range q {
+		if !IsValidMimeCategory(category) {
+			return fmt.Errorf("invalid category %q", category)
+		}
+		if quota <= 0 {
+			return fmt.Errorf("quota for category %q must be positive", category)
+		}
+	}
+	return nil
+}
+
+// CategoryUsage 单个分类的存储使用情况
+type CategoryUsage struct {
+	Category  string `json:"category"`
+	Used      int64  `json:"used"`
+	Quota     int64  `json:"quota,omitempty"` // 0表示未设置子配额
+	Available *int64 `json:"available,omitempty"`
+}
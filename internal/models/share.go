@@ -16,6 +16,31 @@ const (
 	ShareAccessEdit     ShareAccessType = "edit"
 )
 
+// shareAccessLevels 访问类型的权限级别，数值越大权限越高
+var shareAccessLevels = map[ShareAccessType]int{
+	ShareAccessView:     1,
+	ShareAccessDownload: 2,
+	ShareAccessEdit:     3,
+}
+
+// AllowsDownload 检查访问类型是否允许下载
+func (t ShareAccessType) AllowsDownload() bool {
+	return t == ShareAccessDownload || t == ShareAccessEdit
+}
+
+// AllowsEdit 检查访问类型是否允许编辑
+func (t ShareAccessType) AllowsEdit() bool {
+	return t == ShareAccessEdit
+}
+
+// MinShareAccess 返回两个访问类型中权限较低的一个
+func MinShareAccess(a, b ShareAccessType) ShareAccessType {
+	if shareAccessLevels[b] < shareAccessLevels[a] {
+		return b
+	}
+	return a
+}
+
 // Share 分享模型
 type Share struct {
 	ID            uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
@@ -27,10 +52,14 @@ type Share struct {
 	ExpiresAt     *time.Time      `gorm:"index" json:"expires_at,omitempty"`
 	MaxDownloads  *int            `json:"max_downloads,omitempty"`
 	DownloadCount int             `gorm:"default:0" json:"download_count"`
+	AccessCount   int64           `gorm:"default:0" json:"access_count"` // 查看和下载的总次数
 	IsActive      bool            `gorm:"default:true" json:"is_active"`
 	CreatedAt     time.Time       `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time       `gorm:"autoUpdateTime" json:"updated_at"`
 
+	// 每次下载和更新内容都必须通过X-Share-Password请求头提供密码，不接受URL中的密码
+	RequirePasswordPerDownload bool `gorm:"default:false" json:"require_password_per_download"`
+
 	// 关联关系
 	File File `gorm:"foreignKey:FileID" json:"file,omitempty"`
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -49,6 +78,38 @@ func (s *Share) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// ShareAccessAction 分享访问记录的动作
+type ShareAccessAction string
+
+const (
+	ShareActionView     ShareAccessAction = "view"
+	ShareActionDownload ShareAccessAction = "download"
+)
+
+// ShareAccess 分享访问记录，每次通过分享链接查看或下载时写入
+type ShareAccess struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ShareID   uuid.UUID         `gorm:"type:uuid;not null;index" json:"share_id"`
+	FileID    *uuid.UUID        `gorm:"type:uuid" json:"file_id,omitempty"` // 下载的文件，目录分享中可能是后代文件
+	Action    ShareAccessAction `gorm:"type:varchar(20);not null" json:"action"`
+	IPAddress string            `gorm:"type:varchar(45)" json:"ip_address"`
+	UserAgent string            `gorm:"type:text" json:"user_agent,omitempty"`
+	CreatedAt time.Time         `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ShareAccess) TableName() string {
+	return "share_accesses"
+}
+
+// BeforeCreate 创建前的钩子
+func (a *ShareAccess) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
 // ShareCreateRequest 分享创建请求
 type ShareCreateRequest struct {
 	FileID        uuid.UUID       `json:"file_id" binding:"required"`
@@ -56,6 +117,8 @@ type ShareCreateRequest struct {
 	AccessType    ShareAccessType `json:"access_type" binding:"oneof=view download edit"`
 	ExpiresInDays *int            `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=365"`
 	MaxDownloads  *int            `json:"max_downloads,omitempty" binding:"omitempty,min=1"`
+
+	RequirePasswordPerDownload bool `json:"require_password_per_download"`
 }
 
 // ShareUpdateRequest 分享更新请求
@@ -65,6 +128,8 @@ type ShareUpdateRequest struct {
 	IsActive      *bool            `json:"is_active"`
 	ExpiresInDays *int             `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=365"`
 	MaxDownloads  *int             `json:"max_downloads,omitempty" binding:"omitempty,min=1"`
+
+	RequirePasswordPerDownload *bool `json:"require_password_per_download"`
 }
 
 // ShareResponse 分享响应
@@ -77,6 +142,7 @@ type ShareResponse struct {
 	ExpiresAt     *time.Time      `json:"expires_at,omitempty"`
 	MaxDownloads  *int            `json:"max_downloads,omitempty"`
 	DownloadCount int             `json:"download_count"`
+	AccessCount   int64           `json:"access_count"`
 	IsActive      bool            `json:"is_active"`
 	CreatedAt     time.Time       `json:"created_at"`
 	UpdatedAt     time.Time       `json:"updated_at"`
@@ -90,6 +156,17 @@ type ShareResponse struct {
 	HasPassword        bool   `json:"has_password"`
 	IsExpired          bool   `json:"is_expired"`
 	RemainingDownloads *int   `json:"remaining_downloads,omitempty"`
+
+	RequirePasswordPerDownload bool `json:"require_password_per_download"`
+}
+
+// FileSharingResponse 文件的公开与分享状态汇总
+type FileSharingResponse struct {
+	FileID       uuid.UUID       `json:"file_id"`
+	IsPublic     bool            `json:"is_public"`
+	PublicToken  *string         `json:"public_token,omitempty"`
+	ActiveShares int             `json:"active_shares"`
+	Shares       []ShareResponse `json:"shares"`
 }
 
 // ToResponse 转换为响应格式
@@ -121,15 +198,24 @@ func (s *Share) ToResponse() ShareResponse {
 		ExpiresAt:          s.ExpiresAt,
 		MaxDownloads:       s.MaxDownloads,
 		DownloadCount:      s.DownloadCount,
+		AccessCount:        s.AccessCount,
 		IsActive:           s.IsActive,
 		CreatedAt:          s.CreatedAt,
 		UpdatedAt:          s.UpdatedAt,
 		HasPassword:        hasPassword,
 		IsExpired:          isExpired,
 		RemainingDownloads: remainingDownloads,
+
+		RequirePasswordPerDownload: s.RequirePasswordPerDownload,
 	}
 }
 
+// SharedFileResponse 通过目录分享访问的文件及其生效的访问类型
+type SharedFileResponse struct {
+	FileResponse
+	AccessType ShareAccessType `json:"access_type"`
+}
+
 // IsValid 检查分享是否有效
 func (s *Share) IsValid() bool {
 	if !s.IsActive {
@@ -183,7 +269,7 @@ type ShareFilter struct {
 	CreatedAtFrom *time.Time       `form:"created_at_from"`
 	CreatedAtTo   *time.Time       `form:"created_at_to"`
 	Page          int              `form:"page" binding:"omitempty,min=1"`
-	PageSize      int              `form:"page_size" binding:"omitempty,min=1,max=100"`
+	PageSize      int              `form:"page_size" binding:"omitempty,min=1"`
 }
 
 // ApplyFilter 应用过滤器到查询
@@ -236,6 +322,10 @@ type ShareStats struct {
 	ExpiredShares  int64 `json:"expired_shares"`
 	TotalDownloads int64 `json:"total_downloads"`
 	PublicFiles    int64 `json:"public_files"` // 通过分享可访问的文件
+
+	// 分享数量限制（0表示不限制）
+	MaxSharesPerUser int `json:"max_shares_per_user"`
+	MaxSharesPerFile int `json:"max_shares_per_file"`
 }
 
 // ShareAccessRequest 分享访问请求
@@ -251,7 +341,9 @@ type ShareAccessResponse struct {
 	AccessURL   string        `json:"access_url"`
 	CanDownload bool          `json:"can_download"`
 	CanEdit     bool          `json:"can_edit"`
-	ExpiresIn   *string       `json:"expires_in,omitempty"` // 剩余时间，如 "3天"
+	ExpiresIn   *string       `json:"expires_in,omitempty"` // 剩余时间，如 "3天"、"3 days"
+	// 剩余秒数，供倒计时使用
+	ExpiresInSeconds *int64 `json:"expires_in_seconds,omitempty"`
 }
 
 // ShareLinkInfo 分享链接信息
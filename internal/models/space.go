@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SpaceRole 空间成员角色
+type SpaceRole string
+
+const (
+	SpaceRoleViewer SpaceRole = "viewer" // 浏览和下载
+	SpaceRoleEditor SpaceRole = "editor" // 上传、修改、移动和删除文件
+	SpaceRoleAdmin  SpaceRole = "admin"  // 管理空间信息和成员
+)
+
+// spaceRoleRank 角色等级，高等级包含低等级的全部权限
+var spaceRoleRank = map[SpaceRole]int{
+	SpaceRoleViewer: 1,
+	SpaceRoleEditor: 2,
+	SpaceRoleAdmin:  3,
+}
+
+// Allows 检查角色是否具备required角色的权限
+func (r SpaceRole) Allows(required SpaceRole) bool {
+	return spaceRoleRank[r] > 0 && spaceRoleRank[r] >= spaceRoleRank[required]
+}
+
+// Space 团队共享空间，成员按角色访问空间内的文件
+type Space struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string    `gorm:"type:varchar(100);not null" json:"name"`
+	Description string    `gorm:"type:varchar(500)" json:"description,omitempty"`
+	CreatedBy   uuid.UUID `gorm:"type:uuid;not null;index" json:"created_by"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Space) TableName() string {
+	return "spaces"
+}
+
+// BeforeCreate 创建前的钩子
+func (s *Space) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// SpaceMember 空间成员
+type SpaceMember struct {
+	SpaceID   uuid.UUID `gorm:"type:uuid;primary_key" json:"space_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;primary_key;index" json:"user_id"`
+	Role      SpaceRole `gorm:"type:varchar(20);not null" json:"role"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// 关联关系
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// TableName 指定表名
+func (SpaceMember) TableName() string {
+	return "space_members"
+}
+
+// SpaceMemberResponse 空间成员响应
+type SpaceMemberResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      SpaceRole `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToResponse 转换为响应格式
+func (m *SpaceMember) ToResponse() SpaceMemberResponse {
+	return SpaceMemberResponse{
+		UserID:    m.UserID,
+		Username:  m.User.Username,
+		Role:      m.Role,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+// SpaceResponse 空间响应，Role为当前用户在空间中的角色
+type SpaceResponse struct {
+	Space
+	Role    SpaceRole             `json:"role"`
+	Members []SpaceMemberResponse `json:"members,omitempty"`
+}
+
+// SpaceCreateRequest 空间创建请求
+type SpaceCreateRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=500"`
+}
+
+// SpaceUpdateRequest 空间更新请求
+type SpaceUpdateRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+}
+
+// SpaceMemberRequest 添加空间成员请求
+type SpaceMemberRequest struct {
+	Username string    `json:"username" binding:"required"`
+	Role     SpaceRole `json:"role" binding:"required,oneof=viewer editor admin"`
+}
+
+// SpaceMemberUpdateRequest 修改成员角色请求
+type SpaceMemberUpdateRequest struct {
+	Role SpaceRole `json:"role" binding:"required,oneof=viewer editor admin"`
+}
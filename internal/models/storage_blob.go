@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StorageBlob 去重保存的文件内容，同一用户内容相同的文件共享一份存储
+// 存储键不随文件移动或覆盖而变化；最后一个引用的文件被永久删除或覆盖后删除存储内容
+type StorageBlob struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_storage_blobs_user_hash" json:"user_id"`
+	Hash      string    `gorm:"type:varchar(64);not null;index:idx_storage_blobs_user_hash" json:"hash"`
+	Size      int64     `gorm:"not null" json:"size"`
+	Key       string    `gorm:"type:varchar(512);not null;uniqueIndex" json:"key"`
+	RefCount  int       `gorm:"not null;default:1" json:"ref_count"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (StorageBlob) TableName() string {
+	return "storage_blobs"
+}
+
+// BeforeCreate 创建前的钩子
+func (b *StorageBlob) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 待删除内容所在的存储
+const (
+	StorageStoreFiles    = "files"    // 当前文件存储（含缩略图）
+	StorageStoreVersions = "versions" // 历史版本存储
+)
+
+// StorageDeletion 待删除的存储内容
+// 永久删除文件时与数据库记录的删除在同一事务中登记，事务提交后才删除存储中的内容，失败时按退避间隔重试；
+// 因此数据库记录不会指向已删除的内容，最坏情况是存储内容晚于记录删除
+type StorageDeletion struct {
+	ID    uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Store string    `gorm:"type:varchar(20);not null" json:"store"`
+	Key   string    `gorm:"type:text;not null" json:"key"`
+	IsDir bool      `gorm:"default:false" json:"is_dir"`
+	// 存储键由所有者（空间文件还有空间）和路径生成时记录，删除前检查该键是否已被同路径的新文件复用
+	OwnerID       *uuid.UUID `gorm:"type:uuid" json:"owner_id,omitempty"`
+	SpaceID       *uuid.UUID `gorm:"type:uuid" json:"space_id,omitempty"`
+	Path          string     `gorm:"type:text" json:"path,omitempty"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (StorageDeletion) TableName() string {
+	return "storage_deletions"
+}
+
+// BeforeCreate 创建前的钩子
+func (d *StorageDeletion) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
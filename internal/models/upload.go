@@ -11,6 +11,7 @@ type UploadStatus string
 const (
 	UploadStatusPending   UploadStatus = "pending"
 	UploadStatusUploading UploadStatus = "uploading"
+	UploadStatusMerging   UploadStatus = "merging" // 正在合并分片并创建文件
 	UploadStatusCompleted UploadStatus = "completed"
 	UploadStatusFailed    UploadStatus = "failed"
 	UploadStatusCanceled  UploadStatus = "canceled"
@@ -33,16 +34,50 @@ type UploadSession struct {
 	CreatedAt      time.Time    `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
 	ExpiresAt      time.Time    `gorm:"index" json:"expires_at"`
+
+	SpaceID         *uuid.UUID `gorm:"type:uuid" json:"space_id,omitempty"`
+	IsPublic        bool       `gorm:"default:false" json:"is_public"`
+	Override        bool       `gorm:"default:false" json:"override"`
+	StorageUploadID string     `gorm:"type:varchar(1024)" json:"-"`        // 存储的分片上传ID，空文件没有分片时为空
+	FileID          *uuid.UUID `gorm:"type:uuid" json:"file_id,omitempty"` // 完成后创建或覆盖的文件
 }
 
 func (UploadSession) TableName() string {
 	return "upload_sessions"
 }
 
+// IsActive 会话是否仍可上传分片
+func (s *UploadSession) IsActive() bool {
+	return s.Status == UploadStatusPending || s.Status == UploadStatusUploading
+}
+
+// ExpectedChunkSize 第index个分片应有的大小，最后一个分片可能小于ChunkSize
+func (s *UploadSession) ExpectedChunkSize(index int) int64 {
+	if index == s.TotalChunks-1 {
+		return s.FileSize - int64(index)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// UploadedChunk 已上传的分片，同一分片重新上传时覆盖
+type UploadedChunk struct {
+	UploadID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"upload_id"`
+	ChunkIndex int       `gorm:"primaryKey;autoIncrement:false" json:"chunk_index"`
+	Size       int64     `gorm:"not null" json:"size"`
+	Hash       string    `gorm:"type:varchar(255)" json:"hash"`
+	ETag       string    `gorm:"type:varchar(255)" json:"etag"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (UploadedChunk) TableName() string {
+	return "upload_chunks"
+}
+
 type ChunkUploadRequest struct {
 	UploadID    uuid.UUID `form:"-"`
 	UploadIDStr string    `form:"upload_id" binding:"required"`
-	ChunkIndex  int       `form:"chunk_index" binding:"required,min=0"`
+	ChunkIndex  int       `form:"chunk_index" binding:"min=0"`
 	ChunkSize   int64     `form:"chunk_size" binding:"required,min=1"`
 	ChunkHash   string    `form:"chunk_hash" binding:"required"`
 }
@@ -69,10 +104,13 @@ type UploadSessionResponse struct {
 	CreatedAt       time.Time    `json:"created_at"`
 	ExpiresAt       time.Time    `json:"expires_at"`
 	CompletedChunks []int        `json:"completed_chunks"`
+
+	FileID *uuid.UUID `json:"file_id,omitempty"`
 }
 
 func (s *UploadSession) ToResponse(completedChunks []int) UploadSessionResponse {
-	progress := float64(0)
+	// 空文件没有分片，视为已全部上传
+	progress := float64(100)
 	if s.TotalChunks > 0 {
 		progress = float64(s.UploadedChunks) / float64(s.TotalChunks) * 100
 	}
@@ -91,18 +129,67 @@ func (s *UploadSession) ToResponse(completedChunks []int) UploadSessionResponse
 		CreatedAt:       s.CreatedAt,
 		ExpiresAt:       s.ExpiresAt,
 		CompletedChunks: completedChunks,
+		FileID:          s.FileID,
 	}
 }
 
 type InitiateUploadRequest struct {
 	FileName  string     `json:"file_name" binding:"required"`
-	FileSize  int64      `json:"file_size" binding:"required,min=1"`
-	FileHash  string     `json:"file_hash" binding:"required"`
+	FileSize  int64      `json:"file_size" binding:"min=0"`
+	FileHash  string     `json:"file_hash" binding:"required"` // 格式为 sha256:<hex> 或 md5:<hex>
 	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
-	ChunkSize int64      `json:"chunk_size" binding:"required,min=1"`
+	ChunkSize int64      `json:"chunk_size" binding:"omitempty,min=1"` // 为空时使用 CHUNK_SIZE
 	MimeType  string     `json:"mime_type"`
+
+	SpaceID  *uuid.UUID `json:"space_id,omitempty"` // 上传到空间根目录时指定
+	IsPublic bool       `json:"is_public"`
+	Override bool       `json:"override"`
 }
 
 type CompleteUploadRequest struct {
 	UploadID uuid.UUID `json:"upload_id" binding:"required"`
 }
+
+// UploadUsage 单个用户或IP在统计窗口内的上传量
+type UploadUsage struct {
+	Subject   string `json:"subject"` // 用户ID或客户端IP
+	Bytes     int64  `json:"bytes"`
+	Threshold int64  `json:"threshold"` // 0表示不检测
+	Exceeded  bool   `json:"exceeded"`
+}
+
+// UploadUsageReport 上传流量统计，按上传量从高到低排列
+type UploadUsageReport struct {
+	Enabled       bool          `json:"enabled"` // Redis不可用时为false
+	WindowSeconds int64         `json:"window_seconds"`
+	Action        string        `json:"action"`
+	Users         []UploadUsage `json:"users"`
+	IPs           []UploadUsage `json:"ips"`
+}
+
+// UploadSessionCleanupStats 过期分片上传会话清理的运行统计，LastRunAt为nil表示尚未运行
+type UploadSessionCleanupStats struct {
+	IntervalSeconds int64      `json:"interval_seconds"`
+	LastRunAt       *time.Time `json:"last_run_at"`
+	LastDurationMs  int64      `json:"last_duration_ms"`
+	LastCanceled    int        `json:"last_canceled"`
+	LastError       string     `json:"last_error,omitempty"`
+	TotalRuns       int64      `json:"total_runs"`
+	TotalCanceled   int64      `json:"total_canceled"`
+}
+
+// MultipartCleanupResult 清理未完成分片上传的结果：取消的过期会话数，以及在存储中中止的上传数、失败数和释放的空间
+type MultipartCleanupResult struct {
+	StorageType      string `json:"storage_type"`
+	OlderThanSeconds int64  `json:"older_than_seconds"`
+	CanceledSessions int    `json:"canceled_sessions"`
+	AbortedUploads   int    `json:"aborted_uploads"`
+	FailedUploads    int    `json:"failed_uploads"`
+	ReclaimedBytes   int64  `json:"reclaimed_bytes"`
+}
+
+// UploadTempUsage 用户进行中的分片上传占用的临时空间（按声明的文件大小计），Quota为0表示不限制
+type UploadTempUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
@@ -24,8 +24,13 @@ type User struct {
 	Role         UserRole       `gorm:"type:varchar(20);default:'user';not null" json:"role"`
 	StorageQuota int64          `gorm:"default:10737418240" json:"storage_quota"` // 10GB默认
 	UsedStorage  int64          `gorm:"default:0" json:"used_storage"`
+	CategoryQuotas CategoryQuotas `gorm:"type:jsonb" json:"category_quotas,omitempty"` // 按MIME分类的子配额
 	IsActive     bool           `gorm:"default:true" json:"is_active"`
+	EmailVerified bool          `gorm:"not null;default:false" json:"email_verified"`
+	VerificationToken *string   `gorm:"type:varchar(64);uniqueIndex" json:"-"` // 邮箱验证令牌，验证后清空
 	LastLoginAt  *time.Time     `json:"last_login_at,omitempty"`
+	AvatarKey    string         `gorm:"type:varchar(255)" json:"-"` // 头像存储键，为空表示未设置头像
+	LockVersion  int64          `gorm:"not null;default:1" json:"lock_version"` // 乐观锁版本，每次更新递增
 	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -64,7 +69,9 @@ type UserUpdateRequest struct {
 	Password     *string  `json:"password"`
 	Role         *UserRole `json:"role"`
 	StorageQuota *int64   `json:"storage_quota"`
+	CategoryQuotas *CategoryQuotas `json:"category_quotas"` // 整体替换，传空对象表示清除
 	IsActive     *bool    `json:"is_active"`
+	LockVersion  *int64   `json:"lock_version"` // 客户端读取到的lock_version，不一致时返回409
 }
 
 // UserLoginRequest 用户登录请求
@@ -81,8 +88,12 @@ type UserResponse struct {
 	Role         UserRole   `json:"role"`
 	StorageQuota int64      `json:"storage_quota"`
 	UsedStorage  int64      `json:"used_storage"`
+	CategoryQuotas CategoryQuotas `json:"category_quotas,omitempty"`
 	IsActive     bool       `json:"is_active"`
+	EmailVerified bool      `json:"email_verified"`
 	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	AvatarURL    string     `json:"avatar_url,omitempty"`
+	LockVersion  int64      `json:"lock_version"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 }
@@ -96,13 +107,26 @@ func (u *User) ToResponse() UserResponse {
 		Role:         u.Role,
 		StorageQuota: u.StorageQuota,
 		UsedStorage:  u.UsedStorage,
+		CategoryQuotas: u.CategoryQuotas,
 		IsActive:     u.IsActive,
+		EmailVerified: u.EmailVerified,
 		LastLoginAt:  u.LastLoginAt,
+		AvatarURL:    u.AvatarURL(),
+		LockVersion:  u.LockVersion,
 		CreatedAt:    u.CreatedAt,
 		UpdatedAt:    u.UpdatedAt,
 	}
 }
 
+// AvatarURL 返回头像的公开访问路径，未设置头像时为空
+// 头像键每次上传都会变化（avatars/<user_id>/<name>），路径可被长期缓存
+func (u *User) AvatarURL() string {
+	if u.AvatarKey == "" {
+		return ""
+	}
+	return "/api/v1/" + u.AvatarKey
+}
+
 // CheckStorageQuota 检查存储配额
 func (u *User) CheckStorageQuota(fileSize int64) bool {
 	return u.UsedStorage+fileSize <= u.StorageQuota
@@ -151,7 +175,7 @@ type UserFilter struct {
 	CreatedAtFrom *time.Time `form:"created_at_from"`
 	CreatedAtTo   *time.Time `form:"created_at_to"`
 	Page      int      `form:"page" binding:"min=1"`
-	PageSize  int      `form:"page_size" binding:"min=1,max=100"`
+	PageSize  int      `form:"page_size" binding:"omitempty,min=1"`
 }
 
 // ApplyFilter 应用过滤器到查询
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebhookEvents Webhook订阅的事件类型列表，以JSON数组保存
+type WebhookEvents []string
+
+// Value 实现driver.Valuer
+func (e WebhookEvents) Value() (driver.Value, error) {
+	if e == nil {
+		e = WebhookEvents{}
+	}
+	data, err := json.Marshal([]string(e))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 实现sql.Scanner
+func (e *WebhookEvents) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported webhook events type %T", value)
+	}
+	return json.Unmarshal(data, (*[]string)(e))
+}
+
+// Contains 检查是否订阅了指定事件
+func (e WebhookEvents) Contains(eventType string) bool {
+	for _, t := range e {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook 用户配置的出站Webhook
+type Webhook struct {
+	ID          uuid.UUID     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID      uuid.UUID     `gorm:"type:uuid;not null;index" json:"user_id"`
+	URL         string        `gorm:"type:text;not null" json:"url"`
+	Secret      string        `gorm:"type:varchar(128);not null" json:"-"` // HMAC签名密钥
+	Events      WebhookEvents `gorm:"type:jsonb;not null" json:"events"`
+	Description string        `gorm:"type:varchar(255)" json:"description,omitempty"`
+	IsActive    bool          `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// BeforeCreate 创建前的钩子
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookDelivery Webhook投递记录，每次尝试一条
+type WebhookDelivery struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	WebhookID  uuid.UUID `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	EventID    uuid.UUID `gorm:"type:uuid;not null;index" json:"event_id"`
+	EventType  string    `gorm:"type:varchar(50);not null" json:"event_type"`
+	Attempt    int       `gorm:"not null" json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `gorm:"not null" json:"success"`
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	Duration   int64     `gorm:"default:0" json:"duration"` // 请求耗时，单位毫秒
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// BeforeCreate 创建前的钩子
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// WebhookCreateRequest 创建Webhook请求
+type WebhookCreateRequest struct {
+	URL         string   `json:"url" binding:"required,url"`
+	Events      []string `json:"events" binding:"required,min=1,dive,required"`
+	Secret      string   `json:"secret" binding:"omitempty,min=16,max=128"` // 为空时自动生成
+	Description string   `json:"description" binding:"max=255"`
+}
+
+// WebhookUpdateRequest 更新Webhook请求
+type WebhookUpdateRequest struct {
+	URL         *string   `json:"url" binding:"omitempty,url"`
+	Events      *[]string `json:"events" binding:"omitempty,min=1,dive,required"`
+	Description *string   `json:"description" binding:"omitempty,max=255"`
+	IsActive    *bool     `json:"is_active"`
+}
+
+// WebhookCreateResponse 创建Webhook响应，签名密钥只在创建时返回
+type WebhookCreateResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// WOPIFileInfo WOPI CheckFileInfo响应，字段名遵循WOPI协议
+type WOPIFileInfo struct {
+	BaseFileName     string `json:"BaseFileName"`
+	OwnerId          string `json:"OwnerId"`
+	Size             int64  `json:"Size"`
+	UserId           string `json:"UserId"`
+	UserFriendlyName string `json:"UserFriendlyName"`
+	Version          string `json:"Version"`
+	LastModifiedTime string `json:"LastModifiedTime"` // ISO 8601
+	UserCanWrite     bool   `json:"UserCanWrite"`
+	ReadOnly         bool   `json:"ReadOnly"`
+	SupportsUpdate   bool   `json:"SupportsUpdate"`
+	SupportsLocks    bool   `json:"SupportsLocks"`
+}
+
+// WOPITokenResponse 打开在线编辑器所需的WOPI访问信息
+type WOPITokenResponse struct {
+	WopiSrc        string `json:"wopi_src"`
+	AccessToken    string `json:"access_token"`
+	AccessTokenTTL int64  `json:"access_token_ttl"` // 令牌过期时间，Unix毫秒时间戳
+}
@@ -0,0 +1,115 @@
+// Package antivirus 提供上传内容的病毒扫描，目前实现了ClamAV（clamd）的INSTREAM扫描
+package antivirus
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Result 扫描结果，Infected为true时Signature为检测到的病毒名称
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner 病毒扫描器
+type Scanner interface {
+	// Scan 读取r中的内容进行扫描；扫描器可能在内容读完前返回（如超出扫描器的大小限制），调用方负责读完剩余内容
+	Scan(ctx context.Context, r io.Reader) (*Result, error)
+}
+
+// clamdChunkSize 通过INSTREAM发送内容时每个数据块的大小
+const clamdChunkSize = 32 * 1024
+
+// ClamAV 通过TCP连接clamd，使用INSTREAM命令流式扫描内容
+type ClamAV struct {
+	address string
+	timeout time.Duration
+}
+
+// NewClamAV 创建ClamAV扫描器，address为clamd的TCP地址（host:port），timeout为连接和等待扫描结果的超时
+func NewClamAV(address string, timeout time.Duration) *ClamAV {
+	return &ClamAV{address: address, timeout: timeout}
+}
+
+// Scan 将内容分块发送给clamd并解析扫描结果
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	// ctx取消时中断正在进行的读写
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send clamd command: %w", err)
+	}
+
+	// clamd超出StreamMaxLength时返回错误并关闭连接，此时停止发送并读取响应
+	if err := sendStream(conn, r); err != nil && !isConnClosed(err) {
+		return nil, err
+	}
+
+	if c.timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// sendStream 以"4字节大端长度+数据"的格式分块发送内容，最后发送长度为0的块
+func sendStream(conn net.Conn, r io.Reader) error {
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// isConnClosed 判断写入错误是否由clamd关闭连接引起
+func isConnClosed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "write"
+}
+
+// parseReply 解析clamd的响应："stream: OK"、"stream: <名称> FOUND"或"<原因> ERROR"
+func parseReply(reply string) (*Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd error: %s", strings.TrimSpace(reply))
+	}
+}
@@ -0,0 +1,106 @@
+// Package events 提供进程内事件总线，业务服务发布事件，Webhook等功能订阅事件
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 事件类型
+const (
+	FileUploaded    = "file.uploaded"
+	FileDeleted     = "file.deleted"
+	ShareCreated    = "share.created"
+	ShareAccessed   = "share.accessed"
+	ShareDownloaded = "share.downloaded"
+	UserRegistered  = "user.registered"
+	QuotaWarning    = "quota.warning"
+	QuotaReached    = "quota.reached"
+	QuotaExceeded   = "quota.exceeded"
+	MalwareDetected = "malware.detected"
+)
+
+// Types 可订阅的事件类型
+var Types = []string{
+	FileUploaded, FileDeleted, ShareCreated, ShareAccessed, ShareDownloaded, UserRegistered,
+	QuotaWarning, QuotaReached, QuotaExceeded, MalwareDetected,
+}
+
+// IsValidType 检查事件类型是否受支持
+func IsValidType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event 系统事件，UserID为事件所属用户（资源所有者）
+type Event struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	UserID     uuid.UUID              `json:"user_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// New 创建事件
+func New(eventType string, userID uuid.UUID, data map[string]interface{}) Event {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: time.Now(),
+		Data:       data,
+	}
+}
+
+// Handler 事件处理函数，在发布者的goroutine中同步调用，不应阻塞
+type Handler func(Event)
+
+// Bus 事件总线
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe 订阅全部事件
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish 发布事件，总线为nil时忽略；单个处理函数panic不影响其他订阅者
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event handler panic for %s: %v", event.Type, r)
+				}
+			}()
+			handler(event)
+		}()
+	}
+}
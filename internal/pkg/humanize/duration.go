@@ -0,0 +1,58 @@
+package humanize
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// 支持的语言，第一个为无法匹配时的默认语言
+var supported = []language.Tag{language.Chinese, language.English}
+
+var matcher = language.NewMatcher(supported)
+
+// Language 根据locale参数或Accept-Language请求头选择语言，返回"zh"或"en"；
+// locale优先，两者都无法匹配时返回"zh"
+func Language(locale, acceptLanguage string) string {
+	tag, _ := language.MatchStrings(matcher, locale, acceptLanguage)
+	base, _ := tag.Base()
+	if base.String() == "en" {
+		return "en"
+	}
+	return "zh"
+}
+
+// Duration 将剩余时长格式化为可读字符串，只保留最大的单位（天、小时、分钟），向下取整，
+// 如"3天"、"3 days"；不足1分钟时为"不到1分钟"，不大于0时为"已过期"
+func Duration(d time.Duration, lang string) string {
+	en := lang == "en"
+	switch {
+	case d <= 0:
+		if en {
+			return "expired"
+		}
+		return "已过期"
+	case d < time.Minute:
+		if en {
+			return "less than a minute"
+		}
+		return "不到1分钟"
+	case d < time.Hour:
+		return format(int64(d/time.Minute), "分钟", "minute", en)
+	case d < 24*time.Hour:
+		return format(int64(d/time.Hour), "小时", "hour", en)
+	default:
+		return format(int64(d/(24*time.Hour)), "天", "day", en)
+	}
+}
+
+func format(n int64, zhUnit, enUnit string, en bool) string {
+	if !en {
+		return fmt.Sprintf("%d%s", n, zhUnit)
+	}
+	if n == 1 {
+		return fmt.Sprintf("1 %s", enUnit)
+	}
+	return fmt.Sprintf("%d %ss", n, enUnit)
+}
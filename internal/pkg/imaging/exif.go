@@ -0,0 +1,268 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// EXIF方向值，1为正常方向
+const (
+	OrientationNormal = 1
+	orientationTag    = 0x0112
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// JPEGOptions JPEG元数据处理选项，两项可以组合使用
+type JPEGOptions struct {
+	AutoOrient bool // 按EXIF方向旋转像素，并将方向标记重置为正常
+	StripExif  bool // 删除APP1中的EXIF/XMP元数据
+	MaxPixels  int  // 自动旋转时允许解码的最大像素数
+	Quality    int  // 自动旋转后重新编码的JPEG质量
+}
+
+// jpegSegment JPEG头部段，start指向0xFF标记，end为段结束位置（不含）
+type jpegSegment struct {
+	marker     byte
+	start, end int
+}
+
+// payload 返回段内容（不含标记和长度）
+func (s jpegSegment) payload(data []byte) []byte {
+	return data[s.start+4 : s.end]
+}
+
+// isExif 检查是否为EXIF段
+func (s jpegSegment) isExif(data []byte) bool {
+	return s.marker == 0xE1 && bytes.HasPrefix(s.payload(data), exifHeader)
+}
+
+// parseJPEGSegments 解析扫描数据之前的所有段，返回各段及扫描数据的起始位置
+func parseJPEGSegments(data []byte) ([]jpegSegment, int, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, false
+	}
+
+	var segments []jpegSegment
+	i := 2
+	for i+2 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // 填充字节
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // SOS、EOI
+			return segments, i, true
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // 无长度的独立标记
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, 0, false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil, 0, false
+		}
+		segments = append(segments, jpegSegment{marker: marker, start: i, end: i + 2 + length})
+		i += 2 + length
+	}
+	return nil, 0, false
+}
+
+// orientationOffset 在TIFF结构的IFD0中查找方向标记，返回其取值的偏移和字节序
+func orientationOffset(tiff []byte) (int, binary.ByteOrder, bool) {
+	if len(tiff) < 8 {
+		return 0, nil, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, nil, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0, nil, false
+	}
+
+	ifd := int64(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > int64(len(tiff)) {
+		return 0, nil, false
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < count; k++ {
+		entry := int(ifd) + 2 + k*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// 方向标记类型为SHORT，取值位于值字段的前两个字节
+		if order.Uint16(tiff[entry:]) == orientationTag && order.Uint16(tiff[entry+2:]) == 3 {
+			return entry + 8, order, true
+		}
+	}
+	return 0, nil, false
+}
+
+// ReadOrientation 读取JPEG的EXIF方向，缺失或无效时返回OrientationNormal
+func ReadOrientation(data []byte) int {
+	segments, _, ok := parseJPEGSegments(data)
+	if !ok {
+		return OrientationNormal
+	}
+
+	for _, seg := range segments {
+		if !seg.isExif(data) {
+			continue
+		}
+		tiff := seg.payload(data)[len(exifHeader):]
+		offset, order, ok := orientationOffset(tiff)
+		if !ok {
+			return OrientationNormal
+		}
+		if orientation := int(order.Uint16(tiff[offset:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+		return OrientationNormal
+	}
+	return OrientationNormal
+}
+
+// Orient 按EXIF方向变换图片，使其正向显示
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转90°
+				dx, dy = h-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转90°
+				dx, dy = y, w-1-x
+			}
+			si := src.PixOffset(x, y)
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// StripExif 无损删除JPEG中的APP1元数据段（EXIF、XMP），非JPEG数据原样返回
+func StripExif(data []byte) ([]byte, bool) {
+	segments, scan, ok := parseJPEGSegments(data)
+	if !ok {
+		return data, false
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	buf.Write(data[:2])
+	stripped := false
+	for _, seg := range segments {
+		if seg.marker == 0xE1 {
+			stripped = true
+			continue
+		}
+		buf.Write(data[seg.start:seg.end])
+	}
+	if !stripped {
+		return data, false
+	}
+	buf.Write(data[scan:])
+	return buf.Bytes(), true
+}
+
+// ProcessJPEG 按选项自动旋转JPEG和/或删除元数据，返回处理后的数据及是否有修改
+// 自动旋转会重新编码像素，保留的元数据（EXIF、XMP、ICC配置）写回新图片且方向重置为正常
+func ProcessJPEG(data []byte, opts JPEGOptions) ([]byte, bool, error) {
+	orientation := OrientationNormal
+	if opts.AutoOrient {
+		orientation = ReadOrientation(data)
+	}
+
+	if orientation == OrientationNormal {
+		if opts.StripExif {
+			stripped, ok := StripExif(data)
+			return stripped, ok, nil
+		}
+		return data, false, nil
+	}
+
+	segments, _, ok := parseJPEGSegments(data)
+	if !ok {
+		return data, false, ErrUnsupportedFormat
+	}
+
+	img, _, err := Decode(bytes.NewReader(data), opts.MaxPixels)
+	if err != nil {
+		return data, false, err
+	}
+
+	var encoded bytes.Buffer
+	if err := EncodeJPEG(&encoded, Orient(img, orientation), opts.Quality); err != nil {
+		return data, false, err
+	}
+	pixels := encoded.Bytes()
+
+	var buf bytes.Buffer
+	buf.Grow(len(pixels) + len(data)/8)
+	buf.Write(pixels[:2])
+	for _, seg := range segments {
+		// 只保留APP1（EXIF、XMP）和APP2（ICC配置），其余段由编码器重新生成
+		if seg.marker != 0xE1 && seg.marker != 0xE2 {
+			continue
+		}
+		if seg.marker == 0xE1 && opts.StripExif {
+			continue
+		}
+		segment := bytes.Clone(data[seg.start:seg.end])
+		if seg.isExif(data) {
+			resetOrientation(segment[4+len(exifHeader):])
+		}
+		buf.Write(segment)
+	}
+	buf.Write(pixels[2:])
+	return buf.Bytes(), true, nil
+}
+
+// resetOrientation 将TIFF结构中的方向标记改为正常
+func resetOrientation(tiff []byte) {
+	if offset, order, ok := orientationOffset(tiff); ok {
+		order.PutUint16(tiff[offset:], OrientationNormal)
+	}
+}
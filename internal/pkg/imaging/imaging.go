@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	_ "image/png" // 注册PNG解码器
+	"io"
+)
+
+// 图片处理错误定义
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrImageTooLarge     = errors.New("image dimensions too large")
+)
+
+// Decode 解码图片（JPEG、PNG、GIF），先读取尺寸拒绝像素数超过maxPixels的图片，避免解压炸弹
+func Decode(r io.ReadSeeker, maxPixels int) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if maxPixels > 0 && config.Width*config.Height > maxPixels {
+		return nil, "", ErrImageTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s image: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// Square 居中裁剪为正方形并缩放到size×size
+func Square(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	return resize(img, image.Rect(x0, y0, x0+side, y0+side), size, size)
+}
+
+// Fit 按比例缩小到不超过width×height，不放大小图
+func Fit(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > width || h > height {
+		if w*height > h*width {
+			w, h = width, max(h*width/w, 1)
+		} else {
+			w, h = max(w*height/h, 1), height
+		}
+	}
+	return resize(img, bounds, w, h)
+}
+
+// EncodeJPEG 编码为JPEG，透明区域以白色填充
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	flattened := image.NewRGBA(bounds)
+	draw.Draw(flattened, bounds, &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flattened, bounds, img, bounds.Min, draw.Over)
+	return jpeg.Encode(w, flattened, &jpeg.Options{Quality: quality})
+}
+
+// resize 将src区域按区域平均（缩小）或最近邻（放大）缩放到width×height
+func resize(img image.Image, src image.Rectangle, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := src.Dx(), src.Dy()
+	if srcW == 0 || srcH == 0 {
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		sy0 := src.Min.Y + y*srcH/height
+		sy1 := max(sy0+1, src.Min.Y+(y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			sx0 := src.Min.X + x*srcW/width
+			sx1 := max(sx0+1, src.Min.X+(x+1)*srcW/width)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
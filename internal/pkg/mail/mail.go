@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Config 邮件配置
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailer 创建邮件发送器，未配置SMTP主机时返回仅记录日志的发送器
+func NewMailer(config Config) Mailer {
+	if config.Host == "" {
+		return &logMailer{}
+	}
+	return &smtpMailer{config: config}
+}
+
+// smtpMailer 通过SMTP发送邮件
+type smtpMailer struct {
+	config Config
+}
+
+// Send 发送纯文本邮件
+func (m *smtpMailer) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%d", m.config.Host, m.config.Port)
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	headers := []string{
+		"From: " + m.config.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	if err := smtp.SendMail(addr, auth, m.config.From, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// logMailer 将邮件内容写入日志（开发环境使用）
+type logMailer struct{}
+
+// Send 记录邮件内容
+func (m *logMailer) Send(to, subject, body string) error {
+	log.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ChecksumAlgorithm 校验和算法
+type ChecksumAlgorithm string
+
+const (
+	ChecksumSHA256 ChecksumAlgorithm = "sha256"
+	ChecksumMD5    ChecksumAlgorithm = "md5"
+)
+
+// 校验和错误定义
+var (
+	ErrInvalidChecksum  = newStorageError("invalid checksum format")
+	ErrChecksumMismatch = newStorageError("checksum mismatch")
+)
+
+// Checksum 客户端提供的校验和
+type Checksum struct {
+	Algorithm ChecksumAlgorithm
+	Value     string // 小写十六进制
+}
+
+// ParseChecksum 解析带算法前缀的校验和，如 "sha256:<hex>" 或 "md5:<hex>"
+// 未带前缀时根据长度推断（64位为SHA-256，32位为MD5）
+func ParseChecksum(s string) (*Checksum, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ErrInvalidChecksum
+	}
+
+	var algorithm ChecksumAlgorithm
+	value := s
+	if idx := strings.Index(s, ":"); idx >= 0 {
+		algorithm = ChecksumAlgorithm(strings.ToLower(s[:idx]))
+		value = s[idx+1:]
+	}
+	value = strings.ToLower(value)
+
+	if algorithm == "" {
+		switch len(value) {
+		case sha256.Size * 2:
+			algorithm = ChecksumSHA256
+		case md5.Size * 2:
+			algorithm = ChecksumMD5
+		default:
+			return nil, ErrInvalidChecksum
+		}
+	}
+
+	var expectedLen int
+	switch algorithm {
+	case ChecksumSHA256:
+		expectedLen = sha256.Size * 2
+	case ChecksumMD5:
+		expectedLen = md5.Size * 2
+	default:
+		return nil, ErrInvalidChecksum
+	}
+
+	if len(value) != expectedLen {
+		return nil, ErrInvalidChecksum
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return nil, ErrInvalidChecksum
+	}
+
+	return &Checksum{Algorithm: algorithm, Value: value}, nil
+}
+
+// NewHash 创建与校验和算法对应的哈希器
+func (c *Checksum) NewHash() hash.Hash {
+	if c.Algorithm == ChecksumMD5 {
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// Matches 检查计算出的摘要是否与校验和一致
+func (c *Checksum) Matches(sum []byte) bool {
+	return hex.EncodeToString(sum) == c.Value
+}
+
+// String 返回带算法前缀的校验和
+func (c *Checksum) String() string {
+	return string(c.Algorithm) + ":" + c.Value
+}
+
+// ChecksumReader 在读取数据的同时计算哈希，读取完成后可校验
+type ChecksumReader struct {
+	reader   io.Reader
+	hash     hash.Hash
+	expected *Checksum
+}
+
+// NewChecksumReader 创建校验读取器
+func NewChecksumReader(r io.Reader, expected *Checksum) *ChecksumReader {
+	h := expected.NewHash()
+	return &ChecksumReader{
+		reader:   io.TeeReader(r, h),
+		hash:     h,
+		expected: expected,
+	}
+}
+
+// Read 实现io.Reader
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
+
+// Verify 校验已读取数据的哈希，不一致时返回ErrChecksumMismatch
+func (r *ChecksumReader) Verify() error {
+	if !r.expected.Matches(r.hash.Sum(nil)) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// VerifyChecksum 读取全部数据并校验其哈希
+func VerifyChecksum(r io.Reader, expected *Checksum) error {
+	h := expected.NewHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return wrapStorageError("failed to calculate checksum", err)
+	}
+	if !expected.Matches(h.Sum(nil)) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 压缩文件的元数据
+const (
+	metadataCompressed   = "compressed"
+	metadataOriginalSize = "original-size"
+	compressionGzip      = "gzip"
+)
+
+// DefaultCompressTypes 默认压缩保存的类型，支持 text/* 形式的通配
+var DefaultCompressTypes = []string{"text/*", "application/json", "application/xml", "application/yaml", "application/toml"}
+
+// CompressingStorage 在底层存储之上透明地gzip压缩可压缩类型的文件
+// 按存储键的扩展名判断类型，只压缩大小已知且不小于minSize的文件，压缩标记和原始大小记录在对象的元数据中
+type CompressingStorage struct {
+	Storage
+	meta    MetadataStorage
+	types   []string
+	minSize int64
+}
+
+// NewCompressingStorage 创建压缩存储，底层存储需支持元数据；types为空时使用DefaultCompressTypes
+func NewCompressingStorage(inner Storage, types []string, minSize int64) (*CompressingStorage, error) {
+	meta, ok := inner.(MetadataStorage)
+	if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+
+	var normalized []string
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			normalized = append(normalized, t)
+		}
+	}
+	if len(normalized) == 0 {
+		normalized = DefaultCompressTypes
+	}
+
+	return &CompressingStorage{Storage: inner, meta: meta, types: normalized, minSize: minSize}, nil
+}
+
+// Save 保存文件，可压缩的文件压缩后保存
+func (s *CompressingStorage) Save(ctx context.Context, key string, data io.Reader, size int64) error {
+	if !s.shouldCompress(key, size) {
+		return s.Storage.Save(ctx, key, data, size)
+	}
+
+	// 边压缩边保存，压缩后的大小事先未知
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, data)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	metadata := map[string]string{
+		metadataCompressed:   compressionGzip,
+		metadataOriginalSize: strconv.FormatInt(size, 10),
+	}
+	err := s.meta.SaveWithMetadata(ctx, key, pr, -1, metadata)
+	// 保存失败时结束压缩协程
+	pr.CloseWithError(err)
+	return err
+}
+
+// Get 获取文件，压缩保存的文件解压后返回
+func (s *CompressingStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	compressed, _, err := s.compressedSize(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil || !compressed {
+		return reader, err
+	}
+
+	zr, err := gzip.NewReader(reader)
+	if err != nil {
+		reader.Close()
+		return nil, wrapStorageError("failed to decompress file", err)
+	}
+	return &limitedReadCloser{Reader: zr, Closer: reader}, nil
+}
+
+// GetRange 读取文件从offset开始的length个字节，压缩保存的文件需从头解压并跳过之前的内容
+func (s *CompressingStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	compressed, _, err := s.compressedSize(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		return s.Storage.GetRange(ctx, key, offset, length)
+	}
+
+	reader, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, wrapStorageError("failed to seek file", err)
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(reader, length), Closer: reader}, nil
+}
+
+// Stat 获取文件信息，压缩保存的文件返回原始大小
+func (s *CompressingStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	info, err := s.Storage.Stat(ctx, key)
+	if err != nil || info.IsDir {
+		return info, err
+	}
+
+	compressed, size, err := s.compressedSize(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		info.Size = size
+	}
+	return info, nil
+}
+
+// InitiateMultipartUpload 初始化分片上传，返回的上传ID中记录目标键，完成上传时据此压缩合并后的文件
+func (s *CompressingStorage) InitiateMultipartUpload(ctx context.Context, key string) (string, error) {
+	uploadID, err := s.Storage.InitiateMultipartUpload(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	// 以键的长度作前缀，键和底层上传ID中都可能包含任意分隔符
+	return fmt.Sprintf("%d:%s%s", len(key), key, uploadID), nil
+}
+
+// UploadPart 上传分片，分片在合并前不压缩
+func (s *CompressingStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, data io.Reader) (string, error) {
+	innerID, _ := splitCompressingUploadID(uploadID)
+	return s.Storage.UploadPart(ctx, innerID, partNumber, data)
+}
+
+// CompleteMultipartUpload 完成分片上传，合并后可压缩的文件重新压缩保存
+func (s *CompressingStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []string) error {
+	innerID, key := splitCompressingUploadID(uploadID)
+	if err := s.Storage.CompleteMultipartUpload(ctx, innerID, parts); err != nil {
+		return err
+	}
+
+	info, err := s.Storage.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !s.shouldCompress(key, info.Size) {
+		return nil
+	}
+
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return s.Save(ctx, key, reader, info.Size)
+}
+
+// AbortMultipartUpload 中止分片上传
+func (s *CompressingStorage) AbortMultipartUpload(ctx context.Context, uploadID string) error {
+	innerID, _ := splitCompressingUploadID(uploadID)
+	return s.Storage.AbortMultipartUpload(ctx, innerID)
+}
+
+// CleanupIncompleteUploads 清理底层存储中未完成的分片上传
+func (s *CompressingStorage) CleanupIncompleteUploads(ctx context.Context, olderThan time.Duration) (*UploadCleanupResult, error) {
+	inner, ok := s.Storage.(UploadCleaner)
+	if !ok {
+		return nil, ErrUploadCleanupUnsupported
+	}
+	return inner.CleanupIncompleteUploads(ctx, olderThan)
+}
+
+// GetURL 压缩保存的文件不能通过存储的直接链接访问
+func (s *CompressingStorage) GetURL(ctx context.Context, key string) (string, error) {
+	if err := s.checkDirectURL(ctx, key); err != nil {
+		return "", err
+	}
+	return s.Storage.GetURL(ctx, key)
+}
+
+// GetDownloadURL 压缩保存的文件不能通过存储的直接链接下载
+func (s *CompressingStorage) GetDownloadURL(ctx context.Context, key string, filename string) (string, error) {
+	if err := s.checkDirectURL(ctx, key); err != nil {
+		return "", err
+	}
+	return s.Storage.GetDownloadURL(ctx, key, filename)
+}
+
+// checkDirectURL 压缩保存的文件返回ErrDirectURLUnavailable
+func (s *CompressingStorage) checkDirectURL(ctx context.Context, key string) error {
+	compressed, _, err := s.compressedSize(ctx, key)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		return ErrDirectURLUnavailable
+	}
+	return nil
+}
+
+// shouldCompress 检查该键的文件是否应压缩保存
+func (s *CompressingStorage) shouldCompress(key string, size int64) bool {
+	if size < 0 || size < s.minSize {
+		return false
+	}
+	return MatchMimeType(s.types, GetMimeType(filepath.Base(key)))
+}
+
+// compressedSize 从元数据读取文件是否压缩保存及原始大小
+func (s *CompressingStorage) compressedSize(ctx context.Context, key string) (bool, int64, error) {
+	metadata, err := s.meta.GetMetadata(ctx, key)
+	if err != nil {
+		return false, 0, err
+	}
+	if metadata[metadataCompressed] != compressionGzip {
+		return false, 0, nil
+	}
+
+	size, err := strconv.ParseInt(metadata[metadataOriginalSize], 10, 64)
+	if err != nil {
+		return false, 0, wrapStorageError("invalid original size in metadata", err)
+	}
+	return true, size, nil
+}
+
+// splitCompressingUploadID 拆分压缩存储的上传ID为底层存储的上传ID和目标键
+func splitCompressingUploadID(uploadID string) (string, string) {
+	lengthText, rest, _ := strings.Cut(uploadID, ":")
+	length, err := strconv.Atoi(lengthText)
+	if err != nil || length < 0 || length > len(rest) {
+		return uploadID, ""
+	}
+	return rest[length:], rest[:length]
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// streamCopyBufferSize 流式复制时读取源文件使用的缓冲区大小，复制任意大小的文件内存占用都固定
+const streamCopyBufferSize = 1 << 20 // 1MB
+
+// StreamCopy 将src中的srcKey流式复制到dst的dstKey，src和dst可以是不同的存储
+// progress不为nil时每读取一段内容就以本次读取的字节数回调，可能被多个复制并发调用
+func StreamCopy(ctx context.Context, src Storage, srcKey string, dst Storage, dstKey string, size int64, progress func(n int64)) error {
+	reader, err := src.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var content io.Reader = bufio.NewReaderSize(reader, streamCopyBufferSize)
+	if progress != nil {
+		content = &progressReader{r: content, progress: progress}
+	}
+	return dst.Save(ctx, dstKey, content, size)
+}
+
+// progressReader 读取时报告进度
+type progressReader struct {
+	r        io.Reader
+	progress func(n int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.progress(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// defaultDownloadName 文件名清理后为空时使用的下载文件名
+const defaultDownloadName = "download"
+
+// SanitizeFilename 删除文件名中的控制字符（包括换行），并将路径分隔符替换为下划线
+// 用于响应头和压缩包条目，防止文件名注入响应头或改变解压路径
+func SanitizeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r) || r == unicode.ReplacementChar:
+			continue
+		case r == '/' || r == '\\':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	sanitized := strings.TrimSpace(b.String())
+	if sanitized == "" || sanitized == "." || sanitized == ".." {
+		return defaultDownloadName
+	}
+	return sanitized
+}
+
+// ContentDisposition 生成Content-Disposition响应头，disposition为attachment或inline
+// filename参数只包含可打印ASCII字符，其余字符替换为下划线；文件名含非ASCII字符时
+// 另外按RFC 5987以UTF-8编码的filename*参数提供原文件名，asciiOnly为true时不提供
+func ContentDisposition(disposition, filename string, asciiOnly bool) string {
+	filename = SanitizeFilename(filename)
+	fallback := asciiFilename(filename)
+
+	header := fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback)
+	if !asciiOnly && fallback != filename {
+		header += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return header
+}
+
+// asciiFilename 将非ASCII字符和引号、反斜杠、百分号替换为下划线，用作filename参数
+func asciiFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			b.WriteRune('_')
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// encodeRFC5987 按RFC 5987的attr-char对UTF-8字节做百分号编码
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,502 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// 加密文件格式：文件头（标识、用主密钥包装的数据密钥及其随机数、分段随机数前缀）后跟若干AES-256-GCM加密的分段
+// 每个分段加密encryptedSegmentSize字节明文，随机数由前缀、分段序号和是否最后一段组成，防止分段被重排或截断
+const (
+	encryptedSegmentSize = 64 * 1024
+	encryptionKeySize    = 32
+	gcmNonceSize         = 12
+	gcmTagSize           = 16
+	segmentPrefixSize    = gcmNonceSize - 5
+	wrappedKeySize       = encryptionKeySize + gcmTagSize
+	encryptedHeaderSize  = int64(len(encryptedMagic) + gcmNonceSize + wrappedKeySize + segmentPrefixSize)
+	encryptedSegmentCost = encryptedSegmentSize + gcmTagSize
+)
+
+// encryptedMagic 加密文件头的标识
+const encryptedMagic = "\x00CSENC1\x00"
+
+// 加密相关错误
+var (
+	ErrInvalidEncryptionKey = newStorageError("encryption key must be 32 bytes")
+	ErrDecryptionFailed     = newStorageError("failed to decrypt file")
+	ErrNotEncrypted         = newStorageError("file is not encrypted")
+)
+
+// EncryptedStorage 在底层存储之上透明地加解密文件内容，每个文件使用独立的数据密钥
+// allowPlaintext为true时，没有加密文件头的文件（启用加密前保存的文件）按明文读取
+type EncryptedStorage struct {
+	Storage
+	config         StorageConfig
+	masterKey      cipher.AEAD
+	allowPlaintext bool
+}
+
+// NewEncryptedStorage 创建加密存储，masterKey为32字节的AES-256主密钥，用于包装每个文件的数据密钥
+func NewEncryptedStorage(inner Storage, masterKey []byte, allowPlaintext bool) (*EncryptedStorage, error) {
+	if len(masterKey) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	config := inner.Config()
+	config.Encrypted = true
+	config.EncryptionKey = nil
+	config.AllowPlaintext = allowPlaintext
+
+	return &EncryptedStorage{
+		Storage:        inner,
+		config:         config,
+		masterKey:      aead,
+		allowPlaintext: allowPlaintext,
+	}, nil
+}
+
+// Config 获取存储配置，不包含主密钥
+func (s *EncryptedStorage) Config() StorageConfig {
+	return s.config
+}
+
+// Save 加密后保存文件
+func (s *EncryptedStorage) Save(ctx context.Context, key string, data io.Reader, size int64) error {
+	reader, err := s.newEncryptReader(data)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		size = EncryptedSize(size)
+	}
+	return s.Storage.Save(ctx, key, reader, size)
+}
+
+// SaveWithMetadata 加密后连同元数据保存文件，底层存储需支持元数据
+func (s *EncryptedStorage) SaveWithMetadata(ctx context.Context, key string, data io.Reader, size int64, metadata map[string]string) error {
+	inner, ok := s.Storage.(MetadataStorage)
+	if !ok {
+		return ErrMetadataUnsupported
+	}
+
+	reader, err := s.newEncryptReader(data)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		size = EncryptedSize(size)
+	}
+	return inner.SaveWithMetadata(ctx, key, reader, size, metadata)
+}
+
+// GetMetadata 获取文件的元数据，元数据不加密
+func (s *EncryptedStorage) GetMetadata(ctx context.Context, key string) (map[string]string, error) {
+	inner, ok := s.Storage.(MetadataStorage)
+	if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+	return inner.GetMetadata(ctx, key)
+}
+
+// Get 获取并解密文件
+func (s *EncryptedStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, encryptedHeaderSize)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		reader.Close()
+		return nil, wrapStorageError("failed to read file header", err)
+	}
+
+	dataKey, prefix, err := s.openHeader(header[:n])
+	if errors.Is(err, ErrNotEncrypted) && s.allowPlaintext {
+		// 启用加密前保存的明文文件
+		return &limitedReadCloser{Reader: io.MultiReader(bytes.NewReader(header[:n]), reader), Closer: reader}, nil
+	}
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &limitedReadCloser{
+		Reader: &decryptReader{src: bufio.NewReader(reader), aead: dataKey, prefix: prefix, lastIndex: -1},
+		Closer: reader,
+	}, nil
+}
+
+// GetRange 读取文件明文从offset开始的length个字节，只获取并解密覆盖该范围的分段
+func (s *EncryptedStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header, err := s.readHeader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, prefix, err := s.openHeader(header)
+	if errors.Is(err, ErrNotEncrypted) && s.allowPlaintext {
+		return s.Storage.GetRange(ctx, key, offset, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.Storage.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	plainSize, ok := PlaintextSize(info.Size)
+	if !ok {
+		return nil, ErrDecryptionFailed
+	}
+	length = min(length, plainSize-offset)
+	if length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	firstSegment := offset / encryptedSegmentSize
+	lastSegment := (offset + length - 1) / encryptedSegmentSize
+	cipherOffset := encryptedHeaderSize + firstSegment*encryptedSegmentCost
+	cipherLength := min((lastSegment-firstSegment+1)*encryptedSegmentCost, info.Size-cipherOffset)
+
+	reader, err := s.Storage.GetRange(ctx, key, cipherOffset, cipherLength)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := &decryptReader{
+		src:       bufio.NewReader(reader),
+		aead:      dataKey,
+		prefix:    prefix,
+		index:     uint32(firstSegment),
+		lastIndex: segmentCount(plainSize) - 1,
+	}
+	// 跳过第一个分段中范围之前的内容
+	if _, err := io.CopyN(io.Discard, decrypted, offset-firstSegment*encryptedSegmentSize); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &limitedReadCloser{Reader: io.LimitReader(decrypted, length), Closer: reader}, nil
+}
+
+// Stat 获取文件信息，加密文件的大小为明文大小
+func (s *EncryptedStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	info, err := s.Storage.Stat(ctx, key)
+	if err != nil || info.IsDir || info.Size < encryptedHeaderSize {
+		return info, err
+	}
+
+	header, err := s.readHeader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(header), encryptedMagic) {
+		return info, nil
+	}
+	if plainSize, ok := PlaintextSize(info.Size); ok {
+		info.Size = plainSize
+	}
+	return info, nil
+}
+
+// InitiateMultipartUpload 初始化分片上传，返回的上传ID中记录目标键，完成上传时据此加密合并后的文件
+func (s *EncryptedStorage) InitiateMultipartUpload(ctx context.Context, key string) (string, error) {
+	uploadID, err := s.Storage.InitiateMultipartUpload(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return uploadID + "|" + key, nil
+}
+
+// UploadPart 上传分片，分片在合并前以明文暂存
+func (s *EncryptedStorage) UploadPart(ctx context.Context, uploadID string, partNumber int, data io.Reader) (string, error) {
+	innerID, _ := splitUploadID(uploadID)
+	return s.Storage.UploadPart(ctx, innerID, partNumber, data)
+}
+
+// CompleteMultipartUpload 完成分片上传，合并后将文件加密保存
+func (s *EncryptedStorage) CompleteMultipartUpload(ctx context.Context, uploadID string, parts []string) error {
+	innerID, key := splitUploadID(uploadID)
+	if err := s.Storage.CompleteMultipartUpload(ctx, innerID, parts); err != nil {
+		return err
+	}
+
+	reader, err := s.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return s.Save(ctx, key, reader, -1)
+}
+
+// AbortMultipartUpload 中止分片上传
+func (s *EncryptedStorage) AbortMultipartUpload(ctx context.Context, uploadID string) error {
+	innerID, _ := splitUploadID(uploadID)
+	return s.Storage.AbortMultipartUpload(ctx, innerID)
+}
+
+// CleanupIncompleteUploads 清理底层存储中未完成的分片上传
+func (s *EncryptedStorage) CleanupIncompleteUploads(ctx context.Context, olderThan time.Duration) (*UploadCleanupResult, error) {
+	inner, ok := s.Storage.(UploadCleaner)
+	if !ok {
+		return nil, ErrUploadCleanupUnsupported
+	}
+	return inner.CleanupIncompleteUploads(ctx, olderThan)
+}
+
+// GetURL 加密文件不能通过存储的直接链接访问
+func (s *EncryptedStorage) GetURL(ctx context.Context, key string) (string, error) {
+	return "", ErrDirectURLUnavailable
+}
+
+// GetDownloadURL 加密文件不能通过存储的直接链接下载
+func (s *EncryptedStorage) GetDownloadURL(ctx context.Context, key string, filename string) (string, error) {
+	return "", ErrDirectURLUnavailable
+}
+
+// readHeader 读取文件开头可能是加密文件头的部分，文件较短时返回全部内容
+func (s *EncryptedStorage) readHeader(ctx context.Context, key string) ([]byte, error) {
+	reader, err := s.Storage.GetRange(ctx, key, 0, encryptedHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	header, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, wrapStorageError("failed to read file header", err)
+	}
+	return header, nil
+}
+
+// openHeader 解析加密文件头，解包出数据密钥和分段随机数前缀；不是加密文件时返回ErrNotEncrypted
+func (s *EncryptedStorage) openHeader(header []byte) (cipher.AEAD, []byte, error) {
+	if int64(len(header)) < encryptedHeaderSize || !strings.HasPrefix(string(header), encryptedMagic) {
+		return nil, nil, ErrNotEncrypted
+	}
+
+	rest := header[len(encryptedMagic):]
+	keyNonce, wrappedKey, prefix := rest[:gcmNonceSize], rest[gcmNonceSize:gcmNonceSize+wrappedKeySize], rest[gcmNonceSize+wrappedKeySize:]
+	dataKey, err := s.masterKey.Open(nil, keyNonce, wrappedKey, []byte(encryptedMagic))
+	if err != nil {
+		return nil, nil, wrapStorageError(ErrDecryptionFailed.message, err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, prefix, nil
+}
+
+// newEncryptReader 生成新的数据密钥，返回输出加密文件头和加密分段的读取器
+func (s *EncryptedStorage) newEncryptReader(src io.Reader) (io.Reader, error) {
+	random := make([]byte, encryptionKeySize+gcmNonceSize+segmentPrefixSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, wrapStorageError("failed to generate data key", err)
+	}
+	dataKey, keyNonce, prefix := random[:encryptionKeySize], random[encryptionKeySize:encryptionKeySize+gcmNonceSize], random[encryptionKeySize+gcmNonceSize:]
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, encryptedHeaderSize)
+	header = append(header, encryptedMagic...)
+	header = append(header, keyNonce...)
+	header = s.masterKey.Seal(header, keyNonce, dataKey, []byte(encryptedMagic))
+	header = append(header, prefix...)
+
+	return &encryptReader{
+		src:    bufio.NewReader(src),
+		aead:   aead,
+		prefix: prefix,
+		plain:  make([]byte, encryptedSegmentSize),
+		out:    header,
+	}, nil
+}
+
+// EncryptedSize 返回明文大小为size的文件加密后的大小
+func EncryptedSize(size int64) int64 {
+	return encryptedHeaderSize + size + segmentCount(size)*gcmTagSize
+}
+
+// PlaintextSize 由加密文件的大小推算明文大小，大小不可能是加密文件时返回false
+func PlaintextSize(size int64) (int64, bool) {
+	body := size - encryptedHeaderSize
+	if body < gcmTagSize {
+		return 0, false
+	}
+	segments := (body + encryptedSegmentCost - 1) / encryptedSegmentCost
+	plain := body - segments*gcmTagSize
+	if plain < 0 || segmentCount(plain) != segments {
+		return 0, false
+	}
+	return plain, true
+}
+
+// segmentCount 明文大小为size的文件加密后的分段数，空文件也有一个分段
+func segmentCount(size int64) int64 {
+	return max(1, (size+encryptedSegmentSize-1)/encryptedSegmentSize)
+}
+
+// segmentNonce 生成第index个分段的随机数
+func segmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, gcmNonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[segmentPrefixSize:], index)
+	if last {
+		nonce[gcmNonceSize-1] = 1
+	}
+	return nonce
+}
+
+// splitUploadID 拆分加密存储的上传ID为底层存储的上传ID和目标键
+func splitUploadID(uploadID string) (string, string) {
+	innerID, key, _ := strings.Cut(uploadID, "|")
+	return innerID, key
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, wrapStorageError("failed to create cipher", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, wrapStorageError("failed to create cipher", err)
+	}
+	return aead, nil
+}
+
+// encryptReader 逐段加密明文的读取器，先输出文件头
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	plain  []byte
+	out    []byte
+	done   bool
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealSegment 读取并加密下一个分段，读到明文末尾的分段标记为最后一段
+func (r *encryptReader) sealSegment() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.out[:0], segmentNonce(r.prefix, r.index, last), r.plain[:n], nil)
+	r.index++
+	r.done = last
+	return nil
+}
+
+// decryptReader 逐段解密的读取器
+// lastIndex为最后一个分段的序号，小于0时读到密文末尾的分段即为最后一段
+type decryptReader struct {
+	src       *bufio.Reader
+	aead      cipher.AEAD
+	prefix    []byte
+	index     uint32
+	lastIndex int64
+	sealed    []byte
+	out       []byte
+	done      bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.openSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// openSegment 读取并解密下一个分段，分段被篡改、重排或截断时返回ErrDecryptionFailed
+func (r *decryptReader) openSegment() error {
+	if r.sealed == nil {
+		r.sealed = make([]byte, encryptedSegmentCost)
+	}
+
+	n, err := io.ReadFull(r.src, r.sealed)
+	atEnd := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		atEnd = true
+	case err != nil:
+		return err
+	}
+
+	last := int64(r.index) == r.lastIndex
+	if r.lastIndex < 0 {
+		if !atEnd {
+			if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+				atEnd = true
+			} else if err != nil {
+				return err
+			}
+		}
+		last = atEnd
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0], segmentNonce(r.prefix, r.index, last), r.sealed[:n], nil)
+	if err != nil {
+		return ErrDecryptionFailed
+	}
+	r.out = plain
+	r.index++
+	r.done = last
+	return nil
+}
@@ -3,16 +3,23 @@ package storage
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// metadataDir 本地存储保存文件元数据的目录，位于存储根目录下
+const metadataDir = ".meta"
+
 // LocalStorage 本地存储实现
 type LocalStorage struct {
 	config StorageConfig
@@ -80,9 +87,57 @@ func (s *LocalStorage) Save(ctx context.Context, key string, data io.Reader, siz
 		return wrapStorageError("failed to rename file", err)
 	}
 
+	// 覆盖后原有的元数据不再适用
+	s.removeMetadata(key)
+
+	return nil
+}
+
+// SaveWithMetadata 保存文件，元数据写入存储根目录下 .meta/ 中与文件对应的附属文件
+func (s *LocalStorage) SaveWithMetadata(ctx context.Context, key string, data io.Reader, size int64, metadata map[string]string) error {
+	if err := s.Save(ctx, key, data, size); err != nil {
+		return err
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(metadata)
+	if err != nil {
+		return wrapStorageError("failed to encode metadata", err)
+	}
+	metaPath := s.getMetadataPath(key)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return wrapStorageError("failed to create metadata directory", err)
+	}
+	if err := os.WriteFile(metaPath, content, 0644); err != nil {
+		return wrapStorageError("failed to write metadata", err)
+	}
+
 	return nil
 }
 
+// GetMetadata 获取文件的元数据，没有元数据时返回空映射
+func (s *LocalStorage) GetMetadata(ctx context.Context, key string) (map[string]string, error) {
+	if !IsValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	content, err := os.ReadFile(s.getMetadataPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, wrapStorageError("failed to read metadata", err)
+	}
+
+	metadata := map[string]string{}
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, wrapStorageError("failed to decode metadata", err)
+	}
+	return metadata, nil
+}
+
 // Get 获取文件
 func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 	if !IsValidKey(key) {
@@ -102,6 +157,22 @@ func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, erro
 	return f, nil
 }
 
+// GetRange 读取文件从offset开始的length个字节
+func (s *LocalStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f := reader.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, wrapStorageError("failed to seek file", err)
+	}
+
+	return &limitedReadCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
 // Delete 删除文件
 func (s *LocalStorage) Delete(ctx context.Context, key string) error {
 	if !IsValidKey(key) {
@@ -116,6 +187,7 @@ func (s *LocalStorage) Delete(ctx context.Context, key string) error {
 		}
 		return wrapStorageError("failed to delete file", err)
 	}
+	s.removeMetadata(key)
 
 	// 尝试删除空目录
 	s.cleanupEmptyDirs(filepath.Dir(filePath))
@@ -211,6 +283,18 @@ func (s *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
 		return wrapStorageError("failed to copy file", err)
 	}
 
+	// 元数据随文件复制
+	s.removeMetadata(dstKey)
+	if content, err := os.ReadFile(s.getMetadataPath(srcKey)); err == nil {
+		metaPath := s.getMetadataPath(dstKey)
+		if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+			return wrapStorageError("failed to create metadata directory", err)
+		}
+		if err := os.WriteFile(metaPath, content, 0644); err != nil {
+			return wrapStorageError("failed to copy metadata", err)
+		}
+	}
+
 	return nil
 }
 
@@ -231,6 +315,9 @@ func (s *LocalStorage) Move(ctx context.Context, srcKey, dstKey string) error {
 	if err := os.Rename(srcPath, dstPath); err != nil {
 		return wrapStorageError("failed to move file", err)
 	}
+	if err := s.moveMetadata(srcKey, dstKey); err != nil {
+		return err
+	}
 
 	// 清理源目录
 	s.cleanupEmptyDirs(filepath.Dir(srcPath))
@@ -309,6 +396,11 @@ func (s *LocalStorage) DeleteDir(ctx context.Context, path string) error {
 	if err := os.RemoveAll(dirPath); err != nil {
 		return wrapStorageError("failed to delete directory", err)
 	}
+	metaDir := filepath.Join(s.config.LocalPath, metadataDir, path)
+	if err := os.RemoveAll(metaDir); err != nil {
+		return wrapStorageError("failed to delete metadata directory", err)
+	}
+	s.cleanupEmptyDirs(filepath.Dir(metaDir))
 
 	// 清理父目录
 	s.cleanupEmptyDirs(filepath.Dir(dirPath))
@@ -329,6 +421,12 @@ func (s *LocalStorage) InitiateMultipartUpload(ctx context.Context, key string)
 		return "", wrapStorageError("failed to create multipart upload directory", err)
 	}
 
+	// 记录目标键，完成上传时合并到该键
+	if err := os.WriteFile(filepath.Join(tempDir, "key.txt"), []byte(key), 0644); err != nil {
+		os.RemoveAll(tempDir)
+		return "", wrapStorageError("failed to save upload key", err)
+	}
+
 	return uploadID, nil
 }
 
@@ -421,6 +519,7 @@ func (s *LocalStorage) CompleteMultipartUpload(ctx context.Context, uploadID str
 	if err := os.Rename(tempFilePath, filePath); err != nil {
 		return wrapStorageError("failed to rename output file", err)
 	}
+	s.removeMetadata(key)
 
 	// 清理临时目录
 	os.RemoveAll(tempDir)
@@ -439,6 +538,72 @@ func (s *LocalStorage) AbortMultipartUpload(ctx context.Context, uploadID string
 	return nil
 }
 
+// CleanupIncompleteUploads 删除最后写入时间早于olderThan之前的分片上传临时目录
+func (s *LocalStorage) CleanupIncompleteUploads(ctx context.Context, olderThan time.Duration) (*UploadCleanupResult, error) {
+	result := &UploadCleanupResult{}
+	entries, err := os.ReadDir(filepath.Join(s.config.LocalPath, ".multipart"))
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, wrapStorageError("failed to list multipart uploads", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if !entry.IsDir() {
+			continue
+		}
+
+		tempDir := s.getMultipartUploadDir(entry.Name())
+		lastWrite, size, err := multipartDirUsage(tempDir)
+		if err != nil {
+			result.Failed++
+			continue
+		}
+		if lastWrite.After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(tempDir); err != nil {
+			result.Failed++
+			continue
+		}
+		result.Aborted++
+		result.ReclaimedBytes += size
+	}
+	return result, nil
+}
+
+// multipartDirUsage 统计分片上传临时目录中文件的最后修改时间和总大小
+func multipartDirUsage(dir string) (time.Time, int64, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	lastWrite := info.ModTime()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		size += info.Size()
+		if info.ModTime().After(lastWrite) {
+			lastWrite = info.ModTime()
+		}
+	}
+	return lastWrite, size, nil
+}
+
 // GetURL 获取文件URL（本地存储返回文件路径）
 func (s *LocalStorage) GetURL(ctx context.Context, key string) (string, error) {
 	if !IsValidKey(key) {
@@ -448,14 +613,13 @@ func (s *LocalStorage) GetURL(ctx context.Context, key string) (string, error) {
 	return s.getFilePath(key), nil
 }
 
-// GetDownloadURL 获取下载URL
+// GetDownloadURL 本地存储没有可直接访问的下载URL，返回ErrDirectURLUnavailable
 func (s *LocalStorage) GetDownloadURL(ctx context.Context, key string, filename string) (string, error) {
 	if !IsValidKey(key) {
 		return "", ErrInvalidKey
 	}
 
-	// 本地存储直接返回文件路径
-	return s.getFilePath(key), nil
+	return "", ErrDirectURLUnavailable
 }
 
 // 辅助方法
@@ -465,6 +629,41 @@ func (s *LocalStorage) getFilePath(key string) string {
 	return filepath.Join(s.config.LocalPath, key)
 }
 
+// getMetadataPath 获取文件元数据附属文件的路径，位于存储根目录下的 .meta/ 中，不会与文件键冲突
+func (s *LocalStorage) getMetadataPath(key string) string {
+	return filepath.Join(s.config.LocalPath, metadataDir, key+".meta")
+}
+
+// removeMetadata 删除文件的元数据附属文件
+func (s *LocalStorage) removeMetadata(key string) {
+	metaPath := s.getMetadataPath(key)
+	if err := os.Remove(metaPath); err == nil {
+		s.cleanupEmptyDirs(filepath.Dir(metaPath))
+	}
+}
+
+// moveMetadata 移动文件或目录时一并移动元数据，目标原有的元数据被替换
+func (s *LocalStorage) moveMetadata(srcKey, dstKey string) error {
+	s.removeMetadata(dstKey)
+	moves := [][2]string{
+		{s.getMetadataPath(srcKey), s.getMetadataPath(dstKey)},
+		{filepath.Join(s.config.LocalPath, metadataDir, srcKey), filepath.Join(s.config.LocalPath, metadataDir, dstKey)},
+	}
+	for _, move := range moves {
+		if _, err := os.Stat(move[0]); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(move[1]), 0755); err != nil {
+			return wrapStorageError("failed to create metadata directory", err)
+		}
+		if err := os.Rename(move[0], move[1]); err != nil {
+			return wrapStorageError("failed to move metadata", err)
+		}
+		s.cleanupEmptyDirs(filepath.Dir(move[0]))
+	}
+	return nil
+}
+
 // getMultipartUploadDir 获取分片上传临时目录
 func (s *LocalStorage) getMultipartUploadDir(uploadID string) string {
 	return filepath.Join(s.config.LocalPath, ".multipart", uploadID)
@@ -486,12 +685,11 @@ func (s *LocalStorage) calculateETag(filePath string) (string, error) {
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-// cleanupEmptyDirs 清理空目录
+// cleanupEmptyDirs 从dir开始向上删除空目录，到存储根目录为止；dir不在存储根目录内时不删除任何目录
 func (s *LocalStorage) cleanupEmptyDirs(dir string) {
 	for {
-		// 检查是否在存储根目录内
-		rel, err := filepath.Rel(s.config.LocalPath, dir)
-		if err != nil || rel == "." || rel == ".." || filepath.HasPrefix(rel, "..") {
+		// 每次删除前确认目录在存储根目录之内，根目录本身不删除
+		if !s.withinRoot(dir) {
 			break
 		}
 
@@ -511,6 +709,40 @@ func (s *LocalStorage) cleanupEmptyDirs(dir string) {
 	}
 }
 
+// withinRoot 判断path是否位于存储根目录之内（不含根目录本身），两者按绝对路径比较
+func (s *LocalStorage) withinRoot(path string) bool {
+	root, err := filepath.Abs(s.config.LocalPath)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || filepath.IsAbs(rel) {
+		return false
+	}
+	// 只排除".."路径段，"..a"这样的目录名仍在根目录内
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// StorageStats 返回存储目录所在文件系统的容量和使用情况，不统计文件数
+func (s *LocalStorage) StorageStats(ctx context.Context) (*StorageStats, error) {
+	usage, err := s.GetDiskUsage()
+	if err != nil {
+		return nil, wrapStorageError("failed to get disk usage", err)
+	}
+	return &StorageStats{
+		Type:    StorageTypeLocal,
+		Total:   usage.Total,
+		Used:    usage.Used,
+		Free:    usage.Free,
+		Objects: -1,
+	}, nil
+}
+
 // DiskUsage 获取磁盘使用情况
 type DiskUsage struct {
 	Total uint64 `json:"total"`
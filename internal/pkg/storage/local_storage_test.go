@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLocalStorage 在临时目录下创建 base/root/storage 作为存储根目录，返回存储和base目录
+func newTestLocalStorage(t *testing.T) (*LocalStorage, string) {
+	base := t.TempDir()
+	s, err := NewLocalStorage(StorageConfig{Type: StorageTypeLocal, LocalPath: filepath.Join(base, "root", "storage")})
+	require.NoError(t, err)
+	return s, base
+}
+
+// TestCleanupEmptyDirs_OutsideRoot 存储根目录之外的空目录不会被删除
+func TestCleanupEmptyDirs_OutsideRoot(t *testing.T) {
+	s, base := newTestLocalStorage(t)
+
+	outside := filepath.Join(base, "x")
+	require.NoError(t, os.MkdirAll(outside, 0755))
+
+	s.cleanupEmptyDirs(filepath.Join(s.config.LocalPath, "../../x"))
+	s.cleanupEmptyDirs(filepath.Join(s.config.LocalPath, ".."))
+	s.cleanupEmptyDirs(base)
+
+	assert.DirExists(t, outside)
+	assert.DirExists(t, filepath.Join(base, "root"))
+	assert.DirExists(t, s.config.LocalPath)
+
+	// 路径遍历的键在存储接口上直接被拒绝
+	assert.ErrorIs(t, s.Delete(context.Background(), "../../x"), ErrInvalidKey)
+	assert.DirExists(t, outside)
+}
+
+// TestCleanupEmptyDirs_StopsAtRoot 删除文件后逐级清理空目录，保留存储根目录
+func TestCleanupEmptyDirs_StopsAtRoot(t *testing.T) {
+	s, _ := newTestLocalStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, s.Save(ctx, "..a/b/c.txt", strings.NewReader("data"), 4))
+	require.NoError(t, s.Delete(ctx, "..a/b/c.txt"))
+
+	assert.NoDirExists(t, filepath.Join(s.config.LocalPath, "..a"))
+	assert.DirExists(t, s.config.LocalPath)
+}
+
+// TestWithinRoot 相对路径的存储根目录按绝对路径比较
+func TestWithinRoot(t *testing.T) {
+	s := &LocalStorage{config: StorageConfig{LocalPath: "./storage/uploads"}}
+	abs, err := filepath.Abs("./storage/uploads")
+	require.NoError(t, err)
+
+	assert.True(t, s.withinRoot(filepath.Join(abs, "user", "dir")))
+	assert.True(t, s.withinRoot("storage/uploads/..a"))
+	assert.False(t, s.withinRoot(abs))
+	assert.False(t, s.withinRoot("./storage/uploads/../other"))
+	assert.False(t, s.withinRoot("/"))
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultMimeType 未知扩展名使用的MIME类型
+const DefaultMimeType = "application/octet-stream"
+
+// defaultMimeTypes 内置的扩展名到MIME类型映射
+var defaultMimeTypes = map[string]string{
+	// 文本
+	".txt":  "text/plain",
+	".log":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".tsv":  "text/tab-separated-values",
+	".html": "text/html",
+	".htm":  "text/html",
+	".css":  "text/css",
+	".js":   "application/javascript",
+	".mjs":  "application/javascript",
+	".json": "application/json",
+	".xml":  "application/xml",
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".toml": "application/toml",
+	".ics":  "text/calendar",
+
+	// 图片
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".bmp":  "image/bmp",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".ico":  "image/vnd.microsoft.icon",
+
+	// 音频
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/opus",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+
+	// 视频
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mkv":  "video/x-matroska",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+	".ogv":  "video/ogg",
+
+	// 压缩包
+	".zip": "application/zip",
+	".tar": "application/x-tar",
+	".gz":  "application/gzip",
+	".tgz": "application/gzip",
+	".bz2": "application/x-bzip2",
+	".xz":  "application/x-xz",
+	".7z":  "application/x-7z-compressed",
+	".rar": "application/x-rar-compressed",
+
+	// 文档
+	".pdf":  "application/pdf",
+	".rtf":  "application/rtf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".epub": "application/epub+zip",
+}
+
+var (
+	mimeMu    sync.RWMutex
+	mimeTypes = defaultMimeTypes
+)
+
+// RegisterMimeTypes 将自定义映射合并到内置映射之上，扩展名不区分大小写，可省略前导点
+func RegisterMimeTypes(overrides map[string]string) {
+	if len(overrides) == 0 {
+		return
+	}
+
+	mimeMu.Lock()
+	defer mimeMu.Unlock()
+
+	merged := make(map[string]string, len(mimeTypes)+len(overrides))
+	for ext, mimeType := range mimeTypes {
+		merged[ext] = mimeType
+	}
+	for ext, mimeType := range overrides {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		mimeType = strings.TrimSpace(mimeType)
+		if ext == "" || mimeType == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		merged[ext] = mimeType
+	}
+	mimeTypes = merged
+}
+
+// GetMimeType 根据扩展名获取MIME类型，未知扩展名返回DefaultMimeType
+func GetMimeType(filename string) string {
+	ext := strings.ToLower(GetFileExtension(filename))
+
+	mimeMu.RLock()
+	mimeType, ok := mimeTypes[ext]
+	mimeMu.RUnlock()
+
+	if !ok {
+		return DefaultMimeType
+	}
+	return mimeType
+}
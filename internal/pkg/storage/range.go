@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeNotSatisfiable 请求的范围超出内容大小
+var ErrRangeNotSatisfiable = newStorageError("range not satisfiable")
+
+// ByteRange 内容中从Offset开始、长度为Length的字节范围
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// ContentRange 返回206响应的Content-Range头，size为内容总大小
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Offset, r.Offset+r.Length-1, size)
+}
+
+// ParseRange 按RFC 7233解析单个范围的Range头（bytes=start-end、bytes=start-、bytes=-suffix），结束位置超出内容时截断
+// 没有Range头、格式无法识别或包含多个范围时返回nil，应返回完整内容；范围起点超出内容时返回ErrRangeNotSatisfiable
+func ParseRange(header string, size int64) (*ByteRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	startText, endText, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	// 后缀范围：最后N个字节
+	if startText == "" {
+		suffix, err := strconv.ParseInt(endText, 10, 64)
+		if err != nil || suffix < 0 {
+			return nil, nil
+		}
+		if suffix == 0 || size == 0 {
+			return nil, ErrRangeNotSatisfiable
+		}
+		suffix = min(suffix, size)
+		return &ByteRange{Offset: size - suffix, Length: suffix}, nil
+	}
+
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if endText != "" {
+		if end, err = strconv.ParseInt(endText, 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return nil, ErrRangeNotSatisfiable
+	}
+	return &ByteRange{Offset: start, Length: end - start + 1}, nil
+}
+
+// limitedReadCloser 只读取部分内容、关闭时关闭底层文件的读取器
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SniffLength 内容嗅探读取的字节数，与http.DetectContentType一致
+const SniffLength = 512
+
+// DetectMimeType 根据内容开头的字节嗅探MIME类型（不含charset等参数），无法识别时返回DefaultMimeType
+func DetectMimeType(head []byte) string {
+	detected := http.DetectContentType(head)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		return DefaultMimeType
+	}
+	return mediaType
+}
+
+// MimeSniffer 作为io.Writer接收写入存储的内容，保留开头的SniffLength字节用于嗅探
+type MimeSniffer struct {
+	head []byte
+}
+
+func (s *MimeSniffer) Write(p []byte) (int, error) {
+	if remaining := SniffLength - len(s.head); remaining > 0 {
+		s.head = append(s.head, p[:min(remaining, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// MimeType 返回已写入内容的嗅探结果
+func (s *MimeSniffer) MimeType() string {
+	return DetectMimeType(s.head)
+}
+
+// DefaultInlineTypes 默认允许内联展示的类型，支持 image/* 形式的通配
+var DefaultInlineTypes = []string{"image/*", "video/*", "audio/*", "application/pdf", "text/plain"}
+
+// neverInlineTypes 可执行脚本的类型，即使匹配允许列表也只能作为附件下载，避免同源XSS
+var neverInlineTypes = map[string]bool{
+	"image/svg+xml":          true,
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+var (
+	inlineMu    sync.RWMutex
+	inlineTypes = DefaultInlineTypes
+)
+
+// RegisterInlineTypes 设置允许内联展示的类型，替换默认列表；类型不区分大小写，为空时保留默认列表
+func RegisterInlineTypes(patterns []string) {
+	var normalized []string
+	for _, pattern := range patterns {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+			normalized = append(normalized, pattern)
+		}
+	}
+	if len(normalized) == 0 {
+		return
+	}
+
+	inlineMu.Lock()
+	defer inlineMu.Unlock()
+	inlineTypes = normalized
+}
+
+// IsInlineSafe 检查该类型（应为内容嗅探结果）的内容能否以inline方式在浏览器中展示
+func IsInlineSafe(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if mimeType == "" || neverInlineTypes[mimeType] {
+		return false
+	}
+
+	inlineMu.RLock()
+	defer inlineMu.RUnlock()
+	return MatchMimeType(inlineTypes, mimeType)
+}
+
+// MatchMimeType 检查类型是否匹配列表中的任一类型，支持 image/* 形式的通配；列表中的类型应已是小写
+func MatchMimeType(patterns []string, mimeType string) bool {
+	for _, pattern := range patterns {
+		if pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
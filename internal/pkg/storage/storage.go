@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -30,6 +31,9 @@ type StorageConfig struct {
 	AccessKey  string
 	SecretKey  string
 	UseSSL     bool
+	Encrypted      bool   // 是否加密保存文件内容
+	EncryptionKey  []byte // 加密使用的32字节主密钥
+	AllowPlaintext bool   // 加密时是否仍可读取启用加密前保存的明文文件
 }
 
 // FileInfo 文件信息
@@ -51,6 +55,7 @@ type Storage interface {
 	// 文件操作
 	Save(ctx context.Context, key string, data io.Reader, size int64) error
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
 	Stat(ctx context.Context, key string) (*FileInfo, error)
@@ -71,34 +76,78 @@ type Storage interface {
 	// 工具方法
 	GetURL(ctx context.Context, key string) (string, error)
 	GetDownloadURL(ctx context.Context, key string, filename string) (string, error)
+	StorageStats(ctx context.Context) (*StorageStats, error)
+}
+
+// StorageStats 存储的物理使用情况：本地存储为所在文件系统的容量和已用、可用空间，
+// 对象存储为存储桶中的对象数和总大小（没有容量上限，Total和Free为0）
+type StorageStats struct {
+	Type    StorageType
+	Total   uint64
+	Used    uint64
+	Free    uint64
+	Objects int64 // 对象数，本地存储不统计，为-1
+}
+
+// MetadataStorage 支持随对象保存元数据的存储，覆盖保存不带元数据的内容时清除原有元数据
+type MetadataStorage interface {
+	SaveWithMetadata(ctx context.Context, key string, data io.Reader, size int64, metadata map[string]string) error
+	GetMetadata(ctx context.Context, key string) (map[string]string, error)
+}
+
+// UploadCleaner 支持清理未完成分片上传的存储
+type UploadCleaner interface {
+	// CleanupIncompleteUploads 中止发起时间早于olderThan之前的未完成分片上传，释放已上传的分片
+	CleanupIncompleteUploads(ctx context.Context, olderThan time.Duration) (*UploadCleanupResult, error)
+}
+
+// UploadCleanupResult 清理未完成分片上传的结果，ReclaimedBytes为已中止上传的分片总大小
+type UploadCleanupResult struct {
+	Aborted        int   `json:"aborted"`
+	Failed         int   `json:"failed"`
+	ReclaimedBytes int64 `json:"reclaimed_bytes"`
 }
 
 // NewStorage 创建存储实例
 func NewStorage(config StorageConfig) (Storage, error) {
+	var inner Storage
+	var err error
 	switch config.Type {
 	case StorageTypeLocal:
-		return NewLocalStorage(config)
+		inner, err = NewLocalStorage(config)
 	case StorageTypeS3:
-		return NewS3Storage(config)
+		inner, err = NewS3Storage(config)
 	case StorageTypeMinIO:
-		return NewMinIOStorage(config)
+		inner, err = NewMinIOStorage(config)
 	default:
 		return nil, ErrUnsupportedStorageType
 	}
+	if err != nil || !config.Encrypted {
+		return inner, err
+	}
+
+	// 在底层存储之上透明地加解密
+	return NewEncryptedStorage(inner, config.EncryptionKey, config.AllowPlaintext)
 }
 
 // 错误定义
 var (
-	ErrUnsupportedStorageType = newStorageError("unsupported storage type")
-	ErrFileNotFound           = newStorageError("file not found")
-	ErrPermissionDenied       = newStorageError("permission denied")
-	ErrStorageFull            = newStorageError("storage is full")
-	ErrInvalidKey             = newStorageError("invalid key")
-	ErrUploadFailed           = newStorageError("upload failed")
-	ErrDownloadFailed         = newStorageError("download failed")
-	ErrDeleteFailed           = newStorageError("delete failed")
+	ErrUnsupportedStorageType   = newStorageError("unsupported storage type")
+	ErrFileNotFound             = newStorageError("file not found")
+	ErrPermissionDenied         = newStorageError("permission denied")
+	ErrStorageFull              = newStorageError("storage is full")
+	ErrInvalidKey               = newStorageError("invalid key")
+	ErrUploadFailed             = newStorageError("upload failed")
+	ErrDownloadFailed           = newStorageError("download failed")
+	ErrDeleteFailed             = newStorageError("delete failed")
+	ErrMetadataUnsupported      = newStorageError("storage does not support object metadata")
+	ErrDirectURLUnavailable     = newStorageError("direct URLs are unavailable for this storage or content")
+	ErrUploadCleanupUnsupported = newStorageError("storage does not support cleaning up incomplete uploads")
 )
 
+// DownloadURLExpiry 存储直接生成的下载URL（如S3预签名URL）的有效期
+const DownloadURLExpiry = 15 * time.Minute
+
 // storageError 存储错误
 type storageError struct {
 	message string
@@ -137,6 +186,11 @@ func GenerateFileKey(userID uuid.UUID, filePath string) string {
 	return filepath.Join(userID.String(), filePath)
 }
 
+// GenerateSpaceFileKey 生成空间文件存储键，与成员的个人文件分开存放
+func GenerateSpaceFileKey(spaceID uuid.UUID, filePath string) string {
+	return filepath.Join("spaces", spaceID.String(), filePath)
+}
+
 // GenerateTempKey 生成临时文件键
 func GenerateTempKey(userID uuid.UUID, filename string) string {
 	tempID := uuid.New().String()
@@ -149,6 +203,42 @@ func GenerateVersionKey(userID uuid.UUID, fileID uuid.UUID, version int) string
 		fmt.Sprintf("v%d", version))
 }
 
+// GenerateVersionDir 生成文件所有版本的存储目录
+func GenerateVersionDir(userID uuid.UUID, fileID uuid.UUID) string {
+	return filepath.Join("versions", userID.String(), fileID.String())
+}
+
+// GenerateThumbnailKey 生成文件某一版本的缩略图键
+func GenerateThumbnailKey(userID uuid.UUID, fileID uuid.UUID, version int) string {
+	return filepath.Join("thumbnails", userID.String(), fileID.String(),
+		fmt.Sprintf("v%d.jpg", version))
+}
+
+// GenerateSizedThumbnailKey 生成文件某一版本指定尺寸的缩略图键，位于该版本的缩略图目录下
+func GenerateSizedThumbnailKey(userID uuid.UUID, fileID uuid.UUID, version int, width, height int) string {
+	return filepath.Join(GenerateSizedThumbnailDir(userID, fileID, version), fmt.Sprintf("%dx%d.jpg", width, height))
+}
+
+// GenerateSizedThumbnailDir 生成文件某一版本指定尺寸缩略图的存储目录
+func GenerateSizedThumbnailDir(userID uuid.UUID, fileID uuid.UUID, version int) string {
+	return filepath.Join(GenerateThumbnailDir(userID, fileID), fmt.Sprintf("v%d", version))
+}
+
+// GenerateThumbnailDir 生成文件所有缩略图的存储目录
+func GenerateThumbnailDir(userID uuid.UUID, fileID uuid.UUID) string {
+	return filepath.Join("thumbnails", userID.String(), fileID.String())
+}
+
+// GenerateBlobKey 生成去重保存的文件内容的存储键
+func GenerateBlobKey(userID uuid.UUID, blobID uuid.UUID) string {
+	return filepath.Join("blobs", userID.String(), blobID.String())
+}
+
+// IsVersionKey 检查存储键是否为版本文件键
+func IsVersionKey(key string) bool {
+	return strings.HasPrefix(filepath.ToSlash(key), "versions/")
+}
+
 // EnsureDir 确保目录存在
 func EnsureDir(path string) error {
 	return os.MkdirAll(path, 0755)
@@ -171,9 +261,11 @@ func IsValidKey(key string) bool {
 		return false
 	}
 
-	// 检查是否包含 ".."
-	if strings.HasPrefix(key, "..") || strings.Contains(key, "..") {
-		return false
+	// 检查是否包含 ".." 路径段，文件名中的 ".."（如 "a..b.txt"）是允许的
+	for _, segment := range strings.Split(filepath.ToSlash(key), "/") {
+		if segment == ".." {
+			return false
+		}
 	}
 
 	return true
@@ -183,50 +275,3 @@ func IsValidKey(key string) bool {
 func GetFileExtension(filename string) string {
 	return filepath.Ext(filename)
 }
-
-// GetMimeType 根据扩展名获取MIME类型
-func GetMimeType(filename string) string {
-	ext := GetFileExtension(filename)
-	switch ext {
-	case ".txt", ".md":
-		return "text/plain"
-	case ".html", ".htm":
-		return "text/html"
-	case ".css":
-		return "text/css"
-	case ".js":
-		return "application/javascript"
-	case ".json":
-		return "application/json"
-	case ".xml":
-		return "application/xml"
-	case ".pdf":
-		return "application/pdf"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".png":
-		return "image/png"
-	case ".gif":
-		return "image/gif"
-	case ".svg":
-		return "image/svg+xml"
-	case ".mp3":
-		return "audio/mpeg"
-	case ".mp4":
-		return "video/mp4"
-	case ".zip":
-		return "application/zip"
-	case ".tar":
-		return "application/x-tar"
-	case ".gz":
-		return "application/gzip"
-	case ".doc", ".docx":
-		return "application/msword"
-	case ".xls", ".xlsx":
-		return "application/vnd.ms-excel"
-	case ".ppt", ".pptx":
-		return "application/vnd.ms-powerpoint"
-	default:
-		return "application/octet-stream"
-	}
-}
\ No newline at end of file
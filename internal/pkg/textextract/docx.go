@@ -0,0 +1,89 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// docxExtractor Word文档（DOCX）提取器，读取 word/document.xml 中的文本
+type docxExtractor struct{}
+
+func (docxExtractor) Name() string { return "docx" }
+
+func (docxExtractor) Supports(mimeType, ext string) bool {
+	return mimeType == docxMimeType || ext == ".docx"
+}
+
+func (docxExtractor) Extract(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		return parseDocumentXML(rc)
+	}
+
+	return "", errors.New("word/document.xml not found")
+}
+
+// parseDocumentXML 提取 <w:t> 中的文本，段落结束时换行
+func parseDocumentXML(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var b strings.Builder
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,70 @@
+package textextract
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// PlainTextLanguage 无法识别语言时的提示值
+const PlainTextLanguage = "plaintext"
+
+// languageExtensions 扩展名对应的语言，名称与highlight.js、Prism等常用高亮库一致
+var languageExtensions = map[string]string{
+	".go": "go", ".py": "python", ".rb": "ruby", ".php": "php", ".java": "java",
+	".kt": "kotlin", ".kts": "kotlin", ".scala": "scala", ".swift": "swift", ".rs": "rust",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".m": "objectivec", ".dart": "dart", ".lua": "lua", ".pl": "perl",
+	".r": "r", ".js": "javascript", ".mjs": "javascript", ".cjs": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".tsx": "typescript", ".vue": "xml", ".html": "xml", ".htm": "xml",
+	".xml": "xml", ".svg": "xml", ".css": "css", ".scss": "scss", ".less": "less",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "ini", ".ini": "ini",
+	".conf": "ini", ".sql": "sql", ".sh": "bash", ".bash": "bash", ".zsh": "bash",
+	".ps1": "powershell", ".bat": "dos", ".md": "markdown", ".markdown": "markdown",
+	".tex": "latex", ".proto": "protobuf", ".graphql": "graphql", ".diff": "diff", ".patch": "diff",
+}
+
+// languageFilenames 没有扩展名的常见文件名对应的语言
+var languageFilenames = map[string]string{
+	"dockerfile": "dockerfile", "makefile": "makefile", "gnumakefile": "makefile",
+	"cmakelists.txt": "cmake", "go.mod": "go", ".bashrc": "bash", ".zshrc": "bash",
+}
+
+// Language 根据文件名推断代码语言，用于客户端语法高亮，无法识别时返回PlainTextLanguage
+func Language(filename string) string {
+	base := strings.ToLower(filepath.Base(filename))
+	if language, ok := languageFilenames[base]; ok {
+		return language
+	}
+	if language, ok := languageExtensions[filepath.Ext(base)]; ok {
+		return language
+	}
+	return PlainTextLanguage
+}
+
+// IsText 检查内容是否为UTF-8文本：不含NUL字节且是合法的UTF-8编码，
+// truncated为true时允许末尾有被截断的不完整字符
+func IsText(data []byte, truncated bool) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	if truncated {
+		data = TrimIncompleteRune(data)
+	}
+	return utf8.Valid(data)
+}
+
+// TrimIncompleteRune 去掉末尾被截断的不完整UTF-8字符
+func TrimIncompleteRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		start := len(data) - i
+		if utf8.RuneStart(data[start]) {
+			if !utf8.FullRune(data[start:]) {
+				return data[:start]
+			}
+			break
+		}
+	}
+	return data
+}
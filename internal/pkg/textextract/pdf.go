@@ -0,0 +1,267 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// pdfExtractor PDF基础文本提取器
+// 解析未压缩或Flate压缩的内容流中的文本操作符（Tj、TJ、'、"），
+// 不支持扫描件、加密文档及使用CID字体编码的文本，需要完整支持时可注册基于外部库的提取器
+type pdfExtractor struct{}
+
+func (pdfExtractor) Name() string { return "pdf" }
+
+func (pdfExtractor) Supports(mimeType, ext string) bool {
+	return mimeType == "application/pdf" || ext == ".pdf"
+}
+
+func (pdfExtractor) Extract(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, stream := range pdfContentStreams(data) {
+		extractPDFText(stream, &b)
+	}
+	return b.String(), nil
+}
+
+// pdfContentStreams 返回文档中可解码的非图像流
+func pdfContentStreams(data []byte) [][]byte {
+	var streams [][]byte
+	offset := 0
+	for {
+		idx := bytes.Index(data[offset:], []byte("stream"))
+		if idx < 0 {
+			break
+		}
+		start := offset + idx
+		offset = start + len("stream")
+
+		// 跳过 endstream 关键字本身
+		if start >= 3 && string(data[start-3:start]) == "end" {
+			continue
+		}
+
+		// 流数据从 stream 之后的换行开始
+		bodyStart := offset
+		if bodyStart < len(data) && data[bodyStart] == '\r' {
+			bodyStart++
+		}
+		if bodyStart < len(data) && data[bodyStart] == '\n' {
+			bodyStart++
+		}
+		end := bytes.Index(data[bodyStart:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		body := data[bodyStart : bodyStart+end]
+		offset = bodyStart + end + len("endstream")
+
+		// 流字典位于所属对象的 obj 与 stream 关键字之间
+		dictStart := bytes.LastIndex(data[:start], []byte("obj"))
+		if dictStart < 0 {
+			dictStart = 0
+		}
+		dict := data[dictStart:start]
+		if bytes.Contains(dict, []byte("/Image")) || bytes.Contains(dict, []byte("/FontFile")) {
+			continue
+		}
+
+		switch {
+		case bytes.Contains(dict, []byte("/FlateDecode")):
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			decoded, err := io.ReadAll(zr)
+			zr.Close()
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+			streams = append(streams, decoded)
+		case bytes.Contains(dict, []byte("/Filter")):
+			// 其他编码（DCT、LZW等）不处理
+			continue
+		default:
+			streams = append(streams, body)
+		}
+	}
+	return streams
+}
+
+// extractPDFText 解析内容流中的文本显示操作符
+func extractPDFText(content []byte, b *strings.Builder) {
+	var operands []string // 当前操作符的字符串操作数
+	var inArray bool
+	i := 0
+
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := readPDFLiteral(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			s, next := readPDFHex(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFDelimiter(c):
+			i++
+		default:
+			start := i
+			for i < len(content) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			token := string(content[start:i])
+
+			// TJ数组中较大的负偏移视为词间空格
+			if inArray {
+				if n, err := strconv.ParseFloat(token, 64); err == nil && n < -200 {
+					operands = append(operands, " ")
+				}
+				continue
+			}
+			if _, err := strconv.ParseFloat(token, 64); err == nil || strings.HasPrefix(token, "/") {
+				continue
+			}
+
+			switch token {
+			case "Tj", "TJ":
+				b.WriteString(decodePDFString(strings.Join(operands, "")))
+			case "'", "\"":
+				b.WriteByte('\n')
+				b.WriteString(decodePDFString(strings.Join(operands, "")))
+			case "T*", "Td", "TD":
+				b.WriteByte('\n')
+			case "ET":
+				b.WriteByte('\n')
+			}
+			operands = operands[:0]
+		}
+	}
+}
+
+// isPDFDelimiter 检查是否为空白或分隔符
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// readPDFLiteral 读取 (...) 字面量字符串，处理嵌套括号和转义
+func readPDFLiteral(content []byte, i int) (string, int) {
+	var b bytes.Buffer
+	depth := 0
+	for i < len(content) {
+		c := content[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(content) {
+				break
+			}
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// 行延续
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(content) && j < i+3 && content[j] >= '0' && content[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(content[i:j]), 8, 8)
+					b.WriteByte(byte(n))
+					i = j - 1
+				} else {
+					b.WriteByte(e)
+				}
+			}
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	return b.String(), i
+}
+
+// readPDFHex 读取 <...> 十六进制字符串
+func readPDFHex(content []byte, i int) (string, int) {
+	end := bytes.IndexByte(content[i:], '>')
+	if end < 0 {
+		return "", len(content)
+	}
+	raw := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n\f", r) {
+			return -1
+		}
+		return r
+	}, string(content[i+1:i+end]))
+	if len(raw)%2 == 1 {
+		raw += "0"
+	}
+	decoded, err := hex.DecodeString(raw)
+	if err != nil {
+		return "", i + end + 1
+	}
+	return string(decoded), i + end + 1
+}
+
+// decodePDFString 将字符串按UTF-16BE（带BOM）、UTF-8或Latin-1解码
+func decodePDFString(s string) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		units := make([]uint16, 0, (len(s)-2)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
@@ -0,0 +1,38 @@
+package textextract
+
+import (
+	"io"
+	"strings"
+)
+
+// textMimeTypes 按纯文本处理的非text/*类型
+var textMimeTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/javascript": true,
+	"application/x-yaml":     true,
+	"application/x-sh":       true,
+}
+
+// textExtensions 按纯文本处理的扩展名
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".csv": true, ".log": true, ".json": true,
+	".xml": true, ".yaml": true, ".yml": true, ".ini": true, ".conf": true,
+}
+
+// textExtractor 纯文本提取器
+type textExtractor struct{}
+
+func (textExtractor) Name() string { return "text" }
+
+func (textExtractor) Supports(mimeType, ext string) bool {
+	return strings.HasPrefix(mimeType, "text/") || textMimeTypes[mimeType] || textExtensions[ext]
+}
+
+func (textExtractor) Extract(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,127 @@
+package textextract
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extractor 文档文本提取器
+type Extractor interface {
+	// Name 提取器名称，用于配置和记录
+	Name() string
+	// Supports 检查是否支持该MIME类型或扩展名（小写，带点）
+	Supports(mimeType, ext string) bool
+	// Extract 从文档中提取纯文本
+	Extract(r io.Reader) (string, error)
+}
+
+// builtinExtractors 内置提取器
+var builtinExtractors = map[string]Extractor{
+	"text": textExtractor{},
+	"docx": docxExtractor{},
+	"pdf":  pdfExtractor{},
+}
+
+// Registry 已启用的提取器集合，按配置顺序匹配
+type Registry struct {
+	extractors []Extractor
+}
+
+// NewRegistry 根据名称创建提取器集合，返回无法识别的名称
+func NewRegistry(names []string) (*Registry, []string) {
+	registry := &Registry{}
+	var unknown []string
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		extractor, ok := builtinExtractors[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		registry.Register(extractor)
+	}
+	return registry, unknown
+}
+
+// Register 注册提取器（可用于接入依赖外部库的提取器）
+func (r *Registry) Register(extractor Extractor) {
+	r.extractors = append(r.extractors, extractor)
+}
+
+// Find 查找支持该文件的提取器，没有时返回nil
+func (r *Registry) Find(mimeType, filename string) Extractor {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, extractor := range r.extractors {
+		if extractor.Supports(mimeType, ext) {
+			return extractor
+		}
+	}
+	return nil
+}
+
+// Extract 使用提取器提取文本，规范化空白后截取前maxChars个字符
+// 返回的truncated表示原文超过maxChars
+func Extract(extractor Extractor, r io.Reader, maxChars int) (string, bool, error) {
+	text, err := extractor.Extract(r)
+	if err != nil {
+		return "", false, err
+	}
+	text = Normalize(text)
+	truncated := Truncate(text, maxChars)
+	return truncated, len(truncated) < len(text), nil
+}
+
+// Truncate 截取前n个字符（按rune计），n<=0时不截取
+func Truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// Normalize 去除无效字符和控制字符，合并连续空白，最多保留一个空行
+func Normalize(s string) string {
+	s = strings.ToValidUTF8(s, "")
+
+	var b strings.Builder
+	b.Grow(len(s))
+	pendingSpace := false
+	newlines := 0
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			pendingSpace = false
+			newlines++
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			continue
+		default:
+			if b.Len() > 0 {
+				if newlines > 0 {
+					b.WriteString(strings.Repeat("\n", min(newlines, 2)))
+				} else if pendingSpace {
+					b.WriteByte(' ')
+				}
+			}
+			pendingSpace = false
+			newlines = 0
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
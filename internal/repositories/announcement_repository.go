@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cloud-storage/internal/models"
+)
+
+// AnnouncementRepository 公告仓库接口
+type AnnouncementRepository interface {
+	Create(announcement *models.Announcement) error
+	FindByID(id uuid.UUID) (*models.Announcement, error)
+	FindAll(page, pageSize int) ([]models.Announcement, int64, error)
+	FindActive(role models.UserRole, now time.Time) ([]models.Announcement, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+	Delete(id uuid.UUID) error
+	Dismiss(announcementID, userID uuid.UUID) error
+	FindDismissedIDs(userID uuid.UUID, announcementIDs []uuid.UUID) (map[uuid.UUID]bool, error)
+}
+
+type announcementRepository struct {
+	db *gorm.DB
+}
+
+// NewAnnouncementRepository 创建公告仓库实例
+func NewAnnouncementRepository(db *gorm.DB) AnnouncementRepository {
+	return &announcementRepository{db: db}
+}
+
+func (r *announcementRepository) Create(announcement *models.Announcement) error {
+	return r.db.Create(announcement).Error
+}
+
+func (r *announcementRepository) FindByID(id uuid.UUID) (*models.Announcement, error) {
+	var announcement models.Announcement
+	err := r.db.Where("id = ?", id).First(&announcement).Error
+	if err != nil {
+		return nil, err
+	}
+	return &announcement, nil
+}
+
+func (r *announcementRepository) FindAll(page, pageSize int) ([]models.Announcement, int64, error) {
+	var announcements []models.Announcement
+	var total int64
+
+	if err := r.db.Model(&models.Announcement{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := r.db.Order("starts_at DESC").Offset(offset).Limit(pageSize).Find(&announcements).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return announcements, total, nil
+}
+
+// FindActive 查找当前展示期内、面向该角色的公告
+func (r *announcementRepository) FindActive(role models.UserRole, now time.Time) ([]models.Announcement, error) {
+	var announcements []models.Announcement
+	err := r.db.
+		Where("starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Where("target_role IS NULL OR target_role = ?", role).
+		Order("starts_at DESC").
+		Find(&announcements).Error
+	if err != nil {
+		return nil, err
+	}
+	return announcements, nil
+}
+
+func (r *announcementRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.Announcement{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *announcementRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("announcement_id = ?", id).Delete(&models.AnnouncementDismissal{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Announcement{}, "id = ?", id).Error
+	})
+}
+
+// Dismiss 记录用户关闭公告（重复关闭不报错）
+func (r *announcementRepository) Dismiss(announcementID, userID uuid.UUID) error {
+	dismissal := &models.AnnouncementDismissal{
+		AnnouncementID: announcementID,
+		UserID:         userID,
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(dismissal).Error
+}
+
+// FindDismissedIDs 返回用户已关闭的公告ID集合
+func (r *announcementRepository) FindDismissedIDs(userID uuid.UUID, announcementIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	dismissed := make(map[uuid.UUID]bool)
+	if len(announcementIDs) == 0 {
+		return dismissed, nil
+	}
+
+	var ids []uuid.UUID
+	err := r.db.Model(&models.AnnouncementDismissal{}).
+		Where("user_id = ? AND announcement_id IN ?", userID, announcementIDs).
+		Pluck("announcement_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		dismissed[id] = true
+	}
+	return dismissed, nil
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// DataExportRepository 数据导出任务仓库接口
+type DataExportRepository interface {
+	Create(export *models.DataExport) error
+	FindByID(id uuid.UUID) (*models.DataExport, error)
+	FindByToken(token string) (*models.DataExport, error)
+	FindByUser(userID uuid.UUID) ([]models.DataExport, error)
+	FindActiveByUser(userID uuid.UUID) (*models.DataExport, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+}
+
+type dataExportRepository struct {
+	db *gorm.DB
+}
+
+// NewDataExportRepository 创建数据导出任务仓库实例
+func NewDataExportRepository(db *gorm.DB) DataExportRepository {
+	return &dataExportRepository{db: db}
+}
+
+func (r *dataExportRepository) Create(export *models.DataExport) error {
+	return r.db.Create(export).Error
+}
+
+func (r *dataExportRepository) FindByID(id uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Where("id = ?", id).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindByToken(token string) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Where("download_token = ?", token).First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) FindByUser(userID uuid.UUID) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&exports).Error
+	if err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// FindActiveByUser 查找用户进行中的导出任务
+func (r *dataExportRepository) FindActiveByUser(userID uuid.UUID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := r.db.Where("user_id = ? AND status IN ?", userID,
+		[]models.ExportStatus{models.ExportStatusPending, models.ExportStatusProcessing}).
+		First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (r *dataExportRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.DataExport{}).Where("id = ?", id).Updates(updates).Error
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// FileMoveRepository 文件移动记录仓库接口
+type FileMoveRepository interface {
+	CreateWithTx(tx *gorm.DB, move *models.FileMoveHistory) error
+	FindLatestByFile(fileID uuid.UUID) (*models.FileMoveHistory, error)
+	FindRecentByUser(userID uuid.UUID, since time.Time, limit int) ([]models.FileMoveHistory, error)
+	MarkUndoneWithTx(tx *gorm.DB, id uuid.UUID) (bool, error)
+}
+
+type fileMoveRepository struct {
+	db *gorm.DB
+}
+
+// NewFileMoveRepository 创建文件移动记录仓库实例
+func NewFileMoveRepository(db *gorm.DB) FileMoveRepository {
+	return &fileMoveRepository{db: db}
+}
+
+func (r *fileMoveRepository) CreateWithTx(tx *gorm.DB, move *models.FileMoveHistory) error {
+	return tx.Create(move).Error
+}
+
+// FindLatestByFile 获取文件最近一次移动的记录（包括已撤销的）
+func (r *fileMoveRepository) FindLatestByFile(fileID uuid.UUID) (*models.FileMoveHistory, error) {
+	var move models.FileMoveHistory
+	err := r.db.Where("file_id = ?", fileID).Order("created_at DESC").First(&move).Error
+	if err != nil {
+		return nil, err
+	}
+	return &move, nil
+}
+
+// FindRecentByUser 按时间从新到旧获取用户在since之后执行的移动，预加载文件
+func (r *fileMoveRepository) FindRecentByUser(userID uuid.UUID, since time.Time, limit int) ([]models.FileMoveHistory, error) {
+	var moves []models.FileMoveHistory
+	err := r.db.Preload("File").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&moves).Error
+	if err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// MarkUndoneWithTx 将移动记录标记为已撤销，记录已被撤销时返回false
+func (r *fileMoveRepository) MarkUndoneWithTx(tx *gorm.DB, id uuid.UUID) (bool, error) {
+	result := tx.Model(&models.FileMoveHistory{}).
+		Where("id = ? AND undone_at IS NULL", id).
+		Update("undone_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
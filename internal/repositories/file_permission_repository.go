@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cloud-storage/internal/models"
+)
+
+// FilePermissionRepository 文件访问控制仓库接口
+type FilePermissionRepository interface {
+	Upsert(permission *models.FilePermission) error
+	Find(fileID, granteeUserID uuid.UUID) (*models.FilePermission, error)
+	FindByFile(fileID uuid.UUID) ([]models.FilePermission, error)
+	Delete(fileID, granteeUserID uuid.UUID) (int64, error)
+}
+
+type filePermissionRepository struct {
+	db *gorm.DB
+}
+
+// NewFilePermissionRepository 创建文件访问控制仓库实例
+func NewFilePermissionRepository(db *gorm.DB) FilePermissionRepository {
+	return &filePermissionRepository{db: db}
+}
+
+// Upsert 创建授权，同一用户已有授权时更新权限和授权人
+func (r *filePermissionRepository) Upsert(permission *models.FilePermission) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}, {Name: "grantee_user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission", "granted_by", "updated_at"}),
+	}).Create(permission).Error
+}
+
+func (r *filePermissionRepository) Find(fileID, granteeUserID uuid.UUID) (*models.FilePermission, error) {
+	var permission models.FilePermission
+	err := r.db.Where("file_id = ? AND grantee_user_id = ?", fileID, granteeUserID).First(&permission).Error
+	if err != nil {
+		return nil, err
+	}
+	return &permission, nil
+}
+
+// FindByFile 查找文件的所有授权，按授权时间排序
+func (r *filePermissionRepository) FindByFile(fileID uuid.UUID) ([]models.FilePermission, error) {
+	var permissions []models.FilePermission
+	err := r.db.Preload("Grantee").Where("file_id = ?", fileID).Order("created_at ASC").Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// Delete 撤销授权，返回删除的行数
+func (r *filePermissionRepository) Delete(fileID, granteeUserID uuid.UUID) (int64, error) {
+	result := r.db.Where("file_id = ? AND grantee_user_id = ?", fileID, granteeUserID).Delete(&models.FilePermission{})
+	return result.RowsAffected, result.Error
+}
@@ -1,10 +1,15 @@
 package repositories
 
 import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"cloud-storage/internal/models"
 )
@@ -17,22 +22,43 @@ type FileRepository interface {
 	FindByID(id uuid.UUID) (*models.File, error)
 	FindByIDIncludingDeleted(id uuid.UUID) (*models.File, error)
 	FindAll(filter models.FileFilter) ([]models.File, error)
+	GetFileAncestors(fileID uuid.UUID) ([]models.File, error)
+	GetFileTree(userID uuid.UUID, rootID *uuid.UUID, maxDepth, maxNodes int, includeFiles bool) ([]*FileTreeNode, bool, error)
 	FindAllWithTx(tx *gorm.DB, filter models.FileFilter) ([]models.File, error)
+	FindChildrenWithTx(tx *gorm.DB, parentIDs []uuid.UUID) ([]models.File, error)
 	Update(id uuid.UUID, updates map[string]interface{}) error
+	SetDetectedMime(id uuid.UUID, mimeType string) error
+	FindWithoutDetectedMime(afterID uuid.UUID, limit int) ([]models.File, error)
+	CountWithoutDetectedMime() (int64, error)
+	SetHash(file *models.File, hash string) error
+	FindWithoutHash(afterID uuid.UUID, limit int) ([]models.File, error)
+	CountWithoutHash() (int64, error)
+	SumUserFileSizeWithTx(tx *gorm.DB, userID uuid.UUID) (int64, error)
 	UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error
+	UpdateIfVersion(id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error)
+	UpdateIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error)
+	LockIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64) (bool, error)
 	Delete(id uuid.UUID) error
 	DeleteWithTx(tx *gorm.DB, id uuid.UUID) error
 	SoftDelete(id uuid.UUID) error
 	Restore(id uuid.UUID) error
+	WithContext(ctx context.Context) FileRepository
 
 	// 查询操作
 	FindByUserAndName(userID uuid.UUID, parentID *uuid.UUID, name string) (*models.File, error)
+	FindBySpaceAndName(spaceID uuid.UUID, parentID *uuid.UUID, name string) (*models.File, error)
 	FindByShareToken(token string) (*models.File, error)
+	ShareTokenExists(token string) (bool, error)
 	FindOldRecycledFiles(userID uuid.UUID, cutoffDate time.Time) ([]models.File, error)
+	FindAllByUser(userID uuid.UUID) ([]models.File, error)
+	PathInUse(userID uuid.UUID, spaceID *uuid.UUID, path string) (bool, error)
 
 	// 统计操作
 	Count(filter models.FileFilter) (int64, error)
 	GetUserFileStats(userID uuid.UUID) (*models.FileStats, error)
+	GetCategoryUsage(userID uuid.UUID, category string) (int64, error)
+	GetCategoryBreakdown(userID uuid.UUID) (map[string]models.CategoryStats, error)
+	GetDuplicateFiles(userID uuid.UUID) (map[string][]models.File, error)
 }
 
 // fileRepository 文件仓库实现
@@ -45,6 +71,11 @@ func NewFileRepository(db *gorm.DB) FileRepository {
 	return &fileRepository{db: db}
 }
 
+// WithContext 返回在ctx下执行查询的仓库，ctx取消或超时时中止正在执行的查询
+func (r *fileRepository) WithContext(ctx context.Context) FileRepository {
+	return &fileRepository{db: r.db.WithContext(ctx)}
+}
+
 // Create 创建文件
 func (r *fileRepository) Create(file *models.File) error {
 	return r.db.Create(file).Error
@@ -75,6 +106,20 @@ func (r *fileRepository) FindByIDIncludingDeleted(id uuid.UUID) (*models.File, e
 	return &file, nil
 }
 
+// PathInUse 检查用户（spaceID不为空时为该空间）是否有该路径的文件记录（包括回收站中的文件），用于判断存储键是否仍在使用
+func (r *fileRepository) PathInUse(userID uuid.UUID, spaceID *uuid.UUID, path string) (bool, error) {
+	query := r.db.Unscoped().Model(&models.File{})
+	if spaceID != nil {
+		query = query.Where("space_id = ? AND path = ?", *spaceID, path)
+	} else {
+		query = query.Where("user_id = ? AND space_id IS NULL AND path = ?", userID, path)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
 // FindAll 查找所有符合条件的文件
 func (r *fileRepository) FindAll(filter models.FileFilter) ([]models.File, error) {
 	var files []models.File
@@ -109,14 +154,136 @@ func (r *fileRepository) FindAllWithTx(tx *gorm.DB, filter models.FileFilter) ([
 	return files, nil
 }
 
+// FindChildrenWithTx 在事务中查找多个目录下的所有未删除子文件，用于逐层遍历目录树
+func (r *fileRepository) FindChildrenWithTx(tx *gorm.DB, parentIDs []uuid.UUID) ([]models.File, error) {
+	var files []models.File
+	if len(parentIDs) == 0 {
+		return files, nil
+	}
+
+	err := tx.Where("parent_id IN ?", parentIDs).Order("name ASC").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // Update 更新文件
 func (r *fileRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
-	return r.db.Model(&models.File{}).Where("id = ?", id).Updates(updates).Error
+	return r.UpdateWithTx(r.db, id, updates)
+}
+
+// SetDetectedMime 写入嗅探出的MIME类型；属于派生数据，不递增lock_version
+func (r *fileRepository) SetDetectedMime(id uuid.UUID, mimeType string) error {
+	return r.db.Unscoped().Model(&models.File{}).Where("id = ?", id).
+		UpdateColumn("detected_mime", mimeType).Error
+}
+
+// FindWithoutDetectedMime 按ID顺序获取afterID之后尚未嗅探MIME类型的文件（包括回收站中的文件）
+func (r *fileRepository) FindWithoutDetectedMime(afterID uuid.UUID, limit int) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Unscoped().
+		Where("type = ? AND (detected_mime IS NULL OR detected_mime = '') AND id > ?", models.FileTypeFile, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// CountWithoutDetectedMime 统计尚未嗅探MIME类型的文件数
+func (r *fileRepository) CountWithoutDetectedMime() (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.File{}).
+		Where("type = ? AND (detected_mime IS NULL OR detected_mime = '')", models.FileTypeFile).
+		Count(&count).Error
+	return count, err
+}
+
+// SetHash 写入文件当前内容的哈希，并补充当前版本记录的哈希；属于派生数据，不递增lock_version
+func (r *fileRepository) SetHash(file *models.File, hash string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.File{}).Where("id = ?", file.ID).
+			UpdateColumn("hash", hash).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.FileVersion{}).
+			Where("file_id = ? AND version_number = ? AND (file_hash IS NULL OR file_hash = '')", file.ID, file.Version).
+			Update("file_hash", hash).Error
+	})
+}
+
+// FindWithoutHash 按ID顺序获取afterID之后尚未计算哈希的文件（包括回收站中的文件）
+func (r *fileRepository) FindWithoutHash(afterID uuid.UUID, limit int) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Unscoped().
+		Where("type = ? AND (hash IS NULL OR hash = '') AND id > ?", models.FileTypeFile, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
 }
 
-// UpdateWithTx 在事务中更新文件
+// SumUserFileSizeWithTx 在事务中统计用户创建的全部文件的大小之和，包括回收站中尚未永久删除的文件
+func (r *fileRepository) SumUserFileSizeWithTx(tx *gorm.DB, userID uuid.UUID) (int64, error) {
+	var total int64
+	err := tx.Unscoped().Model(&models.File{}).
+		Where("user_id = ? AND type = ?", userID, models.FileTypeFile).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// CountWithoutHash 统计尚未计算哈希的文件数
+func (r *fileRepository) CountWithoutHash() (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.File{}).
+		Where("type = ? AND (hash IS NULL OR hash = '')", models.FileTypeFile).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdateWithTx 在事务中更新文件，同时递增lock_version
 func (r *fileRepository) UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error {
-	return tx.Model(&models.File{}).Where("id = ?", id).Updates(updates).Error
+	return tx.Model(&models.File{}).Where("id = ?", id).Updates(withLockVersion(updates)).Error
+}
+
+// UpdateIfVersion 仅当lock_version等于期望值时更新文件，返回是否更新成功
+func (r *fileRepository) UpdateIfVersion(id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error) {
+	return r.UpdateIfVersionWithTx(r.db, id, lockVersion, updates)
+}
+
+// UpdateIfVersionWithTx 在事务中仅当lock_version等于期望值时更新文件，返回是否更新成功
+func (r *fileRepository) UpdateIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error) {
+	result := tx.Model(&models.File{}).
+		Where("id = ? AND lock_version = ?", id, lockVersion).
+		Updates(withLockVersion(updates))
+	return result.RowsAffected > 0, result.Error
+}
+
+// LockIfVersionWithTx 在事务中锁定lock_version等于期望值的文件行，返回是否锁定成功
+func (r *fileRepository) LockIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64) (bool, error) {
+	var file models.File
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id = ? AND lock_version = ?", id, lockVersion).
+		First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// withLockVersion 返回附加了lock_version递增的更新字段副本，不修改调用方的map
+func withLockVersion(updates map[string]interface{}) map[string]interface{} {
+	versioned := make(map[string]interface{}, len(updates)+1)
+	maps.Copy(versioned, updates)
+	versioned["lock_version"] = gorm.Expr("lock_version + 1")
+	return versioned
 }
 
 // Delete 删除文件（硬删除）
@@ -146,6 +313,27 @@ func (r *fileRepository) FindByUserAndName(userID uuid.UUID, parentID *uuid.UUID
 
 	query := r.db.Where("user_id = ? AND name = ? AND deleted_at IS NULL", userID, name)
 
+	if parentID == nil {
+		// 个人根目录，不包括用户在空间根目录下创建的文件
+		query = query.Where("parent_id IS NULL AND space_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", parentID)
+	}
+
+	err := query.First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// FindBySpaceAndName 根据空间ID、父目录ID和文件名查找文件
+func (r *fileRepository) FindBySpaceAndName(spaceID uuid.UUID, parentID *uuid.UUID, name string) (*models.File, error) {
+	var file models.File
+
+	query := r.db.Where("space_id = ? AND name = ? AND deleted_at IS NULL", spaceID, name)
+
 	if parentID == nil {
 		query = query.Where("parent_id IS NULL")
 	} else {
@@ -170,6 +358,13 @@ func (r *fileRepository) FindByShareToken(token string) (*models.File, error) {
 	return &file, nil
 }
 
+// ShareTokenExists 检查分享令牌是否已被使用，包括已删除的文件（唯一索引同样覆盖这些行）
+func (r *fileRepository) ShareTokenExists(token string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.File{}).Where("share_token = ?", token).Count(&count).Error
+	return count > 0, err
+}
+
 // FindOldRecycledFiles 查找旧的回收站文件
 func (r *fileRepository) FindOldRecycledFiles(userID uuid.UUID, cutoffDate time.Time) ([]models.File, error) {
 	var files []models.File
@@ -185,6 +380,16 @@ func (r *fileRepository) FindOldRecycledFiles(userID uuid.UUID, cutoffDate time.
 	return files, nil
 }
 
+// FindAllByUser 查找用户的全部文件和目录（不含回收站，不分页）
+func (r *fileRepository) FindAllByUser(userID uuid.UUID) ([]models.File, error) {
+	var files []models.File
+	err := r.db.Where("user_id = ?", userID).Order("path ASC").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
 // Count 统计符合条件的文件数量
 func (r *fileRepository) Count(filter models.FileFilter) (int64, error) {
 	var count int64
@@ -246,42 +451,85 @@ func (r *fileRepository) GetUserFileStats(userID uuid.UUID) (*models.FileStats,
 
 // 其他辅助方法
 
-// GetFileTree 获取文件树
-func (r *fileRepository) GetFileTree(userID uuid.UUID, rootID *uuid.UUID) ([]*FileTreeNode, error) {
+// GetFileTree 逐层获取文件树，最多展开maxDepth层、返回maxNodes个节点（0表示不限制）
+// rootID为nil时从用户的个人根目录开始，否则从该目录开始（空间目录包含其他成员创建的文件）；includeFiles为false时只返回目录
+// 超出限制时返回已获取的部分，truncated为true
+func (r *fileRepository) GetFileTree(userID uuid.UUID, rootID *uuid.UUID, maxDepth, maxNodes int, includeFiles bool) ([]*FileTreeNode, bool, error) {
+	scope := func() *gorm.DB {
+		query := r.db.Model(&models.File{})
+		if rootID == nil {
+			query = query.Where("user_id = ?", userID)
+		}
+		if !includeFiles {
+			query = query.Where("type = ?", models.FileTypeDir)
+		}
+		return query
+	}
+
 	// 获取根节点文件
 	var rootFiles []models.File
-	query := r.db.Where("user_id = ? AND deleted_at IS NULL", userID)
+	query := scope()
 
 	if rootID == nil {
-		query = query.Where("parent_id IS NULL")
+		query = query.Where("parent_id IS NULL AND space_id IS NULL")
 	} else {
 		query = query.Where("parent_id = ?", rootID)
 	}
 
-	if err := query.Find(&rootFiles).Order("type DESC, name ASC").Error; err != nil {
-		return nil, err
+	if err := query.Order("type DESC, name ASC").Find(&rootFiles).Error; err != nil {
+		return nil, false, err
 	}
 
-	// 构建树节点
 	var tree []*FileTreeNode
+	level := make(map[uuid.UUID]*FileTreeNode)
+	count := 0
 	for _, file := range rootFiles {
-		node := &FileTreeNode{
-			File: file,
+		if maxNodes > 0 && count >= maxNodes {
+			return tree, true, nil
 		}
-
-		// 如果是目录，递归获取子节点
+		node := &FileTreeNode{File: file}
+		tree = append(tree, node)
+		count++
 		if file.Type == models.FileTypeDir {
-			children, err := r.GetFileTree(userID, &file.ID)
-			if err != nil {
-				return nil, err
-			}
-			node.Children = children
+			level[file.ID] = node
+		}
+	}
+
+	// 逐层批量查询子节点，避免递归查询
+	for depth := 1; len(level) > 0; depth++ {
+		if maxDepth > 0 && depth >= maxDepth {
+			return tree, true, nil
 		}
 
-		tree = append(tree, node)
+		parentIDs := make([]uuid.UUID, 0, len(level))
+		for id := range level {
+			parentIDs = append(parentIDs, id)
+		}
+
+		var children []models.File
+		err := scope().Where("parent_id IN ?", parentIDs).
+			Order("type DESC, name ASC").Find(&children).Error
+		if err != nil {
+			return nil, false, err
+		}
+
+		next := make(map[uuid.UUID]*FileTreeNode)
+		for _, file := range children {
+			if maxNodes > 0 && count >= maxNodes {
+				return tree, true, nil
+			}
+			node := &FileTreeNode{File: file}
+			parent := level[*file.ParentID]
+			parent.Children = append(parent.Children, node)
+			count++
+			if file.Type == models.FileTypeDir {
+				next[file.ID] = node
+			}
+		}
+		level = next
 	}
 
-	return tree, nil
+	return tree, false, nil
 }
 
 // FileTreeNode 文件树节点
@@ -299,7 +547,7 @@ func (r *fileRepository) GetFilePath(fileID uuid.UUID) (string, error) {
 	return file.Path, nil
 }
 
-// GetFileAncestors 获取文件的所有祖先
+// GetFileAncestors 获取从根目录到文件本身的路径链（最后一项为文件本身）
 func (r *fileRepository) GetFileAncestors(fileID uuid.UUID) ([]models.File, error) {
 	var ancestors []models.File
 	currentID := fileID
@@ -351,11 +599,12 @@ func (r *fileRepository) UpdateFileHash(fileID uuid.UUID, hash string) error {
 		Update("hash", hash).Error
 }
 
-// GetDuplicateFiles 查找重复文件（根据哈希值）
+// GetDuplicateFiles 查找重复文件（根据哈希值），每组按创建时间从早到晚排列
 func (r *fileRepository) GetDuplicateFiles(userID uuid.UUID) (map[string][]models.File, error) {
-	// 获取所有有哈希值的文件
+	// 获取所有有哈希值的文件，空文件内容都相同，不视为重复
 	var files []models.File
-	err := r.db.Where("user_id = ? AND hash IS NOT NULL AND hash != '' AND deleted_at IS NULL", userID).
+	err := r.db.Where("user_id = ? AND hash IS NOT NULL AND hash != '' AND size > 0 AND deleted_at IS NULL", userID).
+		Order("created_at ASC").
 		Find(&files).Error
 	if err != nil {
 		return nil, err
@@ -377,3 +626,54 @@ func (r *fileRepository) GetDuplicateFiles(userID uuid.UUID) (map[string][]model
 
 	return duplicates, nil
 }
+
+// GetCategoryUsage 统计用户某MIME分类文件的总大小（与已用存储一致，包含回收站中的文件）
+func (r *fileRepository) GetCategoryUsage(userID uuid.UUID, category string) (int64, error) {
+	condition, args := models.MimeCategoryCondition(category)
+
+	var used int64
+	err := r.db.Unscoped().Model(&models.File{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ? AND type = ?", userID, models.FileTypeFile).
+		Where(condition, args...).
+		Scan(&used).Error
+	return used, err
+}
+
+// GetCategoryBreakdown 按统计分类分组统计用户文件数和总大小（不含回收站中的文件），每个分类都有对应项
+// 文件按models.FileStatsCategories的顺序归入第一个匹配的分类，都不匹配的归入其他
+func (r *fileRepository) GetCategoryBreakdown(userID uuid.UUID) (map[string]models.CategoryStats, error) {
+	var cases strings.Builder
+	var args []interface{}
+	cases.WriteString("CASE")
+	for _, category := range models.FileStatsCategories {
+		condition, conditionArgs := models.MimeCategoryCondition(category)
+		cases.WriteString(" WHEN " + condition + " THEN ?")
+		args = append(append(args, conditionArgs...), category)
+	}
+	cases.WriteString(" ELSE ? END")
+	args = append(args, models.FileStatsCategoryOther)
+
+	var rows []struct {
+		Category string
+		Count    int64
+		Size     int64
+	}
+	if err := r.db.Model(&models.File{}).
+		Select(cases.String()+" AS category, COUNT(*) AS count, COALESCE(SUM(size), 0) AS size", args...).
+		Where("user_id = ? AND type = ?", userID, models.FileTypeFile).
+		Group("category").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	breakdown := make(map[string]models.CategoryStats, len(models.FileStatsCategories)+1)
+	for _, category := range models.FileStatsCategories {
+		breakdown[category] = models.CategoryStats{}
+	}
+	breakdown[models.FileStatsCategoryOther] = models.CategoryStats{}
+	for _, row := range rows {
+		breakdown[row.Category] = models.CategoryStats{Count: row.Count, Size: row.Size}
+	}
+	return breakdown, nil
+}
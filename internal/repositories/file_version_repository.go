@@ -14,6 +14,8 @@ type FileVersionRepository interface {
 	FindByVersion(fileID uuid.UUID, versionNumber int) (*models.FileVersion, error)
 	Delete(id uuid.UUID) error
 	DeleteByFileID(fileID uuid.UUID) error
+	DeleteByIDsWithTx(tx *gorm.DB, ids []uuid.UUID) error
+	FindFileIDsWithHistory(afterID uuid.UUID, limit int) ([]uuid.UUID, error)
 }
 
 type fileVersionRepository struct {
@@ -62,3 +64,21 @@ func (r *fileVersionRepository) Delete(id uuid.UUID) error {
 func (r *fileVersionRepository) DeleteByFileID(fileID uuid.UUID) error {
 	return r.db.Where("file_id = ?", fileID).Delete(&models.FileVersion{}).Error
 }
+
+// DeleteByIDsWithTx 在事务中删除指定的版本记录
+func (r *fileVersionRepository) DeleteByIDsWithTx(tx *gorm.DB, ids []uuid.UUID) error {
+	return tx.Where("id IN ?", ids).Delete(&models.FileVersion{}).Error
+}
+
+// FindFileIDsWithHistory 按ID顺序获取afterID之后有历史版本（版本记录多于一条）的文件ID
+func (r *fileVersionRepository) FindFileIDsWithHistory(afterID uuid.UUID, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&models.FileVersion{}).
+		Where("file_id > ?", afterID).
+		Group("file_id").
+		Having("COUNT(*) > 1").
+		Order("file_id").
+		Limit(limit).
+		Pluck("file_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// JobRepository 后台任务仓库接口
+type JobRepository interface {
+	Create(job *models.Job) error
+	FindByID(id uuid.UUID) (*models.Job, error)
+	FindByUser(userID uuid.UUID, limit int) ([]models.Job, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+	UpdateIfStatus(id uuid.UUID, status models.JobStatus, updates map[string]interface{}) (bool, error)
+	FailUnfinished(message string) (int64, error)
+}
+
+type jobRepository struct {
+	db *gorm.DB
+}
+
+// NewJobRepository 创建后台任务仓库实例
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db: db}
+}
+
+func (r *jobRepository) Create(job *models.Job) error {
+	return r.db.Create(job).Error
+}
+
+func (r *jobRepository) FindByID(id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	err := r.db.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindByUser 按创建时间从新到旧获取用户最近的任务
+func (r *jobRepository) FindByUser(userID uuid.UUID, limit int) ([]models.Job, error) {
+	var jobs []models.Job
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *jobRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.Job{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// UpdateIfStatus 仅当任务处于status状态时更新，返回是否更新成功，用于开始和取消任务时的状态切换
+func (r *jobRepository) UpdateIfStatus(id uuid.UUID, status models.JobStatus, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.Job{}).Where("id = ? AND status = ?", id, status).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FailUnfinished 将所有未结束的任务标记为失败，服务启动时调用，返回更新的任务数
+func (r *jobRepository) FailUnfinished(message string) (int64, error) {
+	result := r.db.Model(&models.Job{}).
+		Where("status IN ?", []models.JobStatus{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error":       message,
+			"finished_at": gorm.Expr("CURRENT_TIMESTAMP"),
+		})
+	return result.RowsAffected, result.Error
+}
@@ -1,6 +1,9 @@
 package repositories
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,15 +14,26 @@ import (
 
 type OperationLogRepository interface {
 	Create(log *models.OperationLog) error
+	CreateWithTx(tx *gorm.DB, log *models.OperationLog) error
 	FindByID(id uuid.UUID) (*models.OperationLog, error)
 	FindByUser(userID uuid.UUID, filter models.OperationLogFilter) ([]models.OperationLog, int64, error)
 	FindAll(filter models.OperationLogFilter) ([]models.OperationLog, int64, error)
-	Delete(id uuid.UUID) error
+	FindAfter(filter models.OperationLogFilter, cursor *models.Cursor, limit int) ([]models.OperationLog, error)
+	Aggregate(filter models.OperationLogFilter, groupBy string) ([]models.OperationLogAggregate, error)
+	CreateChained(log *models.OperationLog) error
+	CreateChainedWithTx(tx *gorm.DB, log *models.OperationLog) error
+	FindChained(afterSeq int64, limit int) ([]models.OperationLog, error)
+	CountUnchained() (int64, error)
 	DeleteOldLogs(beforeDate time.Time) (int64, error)
-	GetUserOperationStats(userID uuid.UUID, startDate, endDate time.Time) (map[string]int64, error)
+	GetOperationStats(userID *uuid.UUID, startDate, endDate time.Time) (*models.OperationStats, error)
 	GetSystemStats() (*models.SystemStats, error)
+	FindAllByUser(userID uuid.UUID) ([]models.OperationLog, error)
+	WithContext(ctx context.Context) OperationLogRepository
 }
 
+// auditChainLockKey 追加哈希链日志时使用的事务级咨询锁
+const auditChainLockKey = 0x6175646974
+
 type operationLogRepository struct {
 	db *gorm.DB
 }
@@ -28,10 +42,19 @@ func NewOperationLogRepository(db *gorm.DB) OperationLogRepository {
 	return &operationLogRepository{db: db}
 }
 
+// WithContext 返回在ctx下执行查询的仓库，ctx取消或超时时中止正在执行的查询
+func (r *operationLogRepository) WithContext(ctx context.Context) OperationLogRepository {
+	return &operationLogRepository{db: r.db.WithContext(ctx)}
+}
+
 func (r *operationLogRepository) Create(log *models.OperationLog) error {
 	return r.db.Create(log).Error
 }
 
+func (r *operationLogRepository) CreateWithTx(tx *gorm.DB, log *models.OperationLog) error {
+	return tx.Create(log).Error
+}
+
 func (r *operationLogRepository) FindByID(id uuid.UUID) (*models.OperationLog, error) {
 	var log models.OperationLog
 	err := r.db.Where("id = ?", id).First(&log).Error
@@ -47,13 +70,14 @@ func (r *operationLogRepository) FindByUser(userID uuid.UUID, filter models.Oper
 	query = filter.ApplyFilter(query)
 
 	offset := (filter.Page - 1) * filter.PageSize
-	err := query.Offset(offset).Limit(filter.PageSize).Order("created_at DESC").Find(&logs).Error
+	err := query.Offset(offset).Limit(filter.PageSize).Find(&logs).Error
 	if err != nil {
 		return nil, 0, err
 	}
 
+	// 总数与列表使用相同的过滤条件
 	var total int64
-	err = r.db.Model(&models.OperationLog{}).Where("user_id = ?", userID).Count(&total).Error
+	err = filter.ApplyFilter(r.db.Model(&models.OperationLog{}).Where("user_id = ?", userID)).Count(&total).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -81,8 +105,100 @@ func (r *operationLogRepository) FindAll(filter models.OperationLogFilter) ([]mo
 	return logs, total, nil
 }
 
-func (r *operationLogRepository) Delete(id uuid.UUID) error {
-	return r.db.Delete(&models.OperationLog{}, "id = ?", id).Error
+// FindAfter 按 created_at、id 倒序查询游标之后的日志（键集分页），cursor为nil时从最新的日志开始
+func (r *operationLogRepository) FindAfter(filter models.OperationLogFilter, cursor *models.Cursor, limit int) ([]models.OperationLog, error) {
+	var logs []models.OperationLog
+	query := filter.ApplyConditions(r.db.Model(&models.OperationLog{}))
+
+	if cursor != nil {
+		query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	err := query.Order("created_at DESC").Order("id DESC").Limit(limit).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// logGroupExprs group_by对应的分组表达式
+var logGroupExprs = map[string]string{
+	"hour":          "to_char(created_at, 'YYYY-MM-DD HH24:00')",
+	"day":           "to_char(created_at, 'YYYY-MM-DD')",
+	"month":         "to_char(created_at, 'YYYY-MM')",
+	"operation":     "operation",
+	"resource_type": "resource_type",
+}
+
+// Aggregate 按groupBy分组统计符合过滤条件的日志数及成功、失败数，按分组升序
+func (r *operationLogRepository) Aggregate(filter models.OperationLogFilter, groupBy string) ([]models.OperationLogAggregate, error) {
+	expr, ok := logGroupExprs[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported group_by: %s", groupBy)
+	}
+
+	var aggregates []models.OperationLogAggregate
+	err := filter.ApplyConditions(r.db.Model(&models.OperationLog{})).
+		Select(expr+" AS group_key, COUNT(*) AS total, "+
+			"COUNT(*) FILTER (WHERE result = ?) AS success_count, "+
+			"COUNT(*) FILTER (WHERE result = ?) AS failure_count",
+			models.OperationSuccess, models.OperationFailure).
+		Group("group_key").
+		Order("group_key").
+		Find(&aggregates).Error
+	if err != nil {
+		return nil, err
+	}
+	return aggregates, nil
+}
+
+// CreateChained 在独立事务中将日志追加到哈希链
+func (r *operationLogRepository) CreateChained(log *models.OperationLog) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return r.CreateChainedWithTx(tx, log)
+	})
+}
+
+// CreateChainedWithTx 在事务中将日志追加到哈希链，咨询锁保证链按序号串行增长，事务结束时释放
+func (r *operationLogRepository) CreateChainedWithTx(tx *gorm.DB, log *models.OperationLog) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+		return err
+	}
+
+	var last models.OperationLog
+	err := tx.Select("seq", "hash").
+		Where("seq IS NOT NULL").
+		Order("seq DESC").
+		Limit(1).
+		Find(&last).Error
+	if err != nil {
+		return err
+	}
+
+	seq := int64(1)
+	if last.Seq != nil {
+		seq = *last.Seq + 1
+	}
+	log.Seal(seq, last.Hash)
+
+	return tx.Create(log).Error
+}
+
+// FindChained 按序号升序查找序号大于afterSeq的哈希链日志
+func (r *operationLogRepository) FindChained(afterSeq int64, limit int) ([]models.OperationLog, error) {
+	var logs []models.OperationLog
+	err := r.db.Where("seq > ?", afterSeq).Order("seq ASC").Limit(limit).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// CountUnchained 统计未加入哈希链的日志数
+func (r *operationLogRepository) CountUnchained() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.OperationLog{}).Where("seq IS NULL").Count(&count).Error
+	return count, err
 }
 
 func (r *operationLogRepository) DeleteOldLogs(beforeDate time.Time) (int64, error) {
@@ -93,26 +209,75 @@ func (r *operationLogRepository) DeleteOldLogs(beforeDate time.Time) (int64, err
 	return result.RowsAffected, nil
 }
 
-func (r *operationLogRepository) GetUserOperationStats(userID uuid.UUID, startDate, endDate time.Time) (map[string]int64, error) {
-	type OperationCount struct {
-		OperationType string `gorm:"column:operation_type"`
-		Count         int64  `gorm:"column:count"`
+// GetOperationStats 统计时间范围内的日志：总数、成功和失败数，以及按操作、资源类型、小时（0-23）和日期的分布
+// userID为nil时统计所有用户
+func (r *operationLogRepository) GetOperationStats(userID *uuid.UUID, startDate, endDate time.Time) (*models.OperationStats, error) {
+	scope := func() *gorm.DB {
+		query := r.db.Model(&models.OperationLog{}).Where("created_at BETWEEN ? AND ?", startDate, endDate)
+		if userID != nil {
+			query = query.Where("user_id = ?", *userID)
+		}
+		return query
 	}
 
-	var counts []OperationCount
-	err := r.db.Model(&models.OperationLog{}).
-		Select("operation_type, COUNT(*) as count").
-		Where("user_id = ? AND created_at BETWEEN ? AND ?", userID, startDate, endDate).
-		Group("operation_type").
-		Find(&counts).Error
+	stats := &models.OperationStats{
+		ByOperation:    make(map[models.OperationType]int64),
+		ByResourceType: make(map[models.ResourceType]int64),
+		ByHour:         make(map[int]int64),
+		ByDay:          make(map[string]int64),
+	}
 
+	var totals struct {
+		Total   int64 `gorm:"column:total"`
+		Success int64 `gorm:"column:success"`
+		Failure int64 `gorm:"column:failure"`
+	}
+	err := scope().
+		Select("COUNT(*) AS total, "+
+			"COUNT(*) FILTER (WHERE result = ?) AS success, "+
+			"COUNT(*) FILTER (WHERE result = ?) AS failure",
+			models.OperationSuccess, models.OperationFailure).
+		Scan(&totals).Error
 	if err != nil {
 		return nil, err
 	}
+	stats.TotalOperations, stats.SuccessCount, stats.FailureCount = totals.Total, totals.Success, totals.Failure
 
-	stats := make(map[string]int64)
-	for _, c := range counts {
-		stats[c.OperationType] = c.Count
+	type groupCount struct {
+		Key   string `gorm:"column:key"`
+		Count int64  `gorm:"column:count"`
+	}
+	countBy := func(expr string, add func(key string, count int64)) error {
+		var counts []groupCount
+		if err := scope().Select(expr + " AS key, COUNT(*) AS count").Group("key").Find(&counts).Error; err != nil {
+			return err
+		}
+		for _, c := range counts {
+			add(c.Key, c.Count)
+		}
+		return nil
+	}
+
+	if err := countBy("operation", func(key string, count int64) {
+		stats.ByOperation[models.OperationType(key)] = count
+	}); err != nil {
+		return nil, err
+	}
+	if err := countBy("resource_type", func(key string, count int64) {
+		stats.ByResourceType[models.ResourceType(key)] = count
+	}); err != nil {
+		return nil, err
+	}
+	if err := countBy("CAST(EXTRACT(HOUR FROM created_at) AS integer)::text", func(key string, count int64) {
+		hour, _ := strconv.Atoi(key)
+		stats.ByHour[hour] = count
+	}); err != nil {
+		return nil, err
+	}
+	if err := countBy("to_char(DATE(created_at), 'YYYY-MM-DD')", func(key string, count int64) {
+		stats.ByDay[key] = count
+	}); err != nil {
+		return nil, err
 	}
 
 	return stats, nil
@@ -159,3 +324,13 @@ func (r *operationLogRepository) GetSystemStats() (*models.SystemStats, error) {
 
 	return stats, nil
 }
+
+// FindAllByUser 查找用户的全部操作日志（不分页）
+func (r *operationLogRepository) FindAllByUser(userID uuid.UUID) ([]models.OperationLog, error) {
+	var logs []models.OperationLog
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
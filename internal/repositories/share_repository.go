@@ -14,14 +14,20 @@ type ShareRepository interface {
 	Create(share *models.Share) error
 	FindByID(id uuid.UUID) (*models.Share, error)
 	FindByToken(token string) (*models.Share, error)
+	TokenExists(token string) (bool, error)
 	FindByUser(userID uuid.UUID, filter models.ShareFilter) ([]models.Share, int64, error)
 	FindAll(filter models.ShareFilter) ([]models.Share, error)
 	Update(id uuid.UUID, updates map[string]interface{}) error
 	Delete(id uuid.UUID) error
-	IncrementDownloadCount(id uuid.UUID) error
+	IncrementDownloadCount(id uuid.UUID) (bool, error)
 	GetUserShareStats(userID uuid.UUID) (*models.ShareStats, error)
 	FindByFileID(fileID uuid.UUID) ([]models.Share, error)
 	UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error
+	CountActiveByUser(userID uuid.UUID) (int64, error)
+	CountActiveByFile(fileID uuid.UUID) (int64, error)
+	FindAllByUser(userID uuid.UUID) ([]models.Share, error)
+	RecordAccess(access *models.ShareAccess) error
+	FindAccesses(shareID uuid.UUID, action models.ShareAccessAction, page, pageSize int) ([]models.ShareAccess, int64, error)
 }
 
 type shareRepository struct {
@@ -55,6 +61,13 @@ func (r *shareRepository) FindByToken(token string) (*models.Share, error) {
 	return &share, nil
 }
 
+// TokenExists 检查分享令牌是否已被使用
+func (r *shareRepository) TokenExists(token string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Share{}).Where("share_token = ?", token).Count(&count).Error
+	return count > 0, err
+}
+
 func (r *shareRepository) FindByUser(userID uuid.UUID, filter models.ShareFilter) ([]models.Share, int64, error) {
 	var shares []models.Share
 	query := r.db.Model(&models.Share{}).Where("user_id = ?", userID)
@@ -101,8 +114,15 @@ func (r *shareRepository) Delete(id uuid.UUID) error {
 	return r.db.Delete(&models.Share{}, "id = ?", id).Error
 }
 
-func (r *shareRepository) IncrementDownloadCount(id uuid.UUID) error {
-	return r.db.Model(&models.Share{}).Where("id = ?", id).UpdateColumn("download_count", gorm.Expr("download_count + 1")).Error
+// IncrementDownloadCount 在分享有效且未达到下载次数上限时原子地增加下载计数
+// 检查和计数在同一条UPDATE中完成，并发下载不会超过上限；返回false表示分享已失效、过期或达到上限
+func (r *shareRepository) IncrementDownloadCount(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&models.Share{}).
+		Where("id = ? AND is_active = ?", id, true).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	return result.RowsAffected > 0, result.Error
 }
 
 func (r *shareRepository) GetUserShareStats(userID uuid.UUID) (*models.ShareStats, error) {
@@ -150,3 +170,63 @@ func (r *shareRepository) FindByFileID(fileID uuid.UUID) ([]models.Share, error)
 	}
 	return shares, nil
 }
+
+// CountActiveByUser 统计用户当前有效的分享数量
+func (r *shareRepository) CountActiveByUser(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Share{}).
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Where("(expires_at IS NULL OR expires_at >= ?)", time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// CountActiveByFile 统计文件当前有效的分享数量
+func (r *shareRepository) CountActiveByFile(fileID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Share{}).
+		Where("file_id = ? AND is_active = ?", fileID, true).
+		Where("(expires_at IS NULL OR expires_at >= ?)", time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// FindAllByUser 查找用户的全部分享（不分页）
+func (r *shareRepository) FindAllByUser(userID uuid.UUID) ([]models.Share, error) {
+	var shares []models.Share
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// RecordAccess 写入分享访问记录并增加分享的访问次数
+func (r *shareRepository) RecordAccess(access *models.ShareAccess) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(access).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Share{}).Where("id = ?", access.ShareID).
+			UpdateColumn("access_count", gorm.Expr("access_count + 1")).Error
+	})
+}
+
+// FindAccesses 分页查询分享的访问记录，按时间倒序；action为空时返回全部动作
+func (r *shareRepository) FindAccesses(shareID uuid.UUID, action models.ShareAccessAction, page, pageSize int) ([]models.ShareAccess, int64, error) {
+	query := r.db.Model(&models.ShareAccess{}).Where("share_id = ?", shareID)
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var accesses []models.ShareAccess
+	err := query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&accesses).Error
+	return accesses, total, err
+}
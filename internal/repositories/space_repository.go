@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// SpaceRepository 空间仓库接口
+type SpaceRepository interface {
+	Create(space *models.Space, creator *models.SpaceMember) error
+	FindByID(id uuid.UUID) (*models.Space, error)
+	FindByMember(userID uuid.UUID) ([]models.Space, []models.SpaceMember, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+	Delete(id uuid.UUID) error
+	CountFiles(spaceID uuid.UUID) (int64, error)
+
+	// 成员操作
+	AddMember(member *models.SpaceMember) error
+	FindMember(spaceID, userID uuid.UUID) (*models.SpaceMember, error)
+	FindMembers(spaceID uuid.UUID) ([]models.SpaceMember, error)
+	UpdateMemberRole(spaceID, userID uuid.UUID, role models.SpaceRole) error
+	RemoveMember(spaceID, userID uuid.UUID) error
+	CountMembersByRole(spaceID uuid.UUID, role models.SpaceRole) (int64, error)
+}
+
+type spaceRepository struct {
+	db *gorm.DB
+}
+
+// NewSpaceRepository 创建空间仓库实例
+func NewSpaceRepository(db *gorm.DB) SpaceRepository {
+	return &spaceRepository{db: db}
+}
+
+// Create 创建空间，创建者同时成为成员
+func (r *spaceRepository) Create(space *models.Space, creator *models.SpaceMember) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(space).Error; err != nil {
+			return err
+		}
+		creator.SpaceID = space.ID
+		return tx.Create(creator).Error
+	})
+}
+
+func (r *spaceRepository) FindByID(id uuid.UUID) (*models.Space, error) {
+	var space models.Space
+	err := r.db.Where("id = ?", id).First(&space).Error
+	if err != nil {
+		return nil, err
+	}
+	return &space, nil
+}
+
+// FindByMember 查找用户加入的所有空间及对应的成员记录，按创建时间倒序
+func (r *spaceRepository) FindByMember(userID uuid.UUID) ([]models.Space, []models.SpaceMember, error) {
+	var members []models.SpaceMember
+	if err := r.db.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil, nil
+	}
+
+	spaceIDs := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		spaceIDs = append(spaceIDs, member.SpaceID)
+	}
+
+	var spaces []models.Space
+	if err := r.db.Where("id IN ?", spaceIDs).Order("created_at DESC").Find(&spaces).Error; err != nil {
+		return nil, nil, err
+	}
+	return spaces, members, nil
+}
+
+func (r *spaceRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.Space{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Delete 删除空间及其成员记录
+func (r *spaceRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("space_id = ?", id).Delete(&models.SpaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Space{}, "id = ?", id).Error
+	})
+}
+
+// CountFiles 统计空间内的文件数（包括回收站中的文件）
+func (r *spaceRepository) CountFiles(spaceID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.File{}).Where("space_id = ?", spaceID).Count(&count).Error
+	return count, err
+}
+
+func (r *spaceRepository) AddMember(member *models.SpaceMember) error {
+	return r.db.Create(member).Error
+}
+
+func (r *spaceRepository) FindMember(spaceID, userID uuid.UUID) (*models.SpaceMember, error) {
+	var member models.SpaceMember
+	err := r.db.Where("space_id = ? AND user_id = ?", spaceID, userID).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// FindMembers 查找空间的所有成员，按加入时间排序
+func (r *spaceRepository) FindMembers(spaceID uuid.UUID) ([]models.SpaceMember, error) {
+	var members []models.SpaceMember
+	err := r.db.Preload("User").Where("space_id = ?", spaceID).Order("created_at ASC").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *spaceRepository) UpdateMemberRole(spaceID, userID uuid.UUID, role models.SpaceRole) error {
+	return r.db.Model(&models.SpaceMember{}).
+		Where("space_id = ? AND user_id = ?", spaceID, userID).
+		Update("role", role).Error
+}
+
+func (r *spaceRepository) RemoveMember(spaceID, userID uuid.UUID) error {
+	return r.db.Where("space_id = ? AND user_id = ?", spaceID, userID).Delete(&models.SpaceMember{}).Error
+}
+
+func (r *spaceRepository) CountMembersByRole(spaceID uuid.UUID, role models.SpaceRole) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.SpaceMember{}).Where("space_id = ? AND role = ?", spaceID, role).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cloud-storage/internal/models"
+)
+
+// StorageBlobRepository 去重保存的文件内容仓库接口
+type StorageBlobRepository interface {
+	AcquireWithTx(tx *gorm.DB, userID uuid.UUID, hash string) (string, bool, error)
+	CreateWithTx(tx *gorm.DB, blob *models.StorageBlob) error
+	ReleaseWithTx(tx *gorm.DB, key string) (bool, error)
+}
+
+type storageBlobRepository struct {
+	db *gorm.DB
+}
+
+// NewStorageBlobRepository 创建去重内容仓库实例
+func NewStorageBlobRepository(db *gorm.DB) StorageBlobRepository {
+	return &storageBlobRepository{db: db}
+}
+
+// AcquireWithTx 为用户哈希相同的已有内容增加一个引用，返回其存储键；没有可共享的内容时返回false
+func (r *storageBlobRepository) AcquireWithTx(tx *gorm.DB, userID uuid.UUID, hash string) (string, bool, error) {
+	var blob models.StorageBlob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND hash = ?", userID, hash).
+		Order("created_at ASC").
+		First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := tx.Model(&models.StorageBlob{}).Where("id = ?", blob.ID).
+		Update("ref_count", gorm.Expr("ref_count + 1")).Error; err != nil {
+		return "", false, err
+	}
+	return blob.Key, true, nil
+}
+
+func (r *storageBlobRepository) CreateWithTx(tx *gorm.DB, blob *models.StorageBlob) error {
+	return tx.Create(blob).Error
+}
+
+// ReleaseWithTx 减少一个引用，最后一个引用释放时删除记录并返回true，调用方需在事务提交后删除存储内容
+func (r *storageBlobRepository) ReleaseWithTx(tx *gorm.DB, key string) (bool, error) {
+	var blob models.StorageBlob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 没有引用记录时不确定是否还有其他引用，保留内容，留给垃圾回收工具处理
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if blob.RefCount > 1 {
+		return false, tx.Model(&models.StorageBlob{}).Where("id = ?", blob.ID).
+			Update("ref_count", gorm.Expr("ref_count - 1")).Error
+	}
+	return true, tx.Where("id = ?", blob.ID).Delete(&models.StorageBlob{}).Error
+}
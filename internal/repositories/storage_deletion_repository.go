@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// StorageDeletionRepository 待删除存储内容仓库接口
+type StorageDeletionRepository interface {
+	CreateWithTx(tx *gorm.DB, deletions []models.StorageDeletion) error
+	FindDue(now time.Time, limit int) ([]models.StorageDeletion, error)
+	Delete(id uuid.UUID) error
+	MarkFailed(id uuid.UUID, attempts int, nextAttemptAt time.Time, lastError string) error
+}
+
+type storageDeletionRepository struct {
+	db *gorm.DB
+}
+
+// NewStorageDeletionRepository 创建待删除存储内容仓库实例
+func NewStorageDeletionRepository(db *gorm.DB) StorageDeletionRepository {
+	return &storageDeletionRepository{db: db}
+}
+
+// CreateWithTx 在事务中登记待删除的存储内容，与数据库记录的删除一同提交
+func (r *storageDeletionRepository) CreateWithTx(tx *gorm.DB, deletions []models.StorageDeletion) error {
+	if len(deletions) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&deletions, 500).Error
+}
+
+// FindDue 按登记顺序获取已到重试时间的待删除内容
+func (r *storageDeletionRepository) FindDue(now time.Time, limit int) ([]models.StorageDeletion, error) {
+	var deletions []models.StorageDeletion
+	err := r.db.Where("next_attempt_at <= ?", now).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&deletions).Error
+	if err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (r *storageDeletionRepository) Delete(id uuid.UUID) error {
+	return r.db.Where("id = ?", id).Delete(&models.StorageDeletion{}).Error
+}
+
+// MarkFailed 记录删除失败及下次重试时间
+func (r *storageDeletionRepository) MarkFailed(id uuid.UUID, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return r.db.Model(&models.StorageDeletion{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	}).Error
+}
@@ -0,0 +1,150 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cloud-storage/internal/models"
+)
+
+// UploadSessionRepository 分片上传会话仓库接口
+type UploadSessionRepository interface {
+	Create(session *models.UploadSession) error
+	FindByID(id uuid.UUID) (*models.UploadSession, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+	TransitionStatus(id uuid.UUID, from []models.UploadStatus, to models.UploadStatus) (bool, error)
+	SaveChunk(chunk *models.UploadedChunk) error
+	DeleteChunk(uploadID uuid.UUID, chunkIndex int) error
+	FindChunks(uploadID uuid.UUID) ([]models.UploadedChunk, error)
+	FindExpired(statuses []models.UploadStatus, before time.Time, limit int) ([]models.UploadSession, error)
+	SumInProgressSize(userID uuid.UUID) (int64, error)
+	FindByUser(userID uuid.UUID) ([]models.UploadSession, error)
+}
+
+type uploadSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewUploadSessionRepository 创建分片上传会话仓库实例
+func NewUploadSessionRepository(db *gorm.DB) UploadSessionRepository {
+	return &uploadSessionRepository{db: db}
+}
+
+func (r *uploadSessionRepository) Create(session *models.UploadSession) error {
+	return r.db.Create(session).Error
+}
+
+func (r *uploadSessionRepository) FindByID(id uuid.UUID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	if err := r.db.Where("id = ?", id).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *uploadSessionRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.UploadSession{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// TransitionStatus 会话处于from中的状态时改为to，状态已被其他请求改变时返回false
+func (r *uploadSessionRepository) TransitionStatus(
+	id uuid.UUID,
+	from []models.UploadStatus,
+	to models.UploadStatus,
+) (bool, error) {
+	result := r.db.Model(&models.UploadSession{}).
+		Where("id = ? AND status IN ?", id, from).
+		Update("status", to)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// SaveChunk 记录已上传的分片（重新上传时覆盖），并更新会话的已上传分片数
+func (r *uploadSessionRepository) SaveChunk(chunk *models.UploadedChunk) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "upload_id"}, {Name: "chunk_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"size", "hash", "etag", "created_at"}),
+		}).Create(chunk).Error; err != nil {
+			return err
+		}
+
+		if err := r.refreshUploadedChunks(tx, chunk.UploadID); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.UploadSession{}).
+			Where("id = ? AND status = ?", chunk.UploadID, models.UploadStatusPending).
+			Update("status", models.UploadStatusUploading).Error
+	})
+}
+
+// DeleteChunk 删除分片记录，并更新会话的已上传分片数
+func (r *uploadSessionRepository) DeleteChunk(uploadID uuid.UUID, chunkIndex int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ? AND chunk_index = ?", uploadID, chunkIndex).
+			Delete(&models.UploadedChunk{}).Error; err != nil {
+			return err
+		}
+		return r.refreshUploadedChunks(tx, uploadID)
+	})
+}
+
+// FindChunks 按分片序号获取会话已上传的分片
+func (r *uploadSessionRepository) FindChunks(uploadID uuid.UUID) ([]models.UploadedChunk, error) {
+	var chunks []models.UploadedChunk
+	err := r.db.Where("upload_id = ?", uploadID).Order("chunk_index ASC").Find(&chunks).Error
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// FindExpired 获取在before之前过期且处于statuses中状态的会话，按过期时间排序
+func (r *uploadSessionRepository) FindExpired(
+	statuses []models.UploadStatus,
+	before time.Time,
+	limit int,
+) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	err := r.db.Where("status IN ? AND expires_at < ?", statuses, before).
+		Order("expires_at ASC").Limit(limit).Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// refreshUploadedChunks 按分片记录重新统计会话的已上传分片数
+func (r *uploadSessionRepository) refreshUploadedChunks(tx *gorm.DB, uploadID uuid.UUID) error {
+	return tx.Model(&models.UploadSession{}).
+		Where("id = ?", uploadID).
+		Update("uploaded_chunks", tx.Model(&models.UploadedChunk{}).
+			Select("COUNT(*)").
+			Where("upload_id = ?", uploadID)).Error
+}
+
+// SumInProgressSize 统计用户进行中的分片上传（未过期的等待中、上传中会话及合并中的会话）声明的文件大小之和
+func (r *uploadSessionRepository) SumInProgressSize(userID uuid.UUID) (int64, error) {
+	var total int64
+	err := r.db.Model(&models.UploadSession{}).
+		Where("user_id = ? AND ((status IN ? AND expires_at > ?) OR status = ?)", userID,
+			[]models.UploadStatus{models.UploadStatusPending, models.UploadStatusUploading}, time.Now(),
+			models.UploadStatusMerging).
+		Select("COALESCE(SUM(file_size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// FindByUser 获取用户的全部上传会话
+func (r *uploadSessionRepository) FindByUser(userID uuid.UUID) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	if err := r.db.Where("user_id = ?", userID).Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
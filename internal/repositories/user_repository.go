@@ -3,6 +3,7 @@ package repositories
 import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"cloud-storage/internal/models"
 )
@@ -14,11 +15,15 @@ type UserRepository interface {
 	CreateWithTx(tx *gorm.DB, user *models.User) error
 	FindByID(id uuid.UUID) (*models.User, error)
 	FindByIDWithTx(tx *gorm.DB, id uuid.UUID) (*models.User, error)
+	FindByIDForUpdate(tx *gorm.DB, id uuid.UUID) (*models.User, error)
+	FindIDsAfter(afterID uuid.UUID, limit int) ([]uuid.UUID, error)
 	FindByUsername(username string) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
+	FindByVerificationToken(token string) (*models.User, error)
 	FindAll(filter models.UserFilter) ([]models.User, error)
 	Update(id uuid.UUID, updates map[string]interface{}) error
 	UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error
+	UpdateIfVersion(id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error)
 	Delete(id uuid.UUID) error
 	SoftDelete(id uuid.UUID) error
 
@@ -76,6 +81,27 @@ func (r *userRepository) FindByIDWithTx(tx *gorm.DB, id uuid.UUID) (*models.User
 	return &user, nil
 }
 
+// FindByIDForUpdate 在事务中查找用户并锁定该行，直到事务结束
+func (r *userRepository) FindByIDForUpdate(tx *gorm.DB, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND deleted_at IS NULL", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindIDsAfter 按ID顺序获取afterID之后未删除用户的ID
+func (r *userRepository) FindIDsAfter(afterID uuid.UUID, limit int) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.db.Model(&models.User{}).
+		Where("id > ? AND deleted_at IS NULL", afterID).
+		Order("id").Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
 // FindByUsername 根据用户名查找用户
 func (r *userRepository) FindByUsername(username string) (*models.User, error) {
 	var user models.User
@@ -96,6 +122,16 @@ func (r *userRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByVerificationToken 根据邮箱验证令牌查找用户
+func (r *userRepository) FindByVerificationToken(token string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("verification_token = ? AND deleted_at IS NULL", token).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // FindAll 查找所有符合条件的用户
 func (r *userRepository) FindAll(filter models.UserFilter) ([]models.User, error) {
 	var users []models.User
@@ -115,12 +151,20 @@ func (r *userRepository) FindAll(filter models.UserFilter) ([]models.User, error
 
 // Update 更新用户
 func (r *userRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
-	return r.db.Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+	return r.UpdateWithTx(r.db, id, updates)
 }
 
-// UpdateWithTx 在事务中更新用户
+// UpdateWithTx 在事务中更新用户，同时递增lock_version
 func (r *userRepository) UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error {
-	return tx.Model(&models.User{}).Where("id = ?", id).Updates(updates).Error
+	return tx.Model(&models.User{}).Where("id = ?", id).Updates(withLockVersion(updates)).Error
+}
+
+// UpdateIfVersion 仅当lock_version等于期望值时更新用户，返回是否更新成功
+func (r *userRepository) UpdateIfVersion(id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error) {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND lock_version = ?", id, lockVersion).
+		Updates(withLockVersion(updates))
+	return result.RowsAffected > 0, result.Error
 }
 
 // Delete 删除用户（硬删除）
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+)
+
+// WebhookRepository Webhook仓库接口
+type WebhookRepository interface {
+	Create(webhook *models.Webhook) error
+	FindByID(id uuid.UUID) (*models.Webhook, error)
+	FindByUser(userID uuid.UUID) ([]models.Webhook, error)
+	FindActiveForEvent(userID uuid.UUID, eventType string) ([]models.Webhook, error)
+	CountByUser(userID uuid.UUID) (int64, error)
+	Update(id uuid.UUID, updates map[string]interface{}) error
+	Delete(id uuid.UUID) error
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	FindDeliveries(webhookID uuid.UUID, page, pageSize int) ([]models.WebhookDelivery, int64, error)
+}
+
+type webhookRepository struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepository 创建Webhook仓库实例
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) Create(webhook *models.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+func (r *webhookRepository) FindByID(id uuid.UUID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.Where("id = ?", id).First(&webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) FindByUser(userID uuid.UUID) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// FindActiveForEvent 查找用户已启用且订阅了该事件的Webhook
+func (r *webhookRepository) FindActiveForEvent(userID uuid.UUID, eventType string) ([]models.Webhook, error) {
+	subscribed, err := json.Marshal([]string{eventType})
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []models.Webhook
+	err = r.db.
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Where("events @> ?::jsonb", string(subscribed)).
+		Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *webhookRepository) CountByUser(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *webhookRepository) Update(id uuid.UUID, updates map[string]interface{}) error {
+	return r.db.Model(&models.Webhook{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Delete 删除Webhook及其投递记录
+func (r *webhookRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Webhook{}, "id = ?", id).Error
+	})
+}
+
+func (r *webhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Create(delivery).Error
+}
+
+// FindDeliveries 分页查找Webhook的投递记录，最新的在前
+func (r *webhookRepository) FindDeliveries(webhookID uuid.UUID, page, pageSize int) ([]models.WebhookDelivery, int64, error) {
+	var deliveries []models.WebhookDelivery
+	var total int64
+
+	query := r.db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
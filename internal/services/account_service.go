@@ -0,0 +1,513 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+)
+
+// AccountService 账户数据清除服务（被遗忘权）及紧急终止账户
+// 与停用账户不同，清除会永久删除用户的文件、版本、分享、导出包、头像、Webhook、上传会话及存储对象，并匿名化其操作日志
+type AccountService struct {
+	db             *gorm.DB
+	storage        storage.Storage
+	versionStorage storage.Storage
+	avatarStorage  storage.Storage
+	chunkUploads   *ChunkUploadService
+}
+
+// NewAccountService 创建账户数据清除服务实例
+func NewAccountService(
+	db *gorm.DB,
+	storage storage.Storage,
+	versionStorage storage.Storage,
+	avatarStorage storage.Storage,
+	chunkUploads *ChunkUploadService,
+) *AccountService {
+	return &AccountService{
+		db:             db,
+		storage:        storage,
+		versionStorage: versionStorage,
+		avatarStorage:  avatarStorage,
+		chunkUploads:   chunkUploads,
+	}
+}
+
+// EraseUser 永久清除用户及其全部数据
+// dryRun为true时只统计将要删除的数据，不做任何修改
+func (s *AccountService) EraseUser(ctx context.Context, userID uuid.UUID, dryRun bool) (*models.AccountErasureReport, error) {
+	// 包括已软删除（停用）的账户
+	var user models.User
+	if err := s.db.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	report, plan, err := s.buildErasureReport(&user)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = dryRun
+
+	if dryRun {
+		return report, nil
+	}
+
+	// 先中止进行中的分片上传，删除会话记录后就无法再找到对应的存储上传
+	if _, err := s.chunkUploads.CancelUserSessions(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// 在事务中删除数据库记录
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	blobKeys, err := s.eraseRecords(tx, &user, plan)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// 旧版本把空间文件存放在上传者的个人存储键下，删除个人目录前先移到空间的存储键
+	for _, file := range plan.kept {
+		if err := s.moveLegacySpaceContent(ctx, userID, &file); err != nil {
+			report.BlobErrors = append(report.BlobErrors, storage.GenerateFileKey(userID, file.Path))
+		}
+	}
+
+	// 数据库记录删除后清理存储对象；失败的键留给垃圾回收工具处理
+	type erasedKey struct {
+		store storage.Storage
+		key   string
+		dir   bool
+	}
+	keys := []erasedKey{
+		{s.storage, userID.String(), true},
+		{s.storage, path.Join("exports", userID.String()), true},
+		{s.storage, path.Join("temp", userID.String()), true},
+		{s.storage, path.Join("thumbnails", userID.String()), true},
+		{s.avatarStorage, path.Join(avatarPrefix, userID.String()), true},
+	}
+	// 转交的空间文件仍引用用户前缀下的历史版本和去重内容，只删除被清除的部分
+	if len(plan.kept) == 0 {
+		keys = append(keys,
+			erasedKey{s.versionStorage, path.Join("versions", userID.String()), true},
+			erasedKey{s.storage, path.Join("blobs", userID.String()), true})
+	} else {
+		for _, fileID := range plan.fileIDs {
+			keys = append(keys, erasedKey{s.versionStorage, storage.GenerateVersionDir(userID, fileID), true})
+		}
+		for _, key := range blobKeys {
+			keys = append(keys, erasedKey{s.storage, key, false})
+		}
+	}
+	for _, key := range keys {
+		var err error
+		if key.dir {
+			err = key.store.DeleteDir(ctx, key.key)
+		} else {
+			err = key.store.Delete(ctx, key.key)
+		}
+		if err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+			report.BlobErrors = append(report.BlobErrors, key.key)
+		}
+	}
+
+	return report, nil
+}
+
+// moveLegacySpaceContent 空间文件的内容仍在上传者的个人存储键下时移到空间的存储键
+func (s *AccountService) moveLegacySpaceContent(ctx context.Context, userID uuid.UUID, file *models.File) error {
+	if file.Type != models.FileTypeFile || file.BlobKey != "" || file.SpaceID == nil {
+		return nil
+	}
+	legacyKey := storage.GenerateFileKey(userID, file.Path)
+	exists, err := s.storage.Exists(ctx, legacyKey)
+	if err != nil || !exists {
+		return err
+	}
+	if exists, err = s.storage.Exists(ctx, fileKey(file)); err != nil || exists {
+		return err
+	}
+	return s.storage.Move(ctx, legacyKey, fileKey(file))
+}
+
+// TerminateUser 停用账户并按需停用其所有分享，同时记录安全警报
+// 撤销令牌和中止上传由调用方先行完成，结果记录在report和警报详情中
+func (s *AccountService) TerminateUser(
+	adminID uuid.UUID,
+	report *models.UserTerminationReport,
+	req models.UserTerminateRequest,
+	ipAddress string,
+) error {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := tx.Model(&models.User{}).Where("id = ?", report.UserID).Update("is_active", false).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to deactivate user: %w", err)
+	}
+	report.Deactivated = true
+
+	if req.DisableShares {
+		result := tx.Model(&models.Share{}).Where("user_id = ? AND is_active = ?", report.UserID, true).
+			Update("is_active", false)
+		if result.Error != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to disable shares: %w", result.Error)
+		}
+		report.SharesDisabled = result.RowsAffected
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"admin_id":        adminID,
+		"reason":          req.Reason,
+		"tokens_revoked":  report.TokensRevoked,
+		"uploads_aborted": report.UploadsAborted,
+		"shares_disabled": report.SharesDisabled,
+	})
+	alert := &models.SecurityAlert{
+		AlertType:   models.SecurityAlertAccountTerminated,
+		Severity:    models.SecuritySeverityHigh,
+		Description: fmt.Sprintf("account %s was terminated by an administrator", report.Username),
+		IPAddress:   ipAddress,
+		UserID:      &report.UserID,
+		Details:     string(details),
+	}
+	if err := tx.Create(alert).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create security alert: %w", err)
+	}
+	report.AlertID = alert.ID
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// erasurePlan 清除用户时要删除的文件，以及转交给空间其他成员而保留的空间文件
+type erasurePlan struct {
+	fileIDs    []uuid.UUID
+	kept       []models.File
+	successors map[uuid.UUID]uuid.UUID // 空间ID -> 接收用户在该空间中文件的成员
+	keptSize   map[uuid.UUID]int64     // 空间ID -> 转交的文件大小，计入接收者的已用空间
+}
+
+// buildErasureReport 统计用户将被清除的数据，返回要删除的文件和要转交的空间文件
+// 空间中的文件转交给空间的其他成员，保证其他成员的文件所在目录仍然存在；空间中已没有其他用户时随用户一起删除
+func (s *AccountService) buildErasureReport(user *models.User) (*models.AccountErasureReport, *erasurePlan, error) {
+	report := &models.AccountErasureReport{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+
+	// 包括回收站中的文件
+	var files []models.File
+	if err := s.db.Unscoped().Select("id", "type", "size", "space_id", "path", "blob_key").
+		Where("user_id = ?", user.ID).Find(&files).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get files: %w", err)
+	}
+
+	plan := &erasurePlan{
+		fileIDs:    make([]uuid.UUID, 0, len(files)),
+		successors: make(map[uuid.UUID]uuid.UUID),
+		keptSize:   make(map[uuid.UUID]int64),
+	}
+	for _, file := range files {
+		if file.SpaceID != nil {
+			successor, ok := plan.successors[*file.SpaceID]
+			if !ok {
+				var err error
+				if successor, err = s.spaceSuccessor(*file.SpaceID, user.ID); err != nil {
+					return nil, nil, err
+				}
+				plan.successors[*file.SpaceID] = successor
+			}
+			if successor != uuid.Nil {
+				plan.kept = append(plan.kept, file)
+				plan.keptSize[*file.SpaceID] += file.Size
+				report.SpaceFilesTransferred++
+				continue
+			}
+		}
+
+		plan.fileIDs = append(plan.fileIDs, file.ID)
+		if file.Type == models.FileTypeDir {
+			report.Directories++
+			continue
+		}
+		report.Files++
+		report.StorageFreed += file.Size
+	}
+	fileIDs := plan.fileIDs
+
+	// 历史版本（已归档到版本存储的版本会额外释放空间）
+	if len(fileIDs) > 0 {
+		var versions []models.FileVersion
+		if err := s.db.Select("file_size", "storage_path").
+			Where("file_id IN ?", fileIDs).Find(&versions).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to get file versions: %w", err)
+		}
+		report.Versions = len(versions)
+		for _, version := range versions {
+			if storage.IsVersionKey(version.StoragePath) {
+				report.StorageFreed += version.FileSize
+			}
+		}
+	}
+
+	var shareCount, exportCount int64
+	shareQuery := s.db.Model(&models.Share{}).Where("user_id = ?", user.ID)
+	if len(fileIDs) > 0 {
+		shareQuery = shareQuery.Or("file_id IN ?", fileIDs)
+	}
+	if err := shareQuery.Count(&shareCount).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count shares: %w", err)
+	}
+	report.Shares = int(shareCount)
+
+	if err := s.db.Model(&models.DataExport{}).
+		Where("user_id = ?", user.ID).Count(&exportCount).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count exports: %w", err)
+	}
+	report.Exports = int(exportCount)
+
+	var uploadSessionCount int64
+	if err := s.db.Model(&models.UploadSession{}).
+		Where("user_id = ?", user.ID).Count(&uploadSessionCount).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count upload sessions: %w", err)
+	}
+	report.UploadSessions = int(uploadSessionCount)
+
+	var webhookCount int64
+	if err := s.db.Model(&models.Webhook{}).
+		Where("user_id = ?", user.ID).Count(&webhookCount).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count webhooks: %w", err)
+	}
+	report.Webhooks = int(webhookCount)
+
+	userWebhooks := s.db.Model(&models.Webhook{}).Select("id").Where("user_id = ?", user.ID)
+	if err := s.db.Model(&models.WebhookDelivery{}).
+		Where("webhook_id IN (?)", userWebhooks).Count(&report.WebhookDeliveries).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+
+	if err := s.db.Model(&models.OperationLog{}).
+		Where("user_id = ?", user.ID).Count(&report.OperationLogs).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count operation logs: %w", err)
+	}
+
+	if err := s.db.Model(&models.SecurityAlert{}).
+		Where("user_id = ?", user.ID).Count(&report.SecurityAlerts).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count security alerts: %w", err)
+	}
+
+	if err := s.db.Model(&models.LoginAttempt{}).
+		Where("username = ?", user.Username).Count(&report.LoginAttempts).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to count login attempts: %w", err)
+	}
+
+	return report, plan, nil
+}
+
+// spaceSuccessor 选出接收用户在空间中文件的其他用户：优先空间管理员，其次其他成员，
+// 再次在空间中有文件的其他用户；都没有时返回uuid.Nil
+func (s *AccountService) spaceSuccessor(spaceID, userID uuid.UUID) (uuid.UUID, error) {
+	var members []models.SpaceMember
+	if err := s.db.Where("space_id = ? AND user_id <> ?", spaceID, userID).
+		Order("created_at").Find(&members).Error; err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get space members: %w", err)
+	}
+	for _, member := range members {
+		if member.Role == models.SpaceRoleAdmin {
+			return member.UserID, nil
+		}
+	}
+	if len(members) > 0 {
+		return members[0].UserID, nil
+	}
+
+	var owners []uuid.UUID
+	if err := s.db.Unscoped().Model(&models.File{}).
+		Where("space_id = ? AND user_id <> ?", spaceID, userID).
+		Limit(1).Pluck("user_id", &owners).Error; err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get space file owners: %w", err)
+	}
+	if len(owners) > 0 {
+		return owners[0], nil
+	}
+	return uuid.Nil, nil
+}
+
+// transferSpaceFiles 将用户在空间中的文件转交给接收者，已用空间随文件转移，
+// 空间由该用户创建时创建者也改为接收者
+func (s *AccountService) transferSpaceFiles(tx *gorm.DB, userID uuid.UUID, plan *erasurePlan) error {
+	for spaceID, successor := range plan.successors {
+		if successor == uuid.Nil {
+			continue
+		}
+		if err := tx.Unscoped().Model(&models.File{}).
+			Where("user_id = ? AND space_id = ?", userID, spaceID).
+			Update("user_id", successor).Error; err != nil {
+			return fmt.Errorf("failed to transfer space files: %w", err)
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", successor).
+			UpdateColumn("used_storage", gorm.Expr("used_storage + ?", plan.keptSize[spaceID])).Error; err != nil {
+			return fmt.Errorf("failed to update used storage: %w", err)
+		}
+		if err := tx.Model(&models.Space{}).Where("id = ? AND created_by = ?", spaceID, userID).
+			Update("created_by", successor).Error; err != nil {
+			return fmt.Errorf("failed to transfer space: %w", err)
+		}
+	}
+	return nil
+}
+
+// eraseRecords 在事务中删除用户数据记录并匿名化日志，转交的空间文件保留
+// 返回被删除的去重内容的存储键，提交后删除；没有转交的文件时由调用方直接删除用户的去重内容目录
+func (s *AccountService) eraseRecords(tx *gorm.DB, user *models.User, plan *erasurePlan) ([]string, error) {
+	fileIDs := plan.fileIDs
+	if err := s.transferSpaceFiles(tx, user.ID, plan); err != nil {
+		return nil, err
+	}
+
+	if len(fileIDs) > 0 {
+		if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.FileVersion{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete file versions: %w", err)
+		}
+		if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.Share{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete shares: %w", err)
+		}
+		if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.FileText{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete extracted texts: %w", err)
+		}
+		if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.FilePermission{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete file permissions: %w", err)
+		}
+		if err := tx.Where("file_id IN ?", fileIDs).Delete(&models.FileMoveHistory{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete move history: %w", err)
+		}
+	}
+
+	if err := tx.Where("grantee_user_id = ?", user.ID).Delete(&models.FilePermission{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete granted file permissions: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Share{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete shares: %w", err)
+	}
+
+	// 用户在共享空间中移动其他成员文件的记录
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.FileMoveHistory{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete move history: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.DataExport{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete exports: %w", err)
+	}
+
+	userSessions := tx.Model(&models.UploadSession{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("upload_id IN (?)", userSessions).Delete(&models.UploadedChunk{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete uploaded chunks: %w", err)
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.UploadSession{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete upload sessions: %w", err)
+	}
+
+	// 投递记录中包含回调地址的响应和错误信息
+	userWebhooks := tx.Model(&models.Webhook{}).Select("id").Where("user_id = ?", user.ID)
+	if err := tx.Where("webhook_id IN (?)", userWebhooks).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Webhook{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete webhooks: %w", err)
+	}
+
+	// 任务结果中可能包含文件名等信息
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Job{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete jobs: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.AnnouncementDismissal{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete announcement dismissals: %w", err)
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.SpaceMember{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete space memberships: %w", err)
+	}
+
+	if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.File{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete files: %w", err)
+	}
+
+	// 转交的空间文件仍引用的去重内容随文件转交，引用数按剩余的文件重新计算
+	if len(plan.kept) > 0 {
+		if err := tx.Exec(`UPDATE storage_blobs SET
+			user_id = (SELECT f.user_id FROM files f WHERE f.blob_key = storage_blobs.key LIMIT 1),
+			ref_count = (SELECT COUNT(*) FROM files f WHERE f.blob_key = storage_blobs.key)
+			WHERE user_id = ? AND EXISTS (SELECT 1 FROM files f WHERE f.blob_key = storage_blobs.key)`,
+			user.ID).Error; err != nil {
+			return nil, fmt.Errorf("failed to transfer shared contents: %w", err)
+		}
+	}
+
+	var blobKeys []string
+	if err := tx.Model(&models.StorageBlob{}).Where("user_id = ?", user.ID).
+		Pluck("key", &blobKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get shared contents: %w", err)
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.StorageBlob{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete shared contents: %w", err)
+	}
+
+	// 保留操作记录用于统计，但去除可识别个人身份的信息
+	if err := tx.Model(&models.OperationLog{}).Where("user_id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"user_id":    nil,
+			"ip_address": "",
+			"user_agent": "",
+			"details":    "",
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to anonymize operation logs: %w", err)
+	}
+
+	if err := tx.Model(&models.SecurityAlert{}).Where("user_id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"user_id":    nil,
+			"ip_address": "",
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to anonymize security alerts: %w", err)
+	}
+
+	if err := tx.Where("username = ?", user.Username).Delete(&models.LoginAttempt{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+
+	if err := tx.Unscoped().Where("id = ?", user.ID).Delete(&models.User{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return blobKeys, nil
+}
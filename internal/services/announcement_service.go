@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/repositories"
+)
+
+// AnnouncementService 系统公告服务
+type AnnouncementService struct {
+	announcementRepo repositories.AnnouncementRepository
+}
+
+// NewAnnouncementService 创建公告服务实例
+func NewAnnouncementService(announcementRepo repositories.AnnouncementRepository) *AnnouncementService {
+	return &AnnouncementService{
+		announcementRepo: announcementRepo,
+	}
+}
+
+// CreateAnnouncement 创建公告，未指定开始时间时立即生效
+func (s *AnnouncementService) CreateAnnouncement(adminID uuid.UUID, req models.AnnouncementCreateRequest) (*models.Announcement, error) {
+	announcement := &models.Announcement{
+		Title:      req.Title,
+		Content:    req.Content,
+		Level:      req.Level,
+		TargetRole: req.TargetRole,
+		StartsAt:   time.Now(),
+		EndsAt:     req.EndsAt,
+		CreatedBy:  adminID,
+	}
+	if announcement.Level == "" {
+		announcement.Level = models.AnnouncementInfo
+	}
+	if req.StartsAt != nil {
+		announcement.StartsAt = *req.StartsAt
+	}
+
+	if err := validateAnnouncementSchedule(announcement.StartsAt, announcement.EndsAt); err != nil {
+		return nil, err
+	}
+
+	if err := s.announcementRepo.Create(announcement); err != nil {
+		return nil, fmt.Errorf("failed to create announcement: %w", err)
+	}
+
+	return announcement, nil
+}
+
+// ListAnnouncements 分页获取全部公告（包括未开始和已过期的）
+func (s *AnnouncementService) ListAnnouncements(page, pageSize int) ([]models.Announcement, int64, error) {
+	announcements, total, err := s.announcementRepo.FindAll(page, pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get announcements: %w", err)
+	}
+	return announcements, total, nil
+}
+
+// UpdateAnnouncement 更新公告内容、目标角色或展示时间
+func (s *AnnouncementService) UpdateAnnouncement(id uuid.UUID, req models.AnnouncementUpdateRequest) (*models.Announcement, error) {
+	announcement, err := s.announcementRepo.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAnnouncementNotFound, err)
+	}
+
+	updates := make(map[string]interface{})
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Content != nil {
+		updates["content"] = *req.Content
+	}
+	if req.Level != nil {
+		updates["level"] = *req.Level
+	}
+	if req.TargetRole != nil {
+		if *req.TargetRole == "all" {
+			updates["target_role"] = nil
+		} else {
+			updates["target_role"] = *req.TargetRole
+		}
+	}
+
+	startsAt, endsAt := announcement.StartsAt, announcement.EndsAt
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+		updates["starts_at"] = startsAt
+	}
+	if req.EndsAt != nil {
+		endsAt = req.EndsAt
+		updates["ends_at"] = *endsAt
+	}
+	if err := validateAnnouncementSchedule(startsAt, endsAt); err != nil {
+		return nil, err
+	}
+
+	if len(updates) > 0 {
+		if err := s.announcementRepo.Update(id, updates); err != nil {
+			return nil, fmt.Errorf("failed to update announcement: %w", err)
+		}
+	}
+
+	return s.announcementRepo.FindByID(id)
+}
+
+// ExpireAnnouncement 立即结束公告的展示
+func (s *AnnouncementService) ExpireAnnouncement(id uuid.UUID) (*models.Announcement, error) {
+	announcement, err := s.announcementRepo.FindByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAnnouncementNotFound, err)
+	}
+
+	now := time.Now()
+	if announcement.EndsAt != nil && !announcement.EndsAt.After(now) {
+		return announcement, nil
+	}
+
+	if err := s.announcementRepo.Update(id, map[string]interface{}{"ends_at": now}); err != nil {
+		return nil, fmt.Errorf("failed to expire announcement: %w", err)
+	}
+	announcement.EndsAt = &now
+
+	return announcement, nil
+}
+
+// DeleteAnnouncement 删除公告
+func (s *AnnouncementService) DeleteAnnouncement(id uuid.UUID) error {
+	if _, err := s.announcementRepo.FindByID(id); err != nil {
+		return fmt.Errorf("%w: %w", ErrAnnouncementNotFound, err)
+	}
+
+	if err := s.announcementRepo.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete announcement: %w", err)
+	}
+	return nil
+}
+
+// GetActiveAnnouncements 获取面向用户角色的有效公告，includeDismissed为false时不返回用户已关闭的公告
+func (s *AnnouncementService) GetActiveAnnouncements(
+	userID uuid.UUID,
+	role models.UserRole,
+	includeDismissed bool,
+) ([]models.AnnouncementResponse, error) {
+	announcements, err := s.announcementRepo.FindActive(role, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get announcements: %w", err)
+	}
+
+	ids := make([]uuid.UUID, len(announcements))
+	for i := range announcements {
+		ids[i] = announcements[i].ID
+	}
+	dismissed, err := s.announcementRepo.FindDismissedIDs(userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dismissed announcements: %w", err)
+	}
+
+	responses := make([]models.AnnouncementResponse, 0, len(announcements))
+	for i := range announcements {
+		if dismissed[announcements[i].ID] && !includeDismissed {
+			continue
+		}
+		response := announcements[i].ToResponse()
+		response.Dismissed = dismissed[announcements[i].ID]
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// DismissAnnouncement 用户关闭公告，只能关闭对自己可见的有效公告
+func (s *AnnouncementService) DismissAnnouncement(userID uuid.UUID, role models.UserRole, id uuid.UUID) error {
+	announcement, err := s.announcementRepo.FindByID(id)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAnnouncementNotFound, err)
+	}
+
+	visible := announcement.TargetRole == nil || *announcement.TargetRole == role
+	if !visible || !announcement.IsActive(time.Now()) {
+		return ErrAnnouncementNotFound
+	}
+
+	if err := s.announcementRepo.Dismiss(id, userID); err != nil {
+		return fmt.Errorf("failed to dismiss announcement: %w", err)
+	}
+	return nil
+}
+
+// validateAnnouncementSchedule 校验结束时间晚于开始时间
+func validateAnnouncementSchedule(startsAt time.Time, endsAt *time.Time) error {
+	if endsAt != nil && !endsAt.After(startsAt) {
+		return newError(ErrInvalidArgument, "ends_at must be after starts_at")
+	}
+	return nil
+}
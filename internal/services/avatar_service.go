@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/imaging"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
+)
+
+const (
+	avatarPrefix    = "avatars"
+	avatarMaxPixels = 25000000 // 解码前允许的最大像素数
+	avatarQuality   = 85
+)
+
+// avatarNamePattern 头像文件名格式
+var avatarNamePattern = regexp.MustCompile(`^[0-9]+\.jpg$`)
+
+// AvatarService 用户头像服务
+type AvatarService struct {
+	cfg      *config.Config
+	userRepo repositories.UserRepository
+	storage  storage.Storage
+}
+
+// NewAvatarService 创建头像服务实例
+func NewAvatarService(cfg *config.Config, userRepo repositories.UserRepository, storage storage.Storage) *AvatarService {
+	return &AvatarService{
+		cfg:      cfg,
+		userRepo: userRepo,
+		storage:  storage,
+	}
+}
+
+// UploadAvatar 校验上传的图片，裁剪为正方形头像并替换用户当前头像
+func (s *AvatarService) UploadAvatar(ctx context.Context, userID uuid.UUID, fileHeader *multipart.FileHeader) (*models.User, error) {
+	if fileHeader.Size > s.cfg.Avatar.MaxSize {
+		return nil, newError(ErrInvalidArgument, fmt.Sprintf("avatar exceeds maximum size of %d bytes", s.cfg.Avatar.MaxSize))
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+
+	img, format, err := imaging.Decode(bytes.NewReader(data), avatarMaxPixels)
+	if err != nil {
+		if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrImageTooLarge) {
+			return nil, newError(ErrInvalidArgument, "avatar must be a JPEG, PNG or GIF image: "+err.Error())
+		}
+		return nil, newError(ErrInvalidArgument, err.Error())
+	}
+
+	// 重新编码会丢弃EXIF，启用自动旋转时先按方向摆正，避免头像横躺
+	if format == "jpeg" && s.cfg.Image.AutoOrient {
+		img = imaging.Orient(img, imaging.ReadOrientation(data))
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, imaging.Square(img, s.cfg.Avatar.Size), avatarQuality); err != nil {
+		return nil, fmt.Errorf("failed to encode avatar: %w", err)
+	}
+
+	// 每次上传使用新的键，旧地址的缓存不会返回新头像
+	key := path.Join(avatarPrefix, userID.String(), strconv.FormatInt(time.Now().UnixNano(), 10)+".jpg")
+	if err := s.storage.Save(ctx, key, &buf, int64(buf.Len())); err != nil {
+		return nil, fmt.Errorf("failed to save avatar: %w", err)
+	}
+
+	if err := s.userRepo.Update(userID, map[string]interface{}{"avatar_key": key}); err != nil {
+		s.storage.Delete(ctx, key)
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if user.AvatarKey != "" {
+		s.storage.Delete(ctx, user.AvatarKey)
+	}
+	user.AvatarKey = key
+
+	return user, nil
+}
+
+// DeleteAvatar 删除用户头像
+func (s *AvatarService) DeleteAvatar(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	if user.AvatarKey == "" {
+		return nil
+	}
+
+	if err := s.userRepo.Update(userID, map[string]interface{}{"avatar_key": ""}); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	s.storage.Delete(ctx, user.AvatarKey)
+	return nil
+}
+
+// OpenAvatar 打开头像图片，name为头像键中的文件名
+func (s *AvatarService) OpenAvatar(ctx context.Context, userID uuid.UUID, name string) (io.ReadCloser, error) {
+	if !avatarNamePattern.MatchString(name) {
+		return nil, newError(ErrFileNotFound, "avatar not found")
+	}
+
+	reader, err := s.storage.Get(ctx, path.Join(avatarPrefix, userID.String(), name))
+	if err != nil {
+		return nil, newError(ErrFileNotFound, "avatar not found")
+	}
+	return reader, nil
+}
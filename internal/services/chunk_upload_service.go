@@ -0,0 +1,627 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
+)
+
+// ChunkUploadService 分片上传服务
+// 分片通过存储的分片上传接口写入临时键，全部分片上传后合并，再按普通上传的流程校验配额并保存为文件
+type ChunkUploadService struct {
+	cfg         *config.Config
+	sessionRepo repositories.UploadSessionRepository
+	files       *FileService
+
+	cleanupMu    sync.Mutex
+	cleanupStats models.UploadSessionCleanupStats
+}
+
+// NewChunkUploadService 创建分片上传服务实例
+func NewChunkUploadService(cfg *config.Config, db *gorm.DB, fileService *FileService) *ChunkUploadService {
+	return &ChunkUploadService{
+		cfg:         cfg,
+		sessionRepo: repositories.NewUploadSessionRepository(db),
+		files:       fileService,
+	}
+}
+
+// InitiateUpload 创建分片上传会话，按声明的文件大小预先检查配额和同名冲突
+func (s *ChunkUploadService) InitiateUpload(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.InitiateUploadRequest,
+) (*models.UploadSession, error) {
+	if !s.cfg.Storage.EnableChunkUpload {
+		return nil, newError(ErrPermissionDenied, "chunked upload is disabled")
+	}
+
+	user, err := s.files.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, err := s.files.parseUploadChecksum(req.FileHash); err != nil {
+		return nil, err
+	}
+
+	if err := s.files.checkUploadSize(req.FileSize); err != nil {
+		return nil, err
+	}
+	if req.FileSize == 0 && !s.cfg.Storage.AllowEmptyFiles {
+		return nil, newError(ErrInvalidArgument, "empty files are not allowed")
+	}
+
+	chunkSize := req.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = s.cfg.Storage.ChunkSize
+	}
+	if chunkSize <= 0 {
+		return nil, newError(ErrInvalidArgument, "chunk_size is required")
+	}
+	if chunkSize > s.cfg.Storage.MaxUploadSize {
+		return nil, newError(ErrInvalidArgument,
+			fmt.Sprintf("chunk_size must not exceed %d bytes", s.cfg.Storage.MaxUploadSize))
+	}
+
+	filename, err := s.files.sanitizeName(req.FileName)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := req.MimeType
+	if mimeType == "" {
+		mimeType = storage.GetMimeType(filename)
+	}
+	// 内容尚未上传，先按扩展名和声明的类型检查，完成时再按嗅探出的类型检查
+	if err := s.files.checkUploadType(filename, mimeType, nil); err != nil {
+		return nil, err
+	}
+
+	spaceID, err := s.files.resolveParent(userID, req.ParentID, req.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按声明的大小检查配额，完成时按实际内容再检查一次
+	existingFile, err := s.files.findSibling(userID, spaceID, req.ParentID, filename)
+	if err == nil && existingFile != nil {
+		if !req.Override {
+			return nil, newError(ErrNameConflict, "file already exists")
+		}
+		if !user.CheckStorageQuota(req.FileSize - existingFile.Size) {
+			return nil, s.files.quotaExceeded(user, req.FileSize-existingFile.Size)
+		}
+	} else {
+		existingFile = nil
+		if !user.CheckStorageQuota(req.FileSize) {
+			return nil, s.files.quotaExceeded(user, req.FileSize)
+		}
+	}
+	if err := s.files.checkCategoryQuotas(user, mimeType, req.FileSize, existingFile); err != nil {
+		return nil, err
+	}
+	if err := s.checkTempQuota(userID, req.FileSize); err != nil {
+		return nil, err
+	}
+
+	session := &models.UploadSession{
+		ID:          uuid.New(),
+		UserID:      userID,
+		FileName:    filename,
+		FileSize:    req.FileSize,
+		FileHash:    req.FileHash,
+		ParentID:    req.ParentID,
+		SpaceID:     spaceID,
+		ChunkSize:   chunkSize,
+		TotalChunks: int((req.FileSize + chunkSize - 1) / chunkSize),
+		StoragePath: storage.GenerateTempKey(userID, "content"),
+		MimeType:    mimeType,
+		Status:      models.UploadStatusPending,
+		IsPublic:    req.IsPublic,
+		Override:    req.Override,
+		ExpiresAt:   time.Now().Add(s.cfg.Storage.UploadSessionTTL),
+	}
+
+	// 空文件没有分片，完成时直接保存
+	if session.TotalChunks > 0 {
+		session.StorageUploadID, err = s.files.storage.InitiateMultipartUpload(ctx, session.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initiate multipart upload: %w", err)
+		}
+	}
+
+	if err := s.sessionRepo.Create(session); err != nil {
+		if session.StorageUploadID != "" {
+			s.files.storage.AbortMultipartUpload(ctx, session.StorageUploadID)
+		}
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return session, nil
+}
+
+// TempUsage 返回用户进行中的分片上传占用的临时空间（按声明的文件大小计）和上限，上限为0表示不限制
+func (s *ChunkUploadService) TempUsage(userID uuid.UUID) (*models.UploadTempUsage, error) {
+	used, err := s.sessionRepo.SumInProgressSize(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-progress uploads: %w", err)
+	}
+	return &models.UploadTempUsage{Used: used, Quota: s.cfg.Storage.UploadTempQuota}, nil
+}
+
+// checkTempQuota 检查新会话加入后进行中的分片上传是否超出临时空间上限，防止未完成的上传占满磁盘
+func (s *ChunkUploadService) checkTempQuota(userID uuid.UUID, size int64) error {
+	if s.cfg.Storage.UploadTempQuota <= 0 {
+		return nil
+	}
+	usage, err := s.TempUsage(userID)
+	if err != nil {
+		return err
+	}
+	if usage.Used+size > usage.Quota {
+		return newError(ErrTempQuotaExceeded, fmt.Sprintf(
+			"in-progress uploads would use %d of %d bytes, complete or cancel existing uploads first",
+			usage.Used+size, usage.Quota))
+	}
+	return nil
+}
+
+// UploadChunk 上传第req.ChunkIndex个分片，校验分片大小和哈希，同一分片可重复上传
+func (s *ChunkUploadService) UploadChunk(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.ChunkUploadRequest,
+	data io.Reader,
+) (*models.ChunkUploadResponse, error) {
+	session, err := s.getActiveSession(userID, req.UploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ChunkIndex >= session.TotalChunks {
+		return nil, newError(ErrInvalidArgument,
+			fmt.Sprintf("chunk_index must be less than %d", session.TotalChunks))
+	}
+
+	expectedSize := session.ExpectedChunkSize(req.ChunkIndex)
+	if req.ChunkSize != expectedSize {
+		return nil, newError(ErrInvalidArgument,
+			fmt.Sprintf("chunk %d must be %d bytes", req.ChunkIndex, expectedSize))
+	}
+
+	// 未启用UPLOAD_VERIFY_CHECKSUM时不校验分片哈希
+	checksum, err := s.files.parseUploadChecksum(req.ChunkHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多读一个字节以发现超出声明大小的分片
+	reqCtx := ctx.Request.Context()
+	counter := &countingReader{r: io.LimitReader(contextReader{ctx: reqCtx, r: data}, expectedSize+1)}
+	var reader io.Reader = counter
+	var checksumReader *storage.ChecksumReader
+	if checksum != nil {
+		checksumReader = storage.NewChecksumReader(counter, checksum)
+		reader = checksumReader
+	}
+	etag, err := s.files.storage.UploadPart(reqCtx, session.StorageUploadID, req.ChunkIndex+1, reader)
+	if err == nil && counter.n != expectedSize {
+		err = newError(ErrInvalidArgument, fmt.Sprintf("chunk %d must be %d bytes", req.ChunkIndex, expectedSize))
+	}
+	if err == nil && checksumReader != nil {
+		if verifyErr := checksumReader.Verify(); verifyErr != nil {
+			err = ErrChecksumMismatch
+		}
+	}
+	if err != nil {
+		// 存储中的分片可能已被不完整的内容覆盖，删除记录使客户端必须重新上传
+		if dropErr := s.sessionRepo.DeleteChunk(session.ID, req.ChunkIndex); dropErr != nil {
+			log.Printf("Failed to drop chunk %d of upload %s: %v", req.ChunkIndex, session.ID, dropErr)
+		}
+		if reqCtx.Err() != nil {
+			return nil, ErrUploadAborted
+		}
+		if errors.Is(err, ErrInvalidArgument) || errors.Is(err, ErrChecksumMismatch) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to upload chunk: %w", err)
+	}
+
+	if err := s.sessionRepo.SaveChunk(&models.UploadedChunk{
+		UploadID:   session.ID,
+		ChunkIndex: req.ChunkIndex,
+		Size:       expectedSize,
+		Hash:       req.ChunkHash,
+		ETag:       etag,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save chunk: %w", err)
+	}
+
+	chunks, err := s.sessionRepo.FindChunks(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploaded chunks: %w", err)
+	}
+
+	response := &models.ChunkUploadResponse{
+		ChunkIndex:      req.ChunkIndex,
+		Uploaded:        true,
+		CompletedChunks: make([]int, 0, len(chunks)),
+	}
+	for _, chunk := range chunks {
+		response.UploadedSize += chunk.Size
+		response.CompletedChunks = append(response.CompletedChunks, chunk.ChunkIndex)
+	}
+	response.Progress = float64(len(chunks)) / float64(session.TotalChunks) * 100
+
+	return response, nil
+}
+
+// GetUploadSession 获取上传会话及已上传的分片序号，用于断点续传
+func (s *ChunkUploadService) GetUploadSession(userID, uploadID uuid.UUID) (*models.UploadSession, []int, error) {
+	session, err := s.getSession(userID, uploadID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chunks, err := s.sessionRepo.FindChunks(session.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get uploaded chunks: %w", err)
+	}
+
+	completed := make([]int, 0, len(chunks))
+	for _, chunk := range chunks {
+		completed = append(completed, chunk.ChunkIndex)
+	}
+	return session, completed, nil
+}
+
+// CompleteUpload 合并全部分片并保存为文件
+// 合并后按实际内容校验文件哈希，并再次检查配额（上传期间其他上传可能已占用空间）；
+// 配额不足等可重试的失败会保留已合并的内容，会话恢复为上传中，可在有效期内再次完成
+func (s *ChunkUploadService) CompleteUpload(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	uploadID uuid.UUID,
+) (*models.File, error) {
+	session, err := s.getActiveSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, err := s.sessionRepo.FindChunks(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploaded chunks: %w", err)
+	}
+	if len(chunks) != session.TotalChunks {
+		return nil, newError(ErrInvalidArgument,
+			fmt.Sprintf("upload incomplete: %d of %d chunks uploaded", len(chunks), session.TotalChunks))
+	}
+
+	// 防止并发完成同一会话
+	claimed, err := s.sessionRepo.TransitionStatus(session.ID,
+		[]models.UploadStatus{models.UploadStatusPending, models.UploadStatusUploading}, models.UploadStatusMerging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update upload session: %w", err)
+	}
+	if !claimed {
+		return nil, ErrUploadClosed
+	}
+
+	file, err := s.mergeAndSave(ctx, session, chunks)
+	if err != nil {
+		status := models.UploadStatusUploading
+		if errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrFileTypeNotAllowed) || errors.Is(err, ErrMalwareDetected) {
+			// 合并后的内容有误或不允许保存，无法通过重试完成
+			status = models.UploadStatusFailed
+			s.files.storage.Delete(ctx, session.StoragePath)
+		}
+		if updateErr := s.sessionRepo.Update(session.ID, map[string]interface{}{
+			"status":        status,
+			"error_message": err.Error(),
+		}); updateErr != nil {
+			log.Printf("Failed to update upload session %s: %v", session.ID, updateErr)
+		}
+		return nil, err
+	}
+
+	if session.TotalChunks > 0 {
+		if err := s.files.storage.Delete(ctx, session.StoragePath); err != nil {
+			log.Printf("Failed to delete merged upload %s: %v", session.StoragePath, err)
+		}
+	}
+	if err := s.sessionRepo.Update(session.ID, map[string]interface{}{
+		"status":        models.UploadStatusCompleted,
+		"error_message": "",
+		"file_id":       file.ID,
+	}); err != nil {
+		log.Printf("Failed to update upload session %s: %v", session.ID, err)
+	}
+
+	return file, nil
+}
+
+// mergeAndSave 合并分片（已合并时跳过）并将合并后的内容保存为文件
+func (s *ChunkUploadService) mergeAndSave(
+	ctx *gin.Context,
+	session *models.UploadSession,
+	chunks []models.UploadedChunk,
+) (*models.File, error) {
+	if session.StorageUploadID != "" {
+		etags := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			etags = append(etags, chunk.ETag)
+		}
+		if err := s.files.storage.CompleteMultipartUpload(ctx, session.StorageUploadID, etags); err != nil {
+			return nil, fmt.Errorf("failed to merge chunks: %w", err)
+		}
+
+		// 分片上传已结束，重试时直接使用合并后的内容
+		session.StorageUploadID = ""
+		if err := s.sessionRepo.Update(session.ID, map[string]interface{}{"storage_upload_id": ""}); err != nil {
+			return nil, fmt.Errorf("failed to update upload session: %w", err)
+		}
+	}
+
+	var content io.Reader = bytes.NewReader(nil)
+	if session.TotalChunks > 0 {
+		reader, err := s.files.storage.Get(ctx, session.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open merged upload: %w", err)
+		}
+		defer reader.Close()
+
+		buffered := bufio.NewReaderSize(reader, storage.SniffLength)
+		head, err := buffered.Peek(storage.SniffLength)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read merged upload: %w", err)
+		}
+		if err := s.files.checkUploadType(session.FileName, session.MimeType, head); err != nil {
+			return nil, err
+		}
+		content = buffered
+	}
+
+	user, err := s.files.userRepo.FindByID(session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	checksum, err := s.files.parseUploadChecksum(session.FileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	req := models.FileUploadRequest{
+		ParentID: session.ParentID,
+		SpaceID:  session.SpaceID,
+		IsPublic: session.IsPublic,
+		Override: session.Override,
+	}
+	return s.files.saveUploadedFile(ctx, user, session.SpaceID, req, session.FileName, session.MimeType,
+		content, session.FileSize, checksum)
+}
+
+// expiredSessionBatch 每批清理的过期会话数
+const expiredSessionBatch = 100
+
+// CancelExpiredSessions 将已过期仍处于等待或上传中的会话标记为已取消，并中止其分片上传、删除已合并的内容；
+// 返回取消的会话数。合并中的会话可能仍在其他实例上完成，不处理
+func (s *ChunkUploadService) CancelExpiredSessions(ctx context.Context) (int, error) {
+	active := []models.UploadStatus{models.UploadStatusPending, models.UploadStatusUploading}
+	canceled := 0
+	for {
+		sessions, err := s.sessionRepo.FindExpired(active, time.Now(), expiredSessionBatch)
+		if err != nil {
+			return canceled, fmt.Errorf("failed to find expired upload sessions: %w", err)
+		}
+
+		for i := range sessions {
+			if err := ctx.Err(); err != nil {
+				return canceled, err
+			}
+			if s.cancelSession(ctx, &sessions[i]) {
+				canceled++
+			}
+		}
+		if len(sessions) < expiredSessionBatch {
+			return canceled, nil
+		}
+	}
+}
+
+// CancelUserSessions 取消用户全部未完成的上传会话并释放其占用的存储，用于清除账户；返回取消的会话数
+// 等待中、上传中的会话按正常取消处理，其他仍有分片上传的会话（合并中、失败）直接中止分片上传
+func (s *ChunkUploadService) CancelUserSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	sessions, err := s.sessionRepo.FindByUser(userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get upload sessions: %w", err)
+	}
+
+	canceled := 0
+	for i := range sessions {
+		session := &sessions[i]
+		switch session.Status {
+		case models.UploadStatusPending, models.UploadStatusUploading:
+			if s.cancelSession(ctx, session) {
+				canceled++
+			}
+		case models.UploadStatusMerging, models.UploadStatusFailed:
+			if session.StorageUploadID == "" {
+				continue
+			}
+			if err := s.files.storage.AbortMultipartUpload(ctx, session.StorageUploadID); err != nil {
+				log.Printf("Failed to abort multipart upload of session %s: %v", session.ID, err)
+			}
+		}
+	}
+	return canceled, nil
+}
+
+// StartSessionCleanup UPLOAD_SESSION_CLEANUP_INTERVAL大于0时，定期取消过期的上传会话
+func (s *ChunkUploadService) StartSessionCleanup() {
+	interval := s.cfg.Storage.UploadSessionCleanupInterval
+	s.cleanupStats.IntervalSeconds = int64(interval / time.Second)
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runSessionCleanup(context.Background())
+		}
+	}()
+}
+
+// runSessionCleanup 执行一轮过期会话清理并记录统计
+func (s *ChunkUploadService) runSessionCleanup(ctx context.Context) {
+	start := time.Now()
+	canceled, err := s.CancelExpiredSessions(ctx)
+	if err != nil {
+		log.Printf("Upload session cleanup failed: %v", err)
+	} else if canceled > 0 {
+		log.Printf("Upload session cleanup canceled %d expired sessions", canceled)
+	}
+
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+	stats := &s.cleanupStats
+	stats.LastRunAt = &start
+	stats.LastDurationMs = time.Since(start).Milliseconds()
+	stats.LastCanceled = canceled
+	stats.LastError = ""
+	if err != nil {
+		stats.LastError = err.Error()
+	}
+	stats.TotalRuns++
+	stats.TotalCanceled += int64(canceled)
+}
+
+// SessionCleanupStats 获取过期会话清理的运行统计
+func (s *ChunkUploadService) SessionCleanupStats() models.UploadSessionCleanupStats {
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
+	return s.cleanupStats
+}
+
+// CleanupIncompleteUploads 先取消过期的上传会话，再中止存储中发起时间早于olderThan之前的未完成分片上传，
+// 包括没有会话记录的遗留上传（如S3中由已崩溃的请求发起的上传）；olderThan为0时使用会话有效期，
+// 不能小于会话有效期，以免中止仍在进行的上传
+func (s *ChunkUploadService) CleanupIncompleteUploads(ctx context.Context, olderThan time.Duration) (*models.MultipartCleanupResult, error) {
+	if olderThan == 0 {
+		olderThan = s.cfg.Storage.UploadSessionTTL
+	}
+	if olderThan < s.cfg.Storage.UploadSessionTTL {
+		return nil, newError(ErrInvalidArgument, fmt.Sprintf("older_than must be at least the upload session TTL (%s)",
+			s.cfg.Storage.UploadSessionTTL))
+	}
+
+	cleaner, ok := s.files.storage.(storage.UploadCleaner)
+	if !ok {
+		return nil, newError(ErrInvalidArgument, storage.ErrUploadCleanupUnsupported.Error())
+	}
+
+	canceled, err := s.CancelExpiredSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cleaned, err := cleaner.CleanupIncompleteUploads(ctx, olderThan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up incomplete uploads: %w", err)
+	}
+
+	return &models.MultipartCleanupResult{
+		StorageType:      string(s.files.storage.Type()),
+		OlderThanSeconds: int64(olderThan / time.Second),
+		CanceledSessions: canceled,
+		AbortedUploads:   cleaned.Aborted,
+		FailedUploads:    cleaned.Failed,
+		ReclaimedBytes:   cleaned.ReclaimedBytes,
+	}, nil
+}
+
+// cancelSession 取消会话并释放其占用的存储，会话状态已被其他请求改变时返回false
+func (s *ChunkUploadService) cancelSession(ctx context.Context, session *models.UploadSession) bool {
+	claimed, err := s.sessionRepo.TransitionStatus(session.ID,
+		[]models.UploadStatus{models.UploadStatusPending, models.UploadStatusUploading}, models.UploadStatusCanceled)
+	if err != nil {
+		log.Printf("Failed to cancel upload session %s: %v", session.ID, err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	// 分片上传已结束时内容已合并到StoragePath
+	if session.StorageUploadID != "" {
+		err = s.files.storage.AbortMultipartUpload(ctx, session.StorageUploadID)
+	} else if session.TotalChunks > 0 {
+		err = s.files.storage.Delete(ctx, session.StoragePath)
+		if errors.Is(err, storage.ErrFileNotFound) {
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to release storage of upload session %s: %v", session.ID, err)
+	}
+	return true
+}
+
+// getSession 获取用户的上传会话，其他用户的会话视为不存在
+func (s *ChunkUploadService) getSession(userID, uploadID uuid.UUID) (*models.UploadSession, error) {
+	session, err := s.sessionRepo.FindByID(uploadID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	if session.UserID != userID {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+// getActiveSession 获取仍可上传分片的会话
+func (s *ChunkUploadService) getActiveSession(userID, uploadID uuid.UUID) (*models.UploadSession, error) {
+	session, err := s.getSession(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsActive() {
+		return nil, ErrUploadClosed
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return session, nil
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
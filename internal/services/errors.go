@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 服务层哨兵错误，处理器通过errors.Is映射为HTTP状态码
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrFileNotFound         = errors.New("file not found")
+	ErrVersionNotFound      = errors.New("version not found")
+	ErrShareNotFound        = errors.New("share not found")
+	ErrPermissionDenied     = errors.New("permission denied")
+	ErrQuotaExceeded        = errors.New("storage quota exceeded")
+	ErrTempQuotaExceeded    = errors.New("too much upload data in progress")
+	ErrNameConflict         = errors.New("name conflict")
+	ErrInvalidTarget        = errors.New("invalid target directory")
+	ErrInvalidArgument      = errors.New("invalid argument")
+	ErrChecksumMismatch     = errors.New("checksum mismatch")
+	ErrShareInvalid         = errors.New("share is invalid or expired")
+	ErrPasswordRequired     = errors.New("password required")
+	ErrInvalidPassword      = errors.New("invalid password")
+	ErrShareNotAllowed      = errors.New("operation not allowed by share")
+	ErrShareLimitReached    = errors.New("share limit exceeded")
+	ErrExportInProgress     = errors.New("an export is already in progress")
+	ErrExportNotFound       = errors.New("export not found")
+	ErrExportExpired        = errors.New("export link has expired")
+	ErrPreviewUnavailable   = errors.New("text preview not available")
+	ErrAnnouncementNotFound = errors.New("announcement not found")
+	ErrAuditLogImmutable    = errors.New("operation logs are append-only in compliance mode")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrSpaceNotFound        = errors.New("space not found")
+	ErrSpaceNotEmpty        = errors.New("space is not empty")
+	ErrLastSpaceAdmin       = errors.New("space must keep at least one admin")
+	ErrQueryTimeout         = errors.New("query timed out")
+	ErrTreeTooLarge         = errors.New("directory tree too large")
+	ErrUploadAborted        = errors.New("upload was aborted")
+	ErrVersionConflict      = errors.New("resource was modified by another request")
+	ErrJobNotFound          = errors.New("job not found")
+	ErrJobFinished          = errors.New("job has already finished")
+	ErrJobQueueFull         = errors.New("too many pending jobs, please retry later")
+	ErrUploadLimitExceeded  = errors.New("upload volume limit exceeded, please retry later")
+	ErrMoveNotUndoable      = errors.New("move cannot be undone")
+	ErrUploadNotFound       = errors.New("upload session not found")
+	ErrUploadExpired        = errors.New("upload session has expired")
+	ErrUploadClosed         = errors.New("upload session is already completed or canceled")
+	ErrRangeNotSatisfiable  = errors.New("requested range not satisfiable")
+	ErrAlertNotFound        = errors.New("security alert not found")
+	ErrFileTypeNotAllowed   = errors.New("file type not allowed")
+	ErrFileTooLarge         = errors.New("file too large")
+	ErrMalwareDetected      = errors.New("malware detected")
+	ErrScanFailed           = errors.New("virus scan unavailable, please retry later")
+)
+
+// serviceError 带具体描述的服务错误，可通过errors.Is匹配其哨兵错误
+type serviceError struct {
+	kind    error
+	message string
+}
+
+func (e *serviceError) Error() string {
+	return e.message
+}
+
+func (e *serviceError) Unwrap() error {
+	return e.kind
+}
+
+// newError 创建对外消息为message、类别为kind的错误
+func newError(kind error, message string) error {
+	return &serviceError{kind: kind, message: message}
+}
+
+// CategoryQuotaError 超出分类子配额，可通过errors.Is匹配ErrQuotaExceeded
+type CategoryQuotaError struct {
+	Category string
+	Used     int64
+	Quota    int64
+}
+
+func (e *CategoryQuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d bytes used", e.Category, e.Used, e.Quota)
+}
+
+func (e *CategoryQuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// FileTypeError 上传的文件类型不允许，可通过errors.Is匹配ErrFileTypeNotAllowed
+// Declared不为空时表示嗅探出的内容类型Type与声明的类型不符
+type FileTypeError struct {
+	Type     string
+	Declared string
+}
+
+func (e *FileTypeError) Error() string {
+	if e.Declared != "" {
+		return fmt.Sprintf("file content type %s does not match declared type %s", e.Type, e.Declared)
+	}
+	return fmt.Sprintf("file type %s is not allowed", e.Type)
+}
+
+func (e *FileTypeError) Unwrap() error {
+	return ErrFileTypeNotAllowed
+}
+
+// RangeNotSatisfiableError 请求的范围超出文件大小，可通过errors.Is匹配ErrRangeNotSatisfiable
+type RangeNotSatisfiableError struct {
+	Size int64
+}
+
+func (e *RangeNotSatisfiableError) Error() string {
+	return fmt.Sprintf("requested range not satisfiable for %d bytes", e.Size)
+}
+
+func (e *RangeNotSatisfiableError) Unwrap() error {
+	return ErrRangeNotSatisfiable
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/mail"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
+)
+
+// ExportService 用户数据导出服务（数据可携带权）
+type ExportService struct {
+	cfg        *config.Config
+	exportRepo repositories.DataExportRepository
+	userRepo   repositories.UserRepository
+	fileRepo   repositories.FileRepository
+	shareRepo  repositories.ShareRepository
+	logRepo    repositories.OperationLogRepository
+	storage    storage.Storage
+	mailer     mail.Mailer
+	jobs       *JobService
+}
+
+// NewExportService 创建数据导出服务实例
+func NewExportService(
+	cfg *config.Config,
+	exportRepo repositories.DataExportRepository,
+	userRepo repositories.UserRepository,
+	fileRepo repositories.FileRepository,
+	shareRepo repositories.ShareRepository,
+	logRepo repositories.OperationLogRepository,
+	storage storage.Storage,
+	mailer mail.Mailer,
+	jobService *JobService,
+) *ExportService {
+	return &ExportService{
+		cfg:        cfg,
+		exportRepo: exportRepo,
+		userRepo:   userRepo,
+		fileRepo:   fileRepo,
+		shareRepo:  shareRepo,
+		logRepo:    logRepo,
+		storage:    storage,
+		mailer:     mailer,
+		jobs:       jobService,
+	}
+}
+
+// RequestExport 创建导出任务并提交后台任务生成导出包，每个用户同时只允许一个进行中的任务
+func (s *ExportService) RequestExport(userID uuid.UUID) (*models.DataExport, error) {
+	if active, err := s.exportRepo.FindActiveByUser(userID); err == nil {
+		if !s.isInterrupted(userID, active) {
+			return nil, ErrExportInProgress
+		}
+		s.failExport(active.ID, errors.New("interrupted by server restart"))
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to check active exports: %w", err)
+	}
+
+	export := &models.DataExport{
+		UserID: userID,
+		Status: models.ExportStatusPending,
+	}
+	if err := s.exportRepo.Create(export); err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	exportID := export.ID
+	job, err := s.jobs.Submit(userID, models.JobTypeDataExport, func(ctx context.Context, progress JobProgress) (interface{}, error) {
+		return nil, s.runExport(ctx, exportID, userID, progress)
+	})
+	if err != nil {
+		s.failExport(exportID, err)
+		return nil, err
+	}
+
+	if err := s.exportRepo.Update(exportID, map[string]interface{}{"job_id": job.ID}); err != nil {
+		log.Printf("Failed to link export %s to job %s: %v", exportID, job.ID, err)
+	}
+	export.JobID = &job.ID
+
+	return export, nil
+}
+
+// isInterrupted 检查进行中的导出是否因服务重启而中断：其后台任务已结束但导出仍未完成
+func (s *ExportService) isInterrupted(userID uuid.UUID, export *models.DataExport) bool {
+	if export.JobID == nil {
+		return false
+	}
+	job, err := s.jobs.GetJob(userID, *export.JobID)
+	return err == nil && job.IsFinished()
+}
+
+// GetUserExports 获取用户的导出任务列表
+func (s *ExportService) GetUserExports(userID uuid.UUID) ([]models.DataExport, error) {
+	exports, err := s.exportRepo.FindByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exports: %w", err)
+	}
+	return exports, nil
+}
+
+// OpenExport 通过下载令牌打开已完成的导出包
+func (s *ExportService) OpenExport(ctx context.Context, token string) (io.ReadCloser, *models.DataExport, error) {
+	export, err := s.exportRepo.FindByToken(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrExportNotFound, err)
+	}
+
+	if export.Status != models.ExportStatusCompleted {
+		return nil, nil, ErrExportNotFound
+	}
+
+	if export.IsExpired() {
+		return nil, nil, ErrExportExpired
+	}
+
+	reader, err := s.storage.Get(ctx, export.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get export from storage: %w", err)
+	}
+
+	return reader, export, nil
+}
+
+// runExport 生成导出包并通过邮件发送下载链接，失败时将导出标记为失败并返回错误
+func (s *ExportService) runExport(ctx context.Context, exportID uuid.UUID, userID uuid.UUID, progress JobProgress) error {
+	if err := s.exportRepo.Update(exportID, map[string]interface{}{
+		"status": models.ExportStatusProcessing,
+	}); err != nil {
+		return fmt.Errorf("failed to start export: %w", err)
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return s.failExport(exportID, fmt.Errorf("failed to get user: %w", err))
+	}
+
+	storageKey := path.Join("exports", userID.String(), exportID.String()+".zip")
+	size, err := s.buildArchive(ctx, user, storageKey, progress)
+	if err != nil {
+		return s.failExport(exportID, err)
+	}
+
+	token, err := generateExportToken()
+	if err != nil {
+		s.storage.Delete(ctx, storageKey)
+		return s.failExport(exportID, err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(s.cfg.Export.LinkExpireHours) * time.Hour)
+	if err := s.exportRepo.Update(exportID, map[string]interface{}{
+		"status":         models.ExportStatusCompleted,
+		"storage_key":    storageKey,
+		"file_size":      size,
+		"download_token": token,
+		"expires_at":     expiresAt,
+		"completed_at":   now,
+	}); err != nil {
+		s.storage.Delete(ctx, storageKey)
+		return s.failExport(exportID, fmt.Errorf("failed to update export: %w", err))
+	}
+
+	link := fmt.Sprintf("%s/api/v1/exports/%s/download", strings.TrimRight(s.cfg.App.BaseURL, "/"), token)
+	body := fmt.Sprintf("Hello %s,\n\nYour data export is ready. Download it before %s:\n\n%s\n",
+		user.Username, expiresAt.Format(time.RFC1123), link)
+	if err := s.mailer.Send(user.Email, "Your data export is ready", body); err != nil {
+		log.Printf("Failed to send export email for %s: %v", exportID, err)
+	}
+	return nil
+}
+
+// failExport 将导出任务标记为失败，返回cause
+func (s *ExportService) failExport(exportID uuid.UUID, cause error) error {
+	log.Printf("Export %s failed: %v", exportID, cause)
+	if err := s.exportRepo.Update(exportID, map[string]interface{}{
+		"status":        models.ExportStatusFailed,
+		"error_message": cause.Error(),
+	}); err != nil {
+		log.Printf("Failed to mark export %s as failed: %v", exportID, err)
+	}
+	return cause
+}
+
+// buildArchive 将用户文件和元数据清单打包为ZIP并保存到存储，返回包大小；按已写入的文件数报告进度
+func (s *ExportService) buildArchive(ctx context.Context, user *models.User, storageKey string, progress JobProgress) (int64, error) {
+	tmp, err := os.CreateTemp(s.cfg.Storage.TempPath, "export-*.zip")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	files, err := s.fileRepo.FindAllByUser(user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get files: %w", err)
+	}
+	shares, err := s.shareRepo.FindAllByUser(user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get shares: %w", err)
+	}
+	logs, err := s.logRepo.FindAllByUser(user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get operation logs: %w", err)
+	}
+
+	zw := zip.NewWriter(tmp)
+
+	// 写入文件内容
+	manifest := models.DataExportManifest{
+		ExportedAt:    time.Now(),
+		User:          user.ToResponse(),
+		Files:         make([]models.FileResponse, 0, len(files)),
+		Shares:        make([]models.ShareResponse, 0, len(shares)),
+		OperationLogs: make([]models.OperationLogResponse, 0, len(logs)),
+	}
+	for i := range files {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		file := &files[i]
+		manifest.Files = append(manifest.Files, file.ToResponse())
+		if err := s.addFileToArchive(ctx, zw, file); err != nil {
+			return 0, err
+		}
+		progress(int64(i+1), int64(len(files)))
+	}
+	for i := range shares {
+		manifest.Shares = append(manifest.Shares, shares[i].ToResponse())
+	}
+	for i := range logs {
+		manifest.OperationLogs = append(manifest.OperationLogs, logs[i].ToResponse())
+	}
+
+	// 写入元数据清单
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return 0, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return 0, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finalize archive: %w", err)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get archive size: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to rewind archive: %w", err)
+	}
+
+	if err := s.storage.Save(ctx, storageKey, tmp, size); err != nil {
+		return 0, fmt.Errorf("failed to save archive: %w", err)
+	}
+
+	return size, nil
+}
+
+// addFileToArchive 将单个文件或目录写入导出包的 files/ 目录下，路径中的每一级名称都会清理控制字符
+func (s *ExportService) addFileToArchive(ctx context.Context, zw *zip.Writer, file *models.File) error {
+	segments := strings.Split(filepath.ToSlash(file.Path), "/")
+	for i, segment := range segments {
+		segments[i] = storage.SanitizeFilename(segment)
+	}
+	name := path.Join("files", path.Join(segments...))
+
+	if file.Type == models.FileTypeDir {
+		_, err := zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: file.UpdatedAt})
+		return err
+	}
+
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+	defer reader.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", file.Path, err)
+	}
+
+	return nil
+}
+
+// generateExportToken 生成导出下载令牌
+func generateExportToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
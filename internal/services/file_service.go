@@ -1,22 +1,53 @@
 package services
 
 import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"maps"
+	"mime"
 	"mime/multipart"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/unicode/norm"
 	"gorm.io/gorm"
 
 	"cloud-storage/internal/config"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/antivirus"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/pkg/imaging"
 	"cloud-storage/internal/pkg/storage"
 	"cloud-storage/internal/repositories"
 )
 
+// storageWarningHeader 已用空间达到配额警告比例时写入的响应头
+const storageWarningHeader = "X-Storage-Warning"
+
+// defaultQuotaWarningPercent QUOTA_WARNING_PERCENT未配置或超出1~100时使用的配额警告比例
+const defaultQuotaWarningPercent = 90
+
+// treeBatchSize 逐层遍历目录树时每次查询的父目录数
+const treeBatchSize = 500
+
+// recentMovesLimit 最近移动记录最多返回的条数
+const recentMovesLimit = 100
+
 // FileService 文件服务
 type FileService struct {
 	cfg             *config.Config
@@ -24,7 +55,20 @@ type FileService struct {
 	fileRepo        repositories.FileRepository
 	userRepo        repositories.UserRepository
 	fileVersionRepo repositories.FileVersionRepository
+	spaceRepo       repositories.SpaceRepository
+	permissionRepo  repositories.FilePermissionRepository
+	moveRepo        repositories.FileMoveRepository
+	blobRepo        repositories.StorageBlobRepository
 	storage         storage.Storage
+	versionStorage  storage.Storage // 历史版本存储
+	logService      *OperationLogService
+	textService     *TextService
+	thumbnails      *ThumbnailService
+	events          *events.Bus
+	publicCache     *publicFileCache // 公开文件元数据缓存，为nil时不缓存
+	jobs            *JobService
+	cleanup         *StorageCleanupService
+	scanner         antivirus.Scanner // 病毒扫描器，为nil时不扫描
 }
 
 // NewFileService 创建文件服务实例
@@ -34,6 +78,9 @@ func NewFileService(
 	fileRepo repositories.FileRepository,
 	userRepo repositories.UserRepository,
 	storage storage.Storage,
+	versionStorage storage.Storage,
+	eventBus *events.Bus,
+	jobService *JobService,
 ) *FileService {
 	return &FileService{
 		cfg:             cfg,
@@ -41,8 +88,43 @@ func NewFileService(
 		fileRepo:        fileRepo,
 		userRepo:        userRepo,
 		fileVersionRepo: repositories.NewFileVersionRepository(db),
+		spaceRepo:       repositories.NewSpaceRepository(db),
+		permissionRepo:  repositories.NewFilePermissionRepository(db),
+		moveRepo:        repositories.NewFileMoveRepository(db),
+		blobRepo:        repositories.NewStorageBlobRepository(db),
 		storage:         storage,
+		versionStorage:  versionStorage,
+		logService:      NewOperationLogService(cfg, repositories.NewOperationLogRepository(db)),
+		textService:     NewTextService(cfg, db, storage),
+		thumbnails:      NewThumbnailService(cfg, storage),
+		events:          eventBus,
+		publicCache:     newPublicFileCache(cfg.Download.PublicMetaCacheTTL, cfg.Download.PublicMetaCacheSize),
+		jobs:            jobService,
+		cleanup: NewStorageCleanupService(cfg, repositories.NewStorageDeletionRepository(db), fileRepo,
+			storage, versionStorage),
+		scanner: newScanner(cfg.Scan),
+	}
+}
+
+// contentKey 返回文件当前内容的存储键，去重保存的文件指向共享内容
+func contentKey(file *models.File) string {
+	if file.BlobKey != "" {
+		return file.BlobKey
+	}
+	return fileKey(file)
+}
+
+// fileKey 返回文件按路径生成的存储键，空间文件存放在空间自己的命名空间下
+func fileKey(file *models.File) string {
+	return pathKey(file.UserID, file.SpaceID, file.Path)
+}
+
+// pathKey 按所有者或所在空间和路径生成存储键
+func pathKey(userID uuid.UUID, spaceID *uuid.UUID, path string) string {
+	if spaceID != nil {
+		return storage.GenerateSpaceFileKey(*spaceID, path)
 	}
+	return storage.GenerateFileKey(userID, path)
 }
 
 // UploadFile 上传文件
@@ -52,15 +134,40 @@ func (s *FileService) UploadFile(
 	fileHeader *multipart.FileHeader,
 	req models.FileUploadRequest,
 ) (*models.File, error) {
+	if err := s.checkUploadSize(fileHeader.Size); err != nil {
+		return nil, err
+	}
+
 	// 检查用户存储配额
 	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// 检查配额
-	if !user.CheckStorageQuota(fileHeader.Size) {
-		return nil, fmt.Errorf("storage quota exceeded")
+	// 生成文件信息
+	filename, err := s.sanitizeName(fileHeader.Filename)
+	if err != nil {
+		return nil, err
+	}
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = storage.GetMimeType(filename)
+	}
+
+	// 解析客户端提供的校验和
+	checksum, err := s.parseUploadChecksum(req.FileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验目标目录，新文件继承父目录所属的空间
+	spaceID, err := s.resolveParent(userID, req.ParentID, req.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileHeader.Size == 0 && !s.cfg.Storage.AllowEmptyFiles {
+		return nil, newError(ErrInvalidArgument, "empty files are not allowed")
 	}
 
 	// 打开上传的文件
@@ -70,29 +177,123 @@ func (s *FileService) UploadFile(
 	}
 	defer file.Close()
 
-	// 生成文件信息
-	filename := fileHeader.Filename
-	mimeType := fileHeader.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = storage.GetMimeType(filename)
+	// 按扩展名、声明的类型和嗅探出的内容类型检查是否允许上传
+	head, err := readHead(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUploadType(filename, mimeType, head); err != nil {
+		return nil, err
+	}
+
+	// 按配置自动旋转照片、删除EXIF，处理后的内容大小可能变化
+	var content io.Reader = file
+	size := fileHeader.Size
+	processed, err := s.processUploadedImage(file, mimeType, size, checksum, req)
+	if err != nil {
+		return nil, err
+	}
+	if processed != nil {
+		content = bytes.NewReader(processed)
+		size = int64(len(processed))
+		checksum = nil
+	}
+
+	return s.saveUploadedFile(ctx, user, spaceID, req, filename, mimeType, content, size, checksum)
+}
+
+// UpdateFileContent 用上传的内容替换文件内容并创建新版本，文件名、位置和ID保持不变，
+// 已用空间按新旧内容的大小差调整
+func (s *FileService) UpdateFileContent(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	fileHeader *multipart.FileHeader,
+	req models.FileContentUpdateRequest,
+) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if file.Type != models.FileTypeFile {
+		return nil, newError(ErrInvalidArgument, "only file content can be updated")
+	}
+	if !s.canWrite(userID, file) {
+		return nil, ErrPermissionDenied
+	}
+	lockVersion, err := expectedLockVersion(file.LockVersion, req.LockVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUploadSize(fileHeader.Size); err != nil {
+		return nil, err
+	}
+	if fileHeader.Size == 0 && !s.cfg.Storage.AllowEmptyFiles {
+		return nil, newError(ErrInvalidArgument, "empty files are not allowed")
+	}
+
+	checksum, err := s.parseUploadChecksum(req.FileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer content.Close()
+
+	return s.updateExistingFile(ctx, userID, file, lockVersion, content, fileHeader.Size, file.MimeType, checksum, req.ChangeNote, nil)
+}
+
+// saveUploadedFile 检查配额后将上传的内容保存为新文件，req.Override为true时覆盖同名文件
+func (s *FileService) saveUploadedFile(
+	ctx *gin.Context,
+	user *models.User,
+	spaceID *uuid.UUID,
+	req models.FileUploadRequest,
+	filename string,
+	mimeType string,
+	content io.Reader,
+	size int64,
+	checksum *storage.Checksum,
+) (*models.File, error) {
+	userID := user.ID
+
+	// 检查配额
+	if !user.CheckStorageQuota(size) {
+		return nil, s.quotaExceeded(user, size)
 	}
 
 	// 检查文件是否已存在
-	existingFile, err := s.fileRepo.FindByUserAndName(userID, req.ParentID, filename)
+	existingFile, err := s.findSibling(userID, spaceID, req.ParentID, filename)
 	if err == nil && existingFile != nil {
 		if req.Override {
 			// 覆盖现有文件
-			return s.updateExistingFile(ctx, userID, existingFile, file, fileHeader.Size, mimeType)
+			return s.updateExistingFile(ctx, userID, existingFile, existingFile.LockVersion, content, size, mimeType, checksum, req.ChangeNote, nil)
 		}
-		return nil, fmt.Errorf("file already exists")
+		return nil, newError(ErrNameConflict, "file already exists")
+	}
+
+	// 检查分类子配额
+	if err := s.checkCategoryQuotas(user, mimeType, size, nil); err != nil {
+		return nil, err
+	}
+
+	filePath, err := s.childPath(req.ParentID, filename)
+	if err != nil {
+		return nil, err
 	}
 
 	// 创建文件记录
 	newFile := &models.File{
 		UserID:   userID,
 		ParentID: req.ParentID,
+		SpaceID:  spaceID,
 		Name:     filename,
-		Size:     fileHeader.Size,
+		Path:     filePath,
+		Size:     size,
 		MimeType: mimeType,
 		Type:     models.FileTypeFile,
 		IsPublic: req.IsPublic,
@@ -114,15 +315,51 @@ func (s *FileService) UploadFile(
 		return nil, fmt.Errorf("failed to create file record: %w", err)
 	}
 
-	// 保存文件内容到存储
-	storageKey := storage.GenerateFileKey(userID, newFile.Path)
-	if err := s.storage.Save(ctx, storageKey, file, fileHeader.Size); err != nil {
+	// 保存文件内容到存储，去重上传先写入新的共享内容键
+	storageKey := fileKey(newFile)
+	if req.Dedup {
+		storageKey = storage.GenerateBlobKey(userID, uuid.New())
+	}
+	savedKey := storageKey
+	hash, detectedMime, err := s.saveWithChecksum(ctx, userID, savedKey, content, size, checksum)
+	if err != nil {
 		tx.Rollback()
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			return nil, ErrChecksumMismatch
+		}
+		if errors.Is(err, ErrMalwareDetected) || errors.Is(err, ErrScanFailed) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to save file to storage: %w", err)
 	}
 
+	updates := map[string]interface{}{
+		"hash":          hash,
+		"detected_mime": detectedMime,
+	}
+	if req.Dedup {
+		// 已有相同内容时引用已有内容，刚写入的副本在提交后删除
+		storageKey, err = s.shareBlobWithTx(tx, userID, hash, size, savedKey)
+		if err != nil {
+			tx.Rollback()
+			s.storage.Delete(ctx, savedKey)
+			return nil, err
+		}
+		newFile.BlobKey = storageKey
+		updates["blob_key"] = storageKey
+	}
+
+	newFile.Hash = hash
+	newFile.DetectedMime = detectedMime
+	if err := s.fileRepo.UpdateWithTx(tx, newFile.ID, updates); err != nil {
+		tx.Rollback()
+		s.storage.Delete(ctx, savedKey)
+		return nil, fmt.Errorf("failed to update file hash: %w", err)
+	}
+	newFile.LockVersion++
+
 	// 更新用户已使用存储
-	if err := user.UpdateUsedStorage(tx, fileHeader.Size); err != nil {
+	if err := user.UpdateUsedStorage(tx, size); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to update user storage: %w", err)
 	}
@@ -131,10 +368,11 @@ func (s *FileService) UploadFile(
 	fileVersion := &models.FileVersion{
 		FileID:        newFile.ID,
 		VersionNumber: 1,
-		FileSize:      fileHeader.Size,
-		FileHash:      "", // 可以计算文件哈希
+		FileSize:      size,
+		FileHash:      hash,
 		StoragePath:   storageKey,
 		MimeType:      mimeType,
+		ChangeNote:    req.ChangeNote,
 		CreatedBy:     userID,
 	}
 
@@ -143,34 +381,106 @@ func (s *FileService) UploadFile(
 		return nil, fmt.Errorf("failed to create file version: %w", err)
 	}
 
+	// 记录操作日志，与文件变更一同提交
+	details := map[string]interface{}{
+		"name": newFile.Name,
+		"path": newFile.Path,
+		"size": newFile.Size,
+	}
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, models.OperationFileUpload,
+		models.ResourceTypeFile, &newFile.ID, details); err != nil {
+		tx.Rollback()
+		s.storage.Delete(ctx, savedKey)
+		return nil, err
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	if savedKey != storageKey {
+		if err := s.storage.Delete(ctx, savedKey); err != nil {
+			log.Printf("Failed to delete duplicate content %s: %v", savedKey, err)
+		}
+	}
+
+	s.textService.IndexAsync(newFile)
+	s.thumbnails.GenerateAsync(newFile)
+	s.publishUploaded(newFile)
+	s.checkQuotaUsage(ctx, user, size)
 
 	return newFile, nil
 }
 
-// updateExistingFile 更新现有文件
+// shareBlobWithTx 在事务中为去重上传的内容查找可共享的已有内容，返回文件应引用的存储键
+// 没有相同内容时把刚写入的key登记为新的共享内容
+// 只查找storage_blobs中登记的内容：未去重保存的文件内容位于按路径生成的键下，覆盖或在同一路径新建文件时会被改写，不能共享
+func (s *FileService) shareBlobWithTx(tx *gorm.DB, userID uuid.UUID, hash string, size int64, key string) (string, error) {
+	existing, found, err := s.blobRepo.AcquireWithTx(tx, userID, hash)
+	if err != nil {
+		return "", fmt.Errorf("failed to find shared content: %w", err)
+	}
+	if found {
+		return existing, nil
+	}
+
+	blob := &models.StorageBlob{UserID: userID, Hash: hash, Size: size, Key: key}
+	if err := s.blobRepo.CreateWithTx(tx, blob); err != nil {
+		return "", fmt.Errorf("failed to record shared content: %w", err)
+	}
+	return key, nil
+}
+
+// releaseBlobWithTx 在事务中释放文件对共享内容的引用，最后一个引用释放时返回需在提交后删除的内容
+func (s *FileService) releaseBlobWithTx(tx *gorm.DB, key string) ([]models.StorageDeletion, error) {
+	last, err := s.blobRepo.ReleaseWithTx(tx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release shared content: %w", err)
+	}
+	if !last {
+		return nil, nil
+	}
+	return []models.StorageDeletion{{Store: models.StorageStoreFiles, Key: key}}, nil
+}
+
+// updateExistingFile 更新现有文件，changeNote记录在新版本上（可为空），details为附加到操作日志的信息（可为nil）
+// 所有替换内容的入口（覆盖上传、按ID替换、分享编辑、WOPI保存）都在这里按文件名和嗅探出的类型检查是否允许上传，
+// 并且只在文件的lock_version仍等于lockVersion时写入，否则返回ErrVersionConflict
 func (s *FileService) updateExistingFile(
 	ctx *gin.Context,
 	userID uuid.UUID,
 	existingFile *models.File,
+	lockVersion int64,
 	file io.Reader,
 	size int64,
 	mimeType string,
+	checksum *storage.Checksum,
+	changeNote string,
+	details map[string]interface{},
 ) (*models.File, error) {
+	head, file, err := peekHead(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUploadType(existingFile.Name, mimeType, head); err != nil {
+		return nil, err
+	}
+
 	// 计算存储空间变化
 	sizeDelta := size - existingFile.Size
 
-	// 检查用户存储配额
-	user, err := s.userRepo.FindByID(userID)
+	// 检查文件所有者的存储配额，空间内的文件计入创建者的配额
+	user, err := s.userRepo.FindByID(existingFile.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	if !user.CheckStorageQuota(sizeDelta) {
-		return nil, fmt.Errorf("storage quota exceeded")
+		return nil, s.quotaExceeded(user, sizeDelta)
+	}
+
+	if err := s.checkCategoryQuotas(user, mimeType, size, existingFile); err != nil {
+		return nil, err
 	}
 
 	// 在事务中更新文件
@@ -182,504 +492,2566 @@ func (s *FileService) updateExistingFile(
 		}
 	}()
 
+	// 锁定文件记录，其他请求已经修改了文件时不触碰存储中的内容
+	locked, err := s.fileRepo.LockIfVersionWithTx(tx, existingFile.ID, lockVersion)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to lock file: %w", err)
+	}
+	if !locked {
+		tx.Rollback()
+		return nil, ErrVersionConflict
+	}
+
+	// 将当前内容归档到版本存储，并更新旧版本记录的存储键；关闭版本控制时直接覆盖，不保留旧内容
+	previousVersion := existingFile.Version
+	previousSize := existingFile.Size
+	var versionKey string
+	if existingFile.VersioningEnabled {
+		versionKey, err = s.archiveVersion(ctx, existingFile)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to archive current version: %w", err)
+		}
+
+		if err := tx.Model(&models.FileVersion{}).
+			Where("file_id = ? AND version_number = ?", existingFile.ID, previousVersion).
+			Update("storage_path", versionKey).Error; err != nil {
+			tx.Rollback()
+			s.versionStorage.Delete(ctx, versionKey)
+			return nil, fmt.Errorf("failed to update previous version: %w", err)
+		}
+	}
+
+	// 保存新版本到存储；新内容直接覆盖当前内容，先保留一份旧内容（已归档为版本时使用归档），
+	// 检测到病毒或事务未能提交时恢复
+	storageKey := fileKey(existingFile)
+	overwrites := contentKey(existingFile) == storageKey
+	backupKey := versionKey
+	if backupKey == "" && overwrites {
+		if backupKey, err = s.archiveVersion(ctx, existingFile); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to back up current content: %w", err)
+		}
+	}
+	discard := func() {
+		tx.Rollback()
+		if overwrites {
+			s.restoreContent(ctx, backupKey, storageKey, previousSize)
+		}
+		if backupKey != "" {
+			s.versionStorage.Delete(ctx, backupKey)
+		}
+	}
+	hash, detectedMime, err := s.saveWithChecksum(ctx, existingFile.UserID, storageKey, file, size, checksum)
+	if err != nil {
+		discard()
+		if errors.Is(err, storage.ErrChecksumMismatch) {
+			return nil, ErrChecksumMismatch
+		}
+		if errors.Is(err, ErrMalwareDetected) || errors.Is(err, ErrScanFailed) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to save file to storage: %w", err)
+	}
+
 	// 更新文件记录
 	existingFile.Size = size
 	existingFile.MimeType = mimeType
+	existingFile.DetectedMime = detectedMime
+	existingFile.Hash = hash
 	existingFile.Version++
 
 	updates := map[string]interface{}{
-		"size":      size,
-		"mime_type": mimeType,
-		"version":   existingFile.Version,
+		"size":          size,
+		"mime_type":     mimeType,
+		"detected_mime": detectedMime,
+		"hash":          hash,
+		"version":       existingFile.Version,
 	}
 
-	if err := s.fileRepo.UpdateWithTx(tx, existingFile.ID, updates); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to update file record: %w", err)
+	// 新内容写入文件自己的存储键，释放对去重共享内容的引用
+	var deletions []models.StorageDeletion
+	if existingFile.BlobKey != "" {
+		updates["blob_key"] = ""
+		deletions, err = s.releaseBlobWithTx(tx, existingFile.BlobKey)
+		if err == nil {
+			err = s.cleanup.ScheduleWithTx(tx, deletions)
+		}
+		if err != nil {
+			discard()
+			return nil, err
+		}
 	}
 
-	// 保存新版本到存储
-	storageKey := storage.GenerateFileKey(userID, existingFile.Path)
-	if err := s.storage.Save(ctx, storageKey, file, size); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to save file to storage: %w", err)
+	updated, err := s.fileRepo.UpdateIfVersionWithTx(tx, existingFile.ID, lockVersion, updates)
+	if err != nil {
+		discard()
+		return nil, fmt.Errorf("failed to update file record: %w", err)
 	}
+	if !updated {
+		discard()
+		return nil, ErrVersionConflict
+	}
+	existingFile.LockVersion = lockVersion + 1
+	existingFile.BlobKey = ""
 
 	// 更新用户已使用存储
 	if err := user.UpdateUsedStorage(tx, sizeDelta); err != nil {
-		tx.Rollback()
+		discard()
 		return nil, fmt.Errorf("failed to update user storage: %w", err)
 	}
 
-	// 创建新版本记录
-	fileVersion := &models.FileVersion{
-		FileID:        existingFile.ID,
-		VersionNumber: existingFile.Version,
-		FileSize:      size,
-		FileHash:      "", // 可以计算文件哈希
-		StoragePath:   storageKey,
-		MimeType:      mimeType,
-		CreatedBy:     userID,
+	// 创建新版本记录；关闭版本控制时改写当前版本记录，使其与覆盖后的内容一致
+	if existingFile.VersioningEnabled {
+		fileVersion := &models.FileVersion{
+			FileID:        existingFile.ID,
+			VersionNumber: existingFile.Version,
+			FileSize:      size,
+			FileHash:      hash,
+			StoragePath:   storageKey,
+			MimeType:      mimeType,
+			ChangeNote:    changeNote,
+			CreatedBy:     userID,
+		}
+
+		if err := tx.Create(fileVersion).Error; err != nil {
+			discard()
+			return nil, fmt.Errorf("failed to create file version: %w", err)
+		}
+	} else if err := tx.Model(&models.FileVersion{}).
+		Where("file_id = ? AND version_number = ?", existingFile.ID, previousVersion).
+		Updates(map[string]interface{}{
+			"version_number": existingFile.Version,
+			"file_size":      size,
+			"file_hash":      hash,
+			"storage_path":   storageKey,
+			"mime_type":      mimeType,
+			"change_note":    changeNote,
+			"created_by":     userID,
+			"created_at":     time.Now(),
+		}).Error; err != nil {
+		discard()
+		return nil, fmt.Errorf("failed to update current version: %w", err)
 	}
 
-	if err := tx.Create(fileVersion).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to create file version: %w", err)
+	// 记录操作日志，与文件变更一同提交
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["version"] = existingFile.Version
+	details["size"] = size
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, models.OperationFileUpdate,
+		models.ResourceTypeFile, &existingFile.ID, details); err != nil {
+		discard()
+		return nil, err
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
+		discard()
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	if backupKey != versionKey {
+		s.versionStorage.Delete(ctx, backupKey)
+	}
+	s.cleanup.Purge(ctx, deletions)
+
+	s.publicCache.invalidate(existingFile.ID)
+	s.textService.IndexAsync(existingFile)
+	s.thumbnails.GenerateAsync(existingFile)
+	s.publishUploaded(existingFile)
+	s.checkQuotaUsage(ctx, user, sizeDelta)
 
 	return existingFile, nil
 }
 
-// DownloadFile 下载文件
-func (s *FileService) DownloadFile(
-	ctx *gin.Context,
-	userID uuid.UUID,
-	fileID uuid.UUID,
-) (io.ReadCloser, *models.File, error) {
-	// 获取文件信息
-	file, err := s.fileRepo.FindByID(fileID)
-	if err != nil {
-		return nil, nil, fmt.Errorf("file not found: %w", err)
+// checkCategoryQuotas 检查写入size字节、类型为mimeType的内容后是否超出分类子配额，replaced为被覆盖的文件（可为nil）
+func (s *FileService) checkCategoryQuotas(user *models.User, mimeType string, size int64, replaced *models.File) error {
+	if len(user.CategoryQuotas) == 0 {
+		return nil
 	}
 
-	// 检查权限
-	if file.UserID != userID && !file.IsPublic {
-		return nil, nil, fmt.Errorf("permission denied")
+	var replacedCategories []string
+	if replaced != nil {
+		replacedCategories = models.MimeCategoriesOf(replaced.MimeType)
 	}
 
-	// 获取文件内容
-	storageKey := storage.GenerateFileKey(file.UserID, file.Path)
-	reader, err := s.storage.Get(ctx, storageKey)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
+	deltas := make(map[string]int64)
+	for _, category := range models.MimeCategoriesOf(mimeType) {
+		delta := size
+		if slices.Contains(replacedCategories, category) {
+			delta -= replaced.Size
+		}
+		deltas[category] = delta
 	}
 
-	return reader, file, nil
+	return s.checkCategoryDeltas(user, deltas)
 }
 
-// CreateDirectory 创建目录
-func (s *FileService) CreateDirectory(
-	ctx *gin.Context,
-	userID uuid.UUID,
-	req models.FileCreateRequest,
-) (*models.File, error) {
-	// 验证请求
-	if req.Type != models.FileTypeDir {
-		return nil, fmt.Errorf("invalid file type for directory creation")
+// addCategoryBytes 将文件大小计入其所属的各分类
+func addCategoryBytes(deltas map[string]int64, mimeType string, size int64) {
+	for _, category := range models.MimeCategoriesOf(mimeType) {
+		deltas[category] += size
 	}
+}
 
-	// 检查目录是否已存在
-	existingDir, err := s.fileRepo.FindByUserAndName(userID, req.ParentID, req.Name)
-	if err == nil && existingDir != nil {
-		return nil, fmt.Errorf("directory already exists")
+// checkCategoryDeltas 检查各分类新增deltas字节后是否超出子配额，一次写入多个文件（如复制目录）时按分类汇总后检查
+func (s *FileService) checkCategoryDeltas(user *models.User, deltas map[string]int64) error {
+	if len(user.CategoryQuotas) == 0 {
+		return nil
 	}
 
-	// 创建目录记录
-	directory := &models.File{
-		UserID:   userID,
-		ParentID: req.ParentID,
-		Name:     req.Name,
-		Size:     0,
-		Type:     models.FileTypeDir,
-		IsPublic: req.IsPublic,
-		Version:  1,
+	for _, category := range slices.Sorted(maps.Keys(deltas)) {
+		quota, ok := user.CategoryQuotas[category]
+		if !ok {
+			continue
+		}
+
+		delta := deltas[category]
+		if delta <= 0 {
+			continue
+		}
+
+		used, err := s.fileRepo.GetCategoryUsage(user.ID, category)
+		if err != nil {
+			return fmt.Errorf("failed to get %s usage: %w", category, err)
+		}
+		if used+delta > quota {
+			return &CategoryQuotaError{Category: category, Used: used, Quota: quota}
+		}
 	}
 
-	// 保存目录记录
-	if err := s.fileRepo.Create(directory); err != nil {
-		return nil, fmt.Errorf("failed to create directory record: %w", err)
+	return nil
+}
+
+// archiveVersion 将文件当前内容复制到版本存储，返回版本键
+func (s *FileService) archiveVersion(ctx context.Context, file *models.File) (string, error) {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return "", err
 	}
+	defer reader.Close()
 
-	// 在存储中创建目录
-	storageKey := storage.GenerateFileKey(userID, directory.Path)
-	if err := s.storage.CreateDir(ctx, storageKey); err != nil {
-		// 如果存储创建失败，删除数据库记录
-		s.fileRepo.Delete(directory.ID)
-		return nil, fmt.Errorf("failed to create directory in storage: %w", err)
+	versionKey := storage.GenerateVersionKey(file.UserID, file.ID, file.Version)
+	if err := s.versionStorage.Save(ctx, versionKey, reader, file.Size); err != nil {
+		return "", err
 	}
 
-	return directory, nil
+	return versionKey, nil
 }
 
-// GetFileList 获取文件列表
-func (s *FileService) GetFileList(
-	userID uuid.UUID,
-	filter models.FileFilter,
-) ([]models.File, int64, error) {
-	// 设置用户ID过滤器
-	filter.UserID = &userID
+// openVersion 打开版本内容，已归档的版本从版本存储读取；当前版本按文件的内容键读取，
+// 版本记录中的存储键在文件移动、重命名或去重保存后可能已不是内容的实际位置
+func (s *FileService) openVersion(ctx context.Context, file *models.File, version *models.FileVersion) (io.ReadCloser, error) {
+	if storage.IsVersionKey(version.StoragePath) {
+		return s.versionStorage.Get(ctx, version.StoragePath)
+	}
+	if version.VersionNumber == file.Version {
+		return s.storage.Get(ctx, contentKey(file))
+	}
+	return s.storage.Get(ctx, version.StoragePath)
+}
 
-	// 获取文件列表
-	files, err := s.fileRepo.FindAll(filter)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get file list: %w", err)
+// parseUploadChecksum 解析客户端提供的校验和（未提供或未启用校验时返回nil）
+func (s *FileService) parseUploadChecksum(value string) (*storage.Checksum, error) {
+	if value == "" || !s.cfg.Storage.VerifyUploadChecksum {
+		return nil, nil
 	}
 
-	// 获取总数
-	total, err := s.fileRepo.Count(filter)
+	checksum, err := storage.ParseChecksum(value)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count files: %w", err)
+		return nil, newError(ErrInvalidArgument, "invalid checksum format")
 	}
 
-	return files, total, nil
+	return checksum, nil
 }
 
-// GetFileByID 根据ID获取文件
-func (s *FileService) GetFileByID(
-	userID uuid.UUID,
-	fileID uuid.UUID,
-) (*models.File, error) {
-	file, err := s.fileRepo.FindByID(fileID)
-	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+// checkUploadSize 检查单个上传文件的大小是否超出MAX_UPLOAD_SIZE
+func (s *FileService) checkUploadSize(size int64) error {
+	if limit := s.cfg.Storage.MaxUploadSize; limit > 0 && size > limit {
+		return newError(ErrFileTooLarge, fmt.Sprintf("file exceeds maximum upload size of %d bytes", limit))
 	}
+	return nil
+}
 
-	// 检查权限
-	if file.UserID != userID && !file.IsPublic {
-		return nil, fmt.Errorf("permission denied")
+// readHead 读取上传内容开头用于嗅探类型的字节，之后回到开头
+func readHead(file multipart.File) ([]byte, error) {
+	head := make([]byte, storage.SniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
 	}
-
-	return file, nil
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind uploaded file: %w", err)
+	}
+	return head[:n], nil
 }
 
-// UpdateFile 更新文件信息
-func (s *FileService) UpdateFile(
-	userID uuid.UUID,
-	fileID uuid.UUID,
-	req models.FileUpdateRequest,
-) (*models.File, error) {
-	// 获取文件
-	file, err := s.fileRepo.FindByID(fileID)
-	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+// peekHead 读取不可回退的内容开头用于嗅探类型的字节，返回的Reader仍从头读取完整内容
+func peekHead(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, storage.SniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, fmt.Errorf("failed to read uploaded file: %w", err)
 	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
 
-	// 检查权限
-	if file.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
-	}
+// genericMimeTypes 嗅探无法进一步区分的类型，不参与与声明类型是否相符的判断
+var genericMimeTypes = map[string]bool{
+	storage.DefaultMimeType: true,
+	"text/plain":            true,
+	"text/xml":              true,
+	"application/zip":       true, // docx、xlsx、jar等
+	"application/ogg":       true,
+}
 
-	// 更新文件信息
-	updates := make(map[string]interface{})
+// checkUploadType 按UPLOAD_*_TYPES检查上传文件的扩展名、声明的类型和嗅探出的类型，
+// head为nil时（分片上传创建会话时内容尚未上传）只检查扩展名和声明的类型
+func (s *FileService) checkUploadType(filename, declared string, head []byte) error {
+	ext := strings.ToLower(path.Ext(filename))
+	declared = baseMimeType(declared)
+	types := []string{declared}
+	var sniffed string
+	if head != nil {
+		sniffed = storage.DetectMimeType(head)
+		types = append(types, sniffed)
+	}
 
-	if req.Name != nil {
-		// 检查新名称是否已存在
-		existingFile, err := s.fileRepo.FindByUserAndName(userID, file.ParentID, *req.Name)
-		if err == nil && existingFile != nil && existingFile.ID != fileID {
-			return nil, fmt.Errorf("file with this name already exists")
-		}
-		updates["name"] = *req.Name
+	// 禁止列表优先，任一类型命中即拒绝
+	if blocked := matchUploadType(s.cfg.Storage.BlockedTypes, ext, types...); blocked != "" {
+		return &FileTypeError{Type: blocked}
+	}
+	if len(s.cfg.Storage.AllowedTypes) > 0 && matchUploadType(s.cfg.Storage.AllowedTypes, ext, declared) == "" {
+		return &FileTypeError{Type: cmp.Or(declared, ext)}
 	}
 
-	if req.ParentID != nil {
-		// 检查目标目录是否存在且不是当前文件的子目录
-		if *req.ParentID != file.ID {
-			targetDir, err := s.fileRepo.FindByID(*req.ParentID)
-			if err != nil || targetDir.Type != models.FileTypeDir {
-				return nil, fmt.Errorf("invalid target directory")
-			}
+	// 嗅探出具体类型时，与声明的类型须属于同一大类（音频和视频视为一类）
+	if s.cfg.Storage.RejectTypeMismatch && sniffed != "" && !genericMimeTypes[sniffed] &&
+		declared != "" && !genericMimeTypes[declared] && mimeFamily(sniffed) != mimeFamily(declared) {
+		return &FileTypeError{Type: sniffed, Declared: declared}
+	}
+	return nil
+}
 
-			// 检查是否移动到自己的子目录
-			if s.isDescendant(file.ID, *req.ParentID) {
-				return nil, fmt.Errorf("cannot move directory into its own subdirectory")
+// matchUploadType 返回首个命中列表的扩展名或类型；列表中以"."开头的项为扩展名，其余为MIME类型，均不区分大小写
+func matchUploadType(patterns []string, ext string, types ...string) string {
+	var mimePatterns []string
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, ".") {
+			if ext != "" && pattern == ext {
+				return ext
 			}
+			continue
+		}
+		mimePatterns = append(mimePatterns, pattern)
+	}
+	for _, mimeType := range types {
+		if mimeType != "" && storage.MatchMimeType(mimePatterns, mimeType) {
+			return mimeType
 		}
-		updates["parent_id"] = *req.ParentID
 	}
+	return ""
+}
 
-	if req.IsPublic != nil {
-		updates["is_public"] = *req.IsPublic
+// baseMimeType 返回不含参数的小写MIME类型，无法解析时返回空字符串
+func baseMimeType(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
 	}
+	return mediaType
+}
 
-	// 应用更新
-	if err := s.fileRepo.Update(fileID, updates); err != nil {
-		return nil, fmt.Errorf("failed to update file: %w", err)
+// mimeFamily 返回MIME类型的大类，音频和视频归为同一类
+func mimeFamily(mimeType string) string {
+	family, _, _ := strings.Cut(mimeType, "/")
+	if family == "audio" {
+		return "video"
 	}
+	return family
+}
 
-	// 重新加载文件信息
-	updatedFile, err := s.fileRepo.FindByID(fileID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to reload file: %w", err)
+// processUploadedImage 按配置和上传选项处理JPEG照片，未处理时返回nil
+// 客户端校验和针对原始内容，因此在处理前校验；处理失败时记录日志并保存原始内容
+func (s *FileService) processUploadedImage(
+	file multipart.File,
+	mimeType string,
+	size int64,
+	checksum *storage.Checksum,
+	req models.FileUploadRequest,
+) ([]byte, error) {
+	opts := imaging.JPEGOptions{
+		AutoOrient: s.cfg.Image.AutoOrient,
+		StripExif:  s.cfg.Image.StripExif,
+		MaxPixels:  s.cfg.Image.MaxPixels,
+		Quality:    s.cfg.Image.Quality,
+	}
+	if req.AutoOrient != nil {
+		opts.AutoOrient = *req.AutoOrient
+	}
+	if req.StripExif != nil {
+		opts.StripExif = *req.StripExif
 	}
 
-	return updatedFile, nil
-}
+	if mimeType != "image/jpeg" || (!opts.AutoOrient && !opts.StripExif) || size > s.cfg.Image.MaxSize {
+		return nil, nil
+	}
 
-// DeleteFile 删除文件
-func (s *FileService) DeleteFile(
-	ctx *gin.Context,
-	userID uuid.UUID,
-	fileID uuid.UUID,
-	permanent bool,
-) error {
-	// 获取文件
-	file, err := s.fileRepo.FindByID(fileID)
+	data, err := io.ReadAll(file)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
 	}
-
-	// 检查权限
-	if file.UserID != userID {
-		return fmt.Errorf("permission denied")
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind uploaded file: %w", err)
 	}
 
-	if permanent {
-		// 永久删除
-		return s.permanentDeleteFile(ctx, userID, file)
+	if checksum != nil {
+		if err := storage.VerifyChecksum(bytes.NewReader(data), checksum); err != nil {
+			if errors.Is(err, storage.ErrChecksumMismatch) {
+				return nil, ErrChecksumMismatch
+			}
+			return nil, err
+		}
 	}
 
-	// 软删除
-	return s.softDeleteFile(file)
+	processed, changed, err := imaging.ProcessJPEG(data, opts)
+	if err != nil {
+		log.Printf("Failed to process uploaded image, saving original: %v", err)
+		return nil, nil
+	}
+	if !changed {
+		return nil, nil
+	}
+	return processed, nil
 }
 
-// permanentDeleteFile 永久删除文件
-func (s *FileService) permanentDeleteFile(
+// saveWithChecksum 保存文件内容，返回其SHA-256（十六进制）和按内容嗅探出的MIME类型
+// 请求被取消（客户端断开或管理员终止上传）时中止写入
+func (s *FileService) saveWithChecksum(
 	ctx *gin.Context,
 	userID uuid.UUID,
-	file *models.File,
-) error {
-	// 在事务中删除文件
-	tx := s.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r)
+	key string,
+	data io.Reader,
+	size int64,
+	checksum *storage.Checksum,
+) (string, string, error) {
+	reqCtx := ctx.Request.Context()
+	hash := sha256.New()
+	sniffer := &storage.MimeSniffer{}
+	writers := []io.Writer{hash, sniffer}
+	scan := startScan(reqCtx, s.scanner)
+	if scan != nil {
+		writers = append(writers, scan)
+	}
+	content := io.TeeReader(data, io.MultiWriter(writers...))
+	err := s.saveContent(ctx, userID, key, contextReader{ctx: reqCtx, r: content}, size, checksum)
+	if scan != nil {
+		err = s.finishScan(ctx, userID, key, scan, err)
+	}
+	if err != nil {
+		if reqCtx.Err() != nil {
+			return "", "", ErrUploadAborted
 		}
-	}()
+		return "", "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), sniffer.MimeType(), nil
+}
 
-	if file.Type == models.FileTypeDir {
-		// 递归删除目录下的所有文件
-		if err := s.deleteDirectoryRecursive(ctx, tx, userID, file); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to delete directory: %w", err)
-		}
-	} else {
-		// 删除单个文件
-		if err := s.deleteSingleFile(ctx, tx, userID, file); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to delete file: %w", err)
-		}
+// finishScan 等待内容扫描结果，发现病毒或无法扫描时删除已写入key的内容；发现病毒时发布事件以生成安全警报
+func (s *FileService) finishScan(ctx *gin.Context, userID uuid.UUID, key string, scan *contentScan, saveErr error) error {
+	result, err := scan.finish(saveErr)
+	if saveErr != nil {
+		return saveErr
+	}
+	if err == nil && !result.Infected {
+		return nil
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if deleteErr := s.storage.Delete(context.WithoutCancel(ctx), key); deleteErr != nil {
+		log.Printf("Failed to delete rejected upload %s: %v", key, deleteErr)
+	}
+	if err != nil {
+		log.Printf("Failed to scan upload of user %s: %v", userID, err)
+		return ErrScanFailed
 	}
 
-	return nil
+	s.events.Publish(events.New(events.MalwareDetected, userID, map[string]interface{}{
+		"signature":  result.Signature,
+		"ip_address": ctx.ClientIP(),
+	}))
+	return newError(ErrMalwareDetected, fmt.Sprintf("upload rejected: %s detected", result.Signature))
 }
 
-// deleteDirectoryRecursive 递归删除目录
-func (s *FileService) deleteDirectoryRecursive(
-	ctx *gin.Context,
-	tx *gorm.DB,
-	userID uuid.UUID,
-	directory *models.File,
-) error {
-	// 获取目录下的所有文件
-	filter := models.FileFilter{
-		UserID:   &userID,
-		ParentID: &directory.ID,
-		Deleted:  &[]bool{false}[0],
+// restoreContent 覆盖内容失败后将备份的原内容写回key，backupKey为空时无需恢复
+func (s *FileService) restoreContent(ctx context.Context, backupKey, key string, size int64) {
+	if backupKey == "" {
+		return
 	}
+	ctx = context.WithoutCancel(ctx)
 
-	files, err := s.fileRepo.FindAllWithTx(tx, filter)
+	reader, err := s.versionStorage.Get(ctx, backupKey)
 	if err != nil {
-		return err
+		log.Printf("Failed to read backup %s: %v", backupKey, err)
+		return
 	}
+	defer reader.Close()
 
-	// 递归删除子文件和子目录
-	for _, file := range files {
-		if file.Type == models.FileTypeDir {
-			if err := s.deleteDirectoryRecursive(ctx, tx, userID, &file); err != nil {
-				return err
-			}
-		} else {
-			if err := s.deleteSingleFile(ctx, tx, userID, &file); err != nil {
-				return err
-			}
-		}
+	if err := s.storage.Save(ctx, key, reader, size); err != nil {
+		log.Printf("Failed to restore content of %s: %v", key, err)
 	}
+}
 
-	// 删除目录记录
-	if err := s.fileRepo.DeleteWithTx(tx, directory.ID); err != nil {
-		return err
+// detectStoredMime 读取存储中文件开头的内容嗅探MIME类型
+func (s *FileService) detectStoredMime(ctx context.Context, file *models.File) (string, error) {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return "", err
 	}
+	defer reader.Close()
 
-	// 删除存储中的目录
-	storageKey := storage.GenerateFileKey(userID, directory.Path)
-	if err := s.storage.DeleteDir(ctx, storageKey); err != nil {
-		return err
+	head := make([]byte, storage.SniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
 	}
+	return storage.DetectMimeType(head[:n]), nil
+}
 
-	return nil
+// contextReader 在ctx取消后读取失败
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
-// deleteSingleFile 删除单个文件
-func (s *FileService) deleteSingleFile(
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// saveContent 保存文件内容
+// 提供校验和时先写入临时键，校验通过后再移动到目标键，校验失败则清理临时数据
+func (s *FileService) saveContent(
 	ctx *gin.Context,
-	tx *gorm.DB,
 	userID uuid.UUID,
-	file *models.File,
+	key string,
+	data io.Reader,
+	size int64,
+	checksum *storage.Checksum,
 ) error {
-	// 删除文件记录
-	if err := s.fileRepo.DeleteWithTx(tx, file.ID); err != nil {
-		return err
+	if checksum == nil {
+		return s.storage.Save(ctx, key, data, size)
 	}
 
-	// 删除存储中的文件
-	storageKey := storage.GenerateFileKey(userID, file.Path)
-	if err := s.storage.Delete(ctx, storageKey); err != nil {
+	tempKey := storage.GenerateTempKey(userID, path.Base(key))
+	reader := storage.NewChecksumReader(data, checksum)
+	if err := s.storage.Save(ctx, tempKey, reader, size); err != nil {
 		return err
 	}
 
-	// 更新用户已使用存储
-	user, err := s.userRepo.FindByIDWithTx(tx, userID)
-	if err != nil {
+	if err := reader.Verify(); err != nil {
+		s.storage.Delete(ctx, tempKey)
 		return err
 	}
 
-	if err := user.UpdateUsedStorage(tx, -file.Size); err != nil {
+	if err := s.storage.Move(ctx, tempKey, key); err != nil {
+		s.storage.Delete(ctx, tempKey)
 		return err
 	}
 
 	return nil
 }
 
-// softDeleteFile 软删除文件
-func (s *FileService) softDeleteFile(file *models.File) error {
-	// 软删除文件记录
-	return s.fileRepo.SoftDelete(file.ID)
+// DownloadFile 下载文件
+func (s *FileService) DownloadFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+) (io.ReadCloser, *models.File, error) {
+	reader, file, _, err := s.DownloadFileRange(ctx, userID, fileID, "")
+	return reader, file, err
 }
 
-// MoveFile 移动文件
-func (s *FileService) MoveFile(
+// DownloadFileRange 按Range请求头下载文件的部分内容，返回的范围为nil时reader为完整内容
+// 范围起点超出文件大小时返回RangeNotSatisfiableError
+func (s *FileService) DownloadFileRange(
 	ctx *gin.Context,
 	userID uuid.UUID,
 	fileID uuid.UUID,
-	req models.FileMoveRequest,
-) (*models.File, error) {
-	// 获取文件
+	rangeHeader string,
+) (io.ReadCloser, *models.File, *storage.ByteRange, error) {
+	// 获取文件信息
 	file, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+		return nil, nil, nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
 	// 检查权限
-	if file.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+	if !file.IsPublic {
+		if err := s.authorizeGranted(userID, file, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	// 检查目标目录
-	targetDir, err := s.fileRepo.FindByID(*req.TargetParentID)
-	if err != nil || targetDir.Type != models.FileTypeDir {
-		return nil, fmt.Errorf("invalid target directory")
+	byteRange, err := storage.ParseRange(rangeHeader, file.Size)
+	if err != nil {
+		return nil, nil, nil, &RangeNotSatisfiableError{Size: file.Size}
 	}
 
-	// 检查是否移动到自己的子目录
-	if file.Type == models.FileTypeDir && s.isDescendant(file.ID, *req.TargetParentID) {
-		return nil, fmt.Errorf("cannot move directory into its own subdirectory")
+	// 获取文件内容
+	var reader io.ReadCloser
+	if byteRange != nil {
+		reader, err = s.storage.GetRange(ctx, contentKey(file), byteRange.Offset, byteRange.Length)
+	} else {
+		reader, err = s.storage.Get(ctx, contentKey(file))
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
 	}
 
-	// 检查目标位置是否已存在同名文件
-	existingFile, err := s.fileRepo.FindByUserAndName(userID, req.TargetParentID, file.Name)
-	if err == nil && existingFile != nil {
-		return nil, fmt.Errorf("file with this name already exists in target directory")
+	return reader, file, byteRange, nil
+}
+
+// GetDirectDownloadURL 检查下载权限后获取存储直接提供的限时下载URL（如S3预签名URL）
+// 存储不支持时（本地存储、加密或压缩保存的内容）url为空，由调用方签发下载令牌
+func (s *FileService) GetDirectDownloadURL(ctx context.Context, userID uuid.UUID, fileID uuid.UUID) (*models.File, string, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
-	// 在事务中移动文件
-	tx := s.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r)
+	if !file.IsPublic {
+		if err := s.authorizeGranted(userID, file, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
+			return nil, "", err
 		}
-	}()
-
-	// 更新文件父目录
-	updates := map[string]interface{}{
-		"parent_id": req.TargetParentID,
+	}
+	if !file.IsFile() {
+		return nil, "", newError(ErrInvalidArgument, "only files can be downloaded")
 	}
 
-	if err := s.fileRepo.UpdateWithTx(tx, fileID, updates); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to update file: %w", err)
+	url, err := s.storage.GetDownloadURL(ctx, contentKey(file), file.Name)
+	if errors.Is(err, storage.ErrDirectURLUnavailable) {
+		return file, "", nil
 	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get download url: %w", err)
+	}
+	return file, url, nil
+}
 
-	// 如果文件是目录，需要更新所有子文件的路径
-	if file.Type == models.FileTypeDir {
-		if err := s.updateDescendantPaths(tx, file); err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to update descendant paths: %w", err)
+// GetFileTree 获取目录树，rootID为nil时从个人根目录开始；depth为展开的层数，不超过FILE_TREE_MAX_DEPTH
+// 节点数超过FILE_TREE_MAX_NODES或还有未展开的下级时truncated为true
+func (s *FileService) GetFileTree(
+	userID uuid.UUID,
+	rootID *uuid.UUID,
+	depth int,
+	includeFiles bool,
+) ([]*repositories.FileTreeNode, bool, error) {
+	if rootID != nil {
+		root, err := s.fileRepo.FindByID(*rootID)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+		}
+		if err := s.authorizeGranted(userID, root, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
+			return nil, false, err
+		}
+		if root.Type != models.FileTypeDir {
+			return nil, false, newError(ErrInvalidArgument, "root must be a directory")
 		}
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	maxDepth := s.cfg.Storage.FileTreeMaxDepth
+	if depth <= 0 || (maxDepth > 0 && depth > maxDepth) {
+		depth = maxDepth
 	}
 
-	// 重新加载文件信息
-	updatedFile, err := s.fileRepo.FindByID(fileID)
+	tree, truncated, err := s.fileRepo.GetFileTree(userID, rootID, depth, s.cfg.Storage.FileTreeMaxNodes, includeFiles)
 	if err != nil {
-		return nil, fmt.Errorf("failed to reload file: %w", err)
+		return nil, false, fmt.Errorf("failed to get file tree: %w", err)
 	}
+	return tree, truncated, nil
+}
 
-	return updatedFile, nil
+// FolderArchive 待打包下载的目录及其子树
+type FolderArchive struct {
+	Directory *models.File
+	levels    [][]models.File
 }
 
-// CopyFile 复制文件
-func (s *FileService) CopyFile(
-	ctx *gin.Context,
-	userID uuid.UUID,
-	fileID uuid.UUID,
-	req models.FileCopyRequest,
-) (*models.File, error) {
-	// 获取源文件
-	sourceFile, err := s.fileRepo.FindByID(fileID)
+// PrepareFolderArchive 检查目录的下载权限并遍历子树，已删除的文件不会被查出
+// 在写出响应前完成，以便权限和目录树过大等错误仍能正常返回
+func (s *FileService) PrepareFolderArchive(userID uuid.UUID, fileID uuid.UUID) (*FolderArchive, error) {
+	directory, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
 	// 检查权限
-	if sourceFile.UserID != userID && !sourceFile.IsPublic {
-		return nil, fmt.Errorf("permission denied")
+	if !directory.IsPublic {
+		if err := s.authorizeGranted(userID, directory, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
+			return nil, err
+		}
 	}
-
-	// 检查目标目录
-	targetDir, err := s.fileRepo.FindByID(*req.TargetParentID)
-	if err != nil || targetDir.Type != models.FileTypeDir {
-		return nil, fmt.Errorf("invalid target directory")
+	if directory.Type != models.FileTypeDir {
+		return nil, newError(ErrInvalidArgument, "only directories can be downloaded as an archive")
 	}
 
-	// 确定新文件名
-	newName := sourceFile.Name
-	if req.NewName != nil {
-		newName = *req.NewName
+	levels, err := s.walkTree(s.db, directory)
+	if err != nil {
+		return nil, err
 	}
 
-	// 检查目标位置是否已存在同名文件
-	existingFile, err := s.fileRepo.FindByUserAndName(userID, req.TargetParentID, newName)
-	if err == nil && existingFile != nil {
-		return nil, fmt.Errorf("file with this name already exists in target directory")
-	}
+	return &FolderArchive{Directory: directory, levels: levels}, nil
+}
 
-	// 检查用户存储配额
-	user, err := s.userRepo.FindByID(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
+// WriteFolderArchive 将目录子树以ZIP格式流式写入w，逐个从存储读取文件内容，不在内存中缓存整个压缩包
+// 压缩包内的条目以目录名为根，每一级名称都会清理控制字符
+func (s *FileService) WriteFolderArchive(ctx context.Context, w io.Writer, archive *FolderArchive) error {
+	zw := zip.NewWriter(w)
 
-	if !user.CheckStorageQuota(sourceFile.Size) {
-		return nil, fmt.Errorf("storage quota exceeded")
+	// 目录ID到压缩包内路径的映射
+	root := storage.SanitizeFilename(archive.Directory.Name)
+	entryPaths := map[uuid.UUID]string{archive.Directory.ID: root}
+	if _, err := zw.CreateHeader(&zip.FileHeader{Name: root + "/", Modified: archive.Directory.UpdatedAt}); err != nil {
+		return err
+	}
+
+	for _, level := range archive.levels {
+		for i := range level {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			child := &level[i]
+			name := path.Join(entryPaths[*child.ParentID], storage.SanitizeFilename(child.Name))
+			if child.Type == models.FileTypeDir {
+				entryPaths[child.ID] = name
+				if _, err := zw.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: child.UpdatedAt}); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := s.writeArchiveEntry(ctx, zw, child, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+// writeArchiveEntry 将单个文件的内容写入压缩包
+func (s *FileService) writeArchiveEntry(ctx context.Context, zw *zip.Writer, file *models.File, name string) error {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file.Path, err)
+	}
+	defer reader.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", file.Path, err)
+	}
+
+	return nil
+}
+
+// GetPublicFile 获取公开文件信息，不需要登录，优先使用元数据缓存
+// 文件不存在、不是公开文件或是目录时都返回ErrFileNotFound，不暴露私有文件是否存在
+func (s *FileService) GetPublicFile(fileID uuid.UUID) (*models.File, error) {
+	if file, ok := s.publicCache.get(fileID); ok {
+		return file, nil
+	}
+
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if !file.IsPublic || !file.IsFile() {
+		return nil, ErrFileNotFound
+	}
+
+	s.publicCache.set(file)
+	return file, nil
+}
+
+// OpenPublicFile 打开公开文件内容，缓存的路径已失效（如所在目录被移动）时重新查询后再试一次
+func (s *FileService) OpenPublicFile(ctx *gin.Context, file *models.File) (io.ReadCloser, *models.File, error) {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err == nil {
+		return reader, file, nil
+	}
+
+	s.publicCache.invalidate(file.ID)
+	current, findErr := s.GetPublicFile(file.ID)
+	if findErr != nil {
+		return nil, nil, findErr
+	}
+	if current.Path == file.Path {
+		return nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+
+	reader, err = s.storage.Get(ctx, contentKey(current))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+	return reader, current, nil
+}
+
+// CreateDirectory 创建目录
+func (s *FileService) CreateDirectory(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.FileCreateRequest,
+) (*models.File, error) {
+	// 验证请求
+	if req.Type != models.FileTypeDir {
+		return nil, newError(ErrInvalidArgument, "invalid file type for directory creation")
+	}
+
+	name, err := s.sanitizeName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	req.Name = name
+
+	// 校验父目录，新目录继承父目录所属的空间
+	spaceID, err := s.resolveParent(userID, req.ParentID, req.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查目录是否已存在
+	existingDir, err := s.findSibling(userID, spaceID, req.ParentID, req.Name)
+	if err == nil && existingDir != nil {
+		return nil, newError(ErrNameConflict, "directory already exists")
+	}
+
+	dirPath, err := s.childPath(req.ParentID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建目录记录
+	directory := &models.File{
+		UserID:   userID,
+		ParentID: req.ParentID,
+		SpaceID:  spaceID,
+		Name:     req.Name,
+		Path:     dirPath,
+		Size:     0,
+		Type:     models.FileTypeDir,
+		IsPublic: req.IsPublic,
+		Version:  1,
+	}
+
+	// 保存目录记录
+	if err := s.fileRepo.Create(directory); err != nil {
+		return nil, fmt.Errorf("failed to create directory record: %w", err)
+	}
+
+	// 在存储中创建目录
+	storageKey := fileKey(directory)
+	if err := s.storage.CreateDir(ctx, storageKey); err != nil {
+		// 如果存储创建失败，删除数据库记录
+		s.fileRepo.Delete(directory.ID)
+		return nil, fmt.Errorf("failed to create directory in storage: %w", err)
+	}
+
+	return directory, nil
+}
+
+// GetFileList 获取文件列表，查询受DB_TREE_TIMEOUT_MS限制
+func (s *FileService) GetFileList(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter models.FileFilter,
+) ([]models.File, int64, error) {
+	// 设置用户或空间过滤器
+	if err := s.scopeFilter(userID, &filter); err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := queryContext(ctx, s.cfg.Database.TreeTimeout)
+	defer cancel()
+	fileRepo := s.fileRepo.WithContext(ctx)
+
+	// 获取文件列表
+	files, err := fileRepo.FindAll(filter)
+	if err != nil {
+		return nil, 0, queryError(err, "failed to get file list")
+	}
+
+	// 获取总数
+	total, err := fileRepo.Count(filter)
+	if err != nil {
+		return nil, 0, queryError(err, "failed to count files")
+	}
+
+	return files, total, nil
+}
+
+// GetFilesByType 跨所有目录按MIME类型或分类获取用户的文件，查询受DB_TREE_TIMEOUT_MS限制
+func (s *FileService) GetFilesByType(
+	ctx context.Context,
+	userID uuid.UUID,
+	filter models.FileFilter,
+) ([]models.File, int64, error) {
+	fileType := models.FileTypeFile
+	filter.ParentID = nil
+	if err := s.scopeFilter(userID, &filter); err != nil {
+		return nil, 0, err
+	}
+	filter.Type = &fileType
+	filter.Deleted = &[]bool{false}[0]
+	filter.Recursive = true
+
+	ctx, cancel := queryContext(ctx, s.cfg.Database.TreeTimeout)
+	defer cancel()
+	fileRepo := s.fileRepo.WithContext(ctx)
+
+	files, err := fileRepo.FindAll(filter)
+	if err != nil {
+		return nil, 0, queryError(err, "failed to get files by type")
+	}
+
+	total, err := fileRepo.Count(filter)
+	if err != nil {
+		return nil, 0, queryError(err, "failed to count files by type")
+	}
+
+	return files, total, nil
+}
+
+// GetFileByID 根据ID获取文件
+func (s *FileService) GetFileByID(
+	userID uuid.UUID,
+	fileID uuid.UUID,
+) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if !file.IsPublic {
+		if err := s.authorizeGranted(userID, file, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// UpdateFile 更新文件信息
+func (s *FileService) UpdateFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	req models.FileUpdateRequest,
+) (*models.File, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限，仅通过授权获得写权限的用户只能重命名
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		if !s.hasGrant(userID, file, models.FilePermissionWrite) {
+			return nil, err
+		}
+		if req.ParentID != nil || req.IsPublic != nil || req.VersioningEnabled != nil {
+			return nil, ErrPermissionDenied
+		}
+	}
+
+	lockVersion, err := expectedLockVersion(file.LockVersion, req.LockVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新文件信息
+	updates := make(map[string]interface{})
+
+	name := file.Name
+	if req.Name != nil {
+		if name, err = s.validName(*req.Name); err != nil {
+			return nil, err
+		}
+		updates["name"] = name
+	}
+	parentID := file.ParentID
+
+	if req.ParentID != nil {
+		// 检查目标目录是否存在且不是当前文件的子目录
+		if *req.ParentID != file.ID {
+			targetDir, err := s.fileRepo.FindByID(*req.ParentID)
+			if err != nil || targetDir.Type != models.FileTypeDir {
+				return nil, ErrInvalidTarget
+			}
+			if err := s.checkMoveTarget(userID, file, targetDir); err != nil {
+				return nil, err
+			}
+
+			// 检查是否移动到自己的子目录
+			descendant, err := s.isDescendant(*req.ParentID, file.ID)
+			if err != nil {
+				return nil, err
+			}
+			if descendant {
+				return nil, newError(ErrInvalidTarget, "cannot move directory into its own subdirectory")
+			}
+		}
+		updates["parent_id"] = *req.ParentID
+		parentID = req.ParentID
+	}
+
+	// 名称或位置变化时检查目标目录中的同名文件，并重新计算路径
+	var newPath string
+	if req.Name != nil || req.ParentID != nil {
+		existingFile, err := s.findSibling(file.UserID, file.SpaceID, parentID, name)
+		if err == nil && existingFile != nil && existingFile.ID != fileID {
+			return nil, newError(ErrNameConflict, "file with this name already exists")
+		}
+		newPath, err = s.childPath(parentID, name)
+		if err != nil {
+			return nil, err
+		}
+		updates["path"] = newPath
+	}
+
+	if req.IsPublic != nil {
+		updates["is_public"] = *req.IsPublic
+	}
+
+	if req.VersioningEnabled != nil {
+		if !file.IsFile() {
+			return nil, newError(ErrInvalidArgument, "versioning can only be configured for files")
+		}
+		updates["versioning_enabled"] = *req.VersioningEnabled
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	// 应用更新，期间文件被其他请求修改时返回冲突
+	updated, err := s.fileRepo.UpdateIfVersionWithTx(tx, fileID, lockVersion, updates)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update file: %w", err)
+	}
+	if !updated {
+		tx.Rollback()
+		return nil, ErrVersionConflict
+	}
+
+	// 路径变化时更新后代路径，并在提交前移动存储内容
+	var moved []keyMove
+	if newPath != "" && newPath != file.Path {
+		moves, err := s.repathWithTx(tx, file, file.Path, newPath)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if moved, err = s.moveContents(ctx, moves); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		s.revertContents(ctx, moved)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.publicCache.invalidate(fileID)
+
+	// 重新加载文件信息
+	updatedFile, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file: %w", err)
+	}
+
+	return updatedFile, nil
+}
+
+// RenameFile 重命名文件或目录，存储内容随新路径移动，目录的后代路径一并更新
+func (s *FileService) RenameFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	req models.FileRenameRequest,
+) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 被授予写权限的用户也可以重命名
+	if err := s.authorizeGranted(userID, file, models.SpaceRoleEditor, models.FilePermissionWrite); err != nil {
+		return nil, err
+	}
+
+	lockVersion, err := expectedLockVersion(file.LockVersion, req.LockVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := s.validName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if name == file.Name {
+		return file, nil
+	}
+
+	existingFile, err := s.findSibling(file.UserID, file.SpaceID, file.ParentID, name)
+	if err == nil && existingFile != nil && existingFile.ID != fileID {
+		return nil, newError(ErrNameConflict, "file with this name already exists")
+	}
+	newPath, err := s.childPath(file.ParentID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	updated, err := s.fileRepo.UpdateIfVersionWithTx(tx, fileID, lockVersion, map[string]interface{}{
+		"name": name,
+		"path": newPath,
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to rename file: %w", err)
+	}
+	if !updated {
+		tx.Rollback()
+		return nil, ErrVersionConflict
+	}
+
+	// 更新存储键和后代路径，并在提交前移动存储内容
+	moves, err := s.repathWithTx(tx, file, file.Path, newPath)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 记录操作日志，与重命名一同提交
+	details := map[string]interface{}{
+		"from": file.Name,
+		"to":   name,
+		"path": newPath,
+	}
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, models.OperationFileRename,
+		models.ResourceTypeFile, &file.ID, details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	moved, err := s.moveContents(ctx, moves)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		s.revertContents(ctx, moved)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.publicCache.invalidate(fileID)
+
+	updatedFile, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file: %w", err)
+	}
+	return updatedFile, nil
+}
+
+// DeleteFile 删除文件
+func (s *FileService) DeleteFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	permanent bool,
+) error {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return err
+	}
+
+	if permanent {
+		// 永久删除
+		err = s.permanentDeleteFile(ctx, userID, file)
+	} else {
+		// 软删除
+		err = s.softDeleteFile(ctx, userID, file)
+	}
+	if err != nil {
+		return err
+	}
+	s.publicCache.invalidate(file.ID)
+
+	s.events.Publish(events.New(events.FileDeleted, file.UserID, map[string]interface{}{
+		"file_id":   file.ID,
+		"name":      file.Name,
+		"path":      file.Path,
+		"type":      file.Type,
+		"permanent": permanent,
+	}))
+	return nil
+}
+
+// BatchDeleteFiles 批量删除文件，逐个按DeleteFile检查权限并删除，单个文件失败不影响其他文件
+func (s *FileService) BatchDeleteFiles(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.FileBatchDeleteRequest,
+) *models.FileBatchResult {
+	result := &models.FileBatchResult{Results: []models.FileBatchItemResult{}}
+	seen := make(map[uuid.UUID]bool, len(req.FileIDs))
+	for _, fileID := range req.FileIDs {
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+
+		err := s.DeleteFile(ctx, userID, fileID, req.Permanent)
+		if err != nil {
+			log.Printf("Failed to delete file %s in batch: %v", fileID, err)
+		}
+		result.Record(fileID, err)
+	}
+	return result
+}
+
+// publishUploaded 发布文件上传事件
+func (s *FileService) publishUploaded(file *models.File) {
+	s.events.Publish(events.New(events.FileUploaded, file.UserID, map[string]interface{}{
+		"file_id":   file.ID,
+		"name":      file.Name,
+		"path":      file.Path,
+		"size":      file.Size,
+		"mime_type": file.MimeType,
+		"version":   file.Version,
+	}))
+}
+
+// checkQuotaUsage 写入delta字节后检查配额使用情况：
+// 已用空间首次达到警告比例时发布配额警告事件，首次用满配额时发布配额用满事件；
+// ctx非空且已达到警告比例时设置X-Storage-Warning响应头，提醒用户在上传开始失败前清理空间
+func (s *FileService) checkQuotaUsage(ctx *gin.Context, user *models.User, delta int64) {
+	if user.StorageQuota <= 0 {
+		return
+	}
+
+	warningPercent := s.quotaWarningPercent()
+	if warning := s.StorageWarning(user.UsedStorage, user.StorageQuota); warning != nil && ctx != nil {
+		ctx.Header(storageWarningHeader, warning.Header())
+	}
+	if delta <= 0 {
+		return
+	}
+
+	data := map[string]interface{}{
+		"used":            user.UsedStorage,
+		"quota":           user.StorageQuota,
+		"warning_percent": warningPercent,
+	}
+	before := user.UsedStorage - delta
+	if threshold := user.StorageQuota * warningPercent / 100; before < threshold && user.UsedStorage >= threshold {
+		s.events.Publish(events.New(events.QuotaWarning, user.ID, data))
+	}
+	if before < user.StorageQuota && user.UsedStorage >= user.StorageQuota {
+		s.events.Publish(events.New(events.QuotaReached, user.ID, data))
+	}
+}
+
+// StorageWarning 返回已用空间对应的存储警告，未达到警告比例时返回nil
+func (s *FileService) StorageWarning(used, quota int64) *models.StorageWarning {
+	return models.NewStorageWarning(used, quota, s.quotaWarningPercent())
+}
+
+// quotaExceeded 发布超出配额事件并返回ErrQuotaExceeded
+func (s *FileService) quotaExceeded(user *models.User, requested int64) error {
+	s.events.Publish(events.New(events.QuotaExceeded, user.ID, map[string]interface{}{
+		"requested": requested,
+		"used":      user.UsedStorage,
+		"quota":     user.StorageQuota,
+	}))
+	return ErrQuotaExceeded
+}
+
+// expectedLockVersion 返回条件更新使用的lock_version：客户端提供时须与当前值一致，否则使用读取时的值
+func expectedLockVersion(current int64, requested *int64) (int64, error) {
+	if requested != nil && *requested != current {
+		return 0, ErrVersionConflict
+	}
+	return current, nil
+}
+
+// quotaWarningPercent 返回有效的配额警告比例
+func (s *FileService) quotaWarningPercent() int64 {
+	percent := s.cfg.Storage.QuotaWarningPercent
+	if percent <= 0 || percent > 100 {
+		return defaultQuotaWarningPercent
+	}
+	return percent
+}
+
+// permanentDeleteFile 永久删除文件
+func (s *FileService) permanentDeleteFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	file *models.File,
+) error {
+	// 在事务中删除文件
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var deletions []models.StorageDeletion
+	var err error
+	if file.Type == models.FileTypeDir {
+		// 递归删除目录下的所有文件
+		if deletions, err = s.deleteDirectoryRecursive(tx, file); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete directory: %w", err)
+		}
+	} else {
+		// 删除单个文件
+		if deletions, err = s.deleteSingleFile(tx, file); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete file: %w", err)
+		}
+	}
+
+	// 登记待删除的存储内容，与记录的删除一同提交
+	if err := s.cleanup.ScheduleWithTx(tx, deletions); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 记录操作日志，与删除一同提交
+	operation, resourceType := models.OperationFileDelete, models.ResourceTypeFile
+	if file.Type == models.FileTypeDir {
+		operation, resourceType = models.OperationDirDelete, models.ResourceTypeDir
+	}
+	details := map[string]interface{}{
+		"name":      file.Name,
+		"path":      file.Path,
+		"permanent": true,
+	}
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, operation, resourceType, &file.ID, details); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// 记录删除已提交，再删除存储中的内容，失败的由后台重试
+	s.cleanup.Purge(ctx, deletions)
+
+	return nil
+}
+
+// deleteDirectoryRecursive 删除目录及其所有后代的记录：先逐层加载整棵目录树并检查大小限制，
+// 再删除所有文件，最后由深到浅删除目录。空间目录下可能有其他成员创建的文件，按父目录查找子文件
+// 返回需在事务提交后删除的存储内容，顺序为先文件后目录
+func (s *FileService) deleteDirectoryRecursive(
+	tx *gorm.DB,
+	directory *models.File,
+) ([]models.StorageDeletion, error) {
+	levels, err := s.walkTree(tx, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var deletions []models.StorageDeletion
+	for _, level := range levels {
+		for i := range level {
+			if level[i].Type == models.FileTypeDir {
+				continue
+			}
+			fileDeletions, err := s.deleteSingleFile(tx, &level[i])
+			if err != nil {
+				return nil, err
+			}
+			deletions = append(deletions, fileDeletions...)
+		}
+	}
+
+	for depth := len(levels) - 1; depth >= 0; depth-- {
+		for i := range levels[depth] {
+			if levels[depth][i].Type != models.FileTypeDir {
+				continue
+			}
+			if err := s.deleteDirectory(tx, &levels[depth][i]); err != nil {
+				return nil, err
+			}
+			deletions = append(deletions, directoryDeletion(&levels[depth][i]))
+		}
+	}
+
+	if err := s.deleteDirectory(tx, directory); err != nil {
+		return nil, err
+	}
+	return append(deletions, directoryDeletion(directory)), nil
+}
+
+// deleteDirectory 删除单个目录的记录和授权，子文件需已删除
+func (s *FileService) deleteDirectory(tx *gorm.DB, directory *models.File) error {
+	if err := s.fileRepo.DeleteWithTx(tx, directory.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Where("file_id = ?", directory.ID).Delete(&models.FilePermission{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Where("file_id = ?", directory.ID).Delete(&models.FileMoveHistory{}).Error
+}
+
+// directoryDeletion 目录在存储中对应的待删除内容
+func directoryDeletion(directory *models.File) models.StorageDeletion {
+	ownerID := directory.UserID
+	return models.StorageDeletion{
+		Store:   models.StorageStoreFiles,
+		Key:     fileKey(directory),
+		IsDir:   true,
+		OwnerID: &ownerID,
+		SpaceID: directory.SpaceID,
+		Path:    directory.Path,
+	}
+}
+
+// deleteSingleFile 删除单个文件的记录，释放文件所有者的存储空间
+// 不直接删除存储中的内容，返回需在事务提交后删除的文件内容、历史版本和缩略图
+func (s *FileService) deleteSingleFile(
+	tx *gorm.DB,
+	file *models.File,
+) ([]models.StorageDeletion, error) {
+	// 删除文件记录及提取的文本
+	if err := s.fileRepo.DeleteWithTx(tx, file.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileText{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("file_id = ?", file.ID).Delete(&models.FilePermission{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("file_id = ?", file.ID).Delete(&models.FileMoveHistory{}).Error; err != nil {
+		return nil, err
+	}
+
+	// 更新用户已使用存储
+	user, err := s.userRepo.FindByIDWithTx(tx, file.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.UpdateUsedStorage(tx, -file.Size); err != nil {
+		return nil, err
+	}
+
+	// 去重保存的文件只释放引用，最后一个引用释放时才删除共享内容
+	var deletions []models.StorageDeletion
+	if file.BlobKey != "" {
+		if deletions, err = s.releaseBlobWithTx(tx, file.BlobKey); err != nil {
+			return nil, err
+		}
+	} else {
+		ownerID := file.UserID
+		deletions = append(deletions, models.StorageDeletion{
+			Store:   models.StorageStoreFiles,
+			Key:     fileKey(file),
+			OwnerID: &ownerID,
+			SpaceID: file.SpaceID,
+			Path:    file.Path,
+		})
+	}
+
+	return append(deletions,
+		models.StorageDeletion{
+			Store: models.StorageStoreVersions,
+			Key:   storage.GenerateVersionDir(file.UserID, file.ID),
+			IsDir: true,
+		},
+		models.StorageDeletion{
+			Store: models.StorageStoreFiles,
+			Key:   storage.GenerateThumbnailDir(file.UserID, file.ID),
+			IsDir: true,
+		},
+	), nil
+}
+
+// softDeleteFile 软删除文件
+func (s *FileService) softDeleteFile(ctx *gin.Context, userID uuid.UUID, file *models.File) error {
+	// 软删除文件记录
+	if err := s.fileRepo.SoftDelete(file.ID); err != nil {
+		return err
+	}
+
+	operation, resourceType := models.OperationFileDelete, models.ResourceTypeFile
+	if file.Type == models.FileTypeDir {
+		operation, resourceType = models.OperationDirDelete, models.ResourceTypeDir
+	}
+	details := map[string]interface{}{
+		"name":      file.Name,
+		"path":      file.Path,
+		"permanent": false,
+	}
+	if err := s.logService.LogOperation(ctx, userID, operation, resourceType, &file.ID,
+		details, models.OperationSuccess, ""); err != nil {
+		log.Printf("Failed to log deletion of file %s: %v", file.ID, err)
+	}
+	return nil
+}
+
+// MoveFile 移动文件
+func (s *FileService) MoveFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	req models.FileMoveRequest,
+) (*models.File, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, err
+	}
+
+	lockVersion, err := expectedLockVersion(file.LockVersion, req.LockVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查目标目录
+	targetDir, err := s.moveTarget(req.TargetParentID, req.ToRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMove(userID, file, targetDir); err != nil {
+		return nil, err
+	}
+
+	return s.relocateFile(ctx, userID, file, lockVersion, req.TargetParentID, nil)
+}
+
+// moveTarget 返回移动的目标目录，toRoot为true时返回nil表示根目录；两者都未指定或同时指定时返回错误
+func (s *FileService) moveTarget(targetParentID *uuid.UUID, toRoot bool) (*models.File, error) {
+	if toRoot {
+		if targetParentID != nil {
+			return nil, newError(ErrInvalidArgument, "target_parent_id must be empty when to_root is true")
+		}
+		return nil, nil
+	}
+	if targetParentID == nil {
+		return nil, newError(ErrInvalidArgument, "target_parent_id is required unless to_root is true")
+	}
+
+	targetDir, err := s.fileRepo.FindByID(*targetParentID)
+	if err != nil || targetDir.Type != models.FileTypeDir {
+		return nil, ErrInvalidTarget
+	}
+	return targetDir, nil
+}
+
+// checkMove 检查文件能否移动到目标目录（nil为文件所在空间或个人的根目录）：空间和权限、不能移入自己的子目录、目标目录中不能已有同名文件
+func (s *FileService) checkMove(userID uuid.UUID, file, targetDir *models.File) error {
+	// 移动到根目录时文件仍留在原空间，权限已随文件检查
+	spaceID, parentID := file.SpaceID, (*uuid.UUID)(nil)
+	if targetDir != nil {
+		if err := s.checkMoveTarget(userID, file, targetDir); err != nil {
+			return err
+		}
+
+		// 检查是否移动到自己的子目录
+		if file.Type == models.FileTypeDir {
+			descendant, err := s.isDescendant(targetDir.ID, file.ID)
+			if err != nil {
+				return err
+			}
+			if descendant {
+				return newError(ErrInvalidTarget, "cannot move directory into its own subdirectory")
+			}
+		}
+		spaceID, parentID = targetDir.SpaceID, &targetDir.ID
+	}
+
+	// 检查目标位置是否已存在同名文件
+	existingFile, err := s.findSibling(file.UserID, spaceID, parentID, file.Name)
+	if err == nil && existingFile != nil {
+		return newError(ErrNameConflict, "file with this name already exists in target directory")
+	}
+	return nil
+}
+
+// BatchMoveFiles 将多个文件移动到同一目标目录（或根目录），逐个按MoveFile的规则检查，未通过检查的文件跳过并返回原因
+// 通过检查的文件在同一事务中移动，数据库出错时全部不移动；目标目录无效时返回ErrInvalidTarget
+func (s *FileService) BatchMoveFiles(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.FileBatchMoveRequest,
+) (*models.FileBatchResult, error) {
+	targetDir, err := s.moveTarget(req.TargetParentID, req.ToRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐个检查，记录跳过的原因；同一批中移入目标目录的文件也不能重名
+	var order []uuid.UUID
+	outcomes := make(map[uuid.UUID]error, len(req.FileIDs))
+	var movable []*models.File
+	names := make(map[string]bool)
+	for _, fileID := range req.FileIDs {
+		if _, seen := outcomes[fileID]; seen {
+			continue
+		}
+		order = append(order, fileID)
+
+		file, err := s.fileRepo.FindByID(fileID)
+		if err != nil {
+			outcomes[fileID] = ErrFileNotFound
+			continue
+		}
+		if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+			outcomes[fileID] = err
+			continue
+		}
+		if err := s.checkMove(userID, file, targetDir); err != nil {
+			outcomes[fileID] = err
+			continue
+		}
+		name := s.normalizeName(file.Name)
+		if names[name] {
+			outcomes[fileID] = newError(ErrNameConflict, "another file with this name is moved to the target directory")
+			continue
+		}
+		names[name] = true
+		outcomes[fileID] = nil
+		movable = append(movable, file)
+	}
+
+	if len(movable) > 0 {
+		tx := s.db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+				panic(r)
+			}
+		}()
+
+		var moves []keyMove
+		for _, file := range movable {
+			fileMoves, err := s.relocateFileWithTx(tx, ctx, userID, file, file.LockVersion, req.TargetParentID, nil)
+			if errors.Is(err, ErrVersionConflict) {
+				// 检查后被其他请求修改的文件跳过
+				outcomes[file.ID] = err
+				continue
+			}
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			moves = append(moves, fileMoves...)
+		}
+
+		moved, err := s.moveContents(ctx, moves)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			s.revertContents(ctx, moved)
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		for _, file := range movable {
+			s.publicCache.invalidate(file.ID)
+		}
+	}
+
+	result := &models.FileBatchResult{Results: []models.FileBatchItemResult{}}
+	for _, fileID := range order {
+		result.Record(fileID, outcomes[fileID])
+	}
+	return result, nil
+}
+
+// UndoMove 撤销文件最近一次移动，将其移回原目录
+// 只能撤销UNDO_MOVE_WINDOW内、之后未再被移动的移动；原目录已删除或已有同名文件时失败
+func (s *FileService) UndoMove(ctx *gin.Context, userID uuid.UUID, fileID uuid.UUID) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, err
+	}
+
+	move, err := s.moveRepo.FindLatestByFile(fileID)
+	if err != nil || move.UndoneAt != nil {
+		return nil, newError(ErrMoveNotUndoable, "no move to undo")
+	}
+	if window := s.cfg.Storage.UndoMoveWindow; window > 0 && time.Since(move.CreatedAt) > window {
+		return nil, newError(ErrMoveNotUndoable, "move is too old to undo")
+	}
+	if !sameSpace(file.ParentID, move.ToParentID) {
+		return nil, newError(ErrMoveNotUndoable, "file has been moved since")
+	}
+
+	// 重新检查原目录：可能已被删除、移入该目录之下，或权限已变化
+	if move.FromParentID != nil {
+		originalDir, err := s.fileRepo.FindByID(*move.FromParentID)
+		if err != nil || originalDir.Type != models.FileTypeDir {
+			return nil, newError(ErrInvalidTarget, "original directory no longer exists")
+		}
+		if err := s.checkMoveTarget(userID, file, originalDir); err != nil {
+			return nil, err
+		}
+		if file.Type == models.FileTypeDir {
+			descendant, err := s.isDescendant(originalDir.ID, file.ID)
+			if err != nil {
+				return nil, err
+			}
+			if descendant {
+				return nil, newError(ErrInvalidTarget, "original directory is now inside this directory")
+			}
+		}
+	}
+
+	existingFile, err := s.findSibling(file.UserID, file.SpaceID, move.FromParentID, file.Name)
+	if err == nil && existingFile != nil {
+		return nil, newError(ErrNameConflict, "file with this name already exists in original directory")
+	}
+
+	return s.relocateFile(ctx, userID, file, file.LockVersion, move.FromParentID, move)
+}
+
+// GetRecentMoves 获取用户在UNDO_MOVE_WINDOW内执行的移动，从新到旧排列
+func (s *FileService) GetRecentMoves(userID uuid.UUID) ([]models.FileMoveHistory, error) {
+	since := time.Time{}
+	if window := s.cfg.Storage.UndoMoveWindow; window > 0 {
+		since = time.Now().Add(-window)
+	}
+
+	moves, err := s.moveRepo.FindRecentByUser(userID, since, recentMovesLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent moves: %w", err)
+	}
+	return moves, nil
+}
+
+// relocateFile 在事务中将文件移动到targetParentID（nil为根目录），记录移动历史和操作日志
+// undo不为nil时为撤销该次移动，将其标记为已撤销而不产生新的移动记录
+func (s *FileService) relocateFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	file *models.File,
+	lockVersion int64,
+	targetParentID *uuid.UUID,
+	undo *models.FileMoveHistory,
+) (*models.File, error) {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	moves, err := s.relocateFileWithTx(tx, ctx, userID, file, lockVersion, targetParentID, undo)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交前将存储内容移动到新路径，失败时已撤销已完成的移动
+	moved, err := s.moveContents(ctx, moves)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		s.revertContents(ctx, moved)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.publicCache.invalidate(file.ID)
+
+	// 重新加载文件信息
+	updatedFile, err := s.fileRepo.FindByID(file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file: %w", err)
+	}
+
+	return updatedFile, nil
+}
+
+// relocateFileWithTx 在事务中更新文件的父目录及自身和后代的路径，记录移动历史（或标记撤销）和操作日志，出错时由调用方回滚
+// 返回需在提交前按顺序移动的存储内容
+func (s *FileService) relocateFileWithTx(
+	tx *gorm.DB,
+	ctx *gin.Context,
+	userID uuid.UUID,
+	file *models.File,
+	lockVersion int64,
+	targetParentID *uuid.UUID,
+	undo *models.FileMoveHistory,
+) ([]keyMove, error) {
+	// 同一事务中先移动了祖先目录时，文件的路径已随之更新
+	oldPath := file.Path
+	if err := tx.Model(&models.File{}).Select("path").Where("id = ?", file.ID).Scan(&oldPath).Error; err != nil {
+		return nil, fmt.Errorf("failed to get file path: %w", err)
+	}
+	newPath, err := s.childPath(targetParentID, file.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 更新文件父目录和路径
+	updates := map[string]interface{}{
+		"parent_id": targetParentID,
+		"path":      newPath,
+	}
+
+	updated, err := s.fileRepo.UpdateIfVersionWithTx(tx, file.ID, lockVersion, updates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update file: %w", err)
+	}
+	if !updated {
+		return nil, ErrVersionConflict
+	}
+
+	// 更新当前版本记录的存储键，目录还需更新所有后代的路径
+	moves, err := s.repathWithTx(tx, file, oldPath, newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"name":           file.Name,
+		"from_parent_id": file.ParentID,
+		"to_parent_id":   targetParentID,
+	}
+	if undo == nil {
+		move := &models.FileMoveHistory{
+			FileID:       file.ID,
+			UserID:       userID,
+			FromParentID: file.ParentID,
+			ToParentID:   targetParentID,
+		}
+		if err := s.moveRepo.CreateWithTx(tx, move); err != nil {
+			return nil, fmt.Errorf("failed to record move: %w", err)
+		}
+	} else {
+		// 并发撤销同一次移动时只有一个成功
+		marked, err := s.moveRepo.MarkUndoneWithTx(tx, undo.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to mark move as undone: %w", err)
+		}
+		if !marked {
+			return nil, newError(ErrMoveNotUndoable, "move has already been undone")
+		}
+		details["undo_move_id"] = undo.ID
+	}
+
+	// 记录操作日志，与移动一同提交
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, models.OperationFileMove,
+		models.ResourceTypeFile, &file.ID, details); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// keyMove 路径变化后需要移动的存储内容，dir为true时只需在新位置创建目录
+type keyMove struct {
+	from string
+	to   string
+	dir  bool
+}
+
+// repathWithTx 在事务中处理文件路径从oldPath改为newPath后的关联更新：文件当前版本记录的存储键，
+// 目录还包括所有未删除后代的路径；文件自身的path列由调用方更新。返回需要移动的存储内容
+func (s *FileService) repathWithTx(tx *gorm.DB, file *models.File, oldPath, newPath string) ([]keyMove, error) {
+	moves, err := s.repathEntryWithTx(tx, file, oldPath, newPath)
+	if err != nil {
+		return nil, err
+	}
+	if file.Type != models.FileTypeDir {
+		return moves, nil
+	}
+
+	descendantMoves, err := s.updateDescendantPaths(tx, file, newPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update descendant paths: %w", err)
+	}
+	return append(moves, descendantMoves...), nil
+}
+
+// repathEntryWithTx 单个文件或目录路径变化后需要移动的存储内容，并将文件当前版本记录指向新的存储键
+// 去重保存的内容不随路径变化
+func (s *FileService) repathEntryWithTx(tx *gorm.DB, file *models.File, oldPath, newPath string) ([]keyMove, error) {
+	oldKey := pathKey(file.UserID, file.SpaceID, oldPath)
+	newKey := pathKey(file.UserID, file.SpaceID, newPath)
+	if oldKey == newKey {
+		return nil, nil
+	}
+	if file.Type == models.FileTypeDir {
+		return []keyMove{{to: newKey, dir: true}}, nil
+	}
+	if file.BlobKey != "" {
+		return nil, nil
+	}
+
+	if err := tx.Model(&models.FileVersion{}).
+		Where("file_id = ? AND storage_path = ?", file.ID, oldKey).
+		Update("storage_path", newKey).Error; err != nil {
+		return nil, fmt.Errorf("failed to update version storage path: %w", err)
+	}
+	return []keyMove{{from: oldKey, to: newKey}}, nil
+}
+
+// moveContents 按顺序移动存储内容，返回已完成的移动；任一移动失败时撤销已完成的移动
+// 源内容不存在时跳过，不影响其余文件
+func (s *FileService) moveContents(ctx context.Context, moves []keyMove) ([]keyMove, error) {
+	var done []keyMove
+	for _, move := range moves {
+		if move.dir {
+			if err := s.storage.CreateDir(ctx, move.to); err != nil {
+				s.revertContents(ctx, done)
+				return nil, fmt.Errorf("failed to create directory in storage: %w", err)
+			}
+			continue
+		}
+
+		exists, err := s.storage.Exists(ctx, move.from)
+		if err != nil {
+			s.revertContents(ctx, done)
+			return nil, fmt.Errorf("failed to check file in storage: %w", err)
+		}
+		if !exists {
+			log.Printf("Content %s not found in storage, skipping move to %s", move.from, move.to)
+			continue
+		}
+		if err := s.storage.Move(ctx, move.from, move.to); err != nil {
+			s.revertContents(ctx, done)
+			return nil, fmt.Errorf("failed to move file in storage: %w", err)
+		}
+		done = append(done, move)
+	}
+	return done, nil
+}
+
+// revertContents 按相反顺序撤销已完成的移动，失败时只记录日志
+func (s *FileService) revertContents(ctx context.Context, done []keyMove) {
+	for i := len(done) - 1; i >= 0; i-- {
+		if err := s.storage.Move(ctx, done[i].to, done[i].from); err != nil {
+			log.Printf("Failed to move %s back to %s: %v", done[i].to, done[i].from, err)
+		}
+	}
+}
+
+// CopyFile 复制文件或目录
+// 复制的文件总大小或文件数达到COPY_ASYNC_THRESHOLD/COPY_ASYNC_MIN_FILES时提交后台任务并返回任务，否则直接返回副本
+func (s *FileService) CopyFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	req models.FileCopyRequest,
+) (*models.File, *models.Job, error) {
+	// 获取源文件
+	sourceFile, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if !sourceFile.IsPublic {
+		if err := s.authorizeFile(userID, sourceFile, models.SpaceRoleViewer); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 检查目标目录，副本归属目标目录所在的空间
+	spaceID, err := s.resolveParent(userID, req.TargetParentID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 确定新文件名
+	newName := sourceFile.Name
+	if req.NewName != nil {
+		if newName, err = s.validName(*req.NewName); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 检查目标位置是否已存在同名文件
+	existingFile, err := s.findSibling(userID, spaceID, req.TargetParentID, newName)
+	if err == nil && existingFile != nil {
+		return nil, nil, newError(ErrNameConflict, "file with this name already exists in target directory")
+	}
+
+	// 加载整棵目录树并统计要复制的文件数、总大小及各分类的大小
+	var levels [][]models.File
+	totalFiles, totalBytes := 1, sourceFile.Size
+	categoryBytes := make(map[string]int64)
+	if sourceFile.Type == models.FileTypeDir {
+		if levels, err = s.walkTree(s.db, sourceFile); err != nil {
+			return nil, nil, err
+		}
+		totalBytes = 0
+		for _, level := range levels {
+			totalFiles += len(level)
+			for _, child := range level {
+				if child.IsFile() {
+					totalBytes += child.Size
+					addCategoryBytes(categoryBytes, child.MimeType, child.Size)
+				}
+			}
+		}
+	} else {
+		addCategoryBytes(categoryBytes, sourceFile.MimeType, sourceFile.Size)
+	}
+
+	// 检查用户存储配额
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !user.CheckStorageQuota(totalBytes) {
+		return nil, nil, s.quotaExceeded(user, totalBytes)
+	}
+
+	if err := s.checkCategoryDeltas(user, categoryBytes); err != nil {
+		return nil, nil, err
+	}
+
+	plan := copyPlan{
+		source:         sourceFile,
+		levels:         levels,
+		targetParentID: req.TargetParentID,
+		spaceID:        spaceID,
+		name:           newName,
+		totalFiles:     totalFiles,
+		totalBytes:     totalBytes,
+	}
+
+	threshold, minFiles := s.cfg.Storage.CopyAsyncThreshold, s.cfg.Storage.CopyAsyncMinFiles
+	if (threshold <= 0 || totalBytes < threshold) && (minFiles <= 0 || totalFiles < minFiles) {
+		copiedFile, err := s.performCopy(ctx, ctx, userID, plan, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return copiedFile, nil, nil
+	}
+
+	// 请求结束后gin.Context会被复用，后台任务使用其副本记录操作日志
+	logCtx := ctx.Copy()
+	job, err := s.jobs.Submit(userID, models.JobTypeFileCopy, func(jobCtx context.Context, progress JobProgress) (interface{}, error) {
+		copiedFile, err := s.performCopy(jobCtx, logCtx, userID, plan, plan.reportTo(progress))
+		if err != nil {
+			return nil, err
+		}
+		return copiedFile.ToResponse(), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, job, nil
+}
+
+// copyPlan 一次复制的源文件、预先加载的目录树和目标位置
+type copyPlan struct {
+	source         *models.File
+	levels         [][]models.File // 源目录的子文件，由浅到深逐层排列
+	targetParentID *uuid.UUID
+	spaceID        *uuid.UUID
+	name           string
+	totalFiles     int
+	totalBytes     int64
+}
+
+// copyProgress 复制进度回调，bytes为新复制的字节数，files为新复制完成的文件数
+type copyProgress func(bytes int64, files int)
+
+// reportTo 将复制进度累计后报告给后台任务，有文件内容时按字节数计算进度，否则按文件数
+func (p copyPlan) reportTo(progress JobProgress) copyProgress {
+	var mu sync.Mutex
+	var copiedBytes, copiedFiles int64
+	return func(bytes int64, files int) {
+		mu.Lock()
+		copiedBytes += bytes
+		copiedFiles += int64(files)
+		done, total := copiedBytes, p.totalBytes
+		if total == 0 {
+			done, total = copiedFiles, int64(p.totalFiles)
+		}
+		mu.Unlock()
+		progress(done, total)
+	}
+}
+
+// performCopy 在事务中创建副本并更新用户已使用存储，logCtx为nil时操作日志不记录请求信息
+func (s *FileService) performCopy(
+	ctx context.Context,
+	logCtx *gin.Context,
+	userID uuid.UUID,
+	plan copyPlan,
+	progress copyProgress,
+) (*models.File, error) {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	// 创建文件副本
+	copiedFile, err := s.copyFileRecursive(ctx, tx, userID, plan.source, plan.levels,
+		plan.targetParentID, plan.spaceID, plan.name, progress)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	// 异步复制耗时较长，在事务内重新加载用户，避免覆盖期间其他操作对已使用存储的修改
+	user, err := s.userRepo.FindByIDWithTx(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// 更新用户已使用存储
+	if err := user.UpdateUsedStorage(tx, plan.totalBytes); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update user storage: %w", err)
+	}
+
+	// 记录操作日志，与复制一同提交
+	details := map[string]interface{}{
+		"source_id":    plan.source.ID,
+		"name":         copiedFile.Name,
+		"to_parent_id": plan.targetParentID,
+		"size":         plan.totalBytes,
+	}
+	if err := s.logService.LogOperationWithTx(tx, logCtx, userID, models.OperationFileCopy,
+		models.ResourceTypeFile, &copiedFile.ID, details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.checkQuotaUsage(nil, user, plan.totalBytes)
+
+	return copiedFile, nil
+}
+
+// copyTask 待复制的文件内容
+type copyTask struct {
+	srcKey string
+	dstKey string
+	size   int64
+}
+
+// copyFileRecursive 复制文件或目录：levels为walkTree加载的源目录树，由浅到深逐层创建副本记录，
+// 记录全部创建后再以COPY_CONCURRENCY个并发复制文件内容；progress可为nil
+func (s *FileService) copyFileRecursive(
+	ctx context.Context,
+	tx *gorm.DB,
+	userID uuid.UUID,
+	sourceFile *models.File,
+	levels [][]models.File,
+	targetParentID *uuid.UUID,
+	spaceID *uuid.UUID,
+	newName string,
+	progress copyProgress,
+) (*models.File, error) {
+	var tasks []copyTask
+
+	copiedPath, err := s.childPath(targetParentID, newName)
+	if err != nil {
+		return nil, err
+	}
+	copiedFile, task, err := s.copyFileEntry(ctx, tx, userID, sourceFile, targetParentID, spaceID, newName, copiedPath)
+	if err != nil {
+		return nil, err
+	}
+	if task != nil {
+		tasks = append(tasks, *task)
+	} else if progress != nil {
+		progress(0, 1)
+	}
+
+	// 源目录ID到副本目录的映射，空间目录下的子文件可能属于不同成员
+	copiedDirs := map[uuid.UUID]*models.File{sourceFile.ID: copiedFile}
+	for _, level := range levels {
+		for i := range level {
+			child := &level[i]
+			parent := copiedDirs[*child.ParentID]
+			copied, task, err := s.copyFileEntry(ctx, tx, userID, child, &parent.ID, spaceID, child.Name,
+				path.Join(parent.Path, child.Name))
+			if err != nil {
+				return nil, err
+			}
+			if task != nil {
+				tasks = append(tasks, *task)
+			} else if progress != nil {
+				progress(0, 1)
+			}
+			if child.Type == models.FileTypeDir {
+				copiedDirs[child.ID] = copied
+			}
+		}
+	}
+	if err := s.copyContents(ctx, tasks, progress); err != nil {
+		return nil, err
+	}
+
+	return copiedFile, nil
+}
+
+// copyContents 并发复制文件内容，任一文件失败时取消其余复制并删除已复制的内容
+func (s *FileService) copyContents(ctx context.Context, tasks []copyTask, progress copyProgress) error {
+	var bytesProgress func(n int64)
+	if progress != nil {
+		bytesProgress = func(n int64) { progress(n, 0) }
+	}
+
+	var mu sync.Mutex
+	var saved []string
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(max(s.cfg.Storage.CopyConcurrency, 1))
+	for _, task := range tasks {
+		group.Go(func() error {
+			if err := storage.StreamCopy(groupCtx, s.storage, task.srcKey, s.storage, task.dstKey, task.size, bytesProgress); err != nil {
+				return err
+			}
+			mu.Lock()
+			saved = append(saved, task.dstKey)
+			mu.Unlock()
+			if progress != nil {
+				progress(0, 1)
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		for _, key := range saved {
+			s.storage.Delete(context.Background(), key)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyFileEntry 复制单个文件或目录本身（不含子文件）的记录，副本位于filePath，文件内容由返回的copyTask另行复制
+func (s *FileService) copyFileEntry(
+	ctx context.Context,
+	tx *gorm.DB,
+	userID uuid.UUID,
+	sourceFile *models.File,
+	targetParentID *uuid.UUID,
+	spaceID *uuid.UUID,
+	newName string,
+	filePath string,
+) (*models.File, *copyTask, error) {
+	// 创建文件记录副本
+	copiedFile := &models.File{
+		UserID:       userID,
+		ParentID:     targetParentID,
+		SpaceID:      spaceID,
+		Name:         newName,
+		Path:         filePath,
+		Size:         sourceFile.Size,
+		MimeType:     sourceFile.MimeType,
+		DetectedMime: sourceFile.DetectedMime,
+		Type:         sourceFile.Type,
+		IsPublic:     sourceFile.IsPublic,
+		Hash:         sourceFile.Hash,
+		Version:      1,
+	}
+
+	// 保存文件记录
+	if err := s.fileRepo.CreateWithTx(tx, copiedFile); err != nil {
+		return nil, nil, err
+	}
+
+	dstStorageKey := fileKey(copiedFile)
+	if sourceFile.Type == models.FileTypeDir {
+		// 在存储中创建目录
+		if err := s.storage.CreateDir(ctx, dstStorageKey); err != nil {
+			return nil, nil, err
+		}
+		return copiedFile, nil, nil
+	}
+
+	// 创建版本记录
+	fileVersion := &models.FileVersion{
+		FileID:        copiedFile.ID,
+		VersionNumber: 1,
+		FileSize:      sourceFile.Size,
+		FileHash:      sourceFile.Hash,
+		StoragePath:   dstStorageKey,
+		MimeType:      sourceFile.MimeType,
+		CreatedBy:     userID,
+	}
+
+	if err := tx.Create(fileVersion).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return copiedFile, &copyTask{
+		srcKey: contentKey(sourceFile),
+		dstKey: dstStorageKey,
+		size:   sourceFile.Size,
+	}, nil
+}
+
+// GetFileVersions 获取文件版本列表
+func (s *FileService) GetFileVersions(
+	userID uuid.UUID,
+	fileID uuid.UUID,
+) ([]models.FileVersion, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if err := s.authorizeFile(userID, file, models.SpaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	// 获取版本列表
+	versions, err := s.fileVersionRepo.FindByFileID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// DefaultVersionPolicy 返回VERSION_*配置的历史版本保留策略
+func (s *FileService) DefaultVersionPolicy() models.CleanupOldVersions {
+	return models.CleanupOldVersions{
+		KeepLastNVersions: s.cfg.Versions.KeepLast,
+		MaxAgeDays:        s.cfg.Versions.MaxAgeDays,
+		MinVersions:       s.cfg.Versions.MinVersions,
+	}
+}
+
+// CleanupFileVersions 按保留策略删除文件的历史版本记录及其归档内容，当前版本始终保留
+func (s *FileService) CleanupFileVersions(
+	ctx context.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	policy models.CleanupOldVersions,
+) (*models.VersionCleanupResult, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, err
+	}
+	if !file.IsFile() {
+		return nil, newError(ErrInvalidArgument, "only files have versions")
+	}
+
+	return s.applyVersionRetention(ctx, file, policy)
+}
+
+// CleanupAllVersions 按保留策略清理所有有历史版本的文件，回收站中的文件跳过（永久删除时一并删除其版本）
+func (s *FileService) CleanupAllVersions(ctx context.Context, policy models.CleanupOldVersions) (*models.VersionRetentionSummary, error) {
+	summary := &models.VersionRetentionSummary{}
+	lastID := uuid.Nil
+	for {
+		ids, err := s.fileVersionRepo.FindFileIDsWithHistory(lastID, treeBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files with versions: %w", err)
+		}
+		if len(ids) == 0 {
+			return summary, nil
+		}
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			lastID = id
+
+			file, err := s.fileRepo.FindByID(id)
+			if err != nil {
+				continue
+			}
+			summary.Files++
+
+			result, err := s.applyVersionRetention(ctx, file, policy)
+			if err != nil {
+				log.Printf("Failed to clean up versions of file %s: %v", id, err)
+				summary.Failed = append(summary.Failed, id)
+				continue
+			}
+			summary.DeletedVersions += len(result.DeletedVersions)
+			summary.FreedBytes += result.FreedBytes
+		}
+	}
+}
+
+// StartVersionRetention 配置了保留策略且VERSION_CLEANUP_INTERVAL大于0时，定期清理所有文件的历史版本
+func (s *FileService) StartVersionRetention() {
+	policy := s.DefaultVersionPolicy()
+	if s.cfg.Versions.CleanupInterval <= 0 || policy.IsEmpty() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.cfg.Versions.CleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			summary, err := s.CleanupAllVersions(context.Background(), policy)
+			if err != nil {
+				log.Printf("Version retention failed: %v", err)
+			} else if summary.DeletedVersions > 0 {
+				log.Printf("Version retention removed %d versions (%d bytes) from %d files",
+					summary.DeletedVersions, summary.FreedBytes, summary.Files)
+			}
+		}
+	}()
+}
+
+// applyVersionRetention 删除文件超出保留策略的版本记录，归档在版本存储中的内容在事务提交后删除
+func (s *FileService) applyVersionRetention(
+	ctx context.Context,
+	file *models.File,
+	policy models.CleanupOldVersions,
+) (*models.VersionCleanupResult, error) {
+	if policy.IsEmpty() {
+		return nil, newError(ErrInvalidArgument, "retention policy must set keep_last_n_versions or max_age_days")
+	}
+	result := &models.VersionCleanupResult{FileID: file.ID, DeletedVersions: []int{}}
+
+	versions, err := s.fileVersionRepo.FindByFileID(file.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file versions: %w", err)
+	}
+
+	expired := policy.Expired(versions, file.Version, time.Now())
+	result.Remaining = len(versions) - len(expired)
+	if len(expired) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(expired))
+	var deletions []models.StorageDeletion
+	for _, version := range expired {
+		ids = append(ids, version.ID)
+		result.DeletedVersions = append(result.DeletedVersions, version.VersionNumber)
+		// 未归档的版本记录指向文件存储中的内容，不删除
+		if storage.IsVersionKey(version.StoragePath) {
+			deletions = append(deletions, models.StorageDeletion{
+				Store: models.StorageStoreVersions,
+				Key:   version.StoragePath,
+			})
+			result.FreedBytes += version.FileSize
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.fileVersionRepo.DeleteByIDsWithTx(tx, ids); err != nil {
+			return fmt.Errorf("failed to delete file versions: %w", err)
+		}
+		return s.cleanup.ScheduleWithTx(tx, deletions)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cleanup.Purge(ctx, deletions)
+
+	return result, nil
+}
+
+// RestoreFileVersion 恢复文件版本
+// 当前内容先归档为历史版本，再用目标版本的内容生成一个新版本
+func (s *FileService) RestoreFileVersion(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	versionNumber int,
+) (*models.File, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	// 检查权限
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, err
 	}
 
-	// 在事务中复制文件
+	// 获取指定版本
+	version, err := s.fileVersionRepo.FindByVersion(fileID, versionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVersionNotFound, err)
+	}
+
+	// 在事务中恢复
 	tx := s.db.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -688,235 +3060,364 @@ func (s *FileService) CopyFile(
 		}
 	}()
 
-	// 创建文件副本
-	copiedFile, err := s.copyFileRecursive(ctx, tx, userID, sourceFile, req.TargetParentID, newName)
+	// 归档当前内容并写回目标版本的内容
+	versionKey, err := s.restoreVersionContent(ctx, file, version)
 	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to copy file: %w", err)
+		if errors.Is(err, ErrVersionNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to restore file: %w", err)
 	}
 
-	// 更新用户已使用存储
-	if err := user.UpdateUsedStorage(tx, sourceFile.Size); err != nil {
+	// 恢复的内容已写入文件自己的存储键，不再引用去重共享内容
+	blobKey := file.BlobKey
+	file.BlobKey = ""
+
+	// 当前版本记录指向归档后的版本键
+	if err := tx.Model(&models.FileVersion{}).
+		Where("file_id = ? AND version_number = ?", fileID, file.Version).
+		Update("storage_path", versionKey).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update current version: %w", err)
+	}
+
+	// 创建新版本记录，内容位于文件存储键
+	newVersion := &models.FileVersion{
+		FileID:        fileID,
+		VersionNumber: file.Version + 1,
+		FileSize:      version.FileSize,
+		FileHash:      version.FileHash,
+		StoragePath:   fileKey(file),
+		MimeType:      version.MimeType,
+		CreatedBy:     userID,
+	}
+
+	if err := tx.Create(newVersion).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create file version: %w", err)
+	}
+
+	// 更新文件信息，版本未记录嗅探类型，按恢复后的内容重新嗅探
+	updates := map[string]interface{}{
+		"size":      version.FileSize,
+		"mime_type": version.MimeType,
+		"hash":      version.FileHash,
+		"version":   file.Version + 1,
+	}
+	if detectedMime, err := s.detectStoredMime(ctx, file); err == nil {
+		updates["detected_mime"] = detectedMime
+	} else {
+		log.Printf("Failed to detect MIME type of restored file %s: %v", fileID, err)
+		updates["detected_mime"] = ""
+	}
+
+	var deletions []models.StorageDeletion
+	if blobKey != "" {
+		updates["blob_key"] = ""
+		deletions, err = s.releaseBlobWithTx(tx, blobKey)
+		if err == nil {
+			err = s.cleanup.ScheduleWithTx(tx, deletions)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := s.fileRepo.UpdateWithTx(tx, fileID, updates); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update file: %w", err)
+	}
+
+	// 更新文件所有者已使用存储
+	user, err := s.userRepo.FindByIDWithTx(tx, file.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := user.UpdateUsedStorage(tx, version.FileSize-file.Size); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to update user storage: %w", err)
 	}
 
+	// 记录操作日志，与恢复一同提交
+	details := map[string]interface{}{
+		"restored_version": versionNumber,
+		"version":          newVersion.VersionNumber,
+		"size":             version.FileSize,
+	}
+	if err := s.logService.LogOperationWithTx(tx, ctx, userID, models.OperationFileUpdate,
+		models.ResourceTypeFile, &fileID, details); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	s.cleanup.Purge(ctx, deletions)
+	s.publicCache.invalidate(fileID)
 
-	return copiedFile, nil
+	// 重新加载文件信息
+	restored, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file: %w", err)
+	}
+
+	s.textService.IndexAsync(restored)
+	s.thumbnails.GenerateAsync(restored)
+
+	return restored, nil
 }
 
-// copyFileRecursive 递归复制文件
-func (s *FileService) copyFileRecursive(
-	ctx *gin.Context,
-	tx *gorm.DB,
+// GetTextPreview 获取文件提取文本的前length个字符
+func (s *FileService) GetTextPreview(
+	ctx context.Context,
 	userID uuid.UUID,
-	sourceFile *models.File,
-	targetParentID *uuid.UUID,
-	newName string,
-) (*models.File, error) {
-	// 创建文件记录副本
-	copiedFile := &models.File{
-		UserID:   userID,
-		ParentID: targetParentID,
-		Name:     newName,
-		Size:     sourceFile.Size,
-		MimeType: sourceFile.MimeType,
-		Type:     sourceFile.Type,
-		IsPublic: sourceFile.IsPublic,
-		Version:  1,
+	fileID uuid.UUID,
+	length int,
+) (*models.TextPreviewResponse, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
-	// 保存文件记录
-	if err := s.fileRepo.CreateWithTx(tx, copiedFile); err != nil {
+	// 检查权限
+	if err := s.authorizeFile(userID, file, models.SpaceRoleViewer); err != nil {
 		return nil, err
 	}
 
-	if sourceFile.Type == models.FileTypeFile {
-		// 复制文件内容
-		srcStorageKey := storage.GenerateFileKey(sourceFile.UserID, sourceFile.Path)
-		dstStorageKey := storage.GenerateFileKey(userID, copiedFile.Path)
-
-		// 获取源文件
-		reader, err := s.storage.Get(ctx, srcStorageKey)
-		if err != nil {
-			return nil, err
-		}
-		defer reader.Close()
-
-		// 保存副本
-		if err := s.storage.Save(ctx, dstStorageKey, reader, sourceFile.Size); err != nil {
-			return nil, err
-		}
-
-		// 创建版本记录
-		fileVersion := &models.FileVersion{
-			FileID:        copiedFile.ID,
-			VersionNumber: 1,
-			FileSize:      sourceFile.Size,
-			FileHash:      "", // 可以计算文件哈希
-			StoragePath:   dstStorageKey,
-			MimeType:      sourceFile.MimeType,
-			CreatedBy:     userID,
-		}
-
-		if err := tx.Create(fileVersion).Error; err != nil {
-			return nil, err
-		}
-	} else if sourceFile.Type == models.FileTypeDir {
-		// 在存储中创建目录
-		dstStorageKey := storage.GenerateFileKey(userID, copiedFile.Path)
-		if err := s.storage.CreateDir(ctx, dstStorageKey); err != nil {
-			return nil, err
-		}
+	return s.textService.Preview(ctx, file, length)
+}
 
-		// 递归复制子文件
-		filter := models.FileFilter{
-			UserID:   &sourceFile.UserID,
-			ParentID: &sourceFile.ID,
-			Deleted:  &[]bool{false}[0],
-		}
+// GetTextContent 获取文本或代码文件的内容预览，权限与下载相同
+func (s *FileService) GetTextContent(
+	ctx context.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+) (*models.TextContentResponse, error) {
+	// 获取文件
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
 
-		childFiles, err := s.fileRepo.FindAllWithTx(tx, filter)
-		if err != nil {
+	// 检查权限
+	if !file.IsPublic {
+		if err := s.authorizeGranted(userID, file, models.SpaceRoleViewer, models.FilePermissionRead); err != nil {
 			return nil, err
 		}
-
-		for _, childFile := range childFiles {
-			_, err := s.copyFileRecursive(ctx, tx, userID, &childFile, &copiedFile.ID, childFile.Name)
-			if err != nil {
-				return nil, err
-			}
-		}
 	}
 
-	return copiedFile, nil
+	return s.textService.Content(ctx, file)
 }
 
-// GetFileVersions 获取文件版本列表
-func (s *FileService) GetFileVersions(
+// GetThumbnail 获取文件当前版本按比例缩放到width×height以内的缩略图（JPEG）及文件信息，尺寸为0时使用默认值
+func (s *FileService) GetThumbnail(
+	ctx context.Context,
 	userID uuid.UUID,
 	fileID uuid.UUID,
-) ([]models.FileVersion, error) {
+	width, height int,
+) ([]byte, *models.File, error) {
 	// 获取文件
 	file, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+		return nil, nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
 	// 检查权限
-	if file.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+	if err := s.authorizeFile(userID, file, models.SpaceRoleViewer); err != nil {
+		return nil, nil, err
 	}
 
-	// 获取版本列表
-	versions, err := s.fileVersionRepo.FindByFileID(fileID)
+	data, err := s.thumbnails.Get(ctx, file, width, height)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file versions: %w", err)
+		return nil, nil, err
 	}
+	return data, file, nil
+}
 
-	return versions, nil
+// SupportsThumbnail 检查文件是否可以生成缩略图
+func (s *FileService) SupportsThumbnail(file *models.File) bool {
+	return s.thumbnails.Supports(file)
 }
 
-// RestoreFileVersion 恢复文件版本
-func (s *FileService) RestoreFileVersion(
+// restoreVersionContent 将文件当前内容归档到版本存储，并用目标版本的内容覆盖当前文件
+// 返回当前内容归档后的版本键
+func (s *FileService) restoreVersionContent(
+	ctx context.Context,
+	file *models.File,
+	target *models.FileVersion,
+) (string, error) {
+	versionKey, err := s.archiveVersion(ctx, file)
+	if err != nil {
+		return "", err
+	}
+
+	// 目标为当前版本时，其内容已在刚归档的版本键中
+	source := *target
+	if target.VersionNumber == file.Version {
+		source.StoragePath = versionKey
+	}
+
+	// 未归档的历史版本没有独立内容，无法恢复
+	if !storage.IsVersionKey(source.StoragePath) {
+		s.versionStorage.Delete(ctx, versionKey)
+		return "", newError(ErrVersionNotFound, "version content not available")
+	}
+
+	reader, err := s.openVersion(ctx, file, &source)
+	if err != nil {
+		s.versionStorage.Delete(ctx, versionKey)
+		return "", err
+	}
+	defer reader.Close()
+
+	currentKey := fileKey(file)
+	if err := s.storage.Save(ctx, currentKey, reader, target.FileSize); err != nil {
+		s.versionStorage.Delete(ctx, versionKey)
+		return "", err
+	}
+
+	return versionKey, nil
+}
+
+// DownloadFileVersion 下载文件的指定历史版本
+func (s *FileService) DownloadFileVersion(
 	ctx *gin.Context,
 	userID uuid.UUID,
 	fileID uuid.UUID,
 	versionNumber int,
-) (*models.File, error) {
+) (io.ReadCloser, *models.File, *models.FileVersion, error) {
 	// 获取文件
 	file, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+		return nil, nil, nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
 	// 检查权限
-	if file.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+	if err := s.authorizeFile(userID, file, models.SpaceRoleViewer); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// 获取指定版本
 	version, err := s.fileVersionRepo.FindByVersion(fileID, versionNumber)
 	if err != nil {
-		return nil, fmt.Errorf("version not found: %w", err)
+		return nil, nil, nil, fmt.Errorf("%w: %w", ErrVersionNotFound, err)
 	}
 
-	// 创建新版本记录
-	newVersion := &models.FileVersion{
-		FileID:        fileID,
-		VersionNumber: file.Version + 1,
-		FileSize:      file.Size,
-		FileHash:      file.Hash,
-		StoragePath:   file.Path,
-		MimeType:      file.MimeType,
-		CreatedBy:     userID,
+	// 获取版本内容
+	reader, err := s.openVersion(ctx, file, version)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get version file: %w", err)
 	}
 
-	// 在事务中恢复
-	tx := s.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			panic(r)
-		}
-	}()
+	return reader, file, version, nil
+}
 
-	// 保存当前版本
-	if err := s.fileVersionRepo.Create(newVersion); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to save current version: %w", err)
+// GetFilePermissions 获取文件的授权列表，仅文件所有者（空间文件为空间管理员）可查看
+func (s *FileService) GetFilePermissions(userID, fileID uuid.UUID) ([]models.FilePermission, error) {
+	if _, err := s.getFileForGrant(userID, fileID); err != nil {
+		return nil, err
 	}
 
-	// 从指定版本恢复文件内容
-	srcStorageKey := version.StoragePath
-	dstStorageKey := storage.GenerateFileKey(userID, file.Path)
+	permissions, err := s.permissionRepo.FindByFile(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file permissions: %w", err)
+	}
+	return permissions, nil
+}
 
-	reader, err := s.storage.Get(ctx, srcStorageKey)
+// GrantFilePermission 按用户名向指定用户授予文件权限，已有授权时更新权限
+func (s *FileService) GrantFilePermission(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	req models.FilePermissionRequest,
+) (*models.FilePermission, error) {
+	file, err := s.getFileForGrant(userID, fileID)
 	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to get version file: %w", err)
+		return nil, err
 	}
-	defer reader.Close()
 
-	if err := s.storage.Save(ctx, dstStorageKey, reader, version.FileSize); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to restore file: %w", err)
+	grantee, err := s.userRepo.FindByUsername(req.Username)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+	if grantee.ID == file.UserID {
+		return nil, newError(ErrInvalidArgument, "cannot grant permissions to the file owner")
 	}
 
-	// 更新文件信息
-	updates := map[string]interface{}{
-		"size":         version.FileSize,
-		"mime_type":    version.MimeType,
-		"hash":         version.FileHash,
-		"version":      file.Version + 1,
-		"storage_path": version.StoragePath,
+	permission := &models.FilePermission{
+		FileID:        fileID,
+		GranteeUserID: grantee.ID,
+		Permission:    req.Permission,
+		GrantedBy:     userID,
+	}
+	if err := s.permissionRepo.Upsert(permission); err != nil {
+		return nil, fmt.Errorf("failed to grant file permission: %w", err)
 	}
 
-	if err := s.fileRepo.UpdateWithTx(tx, fileID, updates); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to update file: %w", err)
+	s.logService.LogOperation(ctx, userID, models.OperationFileShare, models.ResourceTypeFile, &fileID,
+		map[string]interface{}{
+			"grantee":    grantee.Username,
+			"permission": req.Permission,
+		}, models.OperationSuccess, "")
+
+	granted, err := s.permissionRepo.Find(fileID, grantee.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload file permission: %w", err)
 	}
+	granted.Grantee = *grantee
+	return granted, nil
+}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+// RevokeFilePermission 撤销用户的文件权限
+func (s *FileService) RevokeFilePermission(ctx *gin.Context, userID, fileID, granteeUserID uuid.UUID) error {
+	if _, err := s.getFileForGrant(userID, fileID); err != nil {
+		return err
 	}
 
-	// 重新加载文件信息
-	return s.fileRepo.FindByID(fileID)
+	deleted, err := s.permissionRepo.Delete(fileID, granteeUserID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke file permission: %w", err)
+	}
+	if deleted == 0 {
+		return newError(ErrUserNotFound, "user has no permission on this file")
+	}
+
+	s.logService.LogOperation(ctx, userID, models.OperationFileUnshare, models.ResourceTypeFile, &fileID,
+		map[string]interface{}{
+			"grantee_user_id": granteeUserID,
+		}, models.OperationSuccess, "")
+	return nil
+}
+
+// getFileForGrant 获取文件并检查用户可以管理其授权
+func (s *FileService) getFileForGrant(userID, fileID uuid.UUID) (*models.File, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if err := s.authorizeFile(userID, file, models.SpaceRoleAdmin); err != nil {
+		return nil, err
+	}
+	return file, nil
 }
 
-// SearchFiles 搜索文件
+// SearchFiles 搜索文件，查询受DB_SEARCH_TIMEOUT_MS限制
+// 路径搜索按Path前缀匹配（支持*通配，如 projects/2024/*），结果附带从根目录开始的上级目录
 func (s *FileService) SearchFiles(
+	ctx context.Context,
 	userID uuid.UUID,
 	query string,
 	searchIn string,
 	page, pageSize int,
-) ([]models.File, int64, error) {
+) ([]models.FileSearchHit, int64, error) {
 	// 构建搜索条件
 	filter := models.FileFilter{
 		UserID:   &userID,
@@ -930,36 +3431,122 @@ func (s *FileService) SearchFiles(
 	case "name":
 		filter.Name = &query
 	case "path":
-		// 路径搜索需要特殊处理
-		// 这里简化实现
-		filter.Name = &query
+		pattern := pathSearchPattern(query)
+		filter.PathPattern = &pattern
+		filter.Recursive = true
 	case "content":
-		// 内容搜索需要全文索引，这里简化实现
-		filter.Name = &query
+		// 在提取的文本中全文搜索；未启用文本提取时退化为名称搜索
+		if s.textService.Enabled() {
+			filter.Content = &query
+			filter.Recursive = true
+		} else {
+			filter.Name = &query
+		}
 	}
 
+	ctx, cancel := queryContext(ctx, s.cfg.Database.SearchTimeout)
+	defer cancel()
+	fileRepo := s.fileRepo.WithContext(ctx)
+
 	// 搜索文件
-	files, err := s.fileRepo.FindAll(filter)
+	files, err := fileRepo.FindAll(filter)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search files: %w", err)
+		return nil, 0, queryError(err, "failed to search files")
 	}
 
 	// 获取总数
-	total, err := s.fileRepo.Count(filter)
+	total, err := fileRepo.Count(filter)
+	if err != nil {
+		return nil, 0, queryError(err, "failed to count search results")
+	}
+
+	if searchIn != "path" {
+		hits := make([]models.FileSearchHit, 0, len(files))
+		for _, file := range files {
+			hits = append(hits, models.FileSearchHit{File: file})
+		}
+		return hits, total, nil
+	}
+
+	hits, err := s.resolveSearchPaths(fileRepo, files, query)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+		return nil, 0, queryError(err, "failed to resolve search results")
+	}
+	return hits, total, nil
+}
+
+// resolveSearchPaths 按parent_id逐级加载每个结果的上级目录；Path与上级目录不一致（移动后未更新）时
+// 以按上级目录重新计算的路径为准，不再匹配查询的结果被排除
+func (s *FileService) resolveSearchPaths(
+	fileRepo repositories.FileRepository,
+	files []models.File,
+	query string,
+) ([]models.FileSearchHit, error) {
+	matcher := pathSearchMatcher(query)
+
+	hits := make([]models.FileSearchHit, 0, len(files))
+	for _, file := range files {
+		chain, err := fileRepo.GetFileAncestors(file.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 上级目录已删除
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(chain))
+		for _, entry := range chain {
+			names = append(names, entry.Name)
+		}
+		if actual := strings.Join(names, "/"); actual != file.Path {
+			if !matcher.MatchString(actual) {
+				continue
+			}
+			file.Path = actual
+		}
+
+		hits = append(hits, models.FileSearchHit{File: file, Ancestors: chain[:len(chain)-1]})
 	}
+	return hits, nil
+}
+
+// normalizeSearchPath 去掉路径查询首尾的斜杠，不含*时按前缀匹配
+func normalizeSearchPath(query string) string {
+	query = strings.Trim(strings.TrimSpace(query), "/")
+	if !strings.Contains(query, "*") {
+		query += "*"
+	}
+	return query
+}
 
-	return files, total, nil
+// pathSearchPattern 将路径查询转换为ILIKE模式，*匹配任意字符
+func pathSearchPattern(query string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(normalizeSearchPath(query))
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// pathSearchMatcher 返回与pathSearchPattern等价的正则表达式，用于校验重新计算的路径
+func pathSearchMatcher(query string) *regexp.Regexp {
+	parts := strings.Split(normalizeSearchPath(query), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("(?is)^" + strings.Join(parts, ".*") + "$")
 }
 
-// GetFileStats 获取文件统计信息
+// GetFileStats 获取文件统计信息，包括按MIME分类的明细（不含回收站中的文件）
 func (s *FileService) GetFileStats(userID uuid.UUID) (*models.FileStats, error) {
-	stats := &models.FileStats{}
+	stats, err := s.fileRepo.GetUserFileStats(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
 
-	// 获取用户文件统计
-	// 这里需要实现具体的统计查询
-	// 暂时返回空数据
+	// 按MIME分类统计
+	stats.ByCategory, err = s.fileRepo.GetCategoryBreakdown(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category breakdown: %w", err)
+	}
 
 	return stats, nil
 }
@@ -997,12 +3584,12 @@ func (s *FileService) RestoreRecycledFile(
 	// 获取文件（包括已删除的）
 	file, err := s.fileRepo.FindByIDIncludingDeleted(fileID)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
 	// 检查权限
-	if file.UserID != userID {
-		return fmt.Errorf("permission denied")
+	if err := s.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return err
 	}
 
 	// 恢复文件
@@ -1039,56 +3626,266 @@ func (s *FileService) CleanupRecycledFiles(
 
 // 辅助方法
 
-// isDescendant 检查一个文件是否是另一个文件的后代
-func (s *FileService) isDescendant(fileID, potentialAncestorID uuid.UUID) bool {
-	if fileID == potentialAncestorID {
-		return true
+// authorizeFile 检查用户对文件的权限：个人文件仅所有者可访问，空间文件按成员角色判断
+func (s *FileService) authorizeFile(userID uuid.UUID, file *models.File, role models.SpaceRole) error {
+	if file.SpaceID == nil {
+		if file.UserID != userID {
+			return ErrPermissionDenied
+		}
+		return nil
 	}
+	return s.authorizeSpace(userID, *file.SpaceID, role)
+}
 
-	// 获取文件的父目录
-	file, err := s.fileRepo.FindByID(fileID)
-	if err != nil {
-		return false
+// authorizeSpace 检查用户在空间中的角色是否具备role的权限
+func (s *FileService) authorizeSpace(userID, spaceID uuid.UUID, role models.SpaceRole) error {
+	member, err := s.spaceRepo.FindMember(spaceID, userID)
+	if err != nil || !member.Role.Allows(role) {
+		return ErrPermissionDenied
 	}
+	return nil
+}
 
-	if file.ParentID == nil {
-		return false
+// authorizeGranted 在authorizeFile的基础上，允许被直接授予文件权限的用户访问
+func (s *FileService) authorizeGranted(
+	userID uuid.UUID,
+	file *models.File,
+	role models.SpaceRole,
+	permission models.FilePermissionLevel,
+) error {
+	err := s.authorizeFile(userID, file, role)
+	if err != nil && s.hasGrant(userID, file, permission) {
+		return nil
 	}
+	return err
+}
 
-	// 递归检查父目录
-	return s.isDescendant(*file.ParentID, potentialAncestorID)
+// hasGrant 检查用户是否被直接授予了文件的permission权限
+func (s *FileService) hasGrant(userID uuid.UUID, file *models.File, permission models.FilePermissionLevel) bool {
+	grant, err := s.permissionRepo.Find(file.ID, userID)
+	return err == nil && grant.Permission.Allows(permission)
 }
 
-// updateDescendantPaths 更新后代文件的路径
-func (s *FileService) updateDescendantPaths(tx *gorm.DB, directory *models.File) error {
-	// 获取所有子文件
-	filter := models.FileFilter{
-		UserID:   &directory.UserID,
-		ParentID: &directory.ID,
-		Deleted:  &[]bool{false}[0],
+// canWrite 检查用户能否修改文件内容：文件所有者、空间编辑者或被授予写权限的用户
+func (s *FileService) canWrite(userID uuid.UUID, file *models.File) bool {
+	return s.authorizeFile(userID, file, models.SpaceRoleEditor) == nil || s.hasGrant(userID, file, models.FilePermissionWrite)
+}
+
+// resolveParent 检查用户可以在父目录下创建文件，返回新文件所属的空间
+// parentID为空时在个人根目录创建，指定spaceID时在该空间的根目录创建
+func (s *FileService) resolveParent(userID uuid.UUID, parentID, spaceID *uuid.UUID) (*uuid.UUID, error) {
+	if parentID == nil {
+		if spaceID != nil {
+			if err := s.authorizeSpace(userID, *spaceID, models.SpaceRoleEditor); err != nil {
+				return nil, err
+			}
+		}
+		return spaceID, nil
+	}
+
+	parent, err := s.fileRepo.FindByID(*parentID)
+	if err != nil || parent.Type != models.FileTypeDir {
+		return nil, ErrInvalidTarget
+	}
+	if spaceID != nil && (parent.SpaceID == nil || *parent.SpaceID != *spaceID) {
+		return nil, newError(ErrInvalidTarget, "parent directory does not belong to the space")
+	}
+	if err := s.authorizeFile(userID, parent, models.SpaceRoleEditor); err != nil {
+		return nil, err
+	}
+	return parent.SpaceID, nil
+}
+
+// checkMoveTarget 检查文件可以移动到目标目录，文件不能在个人文件和空间之间或不同空间之间移动
+func (s *FileService) checkMoveTarget(userID uuid.UUID, file, targetDir *models.File) error {
+	if !sameSpace(file.SpaceID, targetDir.SpaceID) {
+		return newError(ErrInvalidTarget, "cannot move files between spaces")
 	}
+	return s.authorizeFile(userID, targetDir, models.SpaceRoleEditor)
+}
 
-	childFiles, err := s.fileRepo.FindAllWithTx(tx, filter)
+// childPath 返回目录parentID下名为name的文件路径，parentID为nil时位于根目录
+func (s *FileService) childPath(parentID *uuid.UUID, name string) (string, error) {
+	if parentID == nil {
+		return name, nil
+	}
+	parent, err := s.fileRepo.FindByID(*parentID)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+	}
+	return path.Join(parent.Path, name), nil
+}
+
+// findSibling 查找目录下的同名文件，空间内按空间查找，个人目录按用户查找
+func (s *FileService) findSibling(userID uuid.UUID, spaceID, parentID *uuid.UUID, name string) (*models.File, error) {
+	name = s.normalizeName(name)
+	if spaceID != nil {
+		return s.fileRepo.FindBySpaceAndName(*spaceID, parentID, name)
+	}
+	return s.fileRepo.FindByUserAndName(userID, parentID, name)
+}
+
+// validName 检查重命名的新文件名：不能包含路径分隔符，其余按sanitizeName清理
+func (s *FileService) validName(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return "", newError(ErrInvalidArgument, "file name cannot contain path separators")
+	}
+	return s.sanitizeName(name)
+}
+
+// sanitizeName 按配置规范化客户端提交的文件名后用models.SanitizeFileName清理，无效或保留的文件名返回ErrInvalidArgument
+func (s *FileService) sanitizeName(name string) (string, error) {
+	sanitized, err := models.SanitizeFileName(s.normalizeName(name))
+	if err != nil {
+		return "", newError(ErrInvalidArgument, err.Error())
+	}
+	return sanitized, nil
+}
+
+// normalizeName 按配置对文件名做Unicode规范化，使macOS（NFD）等客户端提交的同名文件能被识别为重名
+// 创建、上传、重命名和复制时在保存和查重前调用
+func (s *FileService) normalizeName(name string) string {
+	if s.cfg.Storage.NameNormalization == "nfc" {
+		return norm.NFC.String(name)
+	}
+	return name
+}
+
+// scopeFilter 将列表查询限定在用户的个人文件，或用户有权浏览的空间
+// 指定空间或父目录位于空间时按空间查询，不限制文件所有者
+func (s *FileService) scopeFilter(userID uuid.UUID, filter *models.FileFilter) error {
+	if filter.SpaceID == nil && filter.ParentID != nil {
+		parent, err := s.fileRepo.FindByID(*filter.ParentID)
+		if err == nil && parent.SpaceID != nil {
+			filter.SpaceID = parent.SpaceID
+		}
 	}
 
-	// 递归更新子文件路径
-	for _, childFile := range childFiles {
-		// 更新路径（GORM的BeforeUpdate钩子会自动处理）
-		if err := tx.Save(&childFile).Error; err != nil {
+	if filter.SpaceID != nil {
+		if err := s.authorizeSpace(userID, *filter.SpaceID, models.SpaceRoleViewer); err != nil {
 			return err
 		}
+		filter.UserID = nil
+		return nil
+	}
 
-		// 如果子文件是目录，递归更新
-		if childFile.Type == models.FileTypeDir {
-			if err := s.updateDescendantPaths(tx, &childFile); err != nil {
-				return err
+	filter.UserID = &userID
+	filter.PersonalOnly = true
+	return nil
+}
+
+// sameSpace 判断两个文件是否属于同一空间（或都是个人文件）
+func sameSpace(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// isDescendant 检查fileID是否是potentialAncestorID本身或其后代，沿父目录向上查找，最多查找MaxTreeDepth层
+func (s *FileService) isDescendant(fileID, potentialAncestorID uuid.UUID) (bool, error) {
+	maxDepth := s.cfg.Storage.MaxTreeDepth
+	visited := make(map[uuid.UUID]bool)
+
+	current := fileID
+	for depth := 0; ; depth++ {
+		if current == potentialAncestorID {
+			return true, nil
+		}
+		if visited[current] {
+			return false, newError(ErrInvalidTarget, "directory hierarchy contains a cycle")
+		}
+		if maxDepth > 0 && depth > maxDepth {
+			return false, newError(ErrTreeTooLarge, fmt.Sprintf("directory tree exceeds the maximum depth of %d", maxDepth))
+		}
+		visited[current] = true
+
+		// 获取文件的父目录
+		file, err := s.fileRepo.FindByID(current)
+		if err != nil || file.ParentID == nil {
+			return false, nil
+		}
+		current = *file.ParentID
+	}
+}
+
+// updateDescendantPaths 由浅到深逐层更新后代文件的路径
+func (s *FileService) updateDescendantPaths(tx *gorm.DB, directory *models.File, dirPath string) ([]keyMove, error) {
+	levels, err := s.walkTree(tx, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐层由父目录的新路径推导子文件的路径
+	paths := map[uuid.UUID]string{directory.ID: dirPath}
+	var moves []keyMove
+	for _, level := range levels {
+		for i := range level {
+			child := &level[i]
+			childPath := path.Join(paths[*child.ParentID], child.Name)
+			paths[child.ID] = childPath
+			if childPath == child.Path {
+				continue
+			}
+
+			if err := tx.Model(&models.File{}).Where("id = ?", child.ID).
+				UpdateColumn("path", childPath).Error; err != nil {
+				return nil, err
+			}
+			childMoves, err := s.repathEntryWithTx(tx, child, child.Path, childPath)
+			if err != nil {
+				return nil, err
 			}
+			moves = append(moves, childMoves...)
 		}
 	}
 
-	return nil
+	return moves, nil
+}
+
+// walkTree 逐层批量加载目录下所有未删除的后代，levels[0]为直接子文件
+// 超过MaxTreeDepth或MaxTreeNodes时返回ErrTreeTooLarge，避免超大目录树长时间占用事务
+func (s *FileService) walkTree(tx *gorm.DB, root *models.File) ([][]models.File, error) {
+	maxDepth, maxNodes := s.cfg.Storage.MaxTreeDepth, s.cfg.Storage.MaxTreeNodes
+
+	var levels [][]models.File
+	visited := map[uuid.UUID]bool{root.ID: true}
+	parentIDs := []uuid.UUID{root.ID}
+	count := 0
+	for depth := 1; len(parentIDs) > 0; depth++ {
+		var level []models.File
+		for start := 0; start < len(parentIDs); start += treeBatchSize {
+			end := min(start+treeBatchSize, len(parentIDs))
+			children, err := s.fileRepo.FindChildrenWithTx(tx, parentIDs[start:end])
+			if err != nil {
+				return nil, err
+			}
+			level = append(level, children...)
+		}
+		if len(level) == 0 {
+			break
+		}
+
+		if maxDepth > 0 && depth > maxDepth {
+			return nil, newError(ErrTreeTooLarge, fmt.Sprintf("directory tree exceeds the maximum depth of %d", maxDepth))
+		}
+		count += len(level)
+		if maxNodes > 0 && count > maxNodes {
+			return nil, newError(ErrTreeTooLarge, fmt.Sprintf("directory tree exceeds the maximum of %d files", maxNodes))
+		}
+
+		var next []uuid.UUID
+		for _, file := range level {
+			if file.Type == models.FileTypeDir && !visited[file.ID] {
+				visited[file.ID] = true
+				next = append(next, file.ID)
+			}
+		}
+		levels = append(levels, level)
+		parentIDs = next
+	}
+
+	return levels, nil
 }
 
 // GetStorageUsage 获取存储使用情况
@@ -1101,18 +3898,419 @@ func (s *FileService) GetStorageUsage(userID uuid.UUID) (int64, int64, error) {
 	return user.UsedStorage, user.StorageQuota, nil
 }
 
-// GenerateShareToken 生成分享令牌
+// GetAccountSummary 汇总用户的配额、用量、文件统计及上传限制，供概览页一次获取
+// 分享统计由调用方通过ShareService补充
+func (s *FileService) GetAccountSummary(userID uuid.UUID) (*models.AccountSummary, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	fileStats, err := s.fileRepo.GetUserFileStats(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file stats: %w", err)
+	}
+
+	warningPercent := s.quotaWarningPercent()
+	summary := &models.AccountSummary{
+		Username:     user.Username,
+		Role:         string(user.Role),
+		Quota:        user.StorageQuota,
+		Used:         user.UsedStorage,
+		Available:    max(user.StorageQuota-user.UsedStorage, 0),
+		UsagePercent: models.UsagePercent(user.UsedStorage, user.StorageQuota),
+		WarningLevel: models.QuotaLevel(user.UsedStorage, user.StorageQuota, warningPercent),
+		Files:        *fileStats,
+		Limits: models.AccountLimits{
+			MaxUploadSize:       s.cfg.Storage.MaxUploadSize,
+			QuotaWarningPercent: warningPercent,
+		},
+	}
+
+	return summary, nil
+}
+
+// GetDuplicateReport 按内容哈希查找用户的重复文件，按可释放空间从大到小排列；只包含上传时计算过哈希的文件
+func (s *FileService) GetDuplicateReport(userID uuid.UUID) (*models.DuplicateReport, error) {
+	duplicates, err := s.fileRepo.GetDuplicateFiles(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate files: %w", err)
+	}
+
+	report := &models.DuplicateReport{Groups: make([]models.DuplicateGroup, 0, len(duplicates))}
+	for hash, files := range duplicates {
+		group := models.DuplicateGroup{
+			Hash:        hash,
+			Size:        files[0].Size,
+			Files:       make([]models.FileResponse, 0, len(files)),
+			Reclaimable: files[0].Size * int64(len(files)-1),
+		}
+		for i := range files {
+			group.Files = append(group.Files, files[i].ToResponse())
+		}
+
+		report.Groups = append(report.Groups, group)
+		report.DuplicateFiles += len(files) - 1
+		report.TotalReclaimable += group.Reclaimable
+	}
+
+	slices.SortFunc(report.Groups, func(a, b models.DuplicateGroup) int {
+		if c := cmp.Compare(b.Reclaimable, a.Reclaimable); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Hash, b.Hash)
+	})
+
+	return report, nil
+}
+
+// DedupFiles 提交清理重复文件的后台任务，每组保留一份，任务结果为DuplicateDedupResult
+func (s *FileService) DedupFiles(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	req models.DuplicateDedupRequest,
+) (*models.Job, error) {
+	logCtx := ctx.Copy()
+	return s.jobs.Submit(userID, models.JobTypeFileDedup, func(jobCtx context.Context, progress JobProgress) (interface{}, error) {
+		return s.dedupFiles(jobCtx, logCtx, userID, req, progress)
+	})
+}
+
+// dedupFiles 每个重复组保留一份，删除其余副本（默认移入回收站），单个文件删除失败不影响其他文件
+// 任务取消时停止删除，已删除的文件不恢复
+func (s *FileService) dedupFiles(
+	ctx context.Context,
+	logCtx *gin.Context,
+	userID uuid.UUID,
+	req models.DuplicateDedupRequest,
+	progress JobProgress,
+) (*models.DuplicateDedupResult, error) {
+	duplicates, err := s.fileRepo.GetDuplicateFiles(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find duplicate files: %w", err)
+	}
+
+	if len(req.Hashes) > 0 {
+		selected := make(map[string][]models.File, len(req.Hashes))
+		for _, hash := range req.Hashes {
+			if files, ok := duplicates[hash]; ok {
+				selected[hash] = files
+			}
+		}
+		duplicates = selected
+	}
+
+	keep := make(map[uuid.UUID]bool, len(req.KeepIDs))
+	for _, id := range req.KeepIDs {
+		keep[id] = true
+	}
+
+	var total, done int64
+	for _, files := range duplicates {
+		total += int64(len(files) - 1)
+	}
+
+	result := &models.DuplicateDedupResult{
+		Removed:   []uuid.UUID{},
+		Permanent: req.Permanent,
+	}
+	for _, files := range duplicates {
+		// 默认保留最早创建的文件
+		kept := 0
+		for i := range files {
+			if keep[files[i].ID] {
+				kept = i
+				break
+			}
+		}
+
+		result.Groups++
+		for i := range files {
+			if i == kept {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := s.DeleteFile(logCtx, userID, files[i].ID, req.Permanent); err != nil {
+				log.Printf("Failed to remove duplicate file %s: %v", files[i].ID, err)
+				result.Failed = append(result.Failed, files[i].ID)
+			} else {
+				result.Removed = append(result.Removed, files[i].ID)
+				result.Reclaimed += files[i].Size
+			}
+			done++
+			progress(done, total)
+		}
+	}
+
+	return result, nil
+}
+
+// GetCategoryUsage 获取各MIME分类的使用量和子配额（同一文件可能计入多个分类），查询受DB_STATS_TIMEOUT_MS限制
+func (s *FileService) GetCategoryUsage(ctx context.Context, userID uuid.UUID) ([]models.CategoryUsage, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	categories := make([]string, 0, len(models.MimeCategories))
+	for category := range models.MimeCategories {
+		categories = append(categories, category)
+	}
+	slices.Sort(categories)
+
+	ctx, cancel := queryContext(ctx, s.cfg.Database.StatsTimeout)
+	defer cancel()
+	fileRepo := s.fileRepo.WithContext(ctx)
+
+	usage := make([]models.CategoryUsage, 0, len(categories))
+	for _, category := range categories {
+		used, err := fileRepo.GetCategoryUsage(userID, category)
+		if err != nil {
+			return nil, queryError(err, fmt.Sprintf("failed to get %s usage", category))
+		}
+
+		item := models.CategoryUsage{Category: category, Used: used}
+		if quota, ok := user.CategoryQuotas[category]; ok {
+			available := max(quota-used, 0)
+			item.Quota = quota
+			item.Available = &available
+		}
+		usage = append(usage, item)
+	}
+
+	return usage, nil
+}
+
+// GenerateShareToken 生成文件的分享令牌
 func (s *FileService) GenerateShareToken(fileID uuid.UUID) (string, error) {
-	// 生成随机令牌
-	token := uuid.New().String()
-	token = strings.ReplaceAll(token, "-", "")[:32]
+	return generateShareToken(s.fileRepo.ShareTokenExists)
+}
 
-	// 检查令牌是否唯一（概率极低，但需要检查）
-	existingFile, err := s.fileRepo.FindByShareToken(token)
-	if err == nil && existingFile != nil {
-		// 如果冲突，重新生成
-		return s.GenerateShareToken(fileID)
+// BackfillDetectedMime 提交后台任务，为上线内容嗅探前上传的文件补充detected_mime
+func (s *FileService) BackfillDetectedMime(adminID uuid.UUID) (*models.Job, error) {
+	return s.jobs.Submit(adminID, models.JobTypeDetectMime, s.backfillDetectedMime)
+}
+
+// backfillDetectedMime 按ID顺序分批读取文件开头的内容并写入嗅探结果，读取失败的文件跳过
+func (s *FileService) backfillDetectedMime(ctx context.Context, progress JobProgress) (interface{}, error) {
+	total, err := s.fileRepo.CountWithoutDetectedMime()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	result := &models.MimeBackfillResult{}
+	var done int64
+	lastID := uuid.Nil
+	for {
+		files, err := s.fileRepo.FindWithoutDetectedMime(lastID, treeBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files: %w", err)
+		}
+		if len(files) == 0 {
+			return result, nil
+		}
+
+		for i := range files {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			file := &files[i]
+			lastID = file.ID
+			done++
+
+			detected, err := s.detectStoredMime(ctx, file)
+			if err == nil {
+				err = s.fileRepo.SetDetectedMime(file.ID, detected)
+			}
+			if err != nil {
+				log.Printf("Failed to detect MIME type of file %s: %v", file.ID, err)
+				result.Failed = append(result.Failed, file.ID)
+				progress(done, total)
+				continue
+			}
+
+			result.Detected++
+			if !strings.EqualFold(strings.TrimSpace(strings.SplitN(file.MimeType, ";", 2)[0]), detected) {
+				result.Mismatched++
+			}
+			s.publicCache.invalidate(file.ID)
+			progress(done, total)
+		}
+	}
+}
+
+// BackfillHashes 提交后台任务，为上线哈希计算前上传的文件补充SHA-256，使重复文件检测覆盖这些文件
+func (s *FileService) BackfillHashes(adminID uuid.UUID) (*models.Job, error) {
+	return s.jobs.Submit(adminID, models.JobTypeFileHash, s.backfillHashes)
+}
+
+// backfillHashes 按ID顺序分批读取文件内容并写入哈希，读取失败的文件跳过
+func (s *FileService) backfillHashes(ctx context.Context, progress JobProgress) (interface{}, error) {
+	total, err := s.fileRepo.CountWithoutHash()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	result := &models.HashBackfillResult{}
+	var done int64
+	lastID := uuid.Nil
+	for {
+		files, err := s.fileRepo.FindWithoutHash(lastID, treeBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files: %w", err)
+		}
+		if len(files) == 0 {
+			return result, nil
+		}
+
+		for i := range files {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			file := &files[i]
+			lastID = file.ID
+			done++
+
+			hash, err := s.hashStoredContent(ctx, file)
+			if err == nil {
+				err = s.fileRepo.SetHash(file, hash)
+			}
+			if err != nil {
+				log.Printf("Failed to compute hash of file %s: %v", file.ID, err)
+				result.Failed = append(result.Failed, file.ID)
+				progress(done, total)
+				continue
+			}
+
+			result.Computed++
+			s.publicCache.invalidate(file.ID)
+			progress(done, total)
+		}
+	}
+}
+
+// PhysicalStorageStats 获取文件存储（以及单独配置的历史版本存储）的物理使用情况，单个存储获取失败时记录在其Error中
+func (s *FileService) PhysicalStorageStats(ctx context.Context) []models.PhysicalStorageStats {
+	names := []string{models.StorageStoreFiles}
+	stores := []storage.Storage{s.storage}
+	if s.versionStorage != s.storage {
+		names = append(names, models.StorageStoreVersions)
+		stores = append(stores, s.versionStorage)
+	}
+
+	result := make([]models.PhysicalStorageStats, 0, len(stores))
+	for i, store := range stores {
+		entry := models.PhysicalStorageStats{Store: names[i], Type: string(store.Type())}
+		stats, err := store.StorageStats(ctx)
+		if err != nil {
+			log.Printf("Failed to get %s storage stats: %v", names[i], err)
+			entry.Error = err.Error()
+		} else {
+			entry.TotalBytes, entry.UsedBytes, entry.FreeBytes = stats.Total, stats.Used, stats.Free
+			if stats.Objects >= 0 {
+				objects := stats.Objects
+				entry.Objects = &objects
+			}
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// RecalculateUsedStorage 按用户创建的全部文件（包括回收站中的文件，它们在永久删除前仍占用配额）
+// 的大小之和重写已使用存储，修复增减计数的漂移；在锁定用户的事务中完成，期间的上传和删除会等待
+func (s *FileService) RecalculateUsedStorage(userID uuid.UUID) (*models.StorageRecalculation, error) {
+	var result *models.StorageRecalculation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		user, err := s.userRepo.FindByIDForUpdate(tx, userID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		actual, err := s.fileRepo.SumUserFileSizeWithTx(tx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to sum file sizes: %w", err)
+		}
+
+		if actual != user.UsedStorage {
+			if err := s.userRepo.UpdateWithTx(tx, userID, map[string]interface{}{"used_storage": actual}); err != nil {
+				return fmt.Errorf("failed to update used storage: %w", err)
+			}
+		}
+
+		result = &models.StorageRecalculation{
+			UserID:     user.ID,
+			Username:   user.Username,
+			OldUsed:    user.UsedStorage,
+			NewUsed:    actual,
+			Difference: actual - user.UsedStorage,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RecalculateAllUsedStorage 提交后台任务，重新计算所有用户的已使用存储
+func (s *FileService) RecalculateAllUsedStorage(adminID uuid.UUID) (*models.Job, error) {
+	return s.jobs.Submit(adminID, models.JobTypeRecalculateStorage, s.recalculateAllUsedStorage)
+}
+
+// recalculateAllUsedStorage 按ID顺序分批逐个用户重新计算已使用存储，失败的用户跳过
+func (s *FileService) recalculateAllUsedStorage(ctx context.Context, progress JobProgress) (interface{}, error) {
+	total, err := s.userRepo.Count(models.UserFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	summary := &models.StorageRecalculationSummary{}
+	lastID := uuid.Nil
+	for {
+		ids, err := s.userRepo.FindIDsAfter(lastID, treeBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get users: %w", err)
+		}
+		if len(ids) == 0 {
+			return summary, nil
+		}
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			lastID = id
+			summary.Checked++
+
+			result, err := s.RecalculateUsedStorage(id)
+			if err != nil {
+				log.Printf("Failed to recalculate used storage of user %s: %v", id, err)
+				summary.Failed = append(summary.Failed, id)
+			} else if result.Difference != 0 {
+				summary.Corrected = append(summary.Corrected, *result)
+			}
+			progress(int64(summary.Checked), total)
+		}
+	}
+}
+
+// hashStoredContent 读取存储中的文件内容计算SHA-256（十六进制）
+func (s *FileService) hashStoredContent(ctx context.Context, file *models.File) (string, error) {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return "", err
 	}
+	defer reader.Close()
 
-	return token, nil
+	hash := sha256.New()
+	if _, err := io.Copy(hash, contextReader{ctx: ctx, r: reader}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
@@ -1,10 +1,31 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
 )
 
 // TestGetFileByID_Success 测试成功获取文件
@@ -23,12 +44,21 @@ func TestCreateDirectory_Success(t *testing.T) {
 
 // TestGenerateShareToken 测试生成分享令牌
 func TestGenerateShareToken(t *testing.T) {
-	// 测试UUID生成
-	token1 := uuid.New().String()
-	token2 := uuid.New().String()
+	free := func(string) (bool, error) { return false, nil }
+	token1, err := generateShareToken(free)
+	assert.NoError(t, err)
+	token2, err := generateShareToken(free)
+	assert.NoError(t, err)
 
 	assert.NotEqual(t, token1, token2, "两次生成的令牌应该不同")
-	assert.Len(t, token1, 36, "UUID长度应为36个字符")
+	assert.Len(t, token1, 32, "令牌长度应为32个字符")
+	assert.Regexp(t, "^[0-9A-Za-z]+$", token1, "令牌应只包含base62字符")
+
+	// 令牌冲突时重试，始终冲突时有限次后返回错误
+	attempts := 0
+	_, err = generateShareToken(func(string) (bool, error) { attempts++; return true, nil })
+	assert.Error(t, err)
+	assert.Equal(t, shareTokenAttempts, attempts)
 }
 
 // TestFormatFileSize 测试文件大小格式化
@@ -63,4 +93,820 @@ func formatFileSize(size int64) string {
 	}
 	// 简化实现，实际应该使用fmt.Sprintf
 	return string(rune(size/div)) + " " + string("KMGTPE"[exp]) + "B"
-}
\ No newline at end of file
+}
+// TestRestoreVersionContent_RoundTrip 测试版本恢复往返：恢复旧版本后再恢复回来，内容保持一致
+func TestRestoreVersionContent_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	fileStorage, err := storage.NewLocalStorage(storage.StorageConfig{LocalPath: t.TempDir()})
+	require.NoError(t, err)
+	versionStorage, err := storage.NewLocalStorage(storage.StorageConfig{LocalPath: t.TempDir()})
+	require.NoError(t, err)
+
+	s := &FileService{storage: fileStorage, versionStorage: versionStorage}
+
+	userID := uuid.New()
+	file := &models.File{ID: uuid.New(), UserID: userID, Path: "docs/report.txt"}
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+
+	v1 := []byte("first version")
+	v2 := []byte("second version, longer")
+
+	// 版本1已归档，当前内容为版本2
+	v1Key := storage.GenerateVersionKey(userID, file.ID, 1)
+	require.NoError(t, versionStorage.Save(ctx, v1Key, bytes.NewReader(v1), int64(len(v1))))
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader(v2), int64(len(v2))))
+	file.Version = 2
+	file.Size = int64(len(v2))
+
+	// 恢复版本1，当前内容（版本2）应被归档
+	target := &models.FileVersion{FileID: file.ID, VersionNumber: 1, FileSize: int64(len(v1)), StoragePath: v1Key}
+	v2Key, err := s.restoreVersionContent(ctx, file, target)
+	require.NoError(t, err)
+	assert.Equal(t, storage.GenerateVersionKey(userID, file.ID, 2), v2Key)
+	assert.Equal(t, v1, readKey(t, fileStorage, fileKey))
+	assert.Equal(t, v2, readKey(t, versionStorage, v2Key))
+
+	// 恢复后生成版本3，再恢复版本2
+	file.Version = 3
+	file.Size = int64(len(v1))
+	target = &models.FileVersion{FileID: file.ID, VersionNumber: 2, FileSize: int64(len(v2)), StoragePath: v2Key}
+	v3Key, err := s.restoreVersionContent(ctx, file, target)
+	require.NoError(t, err)
+	assert.Equal(t, v2, readKey(t, fileStorage, fileKey))
+	assert.Equal(t, v1, readKey(t, versionStorage, v3Key))
+	assert.Equal(t, v1, readKey(t, versionStorage, v1Key))
+}
+
+// TestRestoreVersionContent_Unarchived 测试未归档的版本无法恢复且不覆盖当前内容
+func TestRestoreVersionContent_Unarchived(t *testing.T) {
+	ctx := context.Background()
+
+	fileStorage, err := storage.NewLocalStorage(storage.StorageConfig{LocalPath: t.TempDir()})
+	require.NoError(t, err)
+
+	s := &FileService{storage: fileStorage, versionStorage: fileStorage}
+
+	userID := uuid.New()
+	file := &models.File{ID: uuid.New(), UserID: userID, Path: "notes.txt", Version: 2}
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+	content := []byte("current")
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader(content), int64(len(content))))
+	file.Size = int64(len(content))
+
+	target := &models.FileVersion{FileID: file.ID, VersionNumber: 1, StoragePath: fileKey}
+	_, err = s.restoreVersionContent(ctx, file, target)
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+	assert.Equal(t, content, readKey(t, fileStorage, fileKey))
+
+	exists, err := fileStorage.Exists(ctx, storage.GenerateVersionKey(userID, file.ID, 2))
+	require.NoError(t, err)
+	assert.False(t, exists, "失败时应清理归档的版本")
+}
+
+// readKey 读取存储键的全部内容
+func readKey(t *testing.T, s storage.Storage, key string) []byte {
+	t.Helper()
+	reader, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return data
+}
+
+// treeFileRepository 内存中的文件仓库，只实现目录树操作用到的方法
+type treeFileRepository struct {
+	repositories.FileRepository
+	files    map[uuid.UUID]*models.File
+	deleted  []uuid.UUID
+	created  []*models.File
+	maxBatch int
+	// beforeUpdate 在按lock_version更新前调用，用于模拟并发的写入
+	beforeUpdate func()
+}
+
+func newTreeFileRepository() *treeFileRepository {
+	return &treeFileRepository{files: make(map[uuid.UUID]*models.File)}
+}
+
+// add 在parent下添加文件或目录，parent为nil时添加到根目录
+func (r *treeFileRepository) add(userID uuid.UUID, parent *models.File, name string, fileType models.FileType) *models.File {
+	file := &models.File{ID: uuid.New(), UserID: userID, Name: name, Path: name, Type: fileType}
+	if parent != nil {
+		file.ParentID = &parent.ID
+		file.Path = path.Join(parent.Path, name)
+	}
+	r.files[file.ID] = file
+	return file
+}
+
+func (r *treeFileRepository) FindByID(id uuid.UUID) (*models.File, error) {
+	file, ok := r.files[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *file
+	return &copied, nil
+}
+
+func (r *treeFileRepository) FindChildrenWithTx(tx *gorm.DB, parentIDs []uuid.UUID) ([]models.File, error) {
+	if len(parentIDs) > r.maxBatch {
+		r.maxBatch = len(parentIDs)
+	}
+	parents := make(map[uuid.UUID]bool, len(parentIDs))
+	for _, id := range parentIDs {
+		parents[id] = true
+	}
+	var children []models.File
+	for _, file := range r.files {
+		if file.ParentID != nil && parents[*file.ParentID] {
+			children = append(children, *file)
+		}
+	}
+	return children, nil
+}
+
+func (r *treeFileRepository) CreateWithTx(tx *gorm.DB, file *models.File) error {
+	file.ID = uuid.New()
+	file.Path = file.Name
+	if file.ParentID != nil {
+		file.Path = path.Join(r.files[*file.ParentID].Path, file.Name)
+	}
+	r.files[file.ID] = file
+	r.created = append(r.created, file)
+	return nil
+}
+
+func (r *treeFileRepository) DeleteWithTx(tx *gorm.DB, id uuid.UUID) error {
+	if _, ok := r.files[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.files, id)
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func (r *treeFileRepository) FindByUserAndName(userID uuid.UUID, parentID *uuid.UUID, name string) (*models.File, error) {
+	for _, file := range r.files {
+		sameParent := (file.ParentID == nil && parentID == nil) ||
+			(file.ParentID != nil && parentID != nil && *file.ParentID == *parentID)
+		if file.UserID == userID && file.Name == name && sameParent {
+			copied := *file
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *treeFileRepository) PathInUse(userID uuid.UUID, spaceID *uuid.UUID, path string) (bool, error) {
+	for _, file := range r.files {
+		if file.Path != path || !sameSpace(file.SpaceID, spaceID) {
+			continue
+		}
+		if spaceID != nil || file.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *treeFileRepository) UpdateWithTx(tx *gorm.DB, id uuid.UUID, updates map[string]interface{}) error {
+	file, ok := r.files[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if hash, ok := updates["hash"].(string); ok {
+		file.Hash = hash
+	}
+	return nil
+}
+
+func (r *treeFileRepository) LockIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64) (bool, error) {
+	file, ok := r.files[id]
+	return ok && file.LockVersion == lockVersion, nil
+}
+
+func (r *treeFileRepository) UpdateIfVersionWithTx(tx *gorm.DB, id uuid.UUID, lockVersion int64, updates map[string]interface{}) (bool, error) {
+	if r.beforeUpdate != nil {
+		r.beforeUpdate()
+	}
+	file, ok := r.files[id]
+	if !ok || file.LockVersion != lockVersion {
+		return false, nil
+	}
+	file.Size = updates["size"].(int64)
+	file.Hash = updates["hash"].(string)
+	file.Version = updates["version"].(int)
+	file.LockVersion++
+	return true, nil
+}
+
+// treeUserRepository 用户仓库，删除和上传文件时只需要按ID查找用户
+type treeUserRepository struct {
+	repositories.UserRepository
+}
+
+func (treeUserRepository) FindByIDWithTx(tx *gorm.DB, id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id}, nil
+}
+
+func (treeUserRepository) FindByID(id uuid.UUID) (*models.User, error) {
+	return &models.User{ID: id, StorageQuota: 1 << 20}, nil
+}
+
+// noopSQLDriver 不连接数据库的SQL驱动，执行语句总是成功、查询总是返回空结果
+type noopSQLDriver struct{}
+
+func (noopSQLDriver) Open(string) (driver.Conn, error)             { return noopSQLConn{}, nil }
+func (noopSQLDriver) Connect(context.Context) (driver.Conn, error) { return noopSQLConn{}, nil }
+func (d noopSQLDriver) Driver() driver.Driver                      { return d }
+
+type noopSQLConn struct{}
+
+func (noopSQLConn) Prepare(string) (driver.Stmt, error) { return noopSQLStmt{}, nil }
+func (noopSQLConn) Close() error                        { return nil }
+func (noopSQLConn) Begin() (driver.Tx, error)           { return noopSQLConn{}, nil }
+func (noopSQLConn) Commit() error                       { return nil }
+func (noopSQLConn) Rollback() error                     { return nil }
+
+type noopSQLStmt struct{}
+
+func (noopSQLStmt) Close() error                               { return nil }
+func (noopSQLStmt) NumInput() int                              { return -1 }
+func (noopSQLStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (noopSQLStmt) Query([]driver.Value) (driver.Rows, error)  { return noopSQLRows{}, nil }
+
+type noopSQLRows struct{}
+
+func (noopSQLRows) Columns() []string         { return nil }
+func (noopSQLRows) Close() error              { return nil }
+func (noopSQLRows) Next([]driver.Value) error { return io.EOF }
+
+// newTreeTestService 创建使用内存仓库和本地存储的文件服务
+func newTreeTestService(t *testing.T, repo *treeFileRepository, maxDepth, maxNodes int) (*FileService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(noopSQLDriver{})}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	require.NoError(t, err)
+
+	fileStorage, err := storage.NewLocalStorage(storage.StorageConfig{LocalPath: t.TempDir()})
+	require.NoError(t, err)
+
+	cfg := &config.Config{Storage: config.StorageConfig{MaxTreeDepth: maxDepth, MaxTreeNodes: maxNodes}}
+	s := &FileService{
+		cfg:            cfg,
+		fileRepo:       repo,
+		userRepo:       treeUserRepository{},
+		storage:        fileStorage,
+		versionStorage: fileStorage,
+		cleanup:        NewStorageCleanupService(cfg, newMemoryStorageDeletionRepository(), repo, fileStorage, fileStorage),
+	}
+	return s, db
+}
+
+// buildChain 创建depth层嵌套的目录链，返回根目录和最深的目录
+func buildChain(repo *treeFileRepository, userID uuid.UUID, depth int) (*models.File, *models.File) {
+	root := repo.add(userID, nil, "chain", models.FileTypeDir)
+	current := root
+	for i := 0; i < depth; i++ {
+		current = repo.add(userID, current, fmt.Sprintf("d%d", i), models.FileTypeDir)
+	}
+	return root, current
+}
+
+// buildWide 创建levels层、每个目录下fanout个子目录的目录树，最深一层为文件
+func buildWide(repo *treeFileRepository, userID uuid.UUID, levels, fanout int) (*models.File, int) {
+	root := repo.add(userID, nil, "wide", models.FileTypeDir)
+	parents := []*models.File{root}
+	total := 0
+	for level := 0; level < levels; level++ {
+		fileType := models.FileTypeDir
+		if level == levels-1 {
+			fileType = models.FileTypeFile
+		}
+		var next []*models.File
+		for _, parent := range parents {
+			for i := 0; i < fanout; i++ {
+				next = append(next, repo.add(userID, parent, fmt.Sprintf("n%d", i), fileType))
+			}
+		}
+		total += len(next)
+		parents = next
+	}
+	return root, total
+}
+
+// TestWalkTree_WideTree 测试宽目录树逐层批量加载，每次查询的父目录数不超过批次大小
+func TestWalkTree_WideTree(t *testing.T) {
+	repo := newTreeFileRepository()
+	root, total := buildWide(repo, uuid.New(), 3, 30)
+	s, db := newTreeTestService(t, repo, 64, 0)
+
+	levels, err := s.walkTree(db, root)
+	require.NoError(t, err)
+	require.Len(t, levels, 3)
+	assert.Len(t, levels[2], 30*30*30)
+
+	count := 0
+	for _, level := range levels {
+		count += len(level)
+	}
+	assert.Equal(t, total, count)
+	assert.LessOrEqual(t, repo.maxBatch, treeBatchSize)
+}
+
+// TestWalkTree_Limits 测试超过最大深度或最大文件数时返回ErrTreeTooLarge
+func TestWalkTree_Limits(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	chainRoot, _ := buildChain(repo, userID, 100)
+	wideRoot, _ := buildWide(repo, userID, 2, 50)
+
+	s, db := newTreeTestService(t, repo, 64, 1000)
+
+	_, err := s.walkTree(db, chainRoot)
+	assert.ErrorIs(t, err, ErrTreeTooLarge)
+
+	_, err = s.walkTree(db, wideRoot)
+	assert.ErrorIs(t, err, ErrTreeTooLarge)
+
+	// 不限制时可以处理很深的目录树
+	s.cfg.Storage.MaxTreeDepth, s.cfg.Storage.MaxTreeNodes = 0, 0
+	levels, err := s.walkTree(db, chainRoot)
+	require.NoError(t, err)
+	assert.Len(t, levels, 100)
+}
+
+// TestIsDescendant_DeepChain 测试在深目录链中判断后代关系及深度限制
+func TestIsDescendant_DeepChain(t *testing.T) {
+	repo := newTreeFileRepository()
+	root, deepest := buildChain(repo, uuid.New(), 5000)
+	s, _ := newTreeTestService(t, repo, 0, 0)
+
+	descendant, err := s.isDescendant(deepest.ID, root.ID)
+	require.NoError(t, err)
+	assert.True(t, descendant)
+
+	descendant, err = s.isDescendant(root.ID, deepest.ID)
+	require.NoError(t, err)
+	assert.False(t, descendant)
+
+	s.cfg.Storage.MaxTreeDepth = 64
+	_, err = s.isDescendant(deepest.ID, root.ID)
+	assert.ErrorIs(t, err, ErrTreeTooLarge)
+
+	// 损坏的目录层级（循环）不会导致死循环
+	repo.files[root.ID].ParentID = &deepest.ID
+	s.cfg.Storage.MaxTreeDepth = 0
+	_, err = s.isDescendant(deepest.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+// TestDeleteDirectoryRecursive_DeepTree 测试删除深目录树：所有后代被删除，目录由深到浅删除
+func TestDeleteDirectoryRecursive_DeepTree(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	root, deepest := buildChain(repo, userID, 200)
+	file := repo.add(userID, deepest, "leaf.txt", models.FileTypeFile)
+
+	s, db := newTreeTestService(t, repo, 0, 0)
+	ctx := &gin.Context{}
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+	require.NoError(t, s.storage.Save(ctx, fileKey, bytes.NewReader([]byte("x")), 1))
+
+	deletions, err := s.deleteDirectoryRecursive(db, root)
+	require.NoError(t, err)
+	assert.Empty(t, repo.files)
+	require.Len(t, repo.deleted, 202)
+	assert.Equal(t, file.ID, repo.deleted[0], "文件应先于目录删除")
+	assert.Equal(t, deepest.ID, repo.deleted[1], "目录应由深到浅删除")
+	assert.Equal(t, root.ID, repo.deleted[len(repo.deleted)-1])
+
+	// 存储内容留到事务提交后删除：文件的内容、历史版本和缩略图，以及每个目录
+	require.Len(t, deletions, 3+201)
+	assert.Equal(t, fileKey, deletions[0].Key)
+	assert.Equal(t, storage.GenerateFileKey(userID, root.Path), deletions[len(deletions)-1].Key)
+	assert.Equal(t, []byte("x"), readKey(t, s.storage, fileKey))
+}
+
+// TestDeleteDirectoryRecursive_TooLarge 测试超出限制时不删除任何文件
+func TestDeleteDirectoryRecursive_TooLarge(t *testing.T) {
+	repo := newTreeFileRepository()
+	root, total := buildWide(repo, uuid.New(), 2, 40)
+
+	s, db := newTreeTestService(t, repo, 64, 1000)
+	_, err := s.deleteDirectoryRecursive(db, root)
+	assert.ErrorIs(t, err, ErrTreeTooLarge)
+	assert.Empty(t, repo.deleted)
+	assert.Len(t, repo.files, total+1)
+}
+
+// TestCopyFileRecursive_WideTree 测试复制宽目录树，副本保持原有的目录结构
+func TestCopyFileRecursive_WideTree(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	root, total := buildWide(repo, userID, 3, 8)
+
+	s, db := newTreeTestService(t, repo, 0, 0)
+	ctx := &gin.Context{}
+	for _, file := range repo.files {
+		if file.IsFile() {
+			require.NoError(t, s.storage.Save(ctx, storage.GenerateFileKey(userID, file.Path), bytes.NewReader([]byte(file.Path)), int64(len(file.Path))))
+		}
+	}
+
+	levels, err := s.walkTree(db, root)
+	require.NoError(t, err)
+	copied, err := s.copyFileRecursive(ctx, db, userID, root, levels, nil, nil, "wide-copy", nil)
+	require.NoError(t, err)
+	assert.Len(t, repo.created, total+1)
+
+	for _, file := range repo.created[1:] {
+		require.NotNil(t, file.ParentID)
+		parent := repo.files[*file.ParentID]
+		assert.Contains(t, repo.created, parent, "副本应位于复制出的目录下")
+	}
+	assert.Equal(t, []byte("wide/n7/n7/n7"), readKey(t, s.storage, storage.GenerateFileKey(userID, copied.Path+"/n7/n7/n7")))
+}
+
+// newUploadTestContext 创建以multipart表单上传name文件的请求上下文，返回上传的文件头
+func newUploadTestContext(t *testing.T, name string, content []byte) (*gin.Context, *multipart.FileHeader) {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/api/v1/files/upload", &body)
+	ctx.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	fileHeader, err := ctx.FormFile("file")
+	require.NoError(t, err)
+	return ctx, fileHeader
+}
+
+// TestUploadFile_EmptyFile 测试上传和下载0字节的空文件
+func TestUploadFile_EmptyFile(t *testing.T) {
+	repo := newTreeFileRepository()
+	s, db := newTreeTestService(t, repo, 0, 0)
+	s.db = db
+	s.cfg.Storage.AllowEmptyFiles = true
+	s.textService = NewTextService(s.cfg, db, s.storage)
+	s.logService = NewOperationLogService(s.cfg, repositories.NewOperationLogRepository(db))
+
+	userID := uuid.New()
+	ctx, fileHeader := newUploadTestContext(t, "empty.txt", nil)
+	file, err := s.UploadFile(ctx, userID, fileHeader, models.FileUploadRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), file.Size)
+	assert.Equal(t, 1, file.Version)
+	// 空内容的SHA-256
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", file.Hash)
+
+	exists, err := s.storage.Exists(ctx, storage.GenerateFileKey(userID, file.Path))
+	require.NoError(t, err)
+	assert.True(t, exists, "空文件也应在存储中创建")
+
+	reader, downloaded, err := s.DownloadFile(ctx, userID, file.ID)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	assert.Equal(t, file.Hash, downloaded.Hash)
+}
+
+// TestUploadFile_EmptyFileNotAllowed 测试禁止空文件时拒绝上传且不创建记录
+func TestUploadFile_EmptyFileNotAllowed(t *testing.T) {
+	repo := newTreeFileRepository()
+	s, _ := newTreeTestService(t, repo, 0, 0)
+
+	ctx, fileHeader := newUploadTestContext(t, "empty.txt", nil)
+	_, err := s.UploadFile(ctx, uuid.New(), fileHeader, models.FileUploadRequest{})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	assert.Empty(t, repo.files)
+}
+
+// memoryStorageDeletionRepository 内存中的待删除存储内容仓库
+type memoryStorageDeletionRepository struct {
+	pending map[uuid.UUID]*models.StorageDeletion
+}
+
+func newMemoryStorageDeletionRepository() *memoryStorageDeletionRepository {
+	return &memoryStorageDeletionRepository{pending: make(map[uuid.UUID]*models.StorageDeletion)}
+}
+
+func (r *memoryStorageDeletionRepository) CreateWithTx(tx *gorm.DB, deletions []models.StorageDeletion) error {
+	for i := range deletions {
+		if deletions[i].ID == uuid.Nil {
+			deletions[i].ID = uuid.New()
+		}
+		copied := deletions[i]
+		r.pending[copied.ID] = &copied
+	}
+	return nil
+}
+
+func (r *memoryStorageDeletionRepository) FindDue(now time.Time, limit int) ([]models.StorageDeletion, error) {
+	var due []models.StorageDeletion
+	for _, deletion := range r.pending {
+		if !deletion.NextAttemptAt.After(now) && len(due) < limit {
+			due = append(due, *deletion)
+		}
+	}
+	return due, nil
+}
+
+func (r *memoryStorageDeletionRepository) Delete(id uuid.UUID) error {
+	delete(r.pending, id)
+	return nil
+}
+
+func (r *memoryStorageDeletionRepository) MarkFailed(id uuid.UUID, attempts int, nextAttemptAt time.Time, lastError string) error {
+	if deletion, ok := r.pending[id]; ok {
+		deletion.Attempts = attempts
+		deletion.NextAttemptAt = nextAttemptAt
+		deletion.LastError = lastError
+	}
+	return nil
+}
+
+// failingStorage 删除操作按需失败的存储，用于注入存储故障
+type failingStorage struct {
+	storage.Storage
+	failDeletes bool
+}
+
+func (s *failingStorage) Delete(ctx context.Context, key string) error {
+	if s.failDeletes {
+		return storage.ErrDeleteFailed
+	}
+	return s.Storage.Delete(ctx, key)
+}
+
+func (s *failingStorage) DeleteDir(ctx context.Context, key string) error {
+	if s.failDeletes {
+		return storage.ErrDeleteFailed
+	}
+	return s.Storage.DeleteDir(ctx, key)
+}
+
+// newDeleteTestService 创建可执行永久删除的文件服务，存储删除可注入故障
+func newDeleteTestService(t *testing.T, repo *treeFileRepository) (*FileService, *failingStorage, *memoryStorageDeletionRepository) {
+	t.Helper()
+	s, db := newTreeTestService(t, repo, 0, 0)
+	fileStorage := &failingStorage{Storage: s.storage}
+	deletionRepo := newMemoryStorageDeletionRepository()
+	s.db = db
+	s.storage = fileStorage
+	s.versionStorage = fileStorage
+	s.cleanup = NewStorageCleanupService(s.cfg, deletionRepo, repo, fileStorage, fileStorage)
+	s.logService = NewOperationLogService(s.cfg, repositories.NewOperationLogRepository(db))
+	return s, fileStorage, deletionRepo
+}
+
+// TestPermanentDelete_StorageFailureRetried 测试存储删除失败时记录已删除、内容保留并登记重试，
+// 存储恢复后重试成功，不会出现指向已删除内容的记录
+func TestPermanentDelete_StorageFailureRetried(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	file := repo.add(userID, nil, "report.txt", models.FileTypeFile)
+	s, fileStorage, deletionRepo := newDeleteTestService(t, repo)
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodDelete, "/api/v1/files/"+file.ID.String(), nil)
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader([]byte("data")), 4))
+
+	fileStorage.failDeletes = true
+	require.NoError(t, s.DeleteFile(ctx, userID, file.ID, true))
+	assert.Empty(t, repo.files, "存储删除失败不影响记录的删除")
+	assert.Equal(t, []byte("data"), readKey(t, fileStorage, fileKey))
+	require.Len(t, deletionRepo.pending, 3)
+	for _, deletion := range deletionRepo.pending {
+		assert.Equal(t, 1, deletion.Attempts)
+		assert.NotEmpty(t, deletion.LastError)
+		assert.True(t, deletion.NextAttemptAt.After(time.Now()), "应按退避间隔重试")
+	}
+
+	// 未到重试时间不处理
+	purged, err := s.cleanup.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	// 存储恢复后重试成功
+	fileStorage.failDeletes = false
+	for _, deletion := range deletionRepo.pending {
+		deletion.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+	purged, err = s.cleanup.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, purged)
+	assert.Empty(t, deletionRepo.pending)
+	exists, err := fileStorage.Exists(ctx, fileKey)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// TestPermanentDelete_FailedTransactionKeepsContent 测试删除记录失败时不删除任何存储内容
+func TestPermanentDelete_FailedTransactionKeepsContent(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	dir := repo.add(userID, nil, "docs", models.FileTypeDir)
+	file := repo.add(userID, dir, "a.txt", models.FileTypeFile)
+	s, fileStorage, deletionRepo := newDeleteTestService(t, repo)
+
+	ctx := &gin.Context{}
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader([]byte("data")), 4))
+
+	// 删除目录记录前目录已不存在，事务失败
+	delete(repo.files, dir.ID)
+	_, err := s.deleteDirectoryRecursive(s.db, dir)
+	require.Error(t, err)
+	assert.Equal(t, []byte("data"), readKey(t, fileStorage, fileKey), "事务失败时不应删除存储内容")
+	assert.Empty(t, deletionRepo.pending)
+}
+
+// TestStorageCleanup_KeyReused 测试存储键已被同路径的新文件复用时不删除新文件的内容
+func TestStorageCleanup_KeyReused(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	file := repo.add(userID, nil, "report.txt", models.FileTypeFile)
+	s, fileStorage, deletionRepo := newDeleteTestService(t, repo)
+
+	ctx := &gin.Context{}
+	fileKey := storage.GenerateFileKey(userID, file.Path)
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader([]byte("old")), 3))
+
+	fileStorage.failDeletes = true
+	deletions, err := s.deleteSingleFile(s.db, file)
+	require.NoError(t, err)
+	require.NoError(t, s.cleanup.ScheduleWithTx(s.db, deletions))
+	s.cleanup.Purge(ctx, deletions)
+
+	// 重试前上传了同名文件
+	repo.add(userID, nil, "report.txt", models.FileTypeFile)
+	require.NoError(t, fileStorage.Save(ctx, fileKey, bytes.NewReader([]byte("new")), 3))
+
+	fileStorage.failDeletes = false
+	for _, deletion := range deletionRepo.pending {
+		deletion.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+	_, err = s.cleanup.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, deletionRepo.pending)
+	assert.Equal(t, []byte("new"), readKey(t, fileStorage, fileKey))
+}
+
+// memoryStorageBlobRepository 内存中的去重内容仓库
+type memoryStorageBlobRepository struct {
+	blobs map[string]*models.StorageBlob
+}
+
+func (r *memoryStorageBlobRepository) AcquireWithTx(tx *gorm.DB, userID uuid.UUID, hash string) (string, bool, error) {
+	for _, blob := range r.blobs {
+		if blob.UserID == userID && blob.Hash == hash {
+			blob.RefCount++
+			return blob.Key, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (r *memoryStorageBlobRepository) CreateWithTx(tx *gorm.DB, blob *models.StorageBlob) error {
+	copied := *blob
+	copied.RefCount = 1
+	r.blobs[blob.Key] = &copied
+	return nil
+}
+
+func (r *memoryStorageBlobRepository) ReleaseWithTx(tx *gorm.DB, key string) (bool, error) {
+	blob, ok := r.blobs[key]
+	if !ok {
+		return false, nil
+	}
+	if blob.RefCount > 1 {
+		blob.RefCount--
+		return false, nil
+	}
+	delete(r.blobs, key)
+	return true, nil
+}
+
+// TestPermanentDelete_SharedBlobKeptUntilLastReference 测试去重共享的内容在最后一个引用的文件删除后才删除
+func TestPermanentDelete_SharedBlobKeptUntilLastReference(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	first := repo.add(userID, nil, "a.txt", models.FileTypeFile)
+	second := repo.add(userID, nil, "b.txt", models.FileTypeFile)
+	s, fileStorage, deletionRepo := newDeleteTestService(t, repo)
+	blobRepo := &memoryStorageBlobRepository{blobs: make(map[string]*models.StorageBlob)}
+	s.blobRepo = blobRepo
+
+	ctx := &gin.Context{}
+	blobKey := storage.GenerateBlobKey(userID, uuid.New())
+	require.NoError(t, fileStorage.Save(ctx, blobKey, bytes.NewReader([]byte("data")), 4))
+	key, err := s.shareBlobWithTx(s.db, userID, "hash", 4, blobKey)
+	require.NoError(t, err)
+	require.Equal(t, blobKey, key)
+	key, err = s.shareBlobWithTx(s.db, userID, "hash", 4, storage.GenerateBlobKey(userID, uuid.New()))
+	require.NoError(t, err)
+	require.Equal(t, blobKey, key, "相同内容应引用已有内容")
+	first.BlobKey = blobKey
+	second.BlobKey = blobKey
+
+	deletions, err := s.deleteSingleFile(s.db, first)
+	require.NoError(t, err)
+	for _, deletion := range deletions {
+		assert.NotEqual(t, blobKey, deletion.Key, "仍有引用时不应删除共享内容")
+	}
+	require.NoError(t, s.cleanup.ScheduleWithTx(s.db, deletions))
+	s.cleanup.Purge(ctx, deletions)
+	assert.Equal(t, []byte("data"), readKey(t, fileStorage, blobKey))
+
+	deletions, err = s.deleteSingleFile(s.db, second)
+	require.NoError(t, err)
+	require.NoError(t, s.cleanup.ScheduleWithTx(s.db, deletions))
+	s.cleanup.Purge(ctx, deletions)
+	exists, err := fileStorage.Exists(ctx, blobKey)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Empty(t, deletionRepo.pending)
+	assert.Empty(t, blobRepo.blobs)
+}
+
+// TestCopyFile_RejectsTraversalName 测试复制时包含路径的新文件名被拒绝，不会写入其他用户的存储路径
+func TestCopyFile_RejectsTraversalName(t *testing.T) {
+	repo := newTreeFileRepository()
+	userID := uuid.New()
+	source := repo.add(userID, nil, "a.txt", models.FileTypeFile)
+	s, _ := newTreeTestService(t, repo, 64, 0)
+
+	for _, name := range []string{"../../" + uuid.New().String() + "/x.txt", "..", "dir/x.txt", `..\x.txt`} {
+		newName := name
+		_, _, err := s.CopyFile(&gin.Context{}, userID, source.ID, models.FileCopyRequest{NewName: &newName})
+		assert.ErrorIs(t, err, ErrInvalidArgument, name)
+	}
+	assert.Empty(t, repo.created)
+}
+
+// newContentTestService 创建可以替换文件内容的测试服务，返回内容为content的文件
+func newContentTestService(t *testing.T, repo *treeFileRepository, content []byte) (*FileService, uuid.UUID, *models.File) {
+	t.Helper()
+	s, db := newTreeTestService(t, repo, 0, 0)
+	s.db = db
+	s.textService = NewTextService(s.cfg, db, s.storage)
+	s.logService = NewOperationLogService(s.cfg, repositories.NewOperationLogRepository(db))
+
+	userID := uuid.New()
+	file := repo.add(userID, nil, "a.txt", models.FileTypeFile)
+	file.MimeType = "text/plain"
+	file.Size = int64(len(content))
+	file.Version = 1
+	require.NoError(t, s.storage.Save(context.Background(), fileKey(file), bytes.NewReader(content), file.Size))
+	return s, userID, file
+}
+
+// TestUpdateFileContent_SameLockVersion 测试两个请求使用相同的lock_version替换内容时，后写入的请求返回冲突且不覆盖先写入的内容
+func TestUpdateFileContent_SameLockVersion(t *testing.T) {
+	repo := newTreeFileRepository()
+	s, userID, file := newContentTestService(t, repo, []byte("original"))
+	lockVersion := file.LockVersion
+
+	// 第二个请求在第一个请求提交前已经读取了文件
+	stale, err := repo.FindByID(file.ID)
+	require.NoError(t, err)
+
+	ctx, fileHeader := newUploadTestContext(t, "a.txt", []byte("first"))
+	_, err = s.UpdateFileContent(ctx, userID, file.ID, fileHeader, models.FileContentUpdateRequest{LockVersion: &lockVersion})
+	require.NoError(t, err)
+
+	ctx, fileHeader = newUploadTestContext(t, "a.txt", []byte("second"))
+	_, err = s.UpdateFileContent(ctx, userID, file.ID, fileHeader, models.FileContentUpdateRequest{LockVersion: &lockVersion})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = s.updateExistingFile(ctx, userID, stale, lockVersion, bytes.NewReader([]byte("second")), 6, stale.MimeType, nil, "", nil)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	assert.Equal(t, []byte("first"), readKey(t, s.storage, fileKey(file)))
+	assert.Equal(t, int64(5), repo.files[file.ID].Size)
+	assert.Equal(t, lockVersion+1, repo.files[file.ID].LockVersion)
+}
+
+// TestUpdateFileContent_ConflictRestoresContent 测试写入存储后更新记录失败时恢复被覆盖的内容
+func TestUpdateFileContent_ConflictRestoresContent(t *testing.T) {
+	repo := newTreeFileRepository()
+	s, userID, file := newContentTestService(t, repo, []byte("original"))
+	lockVersion := file.LockVersion
+	repo.beforeUpdate = func() { repo.files[file.ID].LockVersion++ }
+
+	ctx, fileHeader := newUploadTestContext(t, "a.txt", []byte("second"))
+	_, err := s.UpdateFileContent(ctx, userID, file.ID, fileHeader, models.FileContentUpdateRequest{LockVersion: &lockVersion})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, []byte("original"), readKey(t, s.storage, fileKey(file)))
+}
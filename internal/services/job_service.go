@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/repositories"
+)
+
+// jobListLimit 任务列表返回的最大条数
+const jobListLimit = 50
+
+// jobProgressInterval 执行中的任务写入进度的最小间隔
+const jobProgressInterval = time.Second
+
+// JobFunc 后台任务的执行函数，ctx在任务被取消时取消；返回值编码为JSON作为任务结果
+type JobFunc func(ctx context.Context, progress JobProgress) (interface{}, error)
+
+// JobProgress 报告任务进度，done和total可以是字节数、文件数等任意单位；可并发调用
+type JobProgress func(done, total int64)
+
+// JobService 后台任务服务：任务记录持久化在数据库中，由固定数量的工作协程按提交顺序执行
+// 执行函数只保存在内存中，服务重启时未结束的任务标记为失败；取消只对本实例执行的任务生效
+type JobService struct {
+	cfg     *config.Config
+	jobRepo repositories.JobRepository
+	queue   chan queuedJob
+
+	mu      sync.Mutex
+	cancels map[uuid.UUID]context.CancelFunc // 执行中任务的取消函数
+}
+
+type queuedJob struct {
+	id  uuid.UUID
+	run JobFunc
+}
+
+// NewJobService 创建后台任务服务，将上次运行遗留的未结束任务标记为失败，并启动JOB_WORKERS个工作协程
+func NewJobService(cfg *config.Config, jobRepo repositories.JobRepository) *JobService {
+	s := &JobService{
+		cfg:     cfg,
+		jobRepo: jobRepo,
+		queue:   make(chan queuedJob, max(cfg.Jobs.QueueSize, 1)),
+		cancels: make(map[uuid.UUID]context.CancelFunc),
+	}
+
+	if count, err := jobRepo.FailUnfinished("interrupted by server restart"); err != nil {
+		log.Printf("Failed to mark interrupted jobs: %v", err)
+	} else if count > 0 {
+		log.Printf("Marked %d interrupted jobs as failed", count)
+	}
+
+	for i := 0; i < max(cfg.Jobs.Workers, 1); i++ {
+		go s.worker()
+	}
+
+	return s
+}
+
+// Submit 创建任务并放入执行队列，队列已满时任务标记为失败并返回ErrJobQueueFull
+func (s *JobService) Submit(userID uuid.UUID, jobType models.JobType, run JobFunc) (*models.Job, error) {
+	job := &models.Job{
+		UserID: userID,
+		Type:   jobType,
+		Status: models.JobStatusPending,
+	}
+	if err := s.jobRepo.Create(job); err != nil {
+		return nil, fmt.Errorf("failed to create job: %w", err)
+	}
+
+	select {
+	case s.queue <- queuedJob{id: job.ID, run: run}:
+	default:
+		s.finish(job.ID, models.JobStatusFailed, nil, ErrJobQueueFull.Error())
+		return nil, ErrJobQueueFull
+	}
+
+	return job, nil
+}
+
+// GetJob 获取用户的任务
+func (s *JobService) GetJob(userID, jobID uuid.UUID) (*models.Job, error) {
+	job, err := s.jobRepo.FindByID(jobID)
+	if err != nil || job.UserID != userID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// ListJobs 获取用户最近的任务
+func (s *JobService) ListJobs(userID uuid.UUID) ([]models.Job, error) {
+	jobs, err := s.jobRepo.FindByUser(userID, jobListLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// CancelJob 取消用户的任务：等待中的任务直接标记为已取消，执行中的任务取消其ctx，由执行函数尽快退出
+func (s *JobService) CancelJob(userID, jobID uuid.UUID) (*models.Job, error) {
+	job, err := s.GetJob(userID, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.IsFinished() {
+		return nil, ErrJobFinished
+	}
+
+	now := time.Now()
+	canceled, err := s.jobRepo.UpdateIfStatus(jobID, models.JobStatusPending, map[string]interface{}{
+		"status":      models.JobStatusCanceled,
+		"finished_at": now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if !canceled {
+		s.mu.Lock()
+		cancel, ok := s.cancels[jobID]
+		s.mu.Unlock()
+		if !ok {
+			return nil, newError(ErrJobFinished, "job is not running on this server")
+		}
+		cancel()
+	}
+
+	return s.GetJob(userID, jobID)
+}
+
+func (s *JobService) worker() {
+	for queued := range s.queue {
+		s.run(queued)
+	}
+}
+
+// run 执行任务，等待期间已被取消的任务直接跳过
+// 先登记取消函数再切换为执行中，保证取消请求看到running状态时总能找到取消函数
+func (s *JobService) run(queued queuedJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancels[queued.id] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.cancels, queued.id)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	started, err := s.jobRepo.UpdateIfStatus(queued.id, models.JobStatusPending, map[string]interface{}{
+		"status":     models.JobStatusRunning,
+		"started_at": time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to start job %s: %v", queued.id, err)
+		return
+	}
+	if !started {
+		return
+	}
+
+	result, err := s.execute(ctx, queued)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		s.finish(queued.id, models.JobStatusCanceled, nil, "")
+	case err != nil:
+		log.Printf("Job %s failed: %v", queued.id, err)
+		s.finish(queued.id, models.JobStatusFailed, nil, err.Error())
+	default:
+		s.finish(queued.id, models.JobStatusCompleted, result, "")
+	}
+}
+
+// execute 调用执行函数，执行函数panic时视为失败，不影响工作协程
+func (s *JobService) execute(ctx context.Context, queued queuedJob) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return queued.run(ctx, s.progress(queued.id))
+}
+
+// progress 返回写入任务进度的回调，两次写入间隔不小于jobProgressInterval
+func (s *JobService) progress(jobID uuid.UUID) JobProgress {
+	var mu sync.Mutex
+	var lastWrite time.Time
+	return func(done, total int64) {
+		if total <= 0 {
+			return
+		}
+		mu.Lock()
+		now := time.Now()
+		if now.Sub(lastWrite) < jobProgressInterval && done < total {
+			mu.Unlock()
+			return
+		}
+		lastWrite = now
+		mu.Unlock()
+
+		percent := math.Round(float64(min(done, total))/float64(total)*10000) / 100
+		if err := s.jobRepo.Update(jobID, map[string]interface{}{"progress": percent}); err != nil {
+			log.Printf("Failed to update progress of job %s: %v", jobID, err)
+		}
+	}
+}
+
+// finish 记录任务的最终状态和结果
+func (s *JobService) finish(jobID uuid.UUID, status models.JobStatus, result interface{}, message string) {
+	updates := map[string]interface{}{
+		"status":      status,
+		"error":       message,
+		"finished_at": time.Now(),
+	}
+	if status == models.JobStatusCompleted {
+		updates["progress"] = 100
+	}
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("Failed to encode result of job %s: %v", jobID, err)
+		} else {
+			updates["result"] = string(data)
+		}
+	}
+
+	if err := s.jobRepo.Update(jobID, updates); err != nil {
+		log.Printf("Failed to finish job %s: %v", jobID, err)
+	}
+}
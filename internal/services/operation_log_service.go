@@ -1,23 +1,39 @@
 package services
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
+	"cloud-storage/internal/config"
 	"cloud-storage/internal/models"
 	"cloud-storage/internal/repositories"
 )
 
+const (
+	auditVerifyBatchSize = 1000
+	auditMaxIssues       = 100  // 校验报告中最多列出的问题数
+	auditExportBatchSize = 1000 // 导出日志时每批读取的条数
+)
+
 type OperationLogService struct {
+	cfg     *config.Config
 	logRepo repositories.OperationLogRepository
 }
 
-func NewOperationLogService(logRepo repositories.OperationLogRepository) *OperationLogService {
+func NewOperationLogService(cfg *config.Config, logRepo repositories.OperationLogRepository) *OperationLogService {
 	return &OperationLogService{
+		cfg:     cfg,
 		logRepo: logRepo,
 	}
 }
@@ -32,12 +48,68 @@ func (s *OperationLogService) LogOperation(
 	result models.OperationResult,
 	errorMessage string,
 ) error {
+	log := newOperationLog(c, userID, operationType, resourceType, resourceID, details, result, errorMessage)
+
+	var err error
+	if s.cfg.Audit.HashChain {
+		err = s.logRepo.CreateChained(log)
+	} else {
+		err = s.logRepo.Create(log)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to log operation: %w", err)
+	}
+
+	return nil
+}
+
+// LogOperationWithTx 在事务中记录操作日志，日志与数据变更一同提交或回滚
+func (s *OperationLogService) LogOperationWithTx(
+	tx *gorm.DB,
+	c *gin.Context,
+	userID uuid.UUID,
+	operationType models.OperationType,
+	resourceType models.ResourceType,
+	resourceID *uuid.UUID,
+	details interface{},
+) error {
+	log := newOperationLog(c, userID, operationType, resourceType, resourceID, details, models.OperationSuccess, "")
+
+	var err error
+	if s.cfg.Audit.HashChain {
+		err = s.logRepo.CreateChainedWithTx(tx, log)
+	} else {
+		err = s.logRepo.CreateWithTx(tx, log)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to log operation: %w", err)
+	}
+
+	return nil
+}
+
+// newOperationLog 构建操作日志记录，请求上下文为nil时不记录IP、User-Agent和耗时
+func newOperationLog(
+	c *gin.Context,
+	userID uuid.UUID,
+	operationType models.OperationType,
+	resourceType models.ResourceType,
+	resourceID *uuid.UUID,
+	details interface{},
+	result models.OperationResult,
+	errorMessage string,
+) *models.OperationLog {
 	var ipAddress string
 	var userAgent string
+	var duration int64
 
 	if c != nil {
 		ipAddress = c.ClientIP()
 		userAgent = c.Request.UserAgent()
+		// 请求开始时间由操作日志中间件记录
+		if start, ok := c.Get("requestStart"); ok {
+			duration = time.Since(start.(time.Time)).Milliseconds()
+		}
 	}
 
 	var resourceIDStr *string
@@ -53,7 +125,7 @@ func (s *OperationLogService) LogOperation(
 		}
 	}
 
-	log := &models.OperationLog{
+	return &models.OperationLog{
 		UserID:       &userID,
 		Operation:    operationType,
 		ResourceType: resourceType,
@@ -63,13 +135,8 @@ func (s *OperationLogService) LogOperation(
 		UserAgent:    userAgent,
 		Result:       result,
 		Error:        errorMessage,
+		Duration:     duration,
 	}
-
-	if err := s.logRepo.Create(log); err != nil {
-		return fmt.Errorf("failed to log operation: %w", err)
-	}
-
-	return nil
 }
 
 func (s *OperationLogService) GetLogs(filter models.OperationLogFilter) ([]models.OperationLog, int64, error) {
@@ -80,6 +147,32 @@ func (s *OperationLogService) GetLogs(filter models.OperationLogFilter) ([]model
 	return logs, total, nil
 }
 
+// GetLogsByCursor 游标分页获取日志，返回下一页的游标（没有更多数据时为空）
+func (s *OperationLogService) GetLogsByCursor(filter models.OperationLogFilter) ([]models.OperationLog, string, error) {
+	var cursor *models.Cursor
+	if filter.Cursor != "" {
+		parsed, err := models.ParseCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", newError(ErrInvalidArgument, err.Error())
+		}
+		cursor = parsed
+	}
+
+	// 多取一条用于判断是否还有下一页
+	logs, err := s.logRepo.FindAfter(filter, cursor, filter.PageSize+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get logs: %w", err)
+	}
+
+	if len(logs) <= filter.PageSize {
+		return logs, "", nil
+	}
+
+	logs = logs[:filter.PageSize]
+	last := logs[len(logs)-1]
+	return logs, models.NewCursor(last.CreatedAt, last.ID).Encode(), nil
+}
+
 func (s *OperationLogService) GetUserLogs(userID uuid.UUID, filter models.OperationLogFilter) ([]models.OperationLog, int64, error) {
 	logs, total, err := s.logRepo.FindByUser(userID, filter)
 	if err != nil {
@@ -88,23 +181,41 @@ func (s *OperationLogService) GetUserLogs(userID uuid.UUID, filter models.Operat
 	return logs, total, nil
 }
 
-func (s *OperationLogService) GetSystemStats() (*models.SystemStats, error) {
-	stats, err := s.logRepo.GetSystemStats()
+// GetSystemStats 获取系统统计，查询受DB_STATS_TIMEOUT_MS限制
+func (s *OperationLogService) GetSystemStats(ctx context.Context) (*models.SystemStats, error) {
+	ctx, cancel := queryContext(ctx, s.cfg.Database.StatsTimeout)
+	defer cancel()
+
+	stats, err := s.logRepo.WithContext(ctx).GetSystemStats()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get system stats: %w", err)
+		return nil, queryError(err, "failed to get system stats")
 	}
 	return stats, nil
 }
 
-func (s *OperationLogService) GetUserOperationStats(userID uuid.UUID, startDate, endDate time.Time) (map[string]int64, error) {
-	stats, err := s.logRepo.GetUserOperationStats(userID, startDate, endDate)
+// GetOperationStats 统计日志的结果、操作、资源类型及按小时和日期的分布，userID为nil时统计所有用户
+// 查询受DB_STATS_TIMEOUT_MS限制
+func (s *OperationLogService) GetOperationStats(
+	ctx context.Context,
+	userID *uuid.UUID,
+	startDate, endDate time.Time,
+) (*models.OperationStats, error) {
+	ctx, cancel := queryContext(ctx, s.cfg.Database.StatsTimeout)
+	defer cancel()
+
+	stats, err := s.logRepo.WithContext(ctx).GetOperationStats(userID, startDate, endDate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user operation stats: %w", err)
+		return nil, queryError(err, "failed to get operation stats")
 	}
 	return stats, nil
 }
 
+// CleanupOldLogs 删除指定天数之前的日志，合规模式下日志只允许追加，不能清理
 func (s *OperationLogService) CleanupOldLogs(days int) (int64, error) {
+	if s.cfg.Audit.ComplianceMode {
+		return 0, ErrAuditLogImmutable
+	}
+
 	cutoffDate := time.Now().AddDate(0, 0, -days)
 	deletedCount, err := s.logRepo.DeleteOldLogs(cutoffDate)
 	if err != nil {
@@ -112,3 +223,188 @@ func (s *OperationLogService) CleanupOldLogs(days int) (int64, error) {
 	}
 	return deletedCount, nil
 }
+
+// VerifyChain 按序号逐条校验哈希链：序号连续（检测删除）、前一条哈希匹配、哈希与内容一致（检测篡改）
+func (s *OperationLogService) VerifyChain() (*models.AuditChainReport, error) {
+	report := &models.AuditChainReport{
+		ComplianceMode: s.cfg.Audit.ComplianceMode,
+		HashChain:      s.cfg.Audit.HashChain,
+		Valid:          true,
+		Issues:         []models.AuditChainIssue{},
+	}
+
+	addIssue := func(log *models.OperationLog, reason string) {
+		report.Valid = false
+		if len(report.Issues) >= auditMaxIssues {
+			report.IssuesOmitted++
+			return
+		}
+		report.Issues = append(report.Issues, models.AuditChainIssue{Seq: *log.Seq, LogID: log.ID, Reason: reason})
+	}
+
+	unchained, err := s.logRepo.CountUnchained()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unchained logs: %w", err)
+	}
+	report.Unchained = unchained
+
+	for {
+		logs, err := s.logRepo.FindChained(report.LastSeq, auditVerifyBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chained logs: %w", err)
+		}
+
+		for i := range logs {
+			log := &logs[i]
+			if *log.Seq != report.LastSeq+1 {
+				addIssue(log, fmt.Sprintf("sequence gap: expected %d, entries may have been deleted", report.LastSeq+1))
+			}
+			if log.PrevHash != report.LastHash {
+				addIssue(log, "previous hash does not match")
+			}
+			if log.IsAnonymized() {
+				report.Anonymized++
+			} else if log.ComputeSubjectDigest() != log.SubjectDigest {
+				addIssue(log, "user, ip, user agent or details have been modified")
+			}
+			if log.ComputeHash() != log.Hash {
+				addIssue(log, "hash does not match entry content")
+			}
+
+			report.Checked++
+			report.LastSeq = *log.Seq
+			report.LastHash = log.Hash
+		}
+
+		if len(logs) < auditVerifyBatchSize {
+			break
+		}
+	}
+
+	report.VerifiedAt = time.Now()
+	return report, nil
+}
+
+// ExportLogs 将时间范围内的操作日志以CSV或JSON写入w：未指定group_by时按created_at、id倒序
+// 以游标分批读取并逐批写出，不在内存中保留全部日志；指定group_by时写出分组统计
+func (s *OperationLogService) ExportLogs(ctx context.Context, w io.Writer, req models.AuditLogRequest) error {
+	filter := models.OperationLogFilter{CreatedAtFrom: req.StartDate, CreatedAtTo: req.EndDate}
+	repo := s.logRepo.WithContext(ctx)
+
+	if req.GroupBy != "" {
+		aggregates, err := repo.Aggregate(filter, req.GroupBy)
+		if err != nil {
+			return fmt.Errorf("failed to aggregate logs: %w", err)
+		}
+		if req.Format == "json" {
+			return json.NewEncoder(w).Encode(gin.H{"group_by": req.GroupBy, "groups": aggregates})
+		}
+
+		writer := csv.NewWriter(w)
+		writer.Write([]string{req.GroupBy, "total", "success_count", "failure_count"})
+		for _, a := range aggregates {
+			writer.Write([]string{csvCell(a.Group), strconv.FormatInt(a.Total, 10),
+				strconv.FormatInt(a.SuccessCount, 10), strconv.FormatInt(a.FailureCount, 10)})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	var writeBatch func([]models.OperationLog) error
+	var finish func() error
+	if req.Format == "json" {
+		// 逐条写出JSON数组
+		encoder := json.NewEncoder(w)
+		first := true
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+		writeBatch = func(logs []models.OperationLog) error {
+			for i := range logs {
+				if !first {
+					if _, err := io.WriteString(w, ","); err != nil {
+						return err
+					}
+				}
+				first = false
+				if err := encoder.Encode(logs[i].ToResponse()); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		finish = func() error {
+			_, err := io.WriteString(w, "]\n")
+			return err
+		}
+	} else {
+		writer := csv.NewWriter(w)
+		writer.Write(auditCSVHeader)
+		writeBatch = func(logs []models.OperationLog) error {
+			for i := range logs {
+				writer.Write(auditCSVRecord(&logs[i]))
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+		finish = func() error { return nil }
+	}
+
+	var cursor *models.Cursor
+	for {
+		logs, err := repo.FindAfter(filter, cursor, auditExportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read logs: %w", err)
+		}
+		if err := writeBatch(logs); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		if len(logs) < auditExportBatchSize {
+			return finish()
+		}
+		last := logs[len(logs)-1]
+		cursor = models.NewCursor(last.CreatedAt, last.ID)
+	}
+}
+
+// auditCSVHeader 操作日志CSV的列
+var auditCSVHeader = []string{
+	"id", "created_at", "user_id", "operation", "resource_type", "resource_id",
+	"result", "error", "ip_address", "user_agent", "duration_ms", "details",
+}
+
+// auditCSVRecord 将日志转换为CSV行
+func auditCSVRecord(log *models.OperationLog) []string {
+	var userID, resourceID string
+	if log.UserID != nil {
+		userID = log.UserID.String()
+	}
+	if log.ResourceID != nil {
+		resourceID = *log.ResourceID
+	}
+	return []string{
+		log.ID.String(),
+		log.CreatedAt.Format(time.RFC3339),
+		userID,
+		string(log.Operation),
+		string(log.ResourceType),
+		csvCell(resourceID),
+		string(log.Result),
+		csvCell(log.Error),
+		log.IPAddress,
+		csvCell(log.UserAgent),
+		strconv.FormatInt(log.Duration, 10),
+		csvCell(log.Details),
+	}
+}
+
+// csvCell 以公式字符开头的单元格前加单引号，避免在电子表格中被当作公式执行
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+)
+
+// publicFileCache 公开文件元数据的进程内缓存，使公开文件的访问不必每次查询数据库
+// 文件变更时由FileService主动失效；多实例部署时其他实例最多在ttl内继续使用旧数据
+type publicFileCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[uuid.UUID]publicFileEntry
+}
+
+type publicFileEntry struct {
+	file      models.File
+	expiresAt time.Time
+}
+
+// newPublicFileCache 创建公开文件缓存，ttl不大于0时返回nil，即不缓存
+func newPublicFileCache(ttl time.Duration, maxEntries int) *publicFileCache {
+	if ttl <= 0 || maxEntries <= 0 {
+		return nil
+	}
+	return &publicFileCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[uuid.UUID]publicFileEntry),
+	}
+}
+
+// get 返回未过期的缓存文件副本
+func (c *publicFileCache) get(fileID uuid.UUID) (*models.File, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[fileID]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, fileID)
+		return nil, false
+	}
+	file := entry.file
+	return &file, true
+}
+
+// set 缓存公开文件，缓存已满时先清理过期项，仍然满时清空
+func (c *publicFileCache) set(file *models.File) {
+	if c == nil || !file.IsPublic {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[uuid.UUID]publicFileEntry)
+		}
+	}
+	c.entries[file.ID] = publicFileEntry{file: *file, expiresAt: now.Add(c.ttl)}
+}
+
+// invalidate 移除文件的缓存，文件内容、位置或公开状态变化后调用
+func (c *publicFileCache) invalidate(fileID uuid.UUID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, fileID)
+}
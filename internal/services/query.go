@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgQueryCanceled Postgres因statement_timeout或取消请求中止语句时的错误码
+const pgQueryCanceled = "57014"
+
+// queryContext 为一类接口的查询设置超时，timeout为0时只继承ctx
+func queryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// queryError 包装查询错误，超时或被数据库取消的查询转换为ErrQueryTimeout
+func queryError(err error, message string) error {
+	var pgErr *pgconn.PgError
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled) {
+		return newError(ErrQueryTimeout, message+": query timed out")
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
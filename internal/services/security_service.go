@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/database"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+)
+
+// SecurityService 记录登录尝试并为可疑活动生成安全警报：
+// 连续登录失败、老用户从新IP登录、通过分享大量下载、用满或反复超出存储配额、上传的文件中检测到病毒
+type SecurityService struct {
+	cfg config.AlertConfig
+	db  *gorm.DB
+}
+
+// NewSecurityService 创建安全警报服务
+func NewSecurityService(cfg *config.Config, db *gorm.DB) *SecurityService {
+	return &SecurityService{
+		cfg: cfg.Alerts,
+		db:  db,
+	}
+}
+
+// Start 订阅分享下载、用满配额、超出配额和检测到病毒事件
+func (s *SecurityService) Start(bus *events.Bus) {
+	bus.Subscribe(func(event events.Event) {
+		switch event.Type {
+		case events.ShareDownloaded:
+			// 事件处理函数不应阻塞发布者
+			go s.checkShareDownloads(event)
+		case events.QuotaReached:
+			go s.alertQuotaReached(event)
+		case events.QuotaExceeded:
+			go s.checkQuotaExceeded(event)
+		case events.MalwareDetected:
+			go s.alertMalwareDetected(event)
+		}
+	})
+}
+
+// RecordLogin 记录一次登录尝试，failure为空表示登录成功；user为nil表示用户名不存在
+func (s *SecurityService) RecordLogin(username, ip, userAgent string, user *models.User, failure string) {
+	attempt := &models.LoginAttempt{
+		Username:  username,
+		IPAddress: ip,
+		Success:   failure == "",
+		UserAgent: userAgent,
+		Error:     failure,
+	}
+
+	// 写入本次记录前检查是否为新IP
+	newIP := attempt.Success && user != nil && s.isNewLoginIP(username, ip)
+
+	if err := s.db.Create(attempt).Error; err != nil {
+		log.Printf("Failed to record login attempt for %s: %v", username, err)
+		return
+	}
+
+	var userID *uuid.UUID
+	if user != nil {
+		userID = &user.ID
+	}
+
+	if newIP {
+		s.createAlert(&models.SecurityAlert{
+			AlertType:   models.SecurityAlertNewLoginIP,
+			Severity:    models.SecuritySeverityLow,
+			Description: fmt.Sprintf("user %s logged in from a new IP address %s", username, ip),
+			IPAddress:   ip,
+			UserID:      userID,
+		}, map[string]interface{}{
+			"subject":    username,
+			"user_agent": userAgent,
+		}, time.Time{})
+		return
+	}
+
+	if !attempt.Success && s.cfg.FailedLoginThreshold > 0 {
+		s.checkFailedLogins(username, ip, userID)
+	}
+}
+
+// isNewLoginIP 用户此前成功登录过且从未使用该IP成功登录
+func (s *SecurityService) isNewLoginIP(username, ip string) bool {
+	if !s.cfg.NewIPAlert || ip == "" {
+		return false
+	}
+
+	var ips []string
+	if err := s.db.Model(&models.LoginAttempt{}).
+		Where("username = ? AND success = ?", username, true).
+		Distinct().Pluck("ip_address", &ips).Error; err != nil {
+		log.Printf("Failed to read login history of %s: %v", username, err)
+		return false
+	}
+	if len(ips) == 0 {
+		return false
+	}
+	for _, known := range ips {
+		if known == ip {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFailedLogins 统计窗口内上次成功登录之后的失败次数，达到阈值时告警，同一用户名在窗口内只告警一次
+func (s *SecurityService) checkFailedLogins(username, ip string, userID *uuid.UUID) {
+	since := time.Now().Add(-s.cfg.FailedLoginWindow)
+
+	var lastSuccess models.LoginAttempt
+	err := s.db.Where("username = ? AND success = ? AND created_at >= ?", username, true, since).
+		Order("created_at DESC").First(&lastSuccess).Error
+	if err == nil {
+		since = lastSuccess.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Failed to read login history of %s: %v", username, err)
+		return
+	}
+
+	var failures int64
+	if err := s.db.Model(&models.LoginAttempt{}).
+		Where("username = ? AND success = ? AND created_at > ?", username, false, since).
+		Count(&failures).Error; err != nil {
+		log.Printf("Failed to count failed logins of %s: %v", username, err)
+		return
+	}
+	if failures < int64(s.cfg.FailedLoginThreshold) {
+		return
+	}
+
+	s.createAlert(&models.SecurityAlert{
+		AlertType: models.SecurityAlertFailedLogins,
+		Severity:  models.SecuritySeverityMedium,
+		Description: fmt.Sprintf("%d failed logins for %s in the last %s",
+			failures, username, s.cfg.FailedLoginWindow),
+		IPAddress: ip,
+		UserID:    userID,
+	}, map[string]interface{}{
+		"subject":        username,
+		"failures":       failures,
+		"threshold":      s.cfg.FailedLoginThreshold,
+		"window_seconds": int64(s.cfg.FailedLoginWindow / time.Second),
+	}, time.Now().Add(-s.cfg.FailedLoginWindow))
+}
+
+// checkShareDownloads 在Redis中按固定窗口累计分享的下载次数，首次超过阈值时告警；Redis不可用时不统计
+func (s *SecurityService) checkShareDownloads(event events.Event) {
+	client := database.GetRedis()
+	if client == nil || s.cfg.ShareDownloadThreshold <= 0 || s.cfg.ShareDownloadWindow <= 0 {
+		return
+	}
+
+	shareID := fmt.Sprint(event.Data["share_id"])
+	window := time.Now().UnixNano() / int64(s.cfg.ShareDownloadWindow)
+	key := fmt.Sprintf("security:share:downloads:%s:%d", shareID, window)
+
+	ctx := context.Background()
+	count, err := client.Incr(ctx, key).Result()
+	if err != nil {
+		log.Printf("Failed to count downloads of share %s: %v", shareID, err)
+		return
+	}
+	if count == 1 {
+		client.Expire(ctx, key, s.cfg.ShareDownloadWindow)
+	}
+	// 只在刚超过阈值时告警，每个窗口一次
+	if count != s.cfg.ShareDownloadThreshold+1 {
+		return
+	}
+
+	userID := event.UserID
+	s.createAlert(&models.SecurityAlert{
+		AlertType: models.SecurityAlertShareMassDownload,
+		Severity:  models.SecuritySeverityMedium,
+		Description: fmt.Sprintf("share %s was downloaded more than %d times in %s",
+			shareID, s.cfg.ShareDownloadThreshold, s.cfg.ShareDownloadWindow),
+		UserID: &userID,
+	}, map[string]interface{}{
+		"subject":        shareID,
+		"file_id":        event.Data["file_id"],
+		"threshold":      s.cfg.ShareDownloadThreshold,
+		"window_seconds": int64(s.cfg.ShareDownloadWindow / time.Second),
+	}, time.Time{})
+}
+
+// checkQuotaExceeded 用户写入超出存储配额时告警，同一用户在间隔内只告警一次
+func (s *SecurityService) checkQuotaExceeded(event events.Event) {
+	if s.cfg.QuotaAlertInterval <= 0 {
+		return
+	}
+
+	userID := event.UserID
+	s.createAlert(&models.SecurityAlert{
+		AlertType: models.SecurityAlertQuotaExceeded,
+		Severity:  models.SecuritySeverityLow,
+		Description: fmt.Sprintf("user %s attempted to write %v bytes beyond the storage quota",
+			userID, event.Data["requested"]),
+		UserID: &userID,
+	}, map[string]interface{}{
+		"subject":   userID.String(),
+		"requested": event.Data["requested"],
+		"used":      event.Data["used"],
+		"quota":     event.Data["quota"],
+	}, time.Now().Add(-s.cfg.QuotaAlertInterval))
+}
+
+// alertQuotaReached 用户已用空间首次用满配额时告警，同一用户在间隔内只告警一次
+func (s *SecurityService) alertQuotaReached(event events.Event) {
+	if s.cfg.QuotaAlertInterval <= 0 {
+		return
+	}
+
+	userID := event.UserID
+	s.createAlert(&models.SecurityAlert{
+		AlertType:   models.SecurityAlertQuotaReached,
+		Severity:    models.SecuritySeverityLow,
+		Description: fmt.Sprintf("user %s has used the entire storage quota of %v bytes", userID, event.Data["quota"]),
+		UserID:      &userID,
+	}, map[string]interface{}{
+		"subject": userID.String(),
+		"used":    event.Data["used"],
+		"quota":   event.Data["quota"],
+	}, time.Now().Add(-s.cfg.QuotaAlertInterval))
+}
+
+// alertMalwareDetected 上传的文件中检测到病毒时告警，每次检测都记录
+func (s *SecurityService) alertMalwareDetected(event events.Event) {
+	userID := event.UserID
+	s.createAlert(&models.SecurityAlert{
+		AlertType:   models.SecurityAlertMalwareDetected,
+		Severity:    models.SecuritySeverityHigh,
+		Description: fmt.Sprintf("upload by user %s was rejected: %v detected", userID, event.Data["signature"]),
+		IPAddress:   fmt.Sprint(event.Data["ip_address"]),
+		UserID:      &userID,
+	}, map[string]interface{}{
+		"subject":   userID.String(),
+		"signature": event.Data["signature"],
+	}, time.Time{})
+}
+
+// createAlert 记录安全警报，details中的subject标识告警对象；
+// dedupeSince非零时，若该时间之后已有同类型同对象的警报则不再记录
+func (s *SecurityService) createAlert(alert *models.SecurityAlert, details map[string]interface{}, dedupeSince time.Time) {
+	if !dedupeSince.IsZero() {
+		var existing int64
+		if err := s.db.Model(&models.SecurityAlert{}).
+			Where("alert_type = ? AND details->>'subject' = ? AND created_at >= ?",
+				alert.AlertType, fmt.Sprint(details["subject"]), dedupeSince).
+			Count(&existing).Error; err != nil {
+			log.Printf("Failed to check existing %s alerts: %v", alert.AlertType, err)
+			return
+		}
+		if existing > 0 {
+			return
+		}
+	}
+
+	data, _ := json.Marshal(details)
+	alert.Details = string(data)
+	if err := s.db.Create(alert).Error; err != nil {
+		log.Printf("Failed to create %s alert: %v", alert.AlertType, err)
+	}
+}
+
+// ListAlerts 分页查询安全警报，按创建时间倒序
+func (s *SecurityService) ListAlerts(filter models.SecurityAlertFilter) ([]models.SecurityAlert, int64, error) {
+	query := s.db.Model(&models.SecurityAlert{})
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.AlertType != "" {
+		query = query.Where("alert_type = ?", filter.AlertType)
+	}
+	if filter.Resolved != nil {
+		query = query.Where("resolved = ?", *filter.Resolved)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count security alerts: %w", err)
+	}
+
+	var alerts []models.SecurityAlert
+	if err := query.Order("created_at DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&alerts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list security alerts: %w", err)
+	}
+	return alerts, total, nil
+}
+
+// ResolveAlert 将安全警报标记为已处理；已处理的警报保留原处理人和时间
+func (s *SecurityService) ResolveAlert(alertID, adminID uuid.UUID) (*models.SecurityAlert, error) {
+	now := time.Now()
+	if err := s.db.Model(&models.SecurityAlert{}).
+		Where("id = ? AND resolved = ?", alertID, false).
+		Updates(map[string]interface{}{
+			"resolved":    true,
+			"resolved_at": now,
+			"resolved_by": adminID,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve security alert: %w", err)
+	}
+
+	var alert models.SecurityAlert
+	if err := s.db.First(&alert, "id = ?", alertID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAlertNotFound
+		}
+		return nil, fmt.Errorf("failed to get security alert: %w", err)
+	}
+	return &alert, nil
+}
@@ -1,43 +1,71 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"cloud-storage/internal/config"
 	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/pkg/storage"
 	"cloud-storage/internal/repositories"
 )
 
 type ShareService struct {
-	db        *gorm.DB
-	shareRepo repositories.ShareRepository
-	fileRepo  repositories.FileRepository
+	cfg         *config.Config
+	db          *gorm.DB
+	shareRepo   repositories.ShareRepository
+	fileRepo    repositories.FileRepository
+	userRepo    repositories.UserRepository
+	fileService *FileService
+	storage     storage.Storage
+	events      *events.Bus
 }
 
 func NewShareService(
+	cfg *config.Config,
 	db *gorm.DB,
 	shareRepo repositories.ShareRepository,
 	fileRepo repositories.FileRepository,
+	userRepo repositories.UserRepository,
+	fileService *FileService,
+	storage storage.Storage,
+	eventBus *events.Bus,
 ) *ShareService {
 	return &ShareService{
-		db:        db,
-		shareRepo: shareRepo,
-		fileRepo:  fileRepo,
+		cfg:         cfg,
+		db:          db,
+		shareRepo:   shareRepo,
+		fileRepo:    fileRepo,
+		userRepo:    userRepo,
+		fileService: fileService,
+		storage:     storage,
+		events:      eventBus,
 	}
 }
 
 func (s *ShareService) CreateShare(userID uuid.UUID, fileID uuid.UUID, req models.ShareCreateRequest) (*models.Share, error) {
 	file, err := s.fileRepo.FindByID(fileID)
 	if err != nil {
-		return nil, fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 	}
 
-	if file.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+	if err := s.fileService.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkShareLimits(userID, fileID); err != nil {
+		return nil, err
 	}
 
 	var passwordHash *string
@@ -50,47 +78,89 @@ func (s *ShareService) CreateShare(userID uuid.UUID, fileID uuid.UUID, req model
 		passwordHash = &hashed
 	}
 
+	if req.RequirePasswordPerDownload && passwordHash == nil {
+		return nil, newError(ErrInvalidArgument, "require_password_per_download requires a password")
+	}
+
 	var expiresAt *time.Time
 	if req.ExpiresInDays != nil && *req.ExpiresInDays > 0 {
 		expires := time.Now().AddDate(0, 0, *req.ExpiresInDays)
 		expiresAt = &expires
 	}
 
+	token, err := generateShareToken(s.shareRepo.TokenExists)
+	if err != nil {
+		return nil, err
+	}
+
 	share := &models.Share{
 		FileID:       fileID,
 		UserID:       userID,
-		ShareToken:   generateShareToken(),
+		ShareToken:   token,
 		PasswordHash: passwordHash,
 		AccessType:   req.AccessType,
 		ExpiresAt:    expiresAt,
 		MaxDownloads: req.MaxDownloads,
 		IsActive:     true,
+
+		RequirePasswordPerDownload: req.RequirePasswordPerDownload,
 	}
 
 	if err := s.shareRepo.Create(share); err != nil {
 		return nil, fmt.Errorf("failed to create share: %w", err)
 	}
 
+	s.events.Publish(events.New(events.ShareCreated, userID, map[string]interface{}{
+		"share_id":    share.ID,
+		"file_id":     file.ID,
+		"name":        file.Name,
+		"access_type": share.AccessType,
+		"expires_at":  share.ExpiresAt,
+	}))
+
 	return share, nil
 }
 
 func (s *ShareService) GetShare(shareID uuid.UUID, userID uuid.UUID) (*models.Share, error) {
 	share, err := s.shareRepo.FindByID(shareID)
 	if err != nil {
-		return nil, fmt.Errorf("share not found: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrShareNotFound, err)
 	}
 
 	if share.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+		return nil, ErrPermissionDenied
 	}
 
 	return share, nil
 }
 
-func (s *ShareService) GetUserShares(userID uuid.UUID, filter models.ShareFilter) ([]models.Share, int64, error) {
-	filter.Page = 1
-	filter.PageSize = 20
+// GetFileSharing 获取文件及其当前有效的分享，仅文件所有者（空间文件为编辑者以上的成员）可查看
+func (s *ShareService) GetFileSharing(userID uuid.UUID, fileID uuid.UUID) (*models.File, []models.Share, error) {
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+
+	if err := s.fileService.authorizeFile(userID, file, models.SpaceRoleEditor); err != nil {
+		return nil, nil, err
+	}
+
+	shares, err := s.shareRepo.FindByFileID(fileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get file shares: %w", err)
+	}
+
+	active := make([]models.Share, 0, len(shares))
+	for i := range shares {
+		if shares[i].IsValid() {
+			active = append(active, shares[i])
+		}
+	}
 
+	return file, active, nil
+}
+
+func (s *ShareService) GetUserShares(userID uuid.UUID, filter models.ShareFilter) ([]models.Share, int64, error) {
 	shares, total, err := s.shareRepo.FindByUser(userID, filter)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get shares: %w", err)
@@ -102,11 +172,11 @@ func (s *ShareService) GetUserShares(userID uuid.UUID, filter models.ShareFilter
 func (s *ShareService) UpdateShare(shareID uuid.UUID, userID uuid.UUID, req models.ShareUpdateRequest) (*models.Share, error) {
 	share, err := s.shareRepo.FindByID(shareID)
 	if err != nil {
-		return nil, fmt.Errorf("share not found: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrShareNotFound, err)
 	}
 
 	if share.UserID != userID {
-		return nil, fmt.Errorf("permission denied")
+		return nil, ErrPermissionDenied
 	}
 
 	updates := make(map[string]interface{})
@@ -128,6 +198,12 @@ func (s *ShareService) UpdateShare(shareID uuid.UUID, userID uuid.UUID, req mode
 	}
 
 	if req.IsActive != nil {
+		// 重新激活分享时同样受数量限制
+		if *req.IsActive && !share.IsActive {
+			if err := s.checkShareLimits(userID, share.FileID); err != nil {
+				return nil, err
+			}
+		}
 		updates["is_active"] = *req.IsActive
 	}
 
@@ -144,6 +220,20 @@ func (s *ShareService) UpdateShare(shareID uuid.UUID, userID uuid.UUID, req mode
 		updates["max_downloads"] = *req.MaxDownloads
 	}
 
+	// 开启每次下载验证密码时，更新后的分享必须仍有密码
+	requirePassword := share.RequirePasswordPerDownload
+	if req.RequirePasswordPerDownload != nil {
+		requirePassword = *req.RequirePasswordPerDownload
+		updates["require_password_per_download"] = requirePassword
+	}
+	hasPassword := share.PasswordHash != nil
+	if req.Password != nil {
+		hasPassword = *req.Password != ""
+	}
+	if requirePassword && !hasPassword {
+		return nil, newError(ErrInvalidArgument, "require_password_per_download requires a password")
+	}
+
 	if err := s.shareRepo.Update(shareID, updates); err != nil {
 		return nil, fmt.Errorf("failed to update share: %w", err)
 	}
@@ -154,11 +244,11 @@ func (s *ShareService) UpdateShare(shareID uuid.UUID, userID uuid.UUID, req mode
 func (s *ShareService) DeleteShare(shareID uuid.UUID, userID uuid.UUID) error {
 	share, err := s.shareRepo.FindByID(shareID)
 	if err != nil {
-		return fmt.Errorf("share not found: %w", err)
+		return fmt.Errorf("%w: %w", ErrShareNotFound, err)
 	}
 
 	if share.UserID != userID {
-		return fmt.Errorf("permission denied")
+		return ErrPermissionDenied
 	}
 
 	if err := s.shareRepo.Delete(shareID); err != nil {
@@ -171,45 +261,360 @@ func (s *ShareService) DeleteShare(shareID uuid.UUID, userID uuid.UUID) error {
 func (s *ShareService) AccessShare(token string, password *string) (*models.Share, error) {
 	share, err := s.shareRepo.FindByToken(token)
 	if err != nil {
-		return nil, fmt.Errorf("share not found")
+		return nil, ErrShareNotFound
 	}
 
 	if !share.IsValid() {
-		return nil, fmt.Errorf("share is invalid or expired")
+		return nil, ErrShareInvalid
 	}
 
 	if share.PasswordHash != nil {
 		if password == nil {
-			return nil, fmt.Errorf("password required")
+			return nil, ErrPasswordRequired
 		}
 		if err := bcrypt.CompareHashAndPassword([]byte(*share.PasswordHash), []byte(*password)); err != nil {
-			return nil, fmt.Errorf("invalid password")
+			return nil, ErrInvalidPassword
 		}
 	}
 
 	return share, nil
 }
 
-func (s *ShareService) DownloadSharedFile(token string, password *string) (*models.File, error) {
+// ShareVisitor 访问分享的客户端，写入分享访问记录
+type ShareVisitor struct {
+	IPAddress string
+	UserAgent string
+}
+
+// ViewShare 验证并查看分享，记录一次查看
+func (s *ShareService) ViewShare(token string, password *string, visitor ShareVisitor) (*models.Share, error) {
 	share, err := s.AccessShare(token, password)
 	if err != nil {
 		return nil, err
 	}
 
-	if !share.CanDownload() {
-		return nil, fmt.Errorf("download not allowed")
+	s.recordAccess(share, nil, models.ShareActionView, visitor)
+
+	s.events.Publish(events.New(events.ShareAccessed, share.UserID, map[string]interface{}{
+		"share_id":   share.ID,
+		"file_id":    share.FileID,
+		"ip_address": visitor.IPAddress,
+	}))
+	return share, nil
+}
+
+// recordAccess 写入分享访问记录，失败时只记录日志，不影响访问本身
+func (s *ShareService) recordAccess(share *models.Share, fileID *uuid.UUID, action models.ShareAccessAction, visitor ShareVisitor) {
+	access := &models.ShareAccess{
+		ShareID:   share.ID,
+		FileID:    fileID,
+		Action:    action,
+		IPAddress: visitor.IPAddress,
+		UserAgent: visitor.UserAgent,
+	}
+	if err := s.shareRepo.RecordAccess(access); err != nil {
+		log.Printf("Failed to record %s access of share %s: %v", action, share.ID, err)
+	}
+}
+
+// GetShareAccesses 分页查询分享的访问记录，只有分享的创建者可以查看
+func (s *ShareService) GetShareAccesses(
+	shareID uuid.UUID,
+	userID uuid.UUID,
+	action models.ShareAccessAction,
+	page, pageSize int,
+) ([]models.ShareAccess, int64, error) {
+	if _, err := s.GetShare(shareID, userID); err != nil {
+		return nil, 0, err
+	}
+
+	accesses, total, err := s.shareRepo.FindAccesses(shareID, action, page, pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get share accesses: %w", err)
+	}
+	return accesses, total, nil
+}
+
+// SharePassword 访问分享时提供的密码及其来源
+type SharePassword struct {
+	Value *string
+	InURL bool // 密码来自URL查询参数，可能留在浏览器历史、代理日志中并被复用
+}
+
+// accessShareForTransfer 验证下载、更新内容的请求；开启了每次下载验证密码的分享
+// 只接受请求头中的密码，每个请求都必须单独提供，不能通过带密码的链接复用
+func (s *ShareService) accessShareForTransfer(token string, password SharePassword) (*models.Share, error) {
+	share, err := s.AccessShare(token, password.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if share.RequirePasswordPerDownload && password.InURL {
+		return nil, newError(ErrPasswordRequired, "password must be sent in the X-Share-Password header")
+	}
+
+	return share, nil
+}
+
+// DownloadSharedFile 打开分享的文件内容，调用方负责关闭；fileID非空时下载目录分享中的后代文件
+func (s *ShareService) DownloadSharedFile(
+	ctx context.Context,
+	token string,
+	password SharePassword,
+	fileID *uuid.UUID,
+	visitor ShareVisitor,
+) (io.ReadCloser, *models.File, error) {
+	share, err := s.accessShareForTransfer(token, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetID := share.FileID
+	if fileID != nil {
+		targetID = *fileID
+	}
+
+	file, access, err := s.resolveSharedFile(share, targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !access.AllowsDownload() {
+		return nil, nil, newError(ErrShareNotAllowed, "download not allowed")
+	}
+
+	if !file.IsFile() {
+		return nil, nil, newError(ErrInvalidArgument, "only files can be downloaded")
+	}
+
+	// 先打开内容，存储读取失败时不占用下载次数
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get file from storage: %w", err)
 	}
 
-	if err := s.shareRepo.IncrementDownloadCount(share.ID); err != nil {
-		return nil, fmt.Errorf("failed to increment download count")
+	counted, err := s.shareRepo.IncrementDownloadCount(share.ID)
+	if err != nil {
+		reader.Close()
+		return nil, nil, fmt.Errorf("failed to increment download count: %w", err)
 	}
+	if !counted {
+		// 并发下载已用完下载次数，或分享在检查后过期、被停用
+		reader.Close()
+		return nil, nil, ErrShareInvalid
+	}
+
+	s.recordAccess(share, &file.ID, models.ShareActionDownload, visitor)
+
+	s.events.Publish(events.New(events.ShareDownloaded, share.UserID, map[string]interface{}{
+		"share_id": share.ID,
+		"file_id":  file.ID,
+		"name":     file.Name,
+		"size":     file.Size,
+	}))
 
-	file, err := s.fileRepo.FindByID(share.FileID)
+	return reader, file, nil
+}
+
+// ListSharedDirectory 列出目录分享中的文件；parentID为空时列出分享的根目录
+// 返回所列目录及其子文件，每个子文件带有生效的访问类型
+func (s *ShareService) ListSharedDirectory(
+	token string,
+	password *string,
+	parentID *uuid.UUID,
+	page, pageSize int,
+) (*models.File, []models.SharedFileResponse, int64, error) {
+	share, err := s.AccessShare(token, password)
 	if err != nil {
-		return nil, fmt.Errorf("file not found")
+		return nil, nil, 0, err
 	}
 
-	return file, nil
+	targetID := share.FileID
+	if parentID != nil {
+		targetID = *parentID
+	}
+
+	return s.listSharedDirectory(share, targetID, page, pageSize)
+}
+
+// ListShareRoot 列出目录分享根目录下的直接子文件，share须已通过AccessShare或ViewShare验证
+func (s *ShareService) ListShareRoot(share *models.Share, page, pageSize int) ([]models.SharedFileResponse, int64, error) {
+	_, entries, total, err := s.listSharedDirectory(share, share.FileID, page, pageSize)
+	return entries, total, err
+}
+
+// listSharedDirectory 列出分享范围内目录的直接子文件，每个子文件带有生效的访问类型
+func (s *ShareService) listSharedDirectory(
+	share *models.Share,
+	targetID uuid.UUID,
+	page, pageSize int,
+) (*models.File, []models.SharedFileResponse, int64, error) {
+	directory, access, err := s.resolveSharedFile(share, targetID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if !directory.IsDirectory() {
+		return nil, nil, 0, newError(ErrInvalidArgument, "not a directory")
+	}
+
+	// 空间目录下的文件可能由不同成员上传，按空间而非所有者查询
+	filter := models.FileFilter{
+		ParentID: &directory.ID,
+		Deleted:  &[]bool{false}[0],
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if directory.SpaceID != nil {
+		filter.SpaceID = directory.SpaceID
+	} else {
+		filter.UserID = &directory.UserID
+	}
+
+	children, err := s.fileRepo.FindAll(filter)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to list directory: %w", err)
+	}
+
+	total, err := s.fileRepo.Count(filter)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	entries := make([]models.SharedFileResponse, 0, len(children))
+	for i := range children {
+		childAccess, err := s.restrictByOwnShares(access, children[i].ID)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		entries = append(entries, models.SharedFileResponse{
+			FileResponse: children[i].ToResponse(),
+			AccessType:   childAccess,
+		})
+	}
+
+	return directory, entries, total, nil
+}
+
+// UpdateSharedFileContent 通过编辑权限的分享更新文件内容；fileID非空时更新目录分享中的后代文件
+// 新内容作为文件的新版本保存，并计入文件所有者的存储配额
+func (s *ShareService) UpdateSharedFileContent(
+	ctx *gin.Context,
+	token string,
+	password SharePassword,
+	fileID *uuid.UUID,
+	fileHeader *multipart.FileHeader,
+) (*models.Share, *models.File, error) {
+	share, err := s.accessShareForTransfer(token, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetID := share.FileID
+	if fileID != nil {
+		targetID = *fileID
+	}
+
+	file, access, err := s.resolveSharedFile(share, targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !access.AllowsEdit() {
+		return nil, nil, newError(ErrShareNotAllowed, "edit not allowed")
+	}
+
+	if !file.IsFile() {
+		return nil, nil, newError(ErrInvalidArgument, "only files can be edited")
+	}
+	if err := s.fileService.checkUploadSize(fileHeader.Size); err != nil {
+		return nil, nil, err
+	}
+
+	content, err := fileHeader.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer content.Close()
+
+	// 编辑操作归属于分享创建者，日志附带访问者IP
+	details := map[string]interface{}{
+		"share_id": share.ID,
+		"via":      "share",
+	}
+	// 类型沿用文件已有的类型，不采信访问者声明的Content-Type，由updateExistingFile按嗅探出的内容检查
+	updatedFile, err := s.fileService.updateExistingFile(ctx, share.UserID, file, file.LockVersion, content, fileHeader.Size, file.MimeType, nil, "", details)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return share, updatedFile, nil
+}
+
+// resolveSharedFile 解析通过分享访问的文件及其生效的访问类型
+// 目录分享下的后代文件继承分享的访问类型；后代文件或其与分享目录之间的中间目录
+// 自身若有有效分享，则取其中最严格的访问类型（子分享只能收紧、不能放宽继承的权限）
+func (s *ShareService) resolveSharedFile(share *models.Share, fileID uuid.UUID) (*models.File, models.ShareAccessType, error) {
+	root, err := s.fileRepo.FindByID(share.FileID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrFileNotFound, err)
+	}
+	if fileID == share.FileID {
+		return root, share.AccessType, nil
+	}
+
+	// 后代文件须与分享目录属于同一空间；个人目录下还须属于同一所有者
+	file, err := s.fileRepo.FindByID(fileID)
+	if err != nil || !sameSpace(file.SpaceID, root.SpaceID) || (root.SpaceID == nil && file.UserID != root.UserID) {
+		return nil, "", ErrFileNotFound
+	}
+
+	// 自下而上查找分享目录，同时收集路径上的子分享
+	access := share.AccessType
+	visited := make(map[uuid.UUID]bool)
+	node := file
+	for {
+		if visited[node.ID] {
+			return nil, "", ErrFileNotFound
+		}
+		visited[node.ID] = true
+
+		access, err = s.restrictByOwnShares(access, node.ID)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// 到达根目录仍未遇到分享目录，说明文件不在分享范围内
+		if node.ParentID == nil {
+			return nil, "", ErrFileNotFound
+		}
+		if *node.ParentID == share.FileID {
+			break
+		}
+
+		node, err = s.fileRepo.FindByID(*node.ParentID)
+		if err != nil {
+			return nil, "", ErrFileNotFound
+		}
+	}
+
+	return file, access, nil
+}
+
+// restrictByOwnShares 用文件自身的有效分享收紧继承的访问类型
+func (s *ShareService) restrictByOwnShares(access models.ShareAccessType, fileID uuid.UUID) (models.ShareAccessType, error) {
+	shares, err := s.shareRepo.FindByFileID(fileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get file shares: %w", err)
+	}
+
+	for i := range shares {
+		if shares[i].IsValid() {
+			access = models.MinShareAccess(access, shares[i].AccessType)
+		}
+	}
+
+	return access, nil
 }
 
 func (s *ShareService) GetShareStats(userID uuid.UUID) (*models.ShareStats, error) {
@@ -217,6 +622,13 @@ func (s *ShareService) GetShareStats(userID uuid.UUID) (*models.ShareStats, erro
 	if err != nil {
 		return nil, fmt.Errorf("failed to get share stats: %w", err)
 	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	stats.MaxSharesPerUser, stats.MaxSharesPerFile = s.cfg.Share.LimitsForRole(string(user.Role))
+
 	return stats, nil
 }
 
@@ -241,8 +653,77 @@ func (s *ShareService) BatchDeleteShares(shareIDs []uuid.UUID, userID uuid.UUID)
 	return deletedCount, nil
 }
 
-func generateShareToken() string {
-	token := uuid.New().String()
-	token = token[:32]
-	return token
+// checkShareLimits 检查用户及文件的活跃分享数量是否已达上限
+func (s *ShareService) checkShareLimits(userID uuid.UUID, fileID uuid.UUID) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	maxPerUser, maxPerFile := s.cfg.Share.LimitsForRole(string(user.Role))
+
+	if maxPerUser > 0 {
+		count, err := s.shareRepo.CountActiveByUser(userID)
+		if err != nil {
+			return fmt.Errorf("failed to count shares: %w", err)
+		}
+		if count >= int64(maxPerUser) {
+			return newError(ErrShareLimitReached, "share limit per user exceeded")
+		}
+	}
+
+	if maxPerFile > 0 {
+		count, err := s.shareRepo.CountActiveByFile(fileID)
+		if err != nil {
+			return fmt.Errorf("failed to count shares: %w", err)
+		}
+		if count >= int64(maxPerFile) {
+			return newError(ErrShareLimitReached, "share limit per file exceeded")
+		}
+	}
+
+	return nil
+}
+
+const (
+	// shareTokenLength 分享令牌长度，与share_token列的varchar(32)一致
+	shareTokenLength = 32
+	// shareTokenAttempts 生成的令牌已被使用时的最大尝试次数
+	shareTokenAttempts = 5
+	base62Alphabet     = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// generateShareToken 使用crypto/rand生成32位base62分享令牌，exists检查令牌是否已被使用，冲突时有限次重试
+func generateShareToken(exists func(token string) (bool, error)) (string, error) {
+	for i := 0; i < shareTokenAttempts; i++ {
+		token, err := randomBase62(shareTokenLength)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate share token: %w", err)
+		}
+		taken, err := exists(token)
+		if err != nil {
+			return "", fmt.Errorf("failed to check share token: %w", err)
+		}
+		if !taken {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a unique share token after %d attempts", shareTokenAttempts)
+}
+
+// randomBase62 生成指定长度的base62随机串，丢弃248及以上的字节（248=62*4）以避免取模偏差
+func randomBase62(n int) (string, error) {
+	token := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(token) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < 248 && len(token) < n {
+				token = append(token, base62Alphabet[b%62])
+			}
+		}
+	}
+	return string(token), nil
 }
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/repositories"
+)
+
+// SpaceService 团队空间服务：管理空间及其成员，空间内文件的权限由FileService按成员角色检查
+type SpaceService struct {
+	spaceRepo repositories.SpaceRepository
+	userRepo  repositories.UserRepository
+}
+
+// NewSpaceService 创建空间服务实例
+func NewSpaceService(spaceRepo repositories.SpaceRepository, userRepo repositories.UserRepository) *SpaceService {
+	return &SpaceService{
+		spaceRepo: spaceRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// CreateSpace 创建空间，创建者成为空间管理员
+func (s *SpaceService) CreateSpace(userID uuid.UUID, req models.SpaceCreateRequest) (*models.SpaceResponse, error) {
+	space := &models.Space{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   userID,
+	}
+	creator := &models.SpaceMember{
+		UserID: userID,
+		Role:   models.SpaceRoleAdmin,
+	}
+
+	if err := s.spaceRepo.Create(space, creator); err != nil {
+		return nil, fmt.Errorf("failed to create space: %w", err)
+	}
+
+	return &models.SpaceResponse{Space: *space, Role: creator.Role}, nil
+}
+
+// ListSpaces 获取用户加入的空间
+func (s *SpaceService) ListSpaces(userID uuid.UUID) ([]models.SpaceResponse, error) {
+	spaces, members, err := s.spaceRepo.FindByMember(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spaces: %w", err)
+	}
+
+	roles := make(map[uuid.UUID]models.SpaceRole, len(members))
+	for _, member := range members {
+		roles[member.SpaceID] = member.Role
+	}
+
+	responses := make([]models.SpaceResponse, 0, len(spaces))
+	for _, space := range spaces {
+		responses = append(responses, models.SpaceResponse{Space: space, Role: roles[space.ID]})
+	}
+	return responses, nil
+}
+
+// GetSpace 获取空间详情及成员列表，仅空间成员可见
+func (s *SpaceService) GetSpace(userID, spaceID uuid.UUID) (*models.SpaceResponse, error) {
+	space, member, err := s.getSpaceAs(userID, spaceID, models.SpaceRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.spaceRepo.FindMembers(spaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get space members: %w", err)
+	}
+
+	response := &models.SpaceResponse{
+		Space:   *space,
+		Role:    member.Role,
+		Members: make([]models.SpaceMemberResponse, 0, len(members)),
+	}
+	for i := range members {
+		response.Members = append(response.Members, members[i].ToResponse())
+	}
+	return response, nil
+}
+
+// UpdateSpace 更新空间信息，需要管理员角色
+func (s *SpaceService) UpdateSpace(userID, spaceID uuid.UUID, req models.SpaceUpdateRequest) (*models.SpaceResponse, error) {
+	_, member, err := s.getSpaceAs(userID, spaceID, models.SpaceRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+
+	if len(updates) > 0 {
+		if err := s.spaceRepo.Update(spaceID, updates); err != nil {
+			return nil, fmt.Errorf("failed to update space: %w", err)
+		}
+	}
+
+	space, err := s.spaceRepo.FindByID(spaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload space: %w", err)
+	}
+	return &models.SpaceResponse{Space: *space, Role: member.Role}, nil
+}
+
+// DeleteSpace 删除空间，需要管理员角色，空间内仍有文件（包括回收站）时拒绝删除
+func (s *SpaceService) DeleteSpace(userID, spaceID uuid.UUID) error {
+	if _, _, err := s.getSpaceAs(userID, spaceID, models.SpaceRoleAdmin); err != nil {
+		return err
+	}
+
+	count, err := s.spaceRepo.CountFiles(spaceID)
+	if err != nil {
+		return fmt.Errorf("failed to count space files: %w", err)
+	}
+	if count > 0 {
+		return newError(ErrSpaceNotEmpty, fmt.Sprintf("space still contains %d files", count))
+	}
+
+	if err := s.spaceRepo.Delete(spaceID); err != nil {
+		return fmt.Errorf("failed to delete space: %w", err)
+	}
+	return nil
+}
+
+// AddMember 按用户名添加空间成员，需要管理员角色
+func (s *SpaceService) AddMember(userID, spaceID uuid.UUID, req models.SpaceMemberRequest) (*models.SpaceMemberResponse, error) {
+	if _, _, err := s.getSpaceAs(userID, spaceID, models.SpaceRoleAdmin); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByUsername(req.Username)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	if _, err := s.spaceRepo.FindMember(spaceID, user.ID); err == nil {
+		return nil, newError(ErrNameConflict, "user is already a member of this space")
+	}
+
+	member := &models.SpaceMember{
+		SpaceID: spaceID,
+		UserID:  user.ID,
+		Role:    req.Role,
+		User:    *user,
+	}
+	if err := s.spaceRepo.AddMember(member); err != nil {
+		return nil, fmt.Errorf("failed to add space member: %w", err)
+	}
+
+	response := member.ToResponse()
+	return &response, nil
+}
+
+// UpdateMemberRole 修改成员角色，需要管理员角色，不能降级最后一个管理员
+func (s *SpaceService) UpdateMemberRole(userID, spaceID, memberID uuid.UUID, req models.SpaceMemberUpdateRequest) error {
+	if _, _, err := s.getSpaceAs(userID, spaceID, models.SpaceRoleAdmin); err != nil {
+		return err
+	}
+
+	member, err := s.spaceRepo.FindMember(spaceID, memberID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	if member.Role == models.SpaceRoleAdmin && req.Role != models.SpaceRoleAdmin {
+		if err := s.checkLastAdmin(spaceID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.spaceRepo.UpdateMemberRole(spaceID, memberID, req.Role); err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+	return nil
+}
+
+// RemoveMember 移除成员，管理员可移除任何成员，普通成员只能退出空间；不能移除最后一个管理员
+// 成员创建的文件保留在空间中，仍计入其存储配额
+func (s *SpaceService) RemoveMember(userID, spaceID, memberID uuid.UUID) error {
+	required := models.SpaceRoleAdmin
+	if memberID == userID {
+		required = models.SpaceRoleViewer
+	}
+	if _, _, err := s.getSpaceAs(userID, spaceID, required); err != nil {
+		return err
+	}
+
+	member, err := s.spaceRepo.FindMember(spaceID, memberID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	if member.Role == models.SpaceRoleAdmin {
+		if err := s.checkLastAdmin(spaceID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.spaceRepo.RemoveMember(spaceID, memberID); err != nil {
+		return fmt.Errorf("failed to remove space member: %w", err)
+	}
+	return nil
+}
+
+// getSpaceAs 获取空间及用户的成员记录，非成员视为空间不存在，角色不足时拒绝
+func (s *SpaceService) getSpaceAs(userID, spaceID uuid.UUID, role models.SpaceRole) (*models.Space, *models.SpaceMember, error) {
+	member, err := s.spaceRepo.FindMember(spaceID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrSpaceNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get space member: %w", err)
+	}
+
+	space, err := s.spaceRepo.FindByID(spaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrSpaceNotFound, err)
+	}
+
+	if !member.Role.Allows(role) {
+		return nil, nil, ErrPermissionDenied
+	}
+	return space, member, nil
+}
+
+// checkLastAdmin 空间只剩一个管理员时拒绝降级或移除
+func (s *SpaceService) checkLastAdmin(spaceID uuid.UUID) error {
+	admins, err := s.spaceRepo.CountMembersByRole(spaceID, models.SpaceRoleAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to count space admins: %w", err)
+	}
+	if admins <= 1 {
+		return ErrLastSpaceAdmin
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/repositories"
+)
+
+// storageCleanupBatchSize 后台每轮处理的待删除内容数
+const storageCleanupBatchSize = 100
+
+// storageCleanupMaxBackoff 删除失败后重试的最大间隔
+const storageCleanupMaxBackoff = 24 * time.Hour
+
+// StorageCleanupService 删除永久删除文件后遗留的存储内容
+// 删除顺序：数据库记录的删除和待删除内容的登记在同一事务中提交，提交后立即尝试删除存储内容，
+// 失败的由后台每隔STORAGE_CLEANUP_INTERVAL重试，间隔按失败次数翻倍。事务回滚时不删除任何存储内容
+type StorageCleanupService struct {
+	cfg      *config.Config
+	repo     repositories.StorageDeletionRepository
+	fileRepo repositories.FileRepository
+	stores   map[string]storage.Storage
+}
+
+// NewStorageCleanupService 创建存储清理服务，STORAGE_CLEANUP_INTERVAL大于0时启动后台重试
+func NewStorageCleanupService(
+	cfg *config.Config,
+	repo repositories.StorageDeletionRepository,
+	fileRepo repositories.FileRepository,
+	fileStorage storage.Storage,
+	versionStorage storage.Storage,
+) *StorageCleanupService {
+	s := &StorageCleanupService{
+		cfg:      cfg,
+		repo:     repo,
+		fileRepo: fileRepo,
+		stores: map[string]storage.Storage{
+			models.StorageStoreFiles:    fileStorage,
+			models.StorageStoreVersions: versionStorage,
+		},
+	}
+
+	if cfg.Storage.CleanupInterval > 0 {
+		go s.run()
+	}
+
+	return s
+}
+
+// ScheduleWithTx 在事务中登记待删除的存储内容，须与数据库记录的删除在同一事务中调用
+func (s *StorageCleanupService) ScheduleWithTx(tx *gorm.DB, deletions []models.StorageDeletion) error {
+	now := time.Now()
+	for i := range deletions {
+		if deletions[i].NextAttemptAt.IsZero() {
+			deletions[i].NextAttemptAt = now
+		}
+	}
+	if err := s.repo.CreateWithTx(tx, deletions); err != nil {
+		return fmt.Errorf("failed to schedule storage deletion: %w", err)
+	}
+	return nil
+}
+
+// Purge 删除已登记的存储内容，须在登记的事务提交后调用；失败的保留登记，由后台重试
+func (s *StorageCleanupService) Purge(ctx context.Context, deletions []models.StorageDeletion) int {
+	purged := 0
+	for i := range deletions {
+		if s.attempt(ctx, &deletions[i]) {
+			purged++
+		}
+	}
+	return purged
+}
+
+// ProcessDue 重试已到时间的待删除内容，返回成功删除的数量
+func (s *StorageCleanupService) ProcessDue(ctx context.Context) (int, error) {
+	deletions, err := s.repo.FindDue(time.Now(), storageCleanupBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending storage deletions: %w", err)
+	}
+	return s.Purge(ctx, deletions), nil
+}
+
+func (s *StorageCleanupService) run() {
+	ticker := time.NewTicker(s.cfg.Storage.CleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// 每轮最多处理一批，积压时下一轮继续
+		if purged, err := s.ProcessDue(context.Background()); err != nil {
+			log.Printf("Storage cleanup failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Storage cleanup removed %d pending items", purged)
+		}
+	}
+}
+
+// attempt 删除一项存储内容并更新登记，返回是否已完成
+func (s *StorageCleanupService) attempt(ctx context.Context, deletion *models.StorageDeletion) bool {
+	if err := s.delete(ctx, deletion); err != nil {
+		deletion.Attempts++
+		deletion.LastError = err.Error()
+		deletion.NextAttemptAt = time.Now().Add(s.backoff(deletion.Attempts))
+		log.Printf("Failed to delete %s from %s storage (attempt %d): %v",
+			deletion.Key, deletion.Store, deletion.Attempts, err)
+		if err := s.repo.MarkFailed(deletion.ID, deletion.Attempts, deletion.NextAttemptAt, deletion.LastError); err != nil {
+			log.Printf("Failed to record storage deletion failure for %s: %v", deletion.Key, err)
+		}
+		return false
+	}
+
+	if err := s.repo.Delete(deletion.ID); err != nil {
+		// 内容已删除，登记保留时下次重试也会成功
+		log.Printf("Failed to remove storage deletion record for %s: %v", deletion.Key, err)
+	}
+	return true
+}
+
+// delete 删除存储内容，内容已不存在视为成功；存储键已被同路径的新文件复用时不删除
+func (s *StorageCleanupService) delete(ctx context.Context, deletion *models.StorageDeletion) error {
+	store, ok := s.stores[deletion.Store]
+	if !ok || store == nil {
+		return fmt.Errorf("unknown storage %q", deletion.Store)
+	}
+
+	if deletion.OwnerID != nil && deletion.Path != "" {
+		inUse, err := s.fileRepo.PathInUse(*deletion.OwnerID, deletion.SpaceID, deletion.Path)
+		if err != nil {
+			return fmt.Errorf("failed to check whether key is reused: %w", err)
+		}
+		if inUse {
+			return nil
+		}
+	}
+
+	var err error
+	if deletion.IsDir {
+		err = store.DeleteDir(ctx, deletion.Key)
+	} else {
+		err = store.Delete(ctx, deletion.Key)
+	}
+	if err != nil && !errors.Is(err, storage.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
+
+// backoff 第attempts次失败后的重试间隔
+func (s *StorageCleanupService) backoff(attempts int) time.Duration {
+	delay := max(s.cfg.Storage.CleanupInterval, time.Minute)
+	for i := 1; i < attempts && delay < storageCleanupMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, storageCleanupMaxBackoff)
+}
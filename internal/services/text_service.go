@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/storage"
+	"cloud-storage/internal/pkg/textextract"
+)
+
+// TextService 文档文本提取服务，为文本预览和内容搜索提供数据
+type TextService struct {
+	cfg      *config.Config
+	db       *gorm.DB
+	storage  storage.Storage
+	registry *textextract.Registry
+}
+
+// NewTextService 创建文本提取服务实例
+func NewTextService(cfg *config.Config, db *gorm.DB, storage storage.Storage) *TextService {
+	registry, unknown := textextract.NewRegistry(cfg.Preview.TextExtractors)
+	for _, name := range unknown {
+		log.Printf("Warning: unknown text extractor %q ignored", name)
+	}
+
+	return &TextService{
+		cfg:      cfg,
+		db:       db,
+		storage:  storage,
+		registry: registry,
+	}
+}
+
+// Enabled 是否启用文本提取
+func (s *TextService) Enabled() bool {
+	return s.cfg.Preview.TextExtractEnabled
+}
+
+// IndexAsync 在后台提取文件文本，不支持的文件类型直接忽略
+func (s *TextService) IndexAsync(file *models.File) {
+	if !s.Enabled() || !file.IsFile() {
+		return
+	}
+
+	snapshot := *file
+	go func() {
+		if _, err := s.index(context.Background(), &snapshot); err != nil && !errors.Is(err, ErrPreviewUnavailable) {
+			log.Printf("Failed to extract text for file %s: %v", snapshot.ID, err)
+		}
+	}()
+}
+
+// Preview 获取文件前length个字符的提取文本，提取结果过期时重新提取
+func (s *TextService) Preview(ctx context.Context, file *models.File, length int) (*models.TextPreviewResponse, error) {
+	if !s.Enabled() {
+		return nil, newError(ErrPreviewUnavailable, "text extraction is disabled")
+	}
+
+	if !file.IsFile() {
+		return nil, newError(ErrInvalidArgument, "only files have text previews")
+	}
+
+	var record models.FileText
+	err := s.db.Where("file_id = ?", file.ID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get extracted text: %w", err)
+	}
+	if err != nil || record.Version != file.Version {
+		extracted, err := s.index(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		record = *extracted
+	}
+
+	if length <= 0 {
+		length = s.cfg.Preview.TextSnippetChars
+	}
+	if length > s.cfg.Preview.TextMaxChars {
+		length = s.cfg.Preview.TextMaxChars
+	}
+
+	text := textextract.Truncate(record.Content, length)
+	return &models.TextPreviewResponse{
+		FileID:    file.ID,
+		Extractor: record.Extractor,
+		Text:      text,
+		Length:    utf8.RuneCountInString(text),
+		Truncated: record.Truncated || len(text) < len(record.Content),
+	}, nil
+}
+
+// Content 读取文本或代码文件的原始内容用于预览，最多返回PREVIEW_CONTENT_MAX_BYTES字节，
+// 附带按文件名推断的语言；二进制文件和超过PREVIEW_TEXT_MAX_FILE_SIZE的文件返回ErrPreviewUnavailable
+func (s *TextService) Content(ctx context.Context, file *models.File) (*models.TextContentResponse, error) {
+	if !file.IsFile() {
+		return nil, newError(ErrInvalidArgument, "only files have content previews")
+	}
+
+	if file.Size > s.cfg.Preview.TextMaxFileSize {
+		return nil, newError(ErrPreviewUnavailable, "file is too large for preview")
+	}
+
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+	defer reader.Close()
+
+	// 多读一个字节判断是否截断
+	limit := max(s.cfg.Preview.ContentMaxBytes, 1)
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	truncated := int64(len(data)) > limit
+	if truncated {
+		data = data[:limit]
+	}
+
+	if !textextract.IsText(data, truncated) {
+		return nil, newError(ErrPreviewUnavailable, "binary files cannot be previewed as text")
+	}
+	if truncated {
+		data = textextract.TrimIncompleteRune(data)
+	}
+
+	return &models.TextContentResponse{
+		FileID:    file.ID,
+		Name:      file.Name,
+		Language:  textextract.Language(file.Name),
+		Encoding:  "utf-8",
+		Content:   string(data),
+		Size:      int64(len(data)),
+		FileSize:  file.Size,
+		Truncated: truncated,
+	}, nil
+}
+
+// index 提取文件文本并保存
+func (s *TextService) index(ctx context.Context, file *models.File) (*models.FileText, error) {
+	extractor := s.registry.Find(file.PreviewMimeType(s.cfg.Preview.StrictMime()), file.Name)
+	if extractor == nil {
+		return nil, newError(ErrPreviewUnavailable, "no text extractor for this file type")
+	}
+
+	if file.Size > s.cfg.Preview.TextMaxFileSize {
+		return nil, newError(ErrPreviewUnavailable, "file is too large for text extraction")
+	}
+
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+	defer reader.Close()
+
+	content, truncated, err := textextract.Extract(extractor,
+		io.LimitReader(reader, s.cfg.Preview.TextMaxFileSize), s.cfg.Preview.TextMaxChars)
+	if err != nil {
+		return nil, newError(ErrPreviewUnavailable, fmt.Sprintf("failed to extract text: %v", err))
+	}
+
+	record := &models.FileText{
+		FileID:    file.ID,
+		Version:   file.Version,
+		Extractor: extractor.Name(),
+		Snippet:   textextract.Truncate(content, s.cfg.Preview.TextSnippetChars),
+		Content:   content,
+		Truncated: truncated,
+	}
+
+	// 并发提取时不以旧版本覆盖新版本的结果
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "file_id"}},
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "file_texts.version <= excluded.version"}}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "extractor", "snippet", "content", "truncated", "updated_at"}),
+	}).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to save extracted text: %w", err)
+	}
+
+	return record, nil
+}
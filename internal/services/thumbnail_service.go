@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/imaging"
+	"cloud-storage/internal/pkg/storage"
+)
+
+// thumbnailQuality 缩略图的JPEG编码质量
+const thumbnailQuality = 80
+
+// maxThumbnailDimension 请求指定尺寸时允许的最大边长（像素）
+const maxThumbnailDimension = 2048
+
+// thumbnailImageTypes 可直接解码生成缩略图的图片类型
+var thumbnailImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// ThumbnailService 缩略图服务：上传后由后台工作协程预先生成默认尺寸，请求时尚未生成则当场生成
+// 缩略图按文件版本和尺寸保存在存储的 thumbnails/ 前缀下，内容更新后删除上一版本的缩略图
+type ThumbnailService struct {
+	cfg     *config.Config
+	storage storage.Storage
+	queue   chan models.File // 为nil时不在后台生成
+}
+
+// NewThumbnailService 创建缩略图服务实例，并启动PREVIEW_THUMBNAIL_WORKERS个后台工作协程
+func NewThumbnailService(cfg *config.Config, storage storage.Storage) *ThumbnailService {
+	s := &ThumbnailService{
+		cfg:     cfg,
+		storage: storage,
+	}
+
+	if cfg.Preview.ThumbnailWorkers > 0 {
+		s.queue = make(chan models.File, max(cfg.Preview.ThumbnailQueueSize, 1))
+		for i := 0; i < cfg.Preview.ThumbnailWorkers; i++ {
+			go s.worker()
+		}
+	}
+
+	return s
+}
+
+// Supports 检查文件类型是否支持生成缩略图，PDF和视频需要配置外部命令；空文件不生成缩略图
+// 类型按PREVIEW_MIME_VALIDATION取嗅探或声明的类型
+func (s *ThumbnailService) Supports(file *models.File) bool {
+	if !file.IsFile() || file.Size == 0 {
+		return false
+	}
+
+	mimeType := strings.ToLower(file.PreviewMimeType(s.cfg.Preview.StrictMime()))
+	switch {
+	case thumbnailImageTypes[mimeType]:
+		return true
+	case mimeType == "application/pdf":
+		return s.cfg.Preview.PDFToPPMPath != ""
+	case strings.HasPrefix(mimeType, "video/"):
+		return s.cfg.Preview.FFmpegPath != ""
+	}
+	return false
+}
+
+// GenerateAsync 将文件放入后台生成队列，不支持的类型直接忽略；队列满时丢弃，不阻塞上传
+func (s *ThumbnailService) GenerateAsync(file *models.File) {
+	if s == nil || s.queue == nil || !s.Supports(file) || file.Size > s.cfg.Preview.ThumbnailMaxFileSize {
+		return
+	}
+
+	select {
+	case s.queue <- *file:
+	default:
+		log.Printf("Thumbnail queue full, skipping file %s", file.ID)
+	}
+}
+
+func (s *ThumbnailService) worker() {
+	for file := range s.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Preview.ThumbnailTimeout)
+		size := s.defaultSize()
+		key := s.thumbnailKey(&file, size, size)
+		if exists, err := s.storage.Exists(ctx, key); err != nil || !exists {
+			if _, err := s.generate(ctx, &file, size, size); err != nil {
+				log.Printf("Failed to generate thumbnail for file %s: %v", file.ID, err)
+			}
+		}
+		cancel()
+	}
+}
+
+// Get 获取文件当前版本按比例缩放到width×height以内的缩略图（JPEG），尚未生成时当场生成并保存
+// width、height为0时与另一边相同，都为0时使用PREVIEW_THUMBNAIL_SIZE
+func (s *ThumbnailService) Get(ctx context.Context, file *models.File, width, height int) ([]byte, error) {
+	if width < 0 || height < 0 || width > maxThumbnailDimension || height > maxThumbnailDimension {
+		return nil, newError(ErrInvalidArgument,
+			fmt.Sprintf("thumbnail width and height must be between 1 and %d", maxThumbnailDimension))
+	}
+	if !s.Supports(file) {
+		return nil, newError(ErrPreviewUnavailable, "thumbnails are not available for this file type")
+	}
+
+	switch {
+	case width == 0 && height == 0:
+		width, height = s.defaultSize(), s.defaultSize()
+	case width == 0:
+		width = height
+	case height == 0:
+		height = width
+	}
+
+	key := s.thumbnailKey(file, width, height)
+	if reader, err := s.storage.Get(ctx, key); err == nil {
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err == nil {
+			return data, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Preview.ThumbnailTimeout)
+	defer cancel()
+	return s.generate(ctx, file, width, height)
+}
+
+// defaultSize 默认缩略图边长
+func (s *ThumbnailService) defaultSize() int {
+	return max(s.cfg.Preview.ThumbnailSize, 1)
+}
+
+// thumbnailKey 返回文件当前版本指定尺寸缩略图的存储键，默认尺寸使用后台预先生成的键
+func (s *ThumbnailService) thumbnailKey(file *models.File, width, height int) string {
+	if width == s.defaultSize() && height == s.defaultSize() {
+		return storage.GenerateThumbnailKey(file.UserID, file.ID, file.Version)
+	}
+	return storage.GenerateSizedThumbnailKey(file.UserID, file.ID, file.Version, width, height)
+}
+
+// Remove 删除文件的全部缩略图，失败时只记录日志
+func (s *ThumbnailService) Remove(ctx context.Context, file *models.File) {
+	if s == nil {
+		return
+	}
+	if err := s.storage.DeleteDir(ctx, storage.GenerateThumbnailDir(file.UserID, file.ID)); err != nil {
+		log.Printf("Failed to delete thumbnails for file %s: %v", file.ID, err)
+	}
+}
+
+// generate 生成并保存文件当前版本指定尺寸的缩略图，同时删除上一版本的缩略图
+func (s *ThumbnailService) generate(ctx context.Context, file *models.File, width, height int) ([]byte, error) {
+	if file.Size > s.cfg.Preview.ThumbnailMaxFileSize {
+		return nil, newError(ErrPreviewUnavailable, "file is too large for thumbnail generation")
+	}
+
+	img, err := s.decode(ctx, file, max(width, height))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, imaging.Fit(img, width, height), thumbnailQuality); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	data := buf.Bytes()
+
+	key := s.thumbnailKey(file, width, height)
+	if err := s.storage.Save(ctx, key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, fmt.Errorf("failed to save thumbnail: %w", err)
+	}
+	if file.Version > 1 {
+		s.storage.Delete(ctx, storage.GenerateThumbnailKey(file.UserID, file.ID, file.Version-1))
+		s.storage.DeleteDir(ctx, storage.GenerateSizedThumbnailDir(file.UserID, file.ID, file.Version-1))
+	}
+
+	return data, nil
+}
+
+// decode 读取文件并解码为图片，PDF取第一页（按size渲染），视频取第一帧
+func (s *ThumbnailService) decode(ctx context.Context, file *models.File, size int) (image.Image, error) {
+	reader, err := s.storage.Get(ctx, contentKey(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from storage: %w", err)
+	}
+	defer reader.Close()
+
+	mimeType := strings.ToLower(file.PreviewMimeType(s.cfg.Preview.StrictMime()))
+	var data []byte
+	switch {
+	case thumbnailImageTypes[mimeType]:
+		data, err = io.ReadAll(io.LimitReader(reader, s.cfg.Preview.ThumbnailMaxFileSize))
+	case mimeType == "application/pdf":
+		// pdftoppm以"-"为输出前缀时将PNG写到标准输出
+		data, err = s.render(ctx, reader, s.cfg.Preview.PDFToPPMPath,
+			"-png", "-f", "1", "-l", "1", "-singlefile",
+			"-scale-to", strconv.Itoa(size), "{input}", "-")
+	default:
+		data, err = s.render(ctx, reader, s.cfg.Preview.FFmpegPath,
+			"-v", "error", "-i", "{input}", "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := imaging.Decode(bytes.NewReader(data), s.cfg.Image.MaxPixels)
+	if err != nil {
+		if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrImageTooLarge) {
+			return nil, newError(ErrPreviewUnavailable, fmt.Sprintf("cannot generate thumbnail: %v", err))
+		}
+		return nil, err
+	}
+	return img, nil
+}
+
+// render 将内容写入临时文件后调用外部命令，参数中的{input}替换为临时文件路径，返回命令的标准输出
+func (s *ThumbnailService) render(ctx context.Context, content io.Reader, command string, args ...string) ([]byte, error) {
+	tmp, err := os.CreateTemp(s.cfg.Storage.TempPath, "thumbnail-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, io.LimitReader(content, s.cfg.Preview.ThumbnailMaxFileSize))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	for i, arg := range args {
+		if arg == "{input}" {
+			args[i] = tmp.Name()
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("Thumbnail command %s failed: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+		return nil, newError(ErrPreviewUnavailable, "failed to render thumbnail")
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"io"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/pkg/antivirus"
+)
+
+// newScanner 按配置创建病毒扫描器，未启用扫描时返回nil
+func newScanner(cfg config.ScanConfig) antivirus.Scanner {
+	if !cfg.Enabled {
+		return nil
+	}
+	return antivirus.NewClamAV(cfg.ClamAVAddress, cfg.Timeout)
+}
+
+// contentScan 在后台扫描写入的内容，与保存到存储同时进行，不需要缓存整个文件
+type contentScan struct {
+	pw     *io.PipeWriter
+	done   chan struct{}
+	result *antivirus.Result
+	err    error
+}
+
+// startScan 开始扫描之后写入返回值的内容，scanner为nil时返回nil
+func startScan(ctx context.Context, scanner antivirus.Scanner) *contentScan {
+	if scanner == nil {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	scan := &contentScan{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(scan.done)
+		scan.result, scan.err = scanner.Scan(ctx, pr)
+		// 扫描器提前返回时读完剩余内容，避免阻塞保存
+		io.Copy(io.Discard, pr)
+	}()
+	return scan
+}
+
+func (c *contentScan) Write(p []byte) (int, error) {
+	return c.pw.Write(p)
+}
+
+// finish 内容写完后等待扫描结果；saveErr不为nil时保存已失败，扫描随之中止
+func (c *contentScan) finish(saveErr error) (*antivirus.Result, error) {
+	c.pw.CloseWithError(saveErr)
+	<-c.done
+	return c.result, c.err
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/database"
+	"cloud-storage/internal/models"
+)
+
+// uploadUsageBuckets 统计窗口划分的桶数，窗口内的上传量为各桶之和，精度为窗口的1/60
+const uploadUsageBuckets = 60
+
+// uploadUsageReportLimit 上传流量统计每类最多返回的条数
+const uploadUsageReportLimit = 100
+
+// UploadUsageService 上传流量统计：在Redis中按用户和IP累计滑动窗口内的上传字节数，
+// 超过阈值时记录安全警报（每个窗口每个用户或IP一次），配置为block时拒绝后续上传
+// Redis不可用时不统计也不拦截
+type UploadUsageService struct {
+	cfg config.UploadAbuseConfig
+	db  *gorm.DB
+}
+
+// NewUploadUsageService 创建上传流量统计服务
+func NewUploadUsageService(cfg *config.Config, db *gorm.DB) *UploadUsageService {
+	return &UploadUsageService{
+		cfg: cfg.UploadAbuse,
+		db:  db,
+	}
+}
+
+// uploadSubject 统计对象：用户或IP
+type uploadSubject struct {
+	kind      string // user或ip
+	id        string
+	threshold int64
+}
+
+func (s *UploadUsageService) subjects(userID uuid.UUID, ip string) []uploadSubject {
+	return []uploadSubject{
+		{kind: "user", id: userID.String(), threshold: s.cfg.UserThreshold},
+		{kind: "ip", id: ip, threshold: s.cfg.IPThreshold},
+	}
+}
+
+// CheckUpload 在上传前检查，action为block且本次上传后将超过阈值时返回ErrUploadLimitExceeded
+func (s *UploadUsageService) CheckUpload(ctx context.Context, userID uuid.UUID, ip string, size int64) error {
+	client := database.GetRedis()
+	if client == nil || s.cfg.Window <= 0 || s.cfg.Action != "block" {
+		return nil
+	}
+
+	for _, subject := range s.subjects(userID, ip) {
+		if subject.threshold <= 0 {
+			continue
+		}
+		used, err := s.usage(ctx, client, subject, time.Now())
+		if err != nil {
+			log.Printf("Failed to read upload usage of %s %s: %v", subject.kind, subject.id, err)
+			return nil
+		}
+		if used+max(size, 0) > subject.threshold {
+			return newError(ErrUploadLimitExceeded, fmt.Sprintf(
+				"upload volume limit exceeded: %d of %d bytes uploaded in the last %s",
+				used, subject.threshold, s.cfg.Window))
+		}
+	}
+	return nil
+}
+
+// RecordUpload 累计一次成功上传的字节数，超过阈值时记录安全警报
+func (s *UploadUsageService) RecordUpload(ctx context.Context, userID uuid.UUID, ip string, size int64) {
+	client := database.GetRedis()
+	if client == nil || size <= 0 || s.cfg.Window <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, subject := range s.subjects(userID, ip) {
+		key := s.bucketKey(subject, s.bucketIndex(now))
+		pipe := client.TxPipeline()
+		pipe.IncrBy(ctx, key, size)
+		pipe.Expire(ctx, key, s.cfg.Window+s.bucketSize())
+		pipe.ZAdd(ctx, s.activeKey(subject.kind), redis.Z{Score: float64(now.Unix()), Member: subject.id})
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Failed to record upload usage of %s %s: %v", subject.kind, subject.id, err)
+			continue
+		}
+
+		if subject.threshold <= 0 {
+			continue
+		}
+		used, err := s.usage(ctx, client, subject, now)
+		if err != nil {
+			log.Printf("Failed to read upload usage of %s %s: %v", subject.kind, subject.id, err)
+			continue
+		}
+		if used > subject.threshold {
+			s.raiseAlert(ctx, client, subject, userID, ip, used)
+		}
+	}
+}
+
+// GetUsageReport 获取统计窗口内有上传的用户和IP的上传量，供管理员查看
+func (s *UploadUsageService) GetUsageReport(ctx context.Context) (*models.UploadUsageReport, error) {
+	report := &models.UploadUsageReport{
+		WindowSeconds: int64(s.cfg.Window / time.Second),
+		Action:        s.cfg.Action,
+		Users:         []models.UploadUsage{},
+		IPs:           []models.UploadUsage{},
+	}
+	client := database.GetRedis()
+	if client == nil || s.cfg.Window <= 0 {
+		return report, nil
+	}
+	report.Enabled = true
+
+	now := time.Now()
+	var err error
+	if report.Users, err = s.activeUsage(ctx, client, "user", s.cfg.UserThreshold, now); err != nil {
+		return nil, fmt.Errorf("failed to get upload usage: %w", err)
+	}
+	if report.IPs, err = s.activeUsage(ctx, client, "ip", s.cfg.IPThreshold, now); err != nil {
+		return nil, fmt.Errorf("failed to get upload usage: %w", err)
+	}
+	return report, nil
+}
+
+// activeUsage 统计窗口内有上传记录的对象的上传量，顺带清理窗口外的活跃记录
+func (s *UploadUsageService) activeUsage(ctx context.Context, client *redis.Client, kind string, threshold int64, now time.Time) ([]models.UploadUsage, error) {
+	activeKey := s.activeKey(kind)
+	cutoff := strconv.FormatInt(now.Add(-s.cfg.Window).Unix(), 10)
+	if err := client.ZRemRangeByScore(ctx, activeKey, "-inf", "("+cutoff).Err(); err != nil {
+		return nil, err
+	}
+	ids, err := client.ZRange(ctx, activeKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]models.UploadUsage, 0, len(ids))
+	for _, id := range ids {
+		used, err := s.usage(ctx, client, uploadSubject{kind: kind, id: id, threshold: threshold}, now)
+		if err != nil {
+			return nil, err
+		}
+		if used == 0 {
+			continue
+		}
+		usages = append(usages, models.UploadUsage{
+			Subject:   id,
+			Bytes:     used,
+			Threshold: threshold,
+			Exceeded:  threshold > 0 && used > threshold,
+		})
+	}
+
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Bytes > usages[j].Bytes })
+	if len(usages) > uploadUsageReportLimit {
+		usages = usages[:uploadUsageReportLimit]
+	}
+	return usages, nil
+}
+
+// usage 读取对象在窗口内各桶的上传量之和
+func (s *UploadUsageService) usage(ctx context.Context, client *redis.Client, subject uploadSubject, now time.Time) (int64, error) {
+	current := s.bucketIndex(now)
+	keys := make([]string, uploadUsageBuckets)
+	for i := range keys {
+		keys[i] = s.bucketKey(subject, current-int64(i))
+	}
+
+	values, err := client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			n, _ := strconv.ParseInt(str, 10, 64)
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// raiseAlert 记录上传量超过阈值的安全警报，同一对象在一个窗口内只记录一次
+func (s *UploadUsageService) raiseAlert(ctx context.Context, client *redis.Client, subject uploadSubject, userID uuid.UUID, ip string, used int64) {
+	alertedKey := fmt.Sprintf("upload:usage:alerted:%s:%s", subject.kind, subject.id)
+	first, err := client.SetNX(ctx, alertedKey, "1", s.cfg.Window).Result()
+	if err != nil || !first {
+		return
+	}
+
+	severity := models.SecuritySeverityMedium
+	if s.cfg.Action == "block" {
+		severity = models.SecuritySeverityHigh
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"subject_type":   subject.kind,
+		"subject":        subject.id,
+		"bytes":          used,
+		"threshold":      subject.threshold,
+		"window_seconds": int64(s.cfg.Window / time.Second),
+		"action":         s.cfg.Action,
+	})
+	alert := &models.SecurityAlert{
+		AlertType: models.SecurityAlertUploadVolume,
+		Severity:  severity,
+		Description: fmt.Sprintf("%s %s uploaded %d bytes in the last %s (threshold %d)",
+			subject.kind, subject.id, used, s.cfg.Window, subject.threshold),
+		IPAddress: ip,
+		UserID:    &userID,
+		Details:   string(details),
+	}
+	if err := s.db.Create(alert).Error; err != nil {
+		log.Printf("Failed to create upload volume alert for %s %s: %v", subject.kind, subject.id, err)
+		client.Del(ctx, alertedKey)
+	}
+}
+
+// bucketSize 每个桶覆盖的时长，不小于1秒
+func (s *UploadUsageService) bucketSize() time.Duration {
+	return max(s.cfg.Window/uploadUsageBuckets, time.Second)
+}
+
+func (s *UploadUsageService) bucketIndex(t time.Time) int64 {
+	return t.UnixNano() / int64(s.bucketSize())
+}
+
+func (s *UploadUsageService) bucketKey(subject uploadSubject, index int64) string {
+	return fmt.Sprintf("upload:usage:%s:%s:%d", subject.kind, subject.id, index)
+}
+
+func (s *UploadUsageService) activeKey(kind string) string {
+	return "upload:usage:active:" + kind
+}
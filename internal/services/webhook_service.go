@@ -0,0 +1,415 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/config"
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/pkg/events"
+	"cloud-storage/internal/repositories"
+)
+
+// webhookPingEvent 测试投递使用的事件类型，不可订阅
+const webhookPingEvent = "ping"
+
+// errPrivateAddress 目标地址为私有网络
+var errPrivateAddress = errors.New("webhook target resolves to a private or loopback address")
+
+// eventOperations 事件对应的操作类型，与操作日志使用相同的取值，随事件一起投递
+var eventOperations = map[string]models.OperationType{
+	events.FileUploaded:    models.OperationFileUpload,
+	events.FileDeleted:     models.OperationFileDelete,
+	events.ShareCreated:    models.OperationShareCreate,
+	events.ShareAccessed:   models.OperationShareAccess,
+	events.ShareDownloaded: models.OperationFileDownload,
+	events.UserRegistered:  models.OperationUserRegister,
+}
+
+// webhookPayload Webhook请求体，operation为事件对应的操作类型，没有对应操作时省略
+type webhookPayload struct {
+	events.Event
+	Operation models.OperationType `json:"operation,omitempty"`
+}
+
+// WebhookService 出站Webhook服务：管理用户的Webhook，并将事件总线上的事件签名后投递
+// 配置的系统级Webhook（WEBHOOK_URLS）接收所有用户的全部事件，不记录投递日志
+type WebhookService struct {
+	cfg         *config.Config
+	webhookRepo repositories.WebhookRepository
+	client      *http.Client
+	queue       chan events.Event
+	system      []models.Webhook
+}
+
+// NewWebhookService 创建Webhook服务实例
+func NewWebhookService(cfg *config.Config, webhookRepo repositories.WebhookRepository) *WebhookService {
+	dialer := &net.Dialer{Timeout: cfg.Webhook.Timeout}
+	if !cfg.Webhook.AllowPrivateNetworks {
+		// 在连接建立前检查解析后的地址，避免通过DNS指向内网
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &WebhookService{
+		cfg:         cfg,
+		webhookRepo: webhookRepo,
+		client: &http.Client{
+			Timeout:   cfg.Webhook.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// 不跟随重定向，3xx视为投递失败
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		queue:  make(chan events.Event, max(cfg.Webhook.QueueSize, 1)),
+		system: systemWebhooks(cfg.Webhook),
+	}
+}
+
+// systemWebhooks 由配置生成系统级Webhook，忽略无效地址
+func systemWebhooks(cfg config.WebhookConfig) []models.Webhook {
+	var webhooks []models.Webhook
+	for _, rawURL := range cfg.URLs {
+		if err := validateWebhookURL(rawURL); err != nil {
+			log.Printf("Ignoring invalid webhook url %q: %v", rawURL, err)
+			continue
+		}
+		webhooks = append(webhooks, models.Webhook{
+			URL:      rawURL,
+			Secret:   cfg.Secret,
+			Events:   models.WebhookEvents(events.Types),
+			IsActive: true,
+		})
+	}
+	return webhooks
+}
+
+// Start 订阅事件总线并启动投递协程
+func (s *WebhookService) Start(bus *events.Bus) {
+	bus.Subscribe(s.enqueue)
+	for i := 0; i < max(s.cfg.Webhook.Workers, 1); i++ {
+		go s.worker()
+	}
+}
+
+// enqueue 将事件放入投递队列，队列满时丢弃，不阻塞发布者
+func (s *WebhookService) enqueue(event events.Event) {
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Webhook queue full, dropping event %s (%s)", event.ID, event.Type)
+	}
+}
+
+func (s *WebhookService) worker() {
+	for event := range s.queue {
+		webhooks, err := s.webhookRepo.FindActiveForEvent(event.UserID, event.Type)
+		if err != nil {
+			log.Printf("Failed to find webhooks for event %s: %v", event.ID, err)
+			continue
+		}
+
+		for i := range s.system {
+			s.deliver(&s.system[i], event)
+		}
+		for i := range webhooks {
+			s.deliver(&webhooks[i], event)
+		}
+	}
+}
+
+// deliver 投递事件，失败时按指数退避重试，每次尝试都记录投递日志
+func (s *WebhookService) deliver(webhook *models.Webhook, event events.Event) {
+	body, err := encodeWebhookEvent(event)
+	if err != nil {
+		log.Printf("Failed to encode webhook event %s: %v", event.ID, err)
+		return
+	}
+
+	backoff := s.cfg.Webhook.RetryBackoff
+	for attempt := 1; attempt <= max(s.cfg.Webhook.MaxAttempts, 1); attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if s.send(webhook, event, body, attempt).Success {
+			return
+		}
+	}
+}
+
+// send 发送一次请求并记录投递结果
+func (s *WebhookService) send(webhook *models.Webhook, event events.Event, body []byte, attempt int) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Attempt:   attempt,
+	}
+
+	start := time.Now()
+	statusCode, err := s.post(webhook, event, body)
+	delivery.Duration = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Success = true
+	}
+
+	// 系统级Webhook没有数据库记录，只在失败时写日志
+	if webhook.ID == uuid.Nil {
+		if !delivery.Success {
+			log.Printf("Webhook delivery of event %s to %s failed (attempt %d): %s",
+				event.ID, webhook.URL, attempt, delivery.Error)
+		}
+		return delivery
+	}
+
+	if err := s.webhookRepo.CreateDelivery(delivery); err != nil {
+		log.Printf("Failed to record webhook delivery for %s: %v", webhook.ID, err)
+	}
+	return delivery
+}
+
+// encodeWebhookEvent 编码Webhook请求体
+func encodeWebhookEvent(event events.Event) ([]byte, error) {
+	return json.Marshal(webhookPayload{Event: event, Operation: eventOperations[event.Type]})
+}
+
+// post 发送签名的请求，签名为 HMAC-SHA256(secret, timestamp + "." + body)
+func (s *WebhookService) post(webhook *models.Webhook, event events.Event, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cloud-storage-webhook/1.0")
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Delivery", event.ID.String())
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload 计算Webhook请求签名（十六进制），接收方可用同样方式校验
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateWebhook 创建Webhook，未提供密钥时自动生成；密钥只在创建时返回
+func (s *WebhookService) CreateWebhook(userID uuid.UUID, req models.WebhookCreateRequest) (*models.WebhookCreateResponse, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Webhook.MaxPerUser > 0 {
+		count, err := s.webhookRepo.CountByUser(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count webhooks: %w", err)
+		}
+		if count >= int64(s.cfg.Webhook.MaxPerUser) {
+			return nil, newError(ErrInvalidArgument, fmt.Sprintf("webhook limit of %d reached", s.cfg.Webhook.MaxPerUser))
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	webhook := &models.Webhook{
+		UserID:      userID,
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      models.WebhookEvents(req.Events),
+		Description: req.Description,
+		IsActive:    true,
+	}
+	if err := s.webhookRepo.Create(webhook); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &models.WebhookCreateResponse{Webhook: *webhook, Secret: secret}, nil
+}
+
+// ListWebhooks 获取用户的全部Webhook
+func (s *WebhookService) ListWebhooks(userID uuid.UUID) ([]models.Webhook, error) {
+	webhooks, err := s.webhookRepo.FindByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// GetWebhook 获取用户的Webhook，不属于该用户时视为不存在
+func (s *WebhookService) GetWebhook(userID, webhookID uuid.UUID) (*models.Webhook, error) {
+	webhook, err := s.webhookRepo.FindByID(webhookID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebhookNotFound, err)
+	}
+	if webhook.UserID != userID {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// UpdateWebhook 更新Webhook
+func (s *WebhookService) UpdateWebhook(userID, webhookID uuid.UUID, req models.WebhookUpdateRequest) (*models.Webhook, error) {
+	if _, err := s.GetWebhook(userID, webhookID); err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			return nil, err
+		}
+		updates["url"] = *req.URL
+	}
+	if req.Events != nil {
+		if err := validateWebhookEvents(*req.Events); err != nil {
+			return nil, err
+		}
+		updates["events"] = models.WebhookEvents(*req.Events)
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+
+	if len(updates) > 0 {
+		if err := s.webhookRepo.Update(webhookID, updates); err != nil {
+			return nil, fmt.Errorf("failed to update webhook: %w", err)
+		}
+	}
+
+	return s.webhookRepo.FindByID(webhookID)
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (s *WebhookService) DeleteWebhook(userID, webhookID uuid.UUID) error {
+	if _, err := s.GetWebhook(userID, webhookID); err != nil {
+		return err
+	}
+
+	if err := s.webhookRepo.Delete(webhookID); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries 分页获取Webhook的投递记录
+func (s *WebhookService) ListDeliveries(userID, webhookID uuid.UUID, page, pageSize int) ([]models.WebhookDelivery, int64, error) {
+	if _, err := s.GetWebhook(userID, webhookID); err != nil {
+		return nil, 0, err
+	}
+
+	deliveries, total, err := s.webhookRepo.FindDeliveries(webhookID, page, pageSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+// PingWebhook 同步发送一次测试事件（不重试），返回投递结果
+func (s *WebhookService) PingWebhook(userID, webhookID uuid.UUID) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhook(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := events.New(webhookPingEvent, userID, map[string]interface{}{"webhook_id": webhook.ID})
+	body, err := encodeWebhookEvent(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	return s.send(webhook, event, body, 1), nil
+}
+
+// validateWebhookURL 只允许带主机名的http/https地址
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return newError(ErrInvalidArgument, "webhook url must be an absolute http or https url")
+	}
+	return nil
+}
+
+// validateWebhookEvents 检查订阅的事件类型是否受支持
+func validateWebhookEvents(eventTypes []string) error {
+	for _, eventType := range eventTypes {
+		if !events.IsValidType(eventType) {
+			return newError(ErrInvalidArgument, fmt.Sprintf("unsupported event type %q", eventType))
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret 生成随机签名密钥
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// isPrivateIP 检查是否为回环、私有、链路本地或未指定地址
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast()
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"cloud-storage/internal/models"
+	"cloud-storage/internal/repositories"
+)
+
+// WOPIService WOPI宿主服务：为在线编辑器提供文件信息、读取和保存，保存时生成新版本
+type WOPIService struct {
+	fileService *FileService
+	userRepo    repositories.UserRepository
+}
+
+// NewWOPIService 创建WOPI服务实例
+func NewWOPIService(fileService *FileService, userRepo repositories.UserRepository) *WOPIService {
+	return &WOPIService{
+		fileService: fileService,
+		userRepo:    userRepo,
+	}
+}
+
+// GetEditableFile 获取用户可在编辑器中打开的文件，需要读权限且不能是目录
+func (s *WOPIService) GetEditableFile(userID, fileID uuid.UUID) (*models.File, error) {
+	file, err := s.fileService.GetFileByID(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if !file.IsFile() {
+		return nil, newError(ErrInvalidArgument, "only files can be opened in an editor")
+	}
+	return file, nil
+}
+
+// CheckFileInfo 返回WOPI CheckFileInfo所需的文件和用户信息
+func (s *WOPIService) CheckFileInfo(userID, fileID uuid.UUID) (*models.WOPIFileInfo, error) {
+	file, err := s.GetEditableFile(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	canWrite := s.fileService.canWrite(userID, file)
+	return &models.WOPIFileInfo{
+		BaseFileName:     file.Name,
+		OwnerId:          file.UserID.String(),
+		Size:             file.Size,
+		UserId:           userID.String(),
+		UserFriendlyName: user.Username,
+		Version:          strconv.Itoa(file.Version),
+		LastModifiedTime: file.UpdatedAt.UTC().Format(time.RFC3339),
+		UserCanWrite:     canWrite,
+		ReadOnly:         !canWrite,
+		SupportsUpdate:   true,
+		SupportsLocks:    false,
+	}, nil
+}
+
+// GetFile 读取文件内容
+func (s *WOPIService) GetFile(ctx *gin.Context, userID, fileID uuid.UUID) (io.ReadCloser, *models.File, error) {
+	if _, err := s.GetEditableFile(userID, fileID); err != nil {
+		return nil, nil, err
+	}
+	return s.fileService.DownloadFile(ctx, userID, fileID)
+}
+
+// PutFile 保存编辑器提交的内容，当前内容归档为历史版本，新内容计入文件所有者的配额
+func (s *WOPIService) PutFile(
+	ctx *gin.Context,
+	userID uuid.UUID,
+	fileID uuid.UUID,
+	content io.Reader,
+	size int64,
+) (*models.File, error) {
+	file, err := s.GetEditableFile(userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.fileService.canWrite(userID, file) {
+		return nil, ErrPermissionDenied
+	}
+	if err := s.fileService.checkUploadSize(size); err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"via": "wopi",
+	}
+	return s.fileService.updateExistingFile(ctx, userID, file, file.LockVersion, content, size, file.MimeType, nil, "", details)
+}
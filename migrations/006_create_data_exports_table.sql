@@ -0,0 +1,34 @@
+-- 006_create_data_exports_table.sql
+-- 创建数据导出任务表
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    storage_key TEXT,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    download_token VARCHAR(64) UNIQUE,
+    error_message TEXT,
+    expires_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_data_exports_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports(user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports(status);
+
+-- 每个用户同时只允许一个进行中的导出任务
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_user_active ON data_exports(user_id)
+    WHERE status IN ('pending', 'processing');
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_data_exports_updated_at BEFORE UPDATE ON data_exports
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE data_exports IS '用户数据导出任务表（数据可携带权）';
+COMMENT ON COLUMN data_exports.status IS '任务状态：pending, processing, completed, failed';
+COMMENT ON COLUMN data_exports.download_token IS '限时下载令牌，通过邮件发送给用户';
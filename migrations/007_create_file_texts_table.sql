@@ -0,0 +1,28 @@
+-- 007_create_file_texts_table.sql
+-- 创建文件提取文本表（文本预览和内容搜索）
+
+CREATE TABLE IF NOT EXISTS file_texts (
+    file_id UUID PRIMARY KEY,
+    version INTEGER NOT NULL,
+    extractor VARCHAR(20) NOT NULL,
+    snippet TEXT,
+    content TEXT,
+    truncated BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_file_texts_file FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+);
+
+-- 创建全文索引（simple配置按空白和标点分词，不做词干处理）
+CREATE INDEX IF NOT EXISTS idx_file_texts_content ON file_texts
+    USING GIN (to_tsvector('simple', content));
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_file_texts_updated_at BEFORE UPDATE ON file_texts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE file_texts IS '文件提取文本表';
+COMMENT ON COLUMN file_texts.version IS '提取时的文件版本，版本变化后重新提取';
+COMMENT ON COLUMN file_texts.extractor IS '使用的提取器：text, docx, pdf';
+COMMENT ON COLUMN file_texts.truncated IS '原文是否超过保存的最大字符数';
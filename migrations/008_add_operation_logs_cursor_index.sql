@@ -0,0 +1,5 @@
+-- 008_add_operation_logs_cursor_index.sql
+-- 为操作日志游标分页（按 created_at、id 倒序的键集分页）添加索引
+
+CREATE INDEX IF NOT EXISTS idx_operation_logs_created_at_id ON operation_logs(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_operation_logs_user_id_created_at_id ON operation_logs(user_id, created_at DESC, id DESC);
@@ -0,0 +1,6 @@
+-- 009_add_users_avatar_key.sql
+-- 为用户表添加头像存储键
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_key VARCHAR(255);
+
+COMMENT ON COLUMN users.avatar_key IS '头像存储键（avatars/<user_id>/<name>.jpg），为空表示未设置头像';
@@ -0,0 +1,43 @@
+-- 010_create_announcements_tables.sql
+-- 创建系统公告表和用户关闭记录表
+
+CREATE TABLE IF NOT EXISTS announcements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title VARCHAR(200) NOT NULL,
+    content TEXT NOT NULL,
+    level VARCHAR(20) NOT NULL DEFAULT 'info',
+    target_role VARCHAR(20),
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_announcements_level CHECK (level IN ('info', 'warning', 'critical')),
+    CONSTRAINT chk_announcements_schedule CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_target_role ON announcements(target_role);
+CREATE INDEX IF NOT EXISTS idx_announcements_starts_at ON announcements(starts_at);
+CREATE INDEX IF NOT EXISTS idx_announcements_ends_at ON announcements(ends_at);
+
+CREATE TABLE IF NOT EXISTS announcement_dismissals (
+    announcement_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (announcement_id, user_id),
+    CONSTRAINT fk_announcement_dismissals_announcement FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE,
+    CONSTRAINT fk_announcement_dismissals_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcement_dismissals_user_id ON announcement_dismissals(user_id);
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_announcements_updated_at BEFORE UPDATE ON announcements
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE announcements IS '系统公告表';
+COMMENT ON COLUMN announcements.target_role IS '目标角色，为空时面向所有用户';
+COMMENT ON COLUMN announcements.starts_at IS '开始展示时间';
+COMMENT ON COLUMN announcements.ends_at IS '结束展示时间，为空时一直有效';
+COMMENT ON TABLE announcement_dismissals IS '用户已关闭的公告';
@@ -0,0 +1,14 @@
+-- 011_add_operation_logs_hash_chain.sql
+-- 为操作日志添加哈希链字段（AUDIT_HASH_CHAIN=true 时写入）
+
+ALTER TABLE operation_logs ADD COLUMN IF NOT EXISTS seq BIGINT;
+ALTER TABLE operation_logs ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64);
+ALTER TABLE operation_logs ADD COLUMN IF NOT EXISTS hash VARCHAR(64);
+ALTER TABLE operation_logs ADD COLUMN IF NOT EXISTS subject_digest VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_operation_logs_seq ON operation_logs(seq);
+
+COMMENT ON COLUMN operation_logs.seq IS '哈希链序号，连续递增，缺号表示日志被删除';
+COMMENT ON COLUMN operation_logs.prev_hash IS '链上前一条日志的哈希';
+COMMENT ON COLUMN operation_logs.hash IS '本条日志的SHA-256哈希（包含prev_hash）';
+COMMENT ON COLUMN operation_logs.subject_digest IS '用户ID、IP、User-Agent和详情的摘要，账户删除匿名化后仍可校验哈希链';
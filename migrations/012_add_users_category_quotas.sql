@@ -0,0 +1,6 @@
+-- 012_add_users_category_quotas.sql
+-- 为用户表添加按MIME分类的子配额
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS category_quotas JSONB;
+
+COMMENT ON COLUMN users.category_quotas IS '按MIME分类的子配额（字节），如 {"video": 1073741824}，为空表示只受总配额限制';
@@ -0,0 +1,43 @@
+-- 014_create_spaces_tables.sql
+-- 创建团队空间表和成员表，文件表添加所属空间
+
+CREATE TABLE IF NOT EXISTS spaces (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(500),
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_spaces_created_by ON spaces(created_by);
+
+CREATE TABLE IF NOT EXISTS space_members (
+    space_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (space_id, user_id),
+    CONSTRAINT fk_space_members_space FOREIGN KEY (space_id) REFERENCES spaces(id) ON DELETE CASCADE,
+    CONSTRAINT fk_space_members_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_space_members_role CHECK (role IN ('viewer', 'editor', 'admin'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_space_members_user_id ON space_members(user_id);
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS space_id UUID REFERENCES spaces(id);
+CREATE INDEX IF NOT EXISTS idx_files_space_id ON files(space_id);
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_spaces_updated_at BEFORE UPDATE ON spaces
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_space_members_updated_at BEFORE UPDATE ON space_members
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE spaces IS '团队共享空间';
+COMMENT ON TABLE space_members IS '空间成员';
+COMMENT ON COLUMN space_members.role IS '成员角色：viewer（浏览下载）、editor（编辑文件）、admin（管理空间和成员）';
+COMMENT ON COLUMN files.space_id IS '所属团队空间，为空时为个人文件；文件仍计入创建者的存储配额';
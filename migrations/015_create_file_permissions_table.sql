@@ -0,0 +1,26 @@
+-- 015_create_file_permissions_table.sql
+-- 创建文件访问控制表，向指定用户授予文件的读写权限
+
+CREATE TABLE IF NOT EXISTS file_permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    file_id UUID NOT NULL,
+    grantee_user_id UUID NOT NULL,
+    permission VARCHAR(10) NOT NULL,
+    granted_by UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_file_permissions_file FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+    CONSTRAINT fk_file_permissions_grantee FOREIGN KEY (grantee_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_file_permissions_permission CHECK (permission IN ('read', 'write'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_file_permissions_file_grantee ON file_permissions(file_id, grantee_user_id);
+CREATE INDEX IF NOT EXISTS idx_file_permissions_grantee_user_id ON file_permissions(grantee_user_id);
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_file_permissions_updated_at BEFORE UPDATE ON file_permissions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE file_permissions IS '文件访问控制列表';
+COMMENT ON COLUMN file_permissions.permission IS '授予的权限：read（查看、下载）、write（另可重命名）';
@@ -0,0 +1,8 @@
+-- 016_add_lock_version.sql
+-- 为文件表和用户表添加乐观锁版本，条件更新时检测并发修改
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS lock_version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lock_version BIGINT NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN files.lock_version IS '乐观锁版本，每次更新递增；与内容版本version无关';
+COMMENT ON COLUMN users.lock_version IS '乐观锁版本，每次更新递增';
@@ -0,0 +1,34 @@
+-- 017_create_jobs_table.sql
+-- 创建后台任务表，并关联数据导出任务
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+    result JSONB,
+    error TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_jobs_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_jobs_user_id ON jobs(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_jobs_updated_at BEFORE UPDATE ON jobs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 数据导出关联生成导出包的后台任务
+ALTER TABLE data_exports ADD COLUMN IF NOT EXISTS job_id UUID;
+
+-- 添加注释
+COMMENT ON TABLE jobs IS '后台任务表（目录复制、数据导出、重复文件清理等耗时操作）';
+COMMENT ON COLUMN jobs.status IS '任务状态：pending, running, completed, failed, canceled';
+COMMENT ON COLUMN jobs.progress IS '完成百分比（0~100）';
+COMMENT ON COLUMN jobs.result IS '任务结果（JSON）';
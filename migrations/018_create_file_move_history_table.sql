@@ -0,0 +1,25 @@
+-- 018_create_file_move_history_table.sql
+-- 创建文件移动记录表，用于撤销误操作的移动
+
+CREATE TABLE IF NOT EXISTS file_move_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    file_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    from_parent_id UUID,
+    to_parent_id UUID,
+    undone_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_file_move_history_file FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+    CONSTRAINT fk_file_move_history_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_file_move_history_file_id ON file_move_history(file_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_file_move_history_user_id ON file_move_history(user_id, created_at DESC);
+
+-- 添加注释
+COMMENT ON TABLE file_move_history IS '文件移动记录';
+COMMENT ON COLUMN file_move_history.user_id IS '执行移动的用户';
+COMMENT ON COLUMN file_move_history.from_parent_id IS '移动前的父目录，NULL表示根目录';
+COMMENT ON COLUMN file_move_history.to_parent_id IS '移动后的父目录，NULL表示根目录';
+COMMENT ON COLUMN file_move_history.undone_at IS '撤销时间，NULL表示未撤销';
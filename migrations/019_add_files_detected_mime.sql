@@ -0,0 +1,8 @@
+-- 019_add_files_detected_mime.sql
+-- 为文件添加按内容嗅探的MIME类型，预览和内联展示不再信任客户端声明的类型
+-- 已有文件的值为空，可通过 POST /api/v1/admin/files/detect-mime 补充
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS detected_mime VARCHAR(100);
+
+COMMENT ON COLUMN files.mime_type IS '客户端声明的MIME类型，仅用于展示';
+COMMENT ON COLUMN files.detected_mime IS '按内容嗅探出的MIME类型，用于预览和内联展示';
@@ -0,0 +1,6 @@
+-- 020_add_shares_require_password_per_download.sql
+-- 为分享添加每次下载验证密码的选项，开启后下载和更新内容必须通过X-Share-Password请求头提供密码
+
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS require_password_per_download BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN shares.require_password_per_download IS '每次下载和更新内容都必须通过请求头提供密码';
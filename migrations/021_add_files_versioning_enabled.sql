@@ -0,0 +1,6 @@
+-- 021_add_files_versioning_enabled.sql
+-- 为文件添加版本控制开关，关闭后覆盖内容时原地写入，不创建版本记录也不保留旧内容
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS versioning_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+
+COMMENT ON COLUMN files.versioning_enabled IS '覆盖内容时是否保留旧版本';
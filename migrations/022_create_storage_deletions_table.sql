@@ -0,0 +1,24 @@
+-- 022_create_storage_deletions_table.sql
+-- 创建待删除存储内容表：永久删除时与记录删除在同一事务中登记，提交后删除存储内容，失败时后台重试
+
+CREATE TABLE IF NOT EXISTS storage_deletions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    store VARCHAR(20) NOT NULL,
+    key TEXT NOT NULL,
+    is_dir BOOLEAN DEFAULT FALSE,
+    owner_id UUID,
+    path TEXT,
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_storage_deletions_next_attempt_at ON storage_deletions(next_attempt_at);
+
+-- 添加注释
+COMMENT ON TABLE storage_deletions IS '待删除的存储内容';
+COMMENT ON COLUMN storage_deletions.store IS '所在存储：files（当前文件与缩略图）或 versions（历史版本）';
+COMMENT ON COLUMN storage_deletions.owner_id IS '存储键由所有者和路径生成时记录，删除前检查是否已被同路径的新文件复用';
+COMMENT ON COLUMN storage_deletions.next_attempt_at IS '下次尝试删除的时间，失败后按指数退避推迟';
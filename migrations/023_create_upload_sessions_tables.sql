@@ -0,0 +1,55 @@
+-- 023_create_upload_sessions_tables.sql
+-- 创建分片上传会话表和已上传分片表
+
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    file_size BIGINT NOT NULL,
+    file_hash VARCHAR(255),
+    parent_id UUID,
+    space_id UUID,
+    chunk_size BIGINT NOT NULL,
+    total_chunks INTEGER NOT NULL,
+    uploaded_chunks INTEGER DEFAULT 0,
+    storage_path VARCHAR(512),
+    storage_upload_id VARCHAR(1024),
+    mime_type VARCHAR(100),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error_message TEXT,
+    is_public BOOLEAN DEFAULT FALSE,
+    override BOOLEAN DEFAULT FALSE,
+    file_id UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    CONSTRAINT fk_upload_sessions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id UUID NOT NULL,
+    chunk_index INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    hash VARCHAR(255),
+    etag VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (upload_id, chunk_index),
+    CONSTRAINT fk_upload_chunks_session FOREIGN KEY (upload_id) REFERENCES upload_sessions(id) ON DELETE CASCADE
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_parent_id ON upload_sessions(parent_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+
+-- 创建更新时间触发器
+CREATE TRIGGER update_upload_sessions_updated_at BEFORE UPDATE ON upload_sessions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE upload_sessions IS '分片上传会话';
+COMMENT ON COLUMN upload_sessions.status IS '会话状态：pending, uploading, merging, completed, failed, canceled';
+COMMENT ON COLUMN upload_sessions.storage_path IS '合并分片的临时存储键';
+COMMENT ON COLUMN upload_sessions.storage_upload_id IS '存储的分片上传ID，分片合并后清空';
+COMMENT ON COLUMN upload_sessions.file_id IS '完成后创建或覆盖的文件';
+COMMENT ON TABLE upload_chunks IS '已上传的分片，同一分片重新上传时覆盖';
@@ -0,0 +1,23 @@
+-- 024_add_storage_blobs.sql
+-- 去重上传：同一用户内容相同的文件共享一份存储内容，按引用计数在最后一个引用释放后删除
+
+CREATE TABLE IF NOT EXISTS storage_blobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    key VARCHAR(512) NOT NULL UNIQUE,
+    ref_count INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS blob_key VARCHAR(512);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_storage_blobs_user_hash ON storage_blobs(user_id, hash);
+CREATE INDEX IF NOT EXISTS idx_files_blob_key ON files(blob_key);
+
+-- 添加注释
+COMMENT ON TABLE storage_blobs IS '去重保存的共享文件内容';
+COMMENT ON COLUMN storage_blobs.ref_count IS '引用该内容的文件数，降为0时删除记录并删除存储内容';
+COMMENT ON COLUMN files.blob_key IS '去重保存时共享内容的存储键，为空时内容位于按路径生成的存储键';
@@ -0,0 +1,13 @@
+-- 025_add_users_email_verification.sql
+-- 为用户添加邮箱验证状态和验证令牌
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_token VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verification_token ON users(verification_token);
+
+-- 引入邮箱验证前注册的用户视为已验证，开启 REQUIRE_EMAIL_VERIFICATION 后不影响其登录
+UPDATE users SET email_verified = TRUE;
+
+COMMENT ON COLUMN users.email_verified IS '邮箱是否已验证';
+COMMENT ON COLUMN users.verification_token IS '邮箱验证令牌，验证后清空';
@@ -0,0 +1,26 @@
+-- 026_create_share_accesses_table.sql
+-- 创建分享访问记录表，记录每次通过分享链接查看和下载的时间、IP和User-Agent
+
+CREATE TABLE IF NOT EXISTS share_accesses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    share_id UUID NOT NULL,
+    file_id UUID,
+    action VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_share_accesses_share FOREIGN KEY (share_id) REFERENCES shares(id) ON DELETE CASCADE,
+    CONSTRAINT chk_share_accesses_action CHECK (action IN ('view', 'download'))
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_share_accesses_share_id ON share_accesses(share_id, created_at DESC);
+
+-- 分享的访问总次数
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS access_count BIGINT NOT NULL DEFAULT 0;
+
+-- 添加注释
+COMMENT ON TABLE share_accesses IS '分享访问记录';
+COMMENT ON COLUMN share_accesses.file_id IS '下载的文件，目录分享中可能是后代文件；查看时为NULL';
+COMMENT ON COLUMN share_accesses.action IS '动作：view查看分享，download下载文件';
+COMMENT ON COLUMN shares.access_count IS '通过分享链接查看和下载的总次数';
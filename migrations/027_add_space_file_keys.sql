@@ -0,0 +1,8 @@
+-- 027_add_space_file_keys.sql
+-- 空间文件的存储键改为 spaces/<space_id>/<path>，不再与上传者的个人文件共用 <user_id>/<path>
+
+ALTER TABLE storage_deletions ADD COLUMN IF NOT EXISTS space_id UUID;
+
+COMMENT ON COLUMN storage_deletions.space_id IS '空间文件所在空间，删除前按空间和路径检查存储键是否已被复用';
+
+-- 存储中已有的空间文件内容及指向它的版本记录需运行 go run cmd/migrate/main.go -space-keys 迁移